@@ -0,0 +1,172 @@
+package mapper
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// accessCheck is a namespaced resource type the views list, named as in the
+// errors of the processor cache
+type accessCheck struct {
+	what, group, resource string
+}
+
+// accessChecks are the types checked before they are listed
+var accessChecks = []accessCheck{
+	{"pods", "", "pods"},
+	{"services", "", "services"},
+	{"configmaps", "", "configmaps"},
+	{"secrets", "", "secrets"},
+	{"endpoints", "", "endpoints"},
+	{"deployments", "apps", "deployments"},
+	{"statefulsets", "apps", "statefulsets"},
+	{"daemonsets", "apps", "daemonsets"},
+	{"replicasets", "apps", "replicasets"},
+	{"jobs", "batch", "jobs"},
+	{"cronjobs", "batch", "cronjobs"},
+	{"HPAs", "autoscaling", "horizontalpodautoscalers"},
+	{"ingresses", "networking.k8s.io", "ingresses"},
+	{"endpoint slices", "discovery.k8s.io", "endpointslices"},
+	{"pod disruption budgets", "policy", "poddisruptionbudgets"},
+}
+
+// accessVerbs are the verbs checked on each type: the views list them, and
+// look some objects up by name
+var accessVerbs = []string{"list", "get"}
+
+// accessChecker remembers which verbs the identity of a mapper may use on
+// each type. The types are first checked in all namespaces at once, which
+// is enough for identities bound by ClusterRoles, and those denied there
+// again in each namespace, for RoleBindings
+type accessChecker struct {
+	mu sync.Mutex
+	// clusterWide holds the verbs allowed on each type in every namespace,
+	// keyed by type and verb, nil until checked
+	clusterWide map[[2]string]bool
+	// denied holds the types each verb may not be used on, by namespace
+	// and verb
+	denied map[string]map[string][]string
+	// unavailable is set when access reviews fail: every type is listed
+	unavailable bool
+}
+
+// denied reports whether the identity may not list a type in a namespace,
+// in which case the type is skipped instead of failing with Forbidden
+func (rm *ResourceMapper) denied(namespace, what string) bool {
+	return slices.Contains(rm.deniedIn(namespace), what)
+}
+
+// deniedGet reports whether the identity may not get single objects of a
+// type in a namespace, in which case their lookups are skipped
+func (rm *ResourceMapper) deniedGet(namespace, what string) bool {
+	return slices.Contains(rm.deniedVerbs(namespace)["get"], what)
+}
+
+// deniedIn returns the types the identity may not list in a namespace
+func (rm *ResourceMapper) deniedIn(namespace string) []string {
+	return rm.deniedVerbs(namespace)["list"]
+}
+
+// deniedVerbs returns the types the identity may not use each verb on in a
+// namespace, checking them with SelfSubjectAccessReviews on first use. The
+// skipped types are reported once per namespace, on stderr so as not to
+// corrupt JSON outputs
+func (rm *ResourceMapper) deniedVerbs(namespace string) map[string][]string {
+	a := rm.access
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.unavailable {
+		return nil
+	}
+	if a.clusterWide == nil {
+		clusterWide := map[[2]string]bool{}
+		for _, check := range accessChecks {
+			// Disabled types are not listed, whatever the access
+			if !rm.enabled(check.what) {
+				continue
+			}
+			for _, verb := range accessVerbs {
+				allowed, err := rm.canUse(metav1.NamespaceAll, check, verb)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s[access] Cannot check permissions, listing every type: %v%s\n", colorYellow, err, colorReset)
+					a.unavailable = true
+					return nil
+				}
+				clusterWide[[2]string{check.what, verb}] = allowed
+			}
+		}
+		a.clusterWide = clusterWide
+		a.denied = map[string]map[string][]string{}
+	}
+	if denied, ok := a.denied[namespace]; ok {
+		return denied
+	}
+	denied := map[string][]string{}
+	for _, check := range accessChecks {
+		if !rm.enabled(check.what) {
+			continue
+		}
+		for _, verb := range accessVerbs {
+			if a.clusterWide[[2]string{check.what, verb}] {
+				continue
+			}
+			if allowed, err := rm.canUse(namespace, check, verb); err == nil && !allowed {
+				denied[verb] = append(denied[verb], check.what)
+			}
+		}
+	}
+	a.denied[namespace] = denied
+	if len(denied["list"]) > 0 {
+		fmt.Fprintf(os.Stderr, "%s[access] Skipping %s in namespace %s: not allowed to list them%s\n", colorYellow, strings.Join(denied["list"], ", "), namespace, colorReset)
+	}
+	// Types that may not be listed are skipped altogether
+	var unreadable []string
+	for _, what := range denied["get"] {
+		if !slices.Contains(denied["list"], what) {
+			unreadable = append(unreadable, what)
+		}
+	}
+	if len(unreadable) > 0 {
+		fmt.Fprintf(os.Stderr, "%s[access] Skipping lookups of single %s in namespace %s: not allowed to get them%s\n", colorYellow, strings.Join(unreadable, ", "), namespace, colorReset)
+	}
+	return denied
+}
+
+// canUse asks the API server whether the identity may use a verb on a type
+// in a namespace, or in all namespaces
+func (rm *ResourceMapper) canUse(namespace string, check accessCheck, verb string) (bool, error) {
+	review, err := rm.clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(rm.ctx, &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      verb,
+				Group:     check.group,
+				Resource:  check.resource,
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return false, fmt.Errorf("error reviewing access to %s: %v", check.what, err)
+	}
+	return review.Status.Allowed, nil
+}
+
+// skippedErrors describes the types skipped in a namespace as errors of its
+// graph, so that outputs show what the graph is missing
+func (rm *ResourceMapper) skippedErrors(namespace string) []MappingError {
+	var errors []MappingError
+	for _, what := range rm.deniedIn(namespace) {
+		errors = append(errors, MappingError{Namespace: namespace, Source: what,
+			Message: "skipped: not allowed to list " + what, Forbidden: true, Skipped: true})
+	}
+	return errors
+}
@@ -0,0 +1,60 @@
+package mapper
+
+import (
+	"reflect"
+	"testing"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestAccessVerbs(t *testing.T) {
+	// Secrets may only be listed in ops, single services only got in ops
+	clientset := fake.NewClientset()
+	reviews := 0
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		reviews++
+		attrs := review.Spec.ResourceAttributes
+		allowed := true
+		switch {
+		case attrs.Resource == "secrets" && attrs.Verb == "list":
+			allowed = attrs.Namespace == "ops"
+		case attrs.Resource == "services" && attrs.Verb == "get":
+			allowed = attrs.Namespace == "ops"
+		}
+		review.Status.Allowed = allowed
+		return true, review, nil
+	})
+	rm := NewResourceMapperForClients(clientset, nil, "test")
+	rm.access = &accessChecker{}
+
+	want := map[string][]string{"list": {"secrets"}, "get": {"services"}}
+	if got := rm.deniedVerbs("shop"); !reflect.DeepEqual(got, want) {
+		t.Errorf("denied in shop = %v, want %v", got, want)
+	}
+	if got := rm.deniedVerbs("ops"); len(got) != 0 {
+		t.Errorf("denied in ops = %v, want none", got)
+	}
+	if !rm.denied("shop", "secrets") || rm.denied("shop", "services") {
+		t.Errorf("list denied: secrets %v, services %v, want true, false", rm.denied("shop", "secrets"), rm.denied("shop", "services"))
+	}
+	if !rm.deniedGet("shop", "services") || rm.deniedGet("ops", "services") {
+		t.Errorf("get of services denied: shop %v, ops %v, want true, false", rm.deniedGet("shop", "services"), rm.deniedGet("ops", "services"))
+	}
+
+	// Both verbs of every enabled type cluster-wide, then the two denied
+	// verbs in each namespace, checked once
+	enabled := 0
+	for _, check := range accessChecks {
+		if rm.enabled(check.what) {
+			enabled++
+		}
+	}
+	rm.deniedVerbs("shop")
+	if want := enabled*len(accessVerbs) + 2*2; reviews != want {
+		t.Errorf("access reviews = %d, want %d", reviews, want)
+	}
+}
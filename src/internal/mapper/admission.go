@@ -0,0 +1,172 @@
+package mapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// maxAdmissionBody bounds the size of an AdmissionReview request
+const maxAdmissionBody = 4 << 20
+
+// selectsAny reports whether a selector matches the labels of any pod of a
+// graph, looked up in the pod index of the graph. An empty selector matches
+// none
+func selectsAny(g *Graph, selector map[string]string) bool {
+	return len(g.indexed().pods.candidates(selector)) > 0
+}
+
+// serviceWarnings checks an incoming service against the mapped graph of
+// its namespace
+func serviceWarnings(svc *corev1.Service, g *Graph) []string {
+	if svc.Spec.Type == corev1.ServiceTypeExternalName || len(svc.Spec.Selector) == 0 {
+		return nil
+	}
+	if !selectsAny(g, svc.Spec.Selector) {
+		return []string{fmt.Sprintf("service %s: selector %s matches no pods in namespace %s",
+			svc.Name, formatLabels(svc.Spec.Selector), svc.Namespace)}
+	}
+	return nil
+}
+
+// ingressRoutes returns the host and path pairs an ingress routes, such as
+// shop.example.com/api. Rules without a host match every host and are left
+// out
+func ingressRoutes(ing *networkingv1.Ingress) []string {
+	routes := []string{}
+	for _, rule := range ing.Spec.Rules {
+		if rule.Host == "" || rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			routes = append(routes, rule.Host+path.Path)
+		}
+	}
+	return routes
+}
+
+// ingressWarnings checks an incoming ingress against the mapped graphs:
+// host and path pairs already routed by another ingress and backends that
+// do not exist
+func ingressWarnings(ing *networkingv1.Ingress, graphs map[string]*Graph) []string {
+	var warnings []string
+	routes := map[string]bool{}
+	for _, route := range ingressRoutes(ing) {
+		routes[route] = true
+	}
+
+	for _, ns := range sortedKeys(graphs) {
+		for _, res := range graphs[ns].Resources {
+			if res.Kind != "Ingress" || (res.Namespace == ing.Namespace && res.Name == ing.Name) {
+				continue
+			}
+			for _, route := range strings.Split(res.Attributes["routes"], ",") {
+				if routes[route] {
+					warnings = append(warnings, fmt.Sprintf("ingress %s: %s is already routed by ingress %s/%s",
+						ing.Name, route, res.Namespace, res.Name))
+				}
+			}
+		}
+	}
+
+	g := graphs[ing.Namespace]
+	if g == nil {
+		return warnings
+	}
+	backends := map[string]bool{}
+	if ing.Spec.DefaultBackend != nil && ing.Spec.DefaultBackend.Service != nil {
+		backends[ing.Spec.DefaultBackend.Service.Name] = true
+	}
+	for _, rule := range ing.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			if path.Backend.Service != nil {
+				backends[path.Backend.Service.Name] = true
+			}
+		}
+	}
+	for _, name := range sortedKeys(backends) {
+		if !g.hasResource(ResourceKey{Kind: "Service", Namespace: ing.Namespace, Name: name}) {
+			warnings = append(warnings, fmt.Sprintf("ingress %s: backend service %s does not exist in namespace %s",
+				ing.Name, name, ing.Namespace))
+		}
+	}
+	return warnings
+}
+
+// admissionWarnings evaluates an admission request against the mapped graphs
+func (s *graphServer) admissionWarnings(req *admissionv1.AdmissionRequest) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	switch req.Kind.Kind {
+	case "Service":
+		var svc corev1.Service
+		if err := json.Unmarshal(req.Object.Raw, &svc); err != nil {
+			return nil, fmt.Errorf("error decoding service: %v", err)
+		}
+		svc.Namespace = req.Namespace
+		// Namespaces outside the map cannot be checked
+		g := s.graphs[req.Namespace]
+		if g == nil {
+			return nil, nil
+		}
+		return serviceWarnings(&svc, g), nil
+	case "Ingress":
+		var ing networkingv1.Ingress
+		if err := json.Unmarshal(req.Object.Raw, &ing); err != nil {
+			return nil, fmt.Errorf("error decoding ingress: %v", err)
+		}
+		ing.Namespace = req.Namespace
+		return ingressWarnings(&ing, s.graphs), nil
+	}
+	return nil, nil
+}
+
+// handleAdmission serves the validating admission webhook. Objects are
+// admitted with warnings, or rejected when the server runs with --deny
+func (s *graphServer) handleAdmission(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxAdmissionBody))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error reading request: %v", err), http.StatusBadRequest)
+		return
+	}
+	var review admissionv1.AdmissionReview
+	if err := json.Unmarshal(body, &review); err != nil || review.Request == nil {
+		http.Error(w, "expected an AdmissionReview request", http.StatusBadRequest)
+		return
+	}
+
+	resp := &admissionv1.AdmissionResponse{UID: review.Request.UID, Allowed: true}
+	warnings, err := s.admissionWarnings(review.Request)
+	if err != nil {
+		resp.Result = &metav1.Status{Status: metav1.StatusFailure, Message: err.Error()}
+	}
+	resp.Warnings = warnings
+	if len(warnings) > 0 {
+		fmt.Printf("%sAdmission %s %s/%s: %s%s\n", colorYellow, review.Request.Kind.Kind, review.Request.Namespace,
+			review.Request.Name, strings.Join(warnings, "; "), colorReset)
+		if s.deny {
+			resp.Allowed = false
+			resp.Result = &metav1.Status{
+				Status:  metav1.StatusFailure,
+				Reason:  metav1.StatusReasonInvalid,
+				Message: strings.Join(warnings, "; "),
+				Code:    http.StatusUnprocessableEntity,
+			}
+		}
+	}
+
+	review.Request = nil
+	review.Response = resp
+	writeJSON(w, http.StatusOK, review)
+}
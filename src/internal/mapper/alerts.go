@@ -0,0 +1,285 @@
+package mapper
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// prometheusRuleResource holds Prometheus Operator alerting and recording rules
+var prometheusRuleResource = schema.GroupVersionResource{Group: "monitoring.coreos.com", Version: "v1", Resource: "prometheusrules"}
+
+// labelMatcherPattern finds the label matchers of a PromQL expression
+var labelMatcherPattern = regexp.MustCompile(`([a-zA-Z_][a-zA-Z0-9_]*)\s*(=~|!~|!=|=)\s*"((?:[^"\\]|\\.)*)"`)
+
+// workloadLabels are the series labels naming a workload or its pods, as set
+// by kube-state-metrics, cAdvisor and common scrape configurations
+var workloadLabels = map[string]bool{
+	"deployment":             true,
+	"statefulset":            true,
+	"daemonset":              true,
+	"pod":                    true,
+	"container":              true,
+	"service":                true,
+	"job":                    true,
+	"app":                    true,
+	"app_kubernetes_io_name": true,
+}
+
+// labelMatcher is a label matcher of an alert expression
+type labelMatcher struct {
+	label string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+// matches reports whether a label value satisfies the matcher, ignoring
+// whether the matcher is negated
+func (m *labelMatcher) matches(value string) bool {
+	if m.re != nil {
+		return m.re.MatchString(value)
+	}
+	return m.value == value
+}
+
+// negated reports whether the matcher excludes the values it matches
+func (m *labelMatcher) negated() bool {
+	return m.op == "!=" || m.op == "!~"
+}
+
+// alertRule is an alert of a PrometheusRule
+type alertRule struct {
+	Alert    string `json:"alert"`
+	Expr     string `json:"expr"`
+	matchers []labelMatcher
+}
+
+// prometheusRule is a PrometheusRule with its alerts
+type prometheusRule struct {
+	Namespace string
+	Name      string
+	Alerts    []alertRule
+}
+
+// parseMatchers extracts the label matchers of an alert expression;
+// regular expressions are anchored as in PromQL
+func parseMatchers(expr string) []labelMatcher {
+	matchers := []labelMatcher{}
+	for _, m := range labelMatcherPattern.FindAllStringSubmatch(expr, -1) {
+		matcher := labelMatcher{label: m[1], op: m[2], value: strings.ReplaceAll(m[3], `\\`, `\`)}
+		if matcher.op == "=~" || matcher.op == "!~" {
+			re, err := regexp.Compile("^(?:" + matcher.value + ")$")
+			if err != nil {
+				continue
+			}
+			matcher.re = re
+		}
+		matchers = append(matchers, matcher)
+	}
+	return matchers
+}
+
+// listPrometheusRules lists the alerting rules of the cluster once per run,
+// reporting whether PrometheusRules can be read at all
+func (rm *ResourceMapper) listPrometheusRules() ([]prometheusRule, bool, error) {
+	if rm.prometheusRules != nil {
+		return rm.prometheusRules, rm.alerting, nil
+	}
+	rm.prometheusRules = []prometheusRule{}
+	if rm.dynamic == nil || !rm.enabled("PrometheusRules") || !rm.served("PrometheusRules") {
+		return rm.prometheusRules, false, nil
+	}
+	items, err := pagedList(rm, metav1.NamespaceAll, "PrometheusRules", func(opts metav1.ListOptions) ([]unstructured.Unstructured, metav1.ListInterface, error) {
+		list, err := rm.dynamic.Resource(prometheusRuleResource).Namespace(metav1.NamespaceAll).List(rm.ctx, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		return list.Items, list, nil
+	})
+	if apierrors.IsNotFound(err) || apierrors.IsForbidden(err) {
+		return rm.prometheusRules, false, nil
+	}
+	if err != nil {
+		rm.prometheusRules = nil
+		return nil, false, fmt.Errorf("error getting %s: %v", prometheusRuleResource.GroupResource(), err)
+	}
+
+	var spec struct {
+		Groups []struct {
+			Rules []alertRule `json:"rules"`
+		} `json:"groups"`
+	}
+	for _, item := range items {
+		rule := prometheusRule{Namespace: item.GetNamespace(), Name: item.GetName()}
+		raw, ok := item.Object["spec"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		spec.Groups = nil
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &spec); err != nil {
+			rm.prometheusRules = nil
+			return nil, false, fmt.Errorf("error reading PrometheusRule %s/%s: %v", rule.Namespace, rule.Name, err)
+		}
+		for _, group := range spec.Groups {
+			for _, alert := range group.Rules {
+				// Recording rules have no alert name
+				if alert.Alert == "" {
+					continue
+				}
+				alert.matchers = parseMatchers(alert.Expr)
+				rule.Alerts = append(rule.Alerts, alert)
+			}
+		}
+		rm.prometheusRules = append(rm.prometheusRules, rule)
+	}
+	rm.alerting = true
+	return rm.prometheusRules, true, nil
+}
+
+// covers reports whether an alert references a workload of a namespace: no
+// namespace matcher may exclude the namespace, and a workload label matcher
+// must match the workload name or, for the pod label, one of its pods
+func (a *alertRule) covers(namespace, workload string, pods []corev1.Pod) bool {
+	for i := range a.matchers {
+		m := &a.matchers[i]
+		if m.label == "namespace" && m.matches(namespace) == m.negated() {
+			return false
+		}
+	}
+	for i := range a.matchers {
+		m := &a.matchers[i]
+		if m.negated() || !workloadLabels[m.label] {
+			continue
+		}
+		if m.label != "pod" {
+			if m.matches(workload) {
+				return true
+			}
+			continue
+		}
+		for _, pod := range pods {
+			if m.matches(pod.Name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// workloadAlerts returns the alerts of each rule covering a workload, keyed by
+// the rule's namespace and name
+func workloadAlerts(rules []prometheusRule, namespace, workload string, pods []corev1.Pod) map[string][]string {
+	alerts := map[string][]string{}
+	for i := range rules {
+		rule := &rules[i]
+		for j := range rule.Alerts {
+			if rule.Alerts[j].covers(namespace, workload, pods) {
+				ref := rule.Namespace + "/" + rule.Name
+				alerts[ref] = append(alerts[ref], rule.Alerts[j].Alert)
+			}
+		}
+	}
+	return alerts
+}
+
+// showAlertCoverage maps the alerts of PrometheusRules to the deployments and
+// statefulsets their expressions reference, flagging workloads without alerts
+func (rm *ResourceMapper) showAlertCoverage(namespace string) error {
+	rules, installed, err := rm.listPrometheusRules()
+	if err != nil || !installed {
+		return err
+	}
+	index, err := rm.podIndexFor(namespace)
+	if err != nil {
+		return err
+	}
+	deployments, err := rm.listDeployments(namespace)
+	if err != nil {
+		return err
+	}
+	statefulSets, err := rm.listStatefulSets(namespace)
+	if err != nil {
+		return err
+	}
+
+	type workload struct {
+		kind, name string
+		selector   *metav1.LabelSelector
+	}
+	workloads := []workload{}
+	for _, deploy := range deployments {
+		workloads = append(workloads, workload{"Deployment", deploy.Name, deploy.Spec.Selector})
+	}
+	for _, sts := range statefulSets {
+		workloads = append(workloads, workload{"StatefulSet", sts.Name, sts.Spec.Selector})
+	}
+
+	fmt.Printf("\n%sAlert coverage in namespace: %s%s\n", colorCyan, namespace, colorReset)
+	if len(workloads) == 0 {
+		fmt.Printf(sym("└── No deployments or statefulsets\n"))
+		return nil
+	}
+	for i, w := range workloads {
+		branch, indent := sym("├──"), sym("│  ")
+		if i == len(workloads)-1 {
+			branch, indent = sym("└──"), "   "
+		}
+		pods, _ := index.matchSelector(w.selector)
+		alerts := workloadAlerts(rules, namespace, w.name, pods)
+		if len(alerts) == 0 {
+			fmt.Printf("%s %s %s: %sno alerts%s\n", branch, w.kind, w.name, colorYellow, colorReset)
+			continue
+		}
+		fmt.Printf("%s %s %s\n", branch, w.kind, w.name)
+		for _, ref := range sortedKeys(alerts) {
+			fmt.Printf("%s %s %s (%s)\n", indent, rm.createArrow(4), strings.Join(alerts[ref], ", "), ref)
+		}
+	}
+	return nil
+}
+
+// alertCoverage links the alerts of a PrometheusRule to a workload
+type alertCoverage struct {
+	rule   ResourceKey
+	kind   string
+	name   string
+	alerts []string
+}
+
+// alertCoverages returns which rules alert on the deployments and
+// statefulsets of a namespace
+func (objs *namespaceObjects) alertCoverages() []alertCoverage {
+	coverages := []alertCoverage{}
+	if len(objs.prometheusRules) == 0 {
+		return coverages
+	}
+	index := newPodIndex(objs.pods)
+	add := func(kind, name string, selector *metav1.LabelSelector) {
+		pods, _ := index.matchSelector(selector)
+		alerts := workloadAlerts(objs.prometheusRules, objs.namespace, name, pods)
+		for _, ref := range sortedKeys(alerts) {
+			ruleNs, ruleName, _ := strings.Cut(ref, "/")
+			coverages = append(coverages, alertCoverage{
+				rule:   ResourceKey{Kind: "PrometheusRule", Namespace: ruleNs, Name: ruleName},
+				kind:   kind,
+				name:   name,
+				alerts: alerts[ref],
+			})
+		}
+	}
+	for _, deploy := range objs.deployments {
+		add("Deployment", deploy.Name, deploy.Spec.Selector)
+	}
+	for _, sts := range objs.statefulSets {
+		add("StatefulSet", sts.Name, sts.Spec.Selector)
+	}
+	return coverages
+}
@@ -0,0 +1,405 @@
+package mapper
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// eventSpikeWarmup is the number of refreshes building the baselines
+	// before spikes are flagged
+	eventSpikeWarmup = 3
+	// eventSpikeSmoothing is the weight of the latest rate in a baseline,
+	// an exponentially weighted moving average
+	eventSpikeSmoothing = 0.3
+	// eventSpikeWindow is how far back changes are correlated with a spike
+	eventSpikeWindow = 15 * time.Minute
+)
+
+// listWarningEvents lists the warning events of a namespace
+func (rm *ResourceMapper) listWarningEvents(namespace string) ([]corev1.Event, error) {
+	events, err := rm.clientset.CoreV1().Events(namespace).List(rm.ctx, metav1.ListOptions{FieldSelector: "type=" + corev1.EventTypeWarning})
+	if err != nil {
+		return nil, fmt.Errorf("error getting events: %v", err)
+	}
+	// Field selectors are not honoured everywhere, so filter again
+	warnings := []corev1.Event{}
+	for _, ev := range events.Items {
+		if ev.Type == corev1.EventTypeWarning {
+			warnings = append(warnings, ev)
+		}
+	}
+	return warnings, nil
+}
+
+// eventOccurrences returns the number of times an event was recorded
+func eventOccurrences(ev *corev1.Event) int {
+	if ev.Series != nil && ev.Series.Count > 0 {
+		return int(ev.Series.Count)
+	}
+	if ev.Count > 0 {
+		return int(ev.Count)
+	}
+	return 1
+}
+
+// podWorkloads maps the pods of a graph to the workloads managing them
+func podWorkloads(g *Graph) map[ResourceKey]ResourceKey {
+	owners := map[ResourceKey]ResourceKey{}
+	for _, rel := range g.Relationships {
+		if rel.Type == RelManages && rel.To.Kind == "Pod" {
+			owners[rel.To] = rel.From
+		}
+	}
+	return owners
+}
+
+// eventWorkload returns the workload an event is about: the workload
+// managing a pod, the deployment of a replicaset, or else the object itself
+func eventWorkload(namespace string, ev *corev1.Event, owners map[ResourceKey]ResourceKey, g *Graph) ResourceKey {
+	key := ResourceKey{Kind: ev.InvolvedObject.Kind, Namespace: namespace, Name: ev.InvolvedObject.Name}
+	switch key.Kind {
+	case "Pod":
+		if owner, ok := owners[key]; ok {
+			return owner
+		}
+	case "ReplicaSet":
+		// Deployments name their replicasets <deployment>-<pod-template-hash>
+		if i := strings.LastIndex(key.Name, "-"); i > 0 {
+			deploy := ResourceKey{Kind: "Deployment", Namespace: namespace, Name: key.Name[:i]}
+			if g.hasResource(deploy) {
+				return deploy
+			}
+		}
+	}
+	return key
+}
+
+// warningSample is the warning events of a workload seen by one refresh
+type warningSample struct {
+	events  int
+	reasons map[string]int
+	message string
+}
+
+// recentChange is a change to the graph seen by a refresh
+type recentChange struct {
+	At     time.Time `json:"at"`
+	Change string    `json:"change"`
+}
+
+// eventAnomaly is a workload whose warning events spiked
+type eventAnomaly struct {
+	Workload ResourceKey `json:"workload"`
+	Since    time.Time   `json:"since"`
+	// Events are the warning events of the last refresh interval, at Rate
+	// per minute against the Baseline rate before the spike
+	Events   int            `json:"events"`
+	Rate     float64        `json:"ratePerMinute"`
+	Baseline float64        `json:"baselinePerMinute"`
+	Reasons  map[string]int `json:"reasons"`
+	Message  string         `json:"message"`
+	// Changes are the changes to the workload and the resources it relates
+	// to in the window before the spike started
+	Changes []recentChange `json:"changes"`
+}
+
+// formatReasons lists event reasons by decreasing count
+func formatReasons(reasons map[string]int) string {
+	names := sortedKeys(reasons)
+	sort.SliceStable(names, func(i, j int) bool {
+		return reasons[names[i]] > reasons[names[j]]
+	})
+	parts := []string{}
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s x%d", name, reasons[name]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// timedEvent is a graph event with the time of the refresh that saw it
+type timedEvent struct {
+	at    time.Time
+	event graphEvent
+}
+
+// eventSpikeTracker follows the warning-event rate of each workload across
+// refreshes, flagging spikes above a multiple of its moving baseline and
+// correlating them with the recent changes around the workload
+type eventSpikeTracker struct {
+	// factor is the multiple of the baseline a rate must reach, and min the
+	// warning events one refresh must see, to be a spike
+	factor float64
+	min    int
+
+	mu        sync.Mutex
+	refreshes int
+	last      time.Time
+	// counts are the occurrences of each event at the last refresh, so that
+	// repeats of an event count as new warnings
+	counts    map[types.UID]int
+	baselines map[ResourceKey]float64
+	changes   []timedEvent
+	active    map[ResourceKey]*eventAnomaly
+}
+
+// newEventSpikeTracker creates a tracker flagging rates of at least factor
+// times the baseline and min events per refresh
+func newEventSpikeTracker(factor float64, min int) *eventSpikeTracker {
+	return &eventSpikeTracker{
+		factor:    factor,
+		min:       min,
+		counts:    map[types.UID]int{},
+		baselines: map[ResourceKey]float64{},
+		active:    map[ResourceKey]*eventAnomaly{},
+	}
+}
+
+// sample counts the warning events recorded since the last refresh per
+// workload, remembering the occurrences of each event for the next one
+func (t *eventSpikeTracker) sample(graphs map[string]*Graph, warnings map[string][]corev1.Event) map[ResourceKey]*warningSample {
+	samples := map[ResourceKey]*warningSample{}
+	counts := map[types.UID]int{}
+	for ns, events := range warnings {
+		g := graphs[ns]
+		if g == nil {
+			continue
+		}
+		owners := podWorkloads(g)
+		for i := range events {
+			ev := &events[i]
+			counts[ev.UID] = eventOccurrences(ev)
+			delta := counts[ev.UID] - t.counts[ev.UID]
+			if delta <= 0 {
+				continue
+			}
+			key := eventWorkload(ns, ev, owners, g)
+			s := samples[key]
+			if s == nil {
+				s = &warningSample{reasons: map[string]int{}}
+				samples[key] = s
+			}
+			s.events += delta
+			s.reasons[ev.Reason] += delta
+			s.message = ev.Message
+		}
+	}
+	t.counts = counts
+	return samples
+}
+
+// relatedChanges describes the changes in the correlation window to a
+// workload and the resources related to it or its pods. Pods come and go
+// with rollouts, so their relationships are lifted to the workload and only
+// those added or removed on balance are kept
+func (t *eventSpikeTracker) relatedChanges(workload ResourceKey, g *Graph) []recentChange {
+	// Pods removed since are known from the manages relationships removed
+	// with them
+	owners := podWorkloads(g)
+	for _, c := range t.changes {
+		if rel := c.event.Relationship; rel != nil && rel.Type == RelManages {
+			owners[rel.To] = rel.From
+		}
+	}
+	lift := func(key ResourceKey) ResourceKey {
+		if owner, ok := owners[key]; ok {
+			return owner
+		}
+		return key
+	}
+	peripheral := func(key ResourceKey) bool {
+		return key.Kind == "Pod" || key.Kind == "Node"
+	}
+	neighbours := map[ResourceKey]bool{workload: true}
+	for _, rel := range g.Relationships {
+		from, to := lift(rel.From), lift(rel.To)
+		if from == workload && !peripheral(to) {
+			neighbours[to] = true
+		}
+		if to == workload && !peripheral(from) {
+			neighbours[from] = true
+		}
+	}
+
+	changes := []recentChange{}
+	latest := map[string]time.Time{}
+	balance := map[string]int{}
+	for _, c := range t.changes {
+		ev := c.event
+		if ev.Resource != nil {
+			if neighbours[ev.Resource.Key()] {
+				changes = append(changes, recentChange{At: c.at, Change: formatResourceKey(ev.Resource.Key()) + " " + ev.Type})
+			}
+			continue
+		}
+		rel := ev.Relationship
+		from, to := lift(rel.From), lift(rel.To)
+		if (from != workload && to != workload) || peripheral(from) || peripheral(to) || rel.Type == RelManages {
+			continue
+		}
+		change := fmt.Sprintf("%s %s %s", formatResourceKey(from), rel.Type, formatResourceKey(to))
+		switch ev.Type {
+		case eventAdded:
+			balance[change]++
+		case eventRemoved:
+			balance[change]--
+		}
+		latest[change] = c.at
+	}
+
+	for _, change := range sortedKeys(latest) {
+		switch {
+		case balance[change] > 0:
+			changes = append(changes, recentChange{At: latest[change], Change: change + " " + eventAdded})
+		case balance[change] < 0:
+			changes = append(changes, recentChange{At: latest[change], Change: change + " " + eventRemoved})
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].At.After(changes[j].At)
+	})
+	return changes
+}
+
+// observe records a refresh: the graphs, the warning events of their
+// namespaces and the changes since the previous refresh. It returns the
+// anomalies that started and the workloads whose spike ended
+func (t *eventSpikeTracker) observe(now time.Time, graphs map[string]*Graph, warnings map[string][]corev1.Event, diff []graphEvent) (started []*eventAnomaly, ended []ResourceKey) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// The first refresh only learns which events and resources exist
+	first := t.last.IsZero()
+	kept := []timedEvent{}
+	for _, c := range t.changes {
+		if now.Sub(c.at) <= eventSpikeWindow {
+			kept = append(kept, c)
+		}
+	}
+	if !first {
+		for _, ev := range diff {
+			kept = append(kept, timedEvent{at: now, event: ev})
+		}
+	}
+	t.changes = kept
+
+	samples := t.sample(graphs, warnings)
+	minutes := now.Sub(t.last).Minutes()
+	t.last = now
+	t.refreshes++
+	if first || minutes <= 0 {
+		return nil, nil
+	}
+
+	workloads := map[ResourceKey]bool{}
+	for key := range samples {
+		workloads[key] = true
+	}
+	for key := range t.baselines {
+		workloads[key] = true
+	}
+	for key := range workloads {
+		s := samples[key]
+		if s == nil {
+			s = &warningSample{reasons: map[string]int{}}
+		}
+		rate := float64(s.events) / minutes
+		baseline := t.baselines[key]
+		spiking := t.refreshes > eventSpikeWarmup && s.events >= t.min && rate >= t.factor*baseline
+
+		anomaly := t.active[key]
+		switch {
+		case spiking && anomaly == nil:
+			anomaly = &eventAnomaly{Workload: key, Since: now, Baseline: baseline, Changes: []recentChange{}}
+			if g := graphs[key.Namespace]; g != nil {
+				anomaly.Changes = t.relatedChanges(key, g)
+			}
+			t.active[key] = anomaly
+			started = append(started, anomaly)
+		case !spiking && anomaly != nil:
+			delete(t.active, key)
+			ended = append(ended, key)
+		}
+		if spiking {
+			// The baseline stays put during a spike, which lasts until the
+			// rate falls back
+			anomaly.Events, anomaly.Rate, anomaly.Reasons, anomaly.Message = s.events, rate, s.reasons, s.message
+			continue
+		}
+		baseline = eventSpikeSmoothing*rate + (1-eventSpikeSmoothing)*baseline
+		if baseline < 0.001 {
+			delete(t.baselines, key)
+			continue
+		}
+		t.baselines[key] = baseline
+	}
+	sort.Slice(started, func(i, j int) bool {
+		return started[i].Workload.String() < started[j].Workload.String()
+	})
+	sort.Slice(ended, func(i, j int) bool {
+		return ended[i].String() < ended[j].String()
+	})
+	return started, ended
+}
+
+// check records a refresh, printing the spikes that start, with the changes
+// that preceded them, and those that end
+func (t *eventSpikeTracker) check(now time.Time, graphs map[string]*Graph, warnings map[string][]corev1.Event, diff []graphEvent) {
+	started, ended := t.observe(now, graphs, warnings, diff)
+	for _, a := range started {
+		fmt.Printf("%s[event spike] %s: %d warning event(s), %.1f/min against a baseline of %.1f/min (%s)%s\n",
+			colorRed, formatResourceKey(a.Workload), a.Events, a.Rate, a.Baseline, formatReasons(a.Reasons), colorReset)
+		lines := []string{}
+		if a.Message != "" {
+			lines = append(lines, "Latest: "+a.Message)
+		}
+		for _, c := range a.Changes {
+			lines = append(lines, fmt.Sprintf("After %s (%s ago)", c.Change, now.Sub(c.At).Round(time.Second)))
+		}
+		if len(a.Changes) == 0 {
+			lines = append(lines, fmt.Sprintf("No related change in the last %s", eventSpikeWindow))
+		}
+		for i, line := range lines {
+			branch := sym("├──")
+			if i == len(lines)-1 {
+				branch = sym("└──")
+			}
+			fmt.Printf("%s %s\n", branch, line)
+		}
+	}
+	for _, key := range ended {
+		fmt.Printf("%s[event spike resolved] %s%s\n", colorGreen, formatResourceKey(key), colorReset)
+	}
+}
+
+// eventAnomaliesDocument lists the current spikes as served by the API
+type eventAnomaliesDocument struct {
+	APIVersion string          `json:"apiVersion"`
+	Kind       string          `json:"kind"`
+	Updated    time.Time       `json:"updated"`
+	Anomalies  []*eventAnomaly `json:"anomalies"`
+}
+
+// handleAPIAnomalies serves GET /api/v1/anomalies: the workloads whose
+// warning events are spiking
+func (t *eventSpikeTracker) handleAPIAnomalies(w http.ResponseWriter, r *http.Request) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	doc := eventAnomaliesDocument{APIVersion: apiVersion, Kind: "EventAnomalyList", Updated: t.last,
+		Anomalies: []*eventAnomaly{}}
+	for _, anomaly := range t.active {
+		doc.Anomalies = append(doc.Anomalies, anomaly)
+	}
+	sort.Slice(doc.Anomalies, func(i, j int) bool {
+		return doc.Anomalies[i].Workload.String() < doc.Anomalies[j].Workload.String()
+	})
+	writeJSON(w, http.StatusOK, doc)
+}
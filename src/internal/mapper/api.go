@@ -0,0 +1,146 @@
+package mapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// apiVersion versions the JSON model served by the REST API
+const apiVersion = "resource-mapper/v1"
+
+// namespaceListDocument lists the namespaces served by the API
+type namespaceListDocument struct {
+	APIVersion string    `json:"apiVersion"`
+	Kind       string    `json:"kind"`
+	Updated    time.Time `json:"updated"`
+	Namespaces []string  `json:"namespaces"`
+}
+
+// graphDocument is the graph of a namespace as served by the API
+type graphDocument struct {
+	APIVersion string    `json:"apiVersion"`
+	Kind       string    `json:"kind"`
+	Namespace  string    `json:"namespace"`
+	Updated    time.Time `json:"updated"`
+	Graph
+}
+
+// relationshipsDocument holds the relationships of the resources matching a
+// kind and name, in either direction
+type relationshipsDocument struct {
+	APIVersion    string         `json:"apiVersion"`
+	Kind          string         `json:"kind"`
+	Updated       time.Time      `json:"updated"`
+	Resources     []Resource     `json:"resources"`
+	Relationships []Relationship `json:"relationships"`
+}
+
+// apiError is the body of failed API requests
+type apiError struct {
+	APIVersion string `json:"apiVersion"`
+	Error      string `json:"error"`
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		fmt.Printf("%sError writing API response: %v%s\n", colorRed, err, colorReset)
+	}
+}
+
+// writeAPIError writes a JSON error response
+func writeAPIError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeJSON(w, status, apiError{APIVersion: apiVersion, Error: fmt.Sprintf(format, args...)})
+}
+
+// handleAPINamespaces serves GET /api/v1/namespaces
+func (s *graphServer) handleAPINamespaces(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	writeJSON(w, http.StatusOK, namespaceListDocument{
+		APIVersion: apiVersion,
+		Kind:       "NamespaceList",
+		Updated:    s.updated,
+		Namespaces: sortedKeys(s.graphs),
+	})
+}
+
+// handleAPIGraph serves GET /api/v1/namespaces/{ns}/graph
+func (s *graphServer) handleAPIGraph(w http.ResponseWriter, r *http.Request) {
+	ns := r.PathValue("ns")
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	g, ok := s.graphs[ns]
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "namespace %s is not mapped", ns)
+		return
+	}
+	writeJSON(w, http.StatusOK, graphDocument{
+		APIVersion: apiVersion,
+		Kind:       "Graph",
+		Namespace:  ns,
+		Updated:    s.updated,
+		Graph:      *g,
+	})
+}
+
+// handleAPIRelationships serves GET /api/v1/resources/{kind}/{name}/relationships,
+// optionally restricted to a namespace with the namespace query parameter.
+// Kinds are resolved as in the query commands, short names such as deploy
+// included, and match case-insensitively
+func (s *graphServer) handleAPIRelationships(w http.ResponseWriter, r *http.Request) {
+	kind, name := r.PathValue("kind"), r.PathValue("name")
+	namespace := r.URL.Query().Get("namespace")
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	kind = resolveKindIn(s.aliases, kind)
+	doc := relationshipsDocument{
+		APIVersion:    apiVersion,
+		Kind:          "RelationshipList",
+		Updated:       s.updated,
+		Resources:     []Resource{},
+		Relationships: []Relationship{},
+	}
+	// A cluster-scoped resource, such as a node, is in the graph of each
+	// namespace using it but found once
+	found := &Graph{}
+	for _, ns := range sortedKeys(s.graphs) {
+		if namespace != "" && ns != namespace {
+			continue
+		}
+		g := s.graphs[ns]
+		matched := map[ResourceKey]bool{}
+		for _, res := range g.Resources {
+			if strings.EqualFold(res.Kind, kind) && res.Name == name {
+				matched[res.Key()] = true
+				found.addResource(res)
+			}
+		}
+		for _, rel := range g.Relationships {
+			if matched[rel.From] || matched[rel.To] {
+				found.addEdge(rel)
+			}
+		}
+	}
+	doc.Resources = append(doc.Resources, found.Resources...)
+	doc.Relationships = append(doc.Relationships, found.Relationships...)
+	if len(doc.Resources) == 0 {
+		writeAPIError(w, http.StatusNotFound, "%s %s not found", kind, name)
+		return
+	}
+	writeJSON(w, http.StatusOK, doc)
+}
+
+// registerAPI adds the REST API routes to a mux
+func (s *graphServer) registerAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/ontology", s.handleAPIOntology)
+	mux.HandleFunc("GET /api/v1/namespaces", s.handleAPINamespaces)
+	mux.HandleFunc("GET /api/v1/namespaces/{ns}/graph", s.handleAPIGraph)
+	mux.HandleFunc("GET /api/v1/resources/{kind}/{name}/relationships", s.handleAPIRelationships)
+}
@@ -0,0 +1,54 @@
+package mapper
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestAPIRelationshipsKinds(t *testing.T) {
+	web := map[string]string{"app": "web"}
+	g := testGraph(t, testService("web", web), testDeployment("web", web), testPod("web-1", web, corev1.PodSpec{}))
+	g.indexed()
+	s := &graphServer{rm: testMapper()}
+	s.publish(map[string]*Graph{"shop": g}, nil, time.Now())
+	mux := http.NewServeMux()
+	s.registerAPI(mux)
+
+	tests := []struct {
+		path     string
+		want     int
+		wantKind string
+	}{
+		{path: "/api/v1/resources/Service/web/relationships", want: http.StatusOK, wantKind: "Service"},
+		{path: "/api/v1/resources/service/web/relationships", want: http.StatusOK, wantKind: "Service"},
+		{path: "/api/v1/resources/svc/web/relationships", want: http.StatusOK, wantKind: "Service"},
+		{path: "/api/v1/resources/deploy/web/relationships?namespace=shop", want: http.StatusOK, wantKind: "Deployment"},
+		{path: "/api/v1/resources/deployments/web/relationships", want: http.StatusOK, wantKind: "Deployment"},
+		{path: "/api/v1/resources/svc/missing/relationships", want: http.StatusNotFound},
+		{path: "/api/v1/resources/widget/web/relationships", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			var doc relationshipsDocument
+			if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if len(doc.Resources) != 1 || doc.Resources[0].Kind != tt.wantKind {
+				t.Errorf("resources = %+v, want one %s", doc.Resources, tt.wantKind)
+			}
+		})
+	}
+}
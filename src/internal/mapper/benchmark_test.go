@@ -0,0 +1,194 @@
+package mapper
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// Size of the synthetic cluster: 10k pods and 1k services, spread over
+// namespaces, with a deployment and a ConfigMap per service
+const (
+	benchNamespaces     = 10
+	benchServicesPerNs  = 100
+	benchPodsPerService = 10
+	benchIngressesPerNs = 10
+	benchNodes          = 50
+	benchImpactDepth    = 5
+)
+
+// benchCluster creates a mapper of a synthetic cluster held by a fake
+// clientset, and returns it with the names of its namespaces
+func benchCluster(b *testing.B) (*ResourceMapper, []string) {
+	b.Helper()
+	var objects []runtime.Object
+	var namespaces []string
+	replicas := int32(benchPodsPerService)
+	for n := 0; n < benchNamespaces; n++ {
+		ns := fmt.Sprintf("bench-%02d", n)
+		namespaces = append(namespaces, ns)
+		objects = append(objects, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}})
+		for s := 0; s < benchServicesPerNs; s++ {
+			app := fmt.Sprintf("app-%03d", s)
+			labels := map[string]string{"app": app}
+			meta := metav1.ObjectMeta{Name: app, Namespace: ns, Labels: labels}
+			objects = append(objects,
+				&corev1.Service{ObjectMeta: meta, Spec: corev1.ServiceSpec{
+					Selector: labels,
+					Ports:    []corev1.ServicePort{{Name: "http", Port: 80}},
+				}},
+				&corev1.ConfigMap{ObjectMeta: meta, Data: map[string]string{"config.yaml": "{}"}},
+				&appsv1.Deployment{ObjectMeta: meta, Spec: appsv1.DeploymentSpec{
+					Replicas: &replicas,
+					Selector: &metav1.LabelSelector{MatchLabels: labels},
+					Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: labels}, Spec: benchPodSpec(app, "")},
+				}},
+			)
+			for p := 0; p < benchPodsPerService; p++ {
+				node := fmt.Sprintf("node-%02d", (s*benchPodsPerService+p)%benchNodes)
+				objects = append(objects, &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-%d", app, p), Namespace: ns, Labels: labels},
+					Spec:       benchPodSpec(app, node),
+					Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+				})
+			}
+		}
+		for i := 0; i < benchIngressesPerNs; i++ {
+			var paths []networkingv1.HTTPIngressPath
+			for s := i; s < benchServicesPerNs; s += benchIngressesPerNs {
+				paths = append(paths, networkingv1.HTTPIngressPath{
+					Path: fmt.Sprintf("/app-%03d", s),
+					Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+						Name: fmt.Sprintf("app-%03d", s), Port: networkingv1.ServiceBackendPort{Number: 80},
+					}},
+				})
+			}
+			objects = append(objects, &networkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("ingress-%d", i), Namespace: ns},
+				Spec: networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{
+					Host:             fmt.Sprintf("ingress-%d.example.com", i),
+					IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{Paths: paths}},
+				}}},
+			})
+		}
+	}
+	return NewResourceMapperForClients(fake.NewClientset(objects...), nil, "bench"), namespaces
+}
+
+// benchPodSpec is the spec of the pods of an app, mounting its ConfigMap
+func benchPodSpec(app, node string) corev1.PodSpec {
+	return corev1.PodSpec{
+		NodeName: node,
+		Containers: []corev1.Container{{
+			Name:         "app",
+			Image:        "registry.example.com/" + app + ":1.0",
+			Ports:        []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}},
+			VolumeMounts: []corev1.VolumeMount{{Name: "config", MountPath: "/etc/app"}},
+		}},
+		Volumes: []corev1.Volume{{Name: "config", VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: app}},
+		}}},
+	}
+}
+
+// discardOutput sends the output of the views to /dev/null until the
+// benchmark ends
+func discardOutput(b *testing.B) {
+	b.Helper()
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = devNull
+	b.Cleanup(func() {
+		os.Stdout = stdout
+		devNull.Close()
+	})
+}
+
+// BenchmarkBuildGraphs maps the graphs of every namespace, listing the
+// objects from the fake clientset
+func BenchmarkBuildGraphs(b *testing.B) {
+	rm, namespaces := benchCluster(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rm.cache = nil
+		if _, err := rm.buildGraphs(namespaces); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkGraph builds the graph of a namespace from its listed objects,
+// measuring the relationship processors without the API calls
+func BenchmarkGraph(b *testing.B) {
+	rm, namespaces := benchCluster(b)
+	objs, err := rm.listNamespaceObjects(namespaces[0])
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		objs.graph()
+	}
+}
+
+// BenchmarkProcessNamespace renders every view of a namespace
+func BenchmarkProcessNamespace(b *testing.B) {
+	rm, namespaces := benchCluster(b)
+	discardOutput(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := rm.processNamespace(rm.ctx, namespaces[0]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkImpact walks the blast radius of a ConfigMap on the graphs of
+// every namespace merged
+func BenchmarkImpact(b *testing.B) {
+	rm, namespaces := benchCluster(b)
+	graphs, err := rm.buildGraphs(namespaces)
+	if err != nil {
+		b.Fatal(err)
+	}
+	g := mergeGraphs(graphs)
+	from := ResourceKey{Kind: "ConfigMap", Namespace: namespaces[0], Name: "app-000"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		impactOf(g, from, benchImpactDepth)
+	}
+}
+
+// BenchmarkQuery runs a traversal query from every ingress of the merged
+// graphs
+func BenchmarkQuery(b *testing.B) {
+	rm, namespaces := benchCluster(b)
+	graphs, err := rm.buildGraphs(namespaces)
+	if err != nil {
+		b.Fatal(err)
+	}
+	g := mergeGraphs(graphs)
+	q, err := parseQuery("from Ingress traverse out * depth 3")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		q.run(g)
+	}
+}
@@ -0,0 +1,214 @@
+package mapper
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// serviceDNSPattern matches the service.namespace.svc part of in-cluster DNS
+// names, in URLs, host:port pairs and plain host names
+var serviceDNSPattern = regexp.MustCompile(`\b([a-z0-9]([-a-z0-9]*[a-z0-9])?)\.([a-z0-9]([-a-z0-9]*[a-z0-9])?)\.svc\b`)
+
+// namespaceDependency is a reason for a namespace to be created after another
+type namespaceDependency struct {
+	from   string
+	to     string
+	reason string
+}
+
+// dnsDependencies finds the namespaces a text refers to through service DNS
+// names, other than its own
+func dnsDependencies(namespace, text, where string, known map[string]bool) []namespaceDependency {
+	deps := []namespaceDependency{}
+	for _, match := range serviceDNSPattern.FindAllStringSubmatch(text, -1) {
+		service, target := match[1], match[3]
+		if target == namespace || !known[target] {
+			continue
+		}
+		deps = append(deps, namespaceDependency{from: namespace, to: target, reason: fmt.Sprintf("%s calls service %s", where, service)})
+	}
+	return deps
+}
+
+// webhookBlocks reports whether a webhook rejects requests from a namespace
+// while its service is down: it fails closed and selects the namespace
+func webhookBlocks(wh admissionWebhook, ns *corev1.Namespace) bool {
+	if wh.FailurePolicy != string(admissionregistrationv1.Fail) {
+		return false
+	}
+	if wh.NamespaceSelector == nil {
+		return true
+	}
+	selector, err := metav1.LabelSelectorAsSelector(wh.NamespaceSelector)
+	if err != nil {
+		return false
+	}
+	return selector.Matches(labels.Set(ns.Labels))
+}
+
+// namespaceDependencies collects the dependencies between namespaces: fail
+// closed admission webhooks served from another namespace, and service DNS
+// names of another namespace in pod environment variables, ConfigMaps and
+// ExternalName services
+func (rm *ResourceMapper) namespaceDependencies(namespaces []string) ([]namespaceDependency, error) {
+	known := map[string]bool{}
+	for _, ns := range namespaces {
+		known[ns] = true
+	}
+	list, err := rm.listNamespaces()
+	if err != nil {
+		return nil, err
+	}
+	webhooks, err := rm.listAdmissionWebhooks()
+	if err != nil {
+		return nil, err
+	}
+
+	deps := []namespaceDependency{}
+	for i := range list {
+		ns := &list[i]
+		if !known[ns.Name] {
+			continue
+		}
+		for _, wh := range webhooks {
+			service := wh.ClientConfig.Service
+			if service == nil || service.Namespace == ns.Name || !known[service.Namespace] || !webhookBlocks(wh, ns) {
+				continue
+			}
+			deps = append(deps, namespaceDependency{from: ns.Name, to: service.Namespace,
+				reason: fmt.Sprintf("admission webhook %s (failurePolicy Fail) is served by %s", wh.Name, service.Name)})
+		}
+
+		pods, err := rm.listPods(ns.Name)
+		if err != nil {
+			return nil, err
+		}
+		for j := range pods {
+			workload := podOwnerName(&pods[j])
+			for _, c := range pods[j].Spec.Containers {
+				for _, env := range c.Env {
+					deps = append(deps, dnsDependencies(ns.Name, env.Value, workload, known)...)
+				}
+			}
+		}
+		configMaps, err := rm.listConfigMaps(ns.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, cm := range configMaps {
+			for _, key := range sortedKeys(cm.Data) {
+				deps = append(deps, dnsDependencies(ns.Name, cm.Data[key], "ConfigMap "+cm.Name, known)...)
+			}
+		}
+		services, err := rm.listServices(ns.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, svc := range services {
+			if svc.Spec.Type == corev1.ServiceTypeExternalName {
+				deps = append(deps, dnsDependencies(ns.Name, svc.Spec.ExternalName, "ExternalName service "+svc.Name, known)...)
+			}
+		}
+	}
+	return deps, nil
+}
+
+// bootstrapWaves orders namespaces into waves, each depending only on
+// earlier waves. Namespaces caught in dependency cycles are returned apart
+func bootstrapWaves(namespaces []string, deps []namespaceDependency) ([][]string, []string) {
+	pending := map[string]map[string]bool{}
+	for _, ns := range namespaces {
+		pending[ns] = map[string]bool{}
+	}
+	for _, dep := range deps {
+		pending[dep.from][dep.to] = true
+	}
+
+	waves := [][]string{}
+	for len(pending) > 0 {
+		wave := []string{}
+		for ns, after := range pending {
+			if len(after) == 0 {
+				wave = append(wave, ns)
+			}
+		}
+		if len(wave) == 0 {
+			break
+		}
+		sort.Strings(wave)
+		for _, ns := range wave {
+			delete(pending, ns)
+		}
+		for _, after := range pending {
+			for _, ns := range wave {
+				delete(after, ns)
+			}
+		}
+		waves = append(waves, wave)
+	}
+	return waves, sortedKeys(pending)
+}
+
+// runBootstrap runs the bootstrap subcommand: suggests the order to recreate
+// namespaces in when rebuilding a cluster
+func runBootstrap(args []string) error {
+	var global globalFlags
+	fs := newSubcommandFlagSet("bootstrap", &global)
+	fs.Parse(args)
+
+	rm, err := global.newResourceMapper()
+	if err != nil {
+		return err
+	}
+	namespaces, err := global.namespaces(rm)
+	if err != nil {
+		return err
+	}
+	deps, err := rm.namespaceDependencies(namespaces)
+	if err != nil {
+		return err
+	}
+	waves, cyclic := bootstrapWaves(namespaces, deps)
+
+	// Reasons are listed once per pair of namespaces and reason
+	reasons := map[string][]string{}
+	seen := map[namespaceDependency]bool{}
+	for _, dep := range deps {
+		if !seen[dep] {
+			seen[dep] = true
+			reasons[dep.from] = append(reasons[dep.from], fmt.Sprintf("after %s: %s", dep.to, dep.reason))
+		}
+	}
+
+	fmt.Printf("\n%sNamespace bootstrap order:%s\n", colorCyan, colorReset)
+	for i, wave := range waves {
+		branch, indent := sym("├──"), sym("│  ")
+		if i == len(waves)-1 && len(cyclic) == 0 {
+			branch, indent = sym("└──"), "   "
+		}
+		fmt.Printf("%s Wave %d: %s\n", branch, i+1, strings.Join(wave, ", "))
+		for _, ns := range wave {
+			sort.Strings(reasons[ns])
+			for _, reason := range reasons[ns] {
+				fmt.Printf("%s %s %s %s\n", indent, rm.createArrow(4), ns, reason)
+			}
+		}
+	}
+	if len(cyclic) > 0 {
+		fmt.Printf(sym("└── %sDependency cycle, order by hand: %s%s\n"), colorRed, strings.Join(cyclic, ", "), colorReset)
+		for _, ns := range cyclic {
+			sort.Strings(reasons[ns])
+			for _, reason := range reasons[ns] {
+				fmt.Printf("    %s %s %s\n", rm.createArrow(4), ns, reason)
+			}
+		}
+	}
+	return nil
+}
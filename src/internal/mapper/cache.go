@@ -0,0 +1,526 @@
+package mapper
+
+import (
+	"context"
+	"fmt"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// processorCache shares the objects listed from the namespace being mapped
+// between the views rendering it, so that each type is fetched once per
+// namespace instead of once per view. Views read the cached slices and must
+// not modify them
+type processorCache struct {
+	namespace      string
+	services       []corev1.Service
+	ingresses      []networkingv1.Ingress
+	pods           []corev1.Pod
+	podIndex       *podIndex
+	revisions      *podRevisions
+	deployments    []appsv1.Deployment
+	statefulSets   []appsv1.StatefulSet
+	daemonSets     []appsv1.DaemonSet
+	hpas           []autoscalingv2.HorizontalPodAutoscaler
+	jobs           []batchv1.Job
+	cronJobs       []batchv1.CronJob
+	configMaps     []corev1.ConfigMap
+	endpoints      []corev1.Endpoints
+	endpointSlices []discoveryv1.EndpointSlice
+	pdbs           []policyv1.PodDisruptionBudget
+	// secrets are only listed when allowed; secretsListed tells a namespace
+	// without secrets from one not listed yet
+	secrets        []corev1.Secret
+	secretsListed  bool
+	secretsAllowed bool
+	// secretNames are listed as metadata only, nil when not listed yet
+	secretNames        map[string]bool
+	secretNamesAllowed bool
+	// monitors watching the namespace, and whether the Prometheus Operator
+	// is installed at all
+	monitors   []monitor
+	monitoring bool
+	// ctx is the context the objects are listed with
+	ctx context.Context
+}
+
+// clusterCache shares the cluster-scoped lists, and the lists spanning every
+// namespace, between the views of a run, as processorCache does for one
+// namespace. Views read the cached slices and must not modify them
+type clusterCache struct {
+	nodes              []corev1.Node
+	namespaces         []corev1.Namespace
+	pods               []corev1.Pod
+	daemonSets         []appsv1.DaemonSet
+	mutatingWebhooks   []admissionregistrationv1.MutatingWebhookConfiguration
+	validatingWebhooks []admissionregistrationv1.ValidatingWebhookConfiguration
+	// monitors of every namespace by kind, and whether the kind can be read
+	monitors   map[string][]monitor
+	monitoring map[string]bool
+}
+
+// clusterLists returns the cache of the cluster-wide lists of the run
+func (rm *ResourceMapper) clusterLists() *clusterCache {
+	if rm.clusterCache == nil {
+		rm.clusterCache = &clusterCache{}
+	}
+	return rm.clusterCache
+}
+
+// cacheFor returns the cache of a namespace, dropping the cached objects of
+// the previous one. With watches, the watched types start out filled
+func (rm *ResourceMapper) cacheFor(namespace string) *processorCache {
+	return rm.cacheIn(rm.ctx, namespace)
+}
+
+// cacheIn returns the cache of a namespace as cacheFor does, a new cache
+// listing its objects with ctx, such as the context of the span of a step
+func (rm *ResourceMapper) cacheIn(ctx context.Context, namespace string) *processorCache {
+	if rm.cache == nil || rm.cache.namespace != namespace {
+		rm.cache = &processorCache{namespace: namespace, ctx: ctx}
+		rm.forgetTruncations(namespace)
+		if rm.watcher != nil {
+			rm.watcher.fill(rm, rm.cache)
+		}
+	}
+	return rm.cache
+}
+
+// cachedList returns the objects held in a field of the cache, filling it
+// with the list function on first use. Empty lists are cached as empty
+// slices, so that only nil means not listed yet. Types the identity is
+// denied are not listed, and mapped as empty
+func cachedList[T any](cached *[]T, what string, denied bool, list func() ([]T, error)) ([]T, error) {
+	if *cached == nil && denied {
+		*cached = []T{}
+	}
+	if *cached == nil {
+		items, err := list()
+		if err != nil {
+			return nil, fmt.Errorf("error getting %s: %v", what, err)
+		}
+		if items == nil {
+			items = []T{}
+		}
+		*cached = items
+	}
+	return *cached, nil
+}
+
+// listServices returns the services of a namespace, listing them on first use
+func (rm *ResourceMapper) listServices(namespace string) ([]corev1.Service, error) {
+	cache := rm.cacheFor(namespace)
+	return cachedList(&cache.services, "services", rm.skipped(namespace, "services"), func() ([]corev1.Service, error) {
+		return pagedList(rm, namespace, "services", func(opts metav1.ListOptions) ([]corev1.Service, metav1.ListInterface, error) {
+			list, err := rm.clientset.CoreV1().Services(namespace).List(cache.ctx, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			return list.Items, list, nil
+		})
+	})
+}
+
+// listIngresses returns the ingresses of a namespace, listing them on first use
+func (rm *ResourceMapper) listIngresses(namespace string) ([]networkingv1.Ingress, error) {
+	cache := rm.cacheFor(namespace)
+	return cachedList(&cache.ingresses, "ingresses", rm.skipped(namespace, "ingresses"), func() ([]networkingv1.Ingress, error) {
+		return pagedList(rm, namespace, "ingresses", func(opts metav1.ListOptions) ([]networkingv1.Ingress, metav1.ListInterface, error) {
+			list, err := rm.clientset.NetworkingV1().Ingresses(namespace).List(cache.ctx, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			return list.Items, list, nil
+		})
+	})
+}
+
+// listDeployments returns the deployments of a namespace, listing them on
+// first use
+func (rm *ResourceMapper) listDeployments(namespace string) ([]appsv1.Deployment, error) {
+	cache := rm.cacheFor(namespace)
+	return cachedList(&cache.deployments, "deployments", rm.skipped(namespace, "deployments"), func() ([]appsv1.Deployment, error) {
+		return pagedList(rm, namespace, "deployments", func(opts metav1.ListOptions) ([]appsv1.Deployment, metav1.ListInterface, error) {
+			list, err := rm.clientset.AppsV1().Deployments(namespace).List(cache.ctx, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			return list.Items, list, nil
+		})
+	})
+}
+
+// listStatefulSets returns the statefulsets of a namespace, listing them on
+// first use
+func (rm *ResourceMapper) listStatefulSets(namespace string) ([]appsv1.StatefulSet, error) {
+	cache := rm.cacheFor(namespace)
+	return cachedList(&cache.statefulSets, "statefulsets", rm.skipped(namespace, "statefulsets"), func() ([]appsv1.StatefulSet, error) {
+		return pagedList(rm, namespace, "statefulsets", func(opts metav1.ListOptions) ([]appsv1.StatefulSet, metav1.ListInterface, error) {
+			list, err := rm.clientset.AppsV1().StatefulSets(namespace).List(cache.ctx, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			return list.Items, list, nil
+		})
+	})
+}
+
+// listDaemonSets returns the daemonsets of a namespace, listing them on first
+// use
+func (rm *ResourceMapper) listDaemonSets(namespace string) ([]appsv1.DaemonSet, error) {
+	cache := rm.cacheFor(namespace)
+	return cachedList(&cache.daemonSets, "daemonsets", rm.skipped(namespace, "daemonsets"), func() ([]appsv1.DaemonSet, error) {
+		return pagedList(rm, namespace, "daemonsets", func(opts metav1.ListOptions) ([]appsv1.DaemonSet, metav1.ListInterface, error) {
+			list, err := rm.clientset.AppsV1().DaemonSets(namespace).List(cache.ctx, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			return list.Items, list, nil
+		})
+	})
+}
+
+// listHPAs returns the horizontal pod autoscalers of a namespace, listing
+// them on first use
+func (rm *ResourceMapper) listHPAs(namespace string) ([]autoscalingv2.HorizontalPodAutoscaler, error) {
+	cache := rm.cacheFor(namespace)
+	return cachedList(&cache.hpas, "HPAs", rm.skipped(namespace, "HPAs"), func() ([]autoscalingv2.HorizontalPodAutoscaler, error) {
+		return pagedList(rm, namespace, "HPAs", func(opts metav1.ListOptions) ([]autoscalingv2.HorizontalPodAutoscaler, metav1.ListInterface, error) {
+			if rm.apiVersion("HPAs") == "v2beta2" {
+				list, err := rm.clientset.AutoscalingV2beta2().HorizontalPodAutoscalers(namespace).List(cache.ctx, opts)
+				if err != nil {
+					return nil, nil, err
+				}
+				hpas, err := hpasFromV2beta2(list.Items)
+				return hpas, list, err
+			}
+			list, err := rm.clientset.AutoscalingV2().HorizontalPodAutoscalers(namespace).List(cache.ctx, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			return list.Items, list, nil
+		})
+	})
+}
+
+// listJobs returns the jobs of a namespace, listing them on first use
+func (rm *ResourceMapper) listJobs(namespace string) ([]batchv1.Job, error) {
+	cache := rm.cacheFor(namespace)
+	return cachedList(&cache.jobs, "jobs", rm.skipped(namespace, "jobs"), func() ([]batchv1.Job, error) {
+		return pagedList(rm, namespace, "jobs", func(opts metav1.ListOptions) ([]batchv1.Job, metav1.ListInterface, error) {
+			list, err := rm.clientset.BatchV1().Jobs(namespace).List(cache.ctx, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			return list.Items, list, nil
+		})
+	})
+}
+
+// listCronJobs returns the cronjobs of a namespace, listing them on first use
+func (rm *ResourceMapper) listCronJobs(namespace string) ([]batchv1.CronJob, error) {
+	cache := rm.cacheFor(namespace)
+	return cachedList(&cache.cronJobs, "cronjobs", rm.skipped(namespace, "cronjobs"), func() ([]batchv1.CronJob, error) {
+		return pagedList(rm, namespace, "cronjobs", func(opts metav1.ListOptions) ([]batchv1.CronJob, metav1.ListInterface, error) {
+			list, err := rm.clientset.BatchV1().CronJobs(namespace).List(cache.ctx, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			return list.Items, list, nil
+		})
+	})
+}
+
+// listConfigMaps returns the configmaps of a namespace, listing them on first
+// use
+func (rm *ResourceMapper) listConfigMaps(namespace string) ([]corev1.ConfigMap, error) {
+	cache := rm.cacheFor(namespace)
+	return cachedList(&cache.configMaps, "configmaps", rm.skipped(namespace, "configmaps"), func() ([]corev1.ConfigMap, error) {
+		return pagedList(rm, namespace, "configmaps", func(opts metav1.ListOptions) ([]corev1.ConfigMap, metav1.ListInterface, error) {
+			list, err := rm.clientset.CoreV1().ConfigMaps(namespace).List(cache.ctx, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			return list.Items, list, nil
+		})
+	})
+}
+
+// listEndpoints returns the Endpoints objects of a namespace, listing them on
+// first use
+func (rm *ResourceMapper) listEndpoints(namespace string) ([]corev1.Endpoints, error) {
+	cache := rm.cacheFor(namespace)
+	return cachedList(&cache.endpoints, "endpoints", rm.skipped(namespace, "endpoints"), func() ([]corev1.Endpoints, error) {
+		return pagedList(rm, namespace, "endpoints", func(opts metav1.ListOptions) ([]corev1.Endpoints, metav1.ListInterface, error) {
+			list, err := rm.clientset.CoreV1().Endpoints(namespace).List(cache.ctx, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			return list.Items, list, nil
+		})
+	})
+}
+
+// listEndpointSlices returns the endpoint slices of a namespace, listing them
+// on first use
+func (rm *ResourceMapper) listEndpointSlices(namespace string) ([]discoveryv1.EndpointSlice, error) {
+	cache := rm.cacheFor(namespace)
+	return cachedList(&cache.endpointSlices, "endpoint slices", rm.skipped(namespace, "endpoint slices"), func() ([]discoveryv1.EndpointSlice, error) {
+		return pagedList(rm, namespace, "endpoint slices", func(opts metav1.ListOptions) ([]discoveryv1.EndpointSlice, metav1.ListInterface, error) {
+			list, err := rm.clientset.DiscoveryV1().EndpointSlices(namespace).List(cache.ctx, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			return list.Items, list, nil
+		})
+	})
+}
+
+// listPDBs returns the pod disruption budgets of a namespace, listing them on
+// first use
+func (rm *ResourceMapper) listPDBs(namespace string) ([]policyv1.PodDisruptionBudget, error) {
+	cache := rm.cacheFor(namespace)
+	return cachedList(&cache.pdbs, "pod disruption budgets", rm.skipped(namespace, "pod disruption budgets"), func() ([]policyv1.PodDisruptionBudget, error) {
+		return pagedList(rm, namespace, "pod disruption budgets", func(opts metav1.ListOptions) ([]policyv1.PodDisruptionBudget, metav1.ListInterface, error) {
+			list, err := rm.clientset.PolicyV1().PodDisruptionBudgets(namespace).List(cache.ctx, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			return list.Items, list, nil
+		})
+	})
+}
+
+// listSecrets returns the secrets of a namespace, listing them on first use,
+// and whether they may be listed: identities without access to secrets still
+// map the rest of the namespace
+func (rm *ResourceMapper) listSecrets(namespace string) ([]corev1.Secret, bool, error) {
+	cache := rm.cacheFor(namespace)
+	if !cache.secretsListed && rm.skipped(namespace, "secrets") {
+		cache.secretsListed = true
+	}
+	if !cache.secretsListed {
+		secrets, err := pagedList(rm, namespace, "secrets", func(opts metav1.ListOptions) ([]corev1.Secret, metav1.ListInterface, error) {
+			list, err := rm.clientset.CoreV1().Secrets(namespace).List(cache.ctx, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			return list.Items, list, nil
+		})
+		switch {
+		case apierrors.IsForbidden(err):
+		case err != nil:
+			return nil, false, fmt.Errorf("error getting secrets: %v", err)
+		default:
+			cache.secrets = secrets
+			cache.secretsAllowed = true
+		}
+		cache.secretsListed = true
+	}
+	return cache.secrets, cache.secretsAllowed, nil
+}
+
+// listSecretNames returns the names of the secrets of a namespace, listing
+// their metadata only on first use so that their data is not fetched, and
+// whether they may be listed. Without a metadata client the secrets are
+// listed in full
+func (rm *ResourceMapper) listSecretNames(namespace string) (map[string]bool, bool, error) {
+	cache := rm.cacheFor(namespace)
+	if cache.secretNames == nil && (rm.metadata == nil || cache.secretsListed || rm.skipped(namespace, "secrets")) {
+		secrets, allowed, err := rm.listSecrets(namespace)
+		if err != nil {
+			return nil, false, err
+		}
+		names := map[string]bool{}
+		for _, secret := range secrets {
+			names[secret.Name] = true
+		}
+		cache.secretNames, cache.secretNamesAllowed = names, allowed
+	}
+	if cache.secretNames == nil {
+		secrets := corev1.SchemeGroupVersion.WithResource("secrets")
+		items, err := pagedList(rm, namespace, "secrets", func(opts metav1.ListOptions) ([]metav1.PartialObjectMetadata, metav1.ListInterface, error) {
+			list, err := rm.metadata.Resource(secrets).Namespace(namespace).List(cache.ctx, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			return list.Items, list, nil
+		})
+		names := map[string]bool{}
+		switch {
+		case apierrors.IsForbidden(err):
+		case err != nil:
+			return nil, false, fmt.Errorf("error getting secrets: %v", err)
+		default:
+			for _, item := range items {
+				names[item.Name] = true
+			}
+			cache.secretNamesAllowed = true
+		}
+		cache.secretNames = names
+	}
+	return cache.secretNames, cache.secretNamesAllowed, nil
+}
+
+// listPods returns the pods of a namespace, listing them on first use.
+// Completed pods are left out when completed work is hidden
+func (rm *ResourceMapper) listPods(namespace string) ([]corev1.Pod, error) {
+	cache := rm.cacheFor(namespace)
+	if cache.pods == nil && rm.skipped(namespace, "pods") {
+		cache.pods = []corev1.Pod{}
+	}
+	if cache.pods == nil {
+		pods, err := pagedList(rm, namespace, "pods", func(opts metav1.ListOptions) ([]corev1.Pod, metav1.ListInterface, error) {
+			list, err := rm.clientset.CoreV1().Pods(namespace).List(cache.ctx, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			return list.Items, list, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error getting pods: %v", err)
+		}
+		cache.pods = pods
+		if rm.hideCompleted {
+			cache.pods = withoutCompletedPods(cache.pods)
+		}
+		if cache.pods == nil {
+			cache.pods = []corev1.Pod{}
+		}
+	}
+	return cache.pods, nil
+}
+
+// podIndexFor returns the label index of the pods of a namespace
+func (rm *ResourceMapper) podIndexFor(namespace string) (*podIndex, error) {
+	pods, err := rm.listPods(namespace)
+	if err != nil {
+		return nil, err
+	}
+	cache := rm.cacheFor(namespace)
+	if cache.podIndex == nil {
+		cache.podIndex = newPodIndex(pods)
+	}
+	return cache.podIndex, nil
+}
+
+// podRevisionsFor returns the deployment revisions of the namespace
+func (rm *ResourceMapper) podRevisionsFor(namespace string) (podRevisions, error) {
+	cache := rm.cacheFor(namespace)
+	if cache.revisions == nil && rm.skipped(namespace, "replicasets") {
+		cache.revisions = &podRevisions{}
+	}
+	if cache.revisions == nil {
+		replicaSets, err := pagedList(rm, namespace, "replicasets", func(opts metav1.ListOptions) ([]appsv1.ReplicaSet, metav1.ListInterface, error) {
+			list, err := rm.clientset.AppsV1().ReplicaSets(namespace).List(cache.ctx, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			return list.Items, list, nil
+		})
+		if err != nil {
+			return podRevisions{}, fmt.Errorf("error getting replicasets: %v", err)
+		}
+		revisions := revisionsByHash(replicaSets)
+		cache.revisions = &revisions
+	}
+	return *cache.revisions, nil
+}
+
+// listNodes returns the nodes of the cluster, listing them on first use
+func (rm *ResourceMapper) listNodes() ([]corev1.Node, error) {
+	return cachedList(&rm.clusterLists().nodes, "nodes", false, func() ([]corev1.Node, error) {
+		return pagedList(rm, metav1.NamespaceAll, "nodes", func(opts metav1.ListOptions) ([]corev1.Node, metav1.ListInterface, error) {
+			list, err := rm.clientset.CoreV1().Nodes().List(rm.ctx, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			return list.Items, list, nil
+		})
+	})
+}
+
+// listNamespaces returns the namespaces of the cluster, listing them on
+// first use
+func (rm *ResourceMapper) listNamespaces() ([]corev1.Namespace, error) {
+	return cachedList(&rm.clusterLists().namespaces, "namespaces", false, func() ([]corev1.Namespace, error) {
+		return pagedList(rm, metav1.NamespaceAll, "namespaces", func(opts metav1.ListOptions) ([]corev1.Namespace, metav1.ListInterface, error) {
+			list, err := rm.clientset.CoreV1().Namespaces().List(rm.ctx, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			return list.Items, list, nil
+		})
+	})
+}
+
+// listAllPods returns the pods of every namespace, listing them on first
+// use. Completed pods are left out when completed work is hidden
+func (rm *ResourceMapper) listAllPods() ([]corev1.Pod, error) {
+	return cachedList(&rm.clusterLists().pods, "pods", false, func() ([]corev1.Pod, error) {
+		pods, err := pagedList(rm, metav1.NamespaceAll, "pods", func(opts metav1.ListOptions) ([]corev1.Pod, metav1.ListInterface, error) {
+			list, err := rm.clientset.CoreV1().Pods(metav1.NamespaceAll).List(rm.ctx, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			return list.Items, list, nil
+		})
+		if err != nil || !rm.hideCompleted {
+			return pods, err
+		}
+		return withoutCompletedPods(pods), nil
+	})
+}
+
+// listAllDaemonSets returns the daemonsets of every namespace, listing them
+// on first use
+func (rm *ResourceMapper) listAllDaemonSets() ([]appsv1.DaemonSet, error) {
+	return cachedList(&rm.clusterLists().daemonSets, "daemonsets", !rm.enabled("daemonsets") || !rm.served("daemonsets"), func() ([]appsv1.DaemonSet, error) {
+		return pagedList(rm, metav1.NamespaceAll, "daemonsets", func(opts metav1.ListOptions) ([]appsv1.DaemonSet, metav1.ListInterface, error) {
+			list, err := rm.clientset.AppsV1().DaemonSets(metav1.NamespaceAll).List(rm.ctx, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			return list.Items, list, nil
+		})
+	})
+}
+
+// listMutatingWebhooks returns the mutating webhook configurations, none on
+// clusters not serving admissionregistration.k8s.io/v1
+func (rm *ResourceMapper) listMutatingWebhooks() ([]admissionregistrationv1.MutatingWebhookConfiguration, error) {
+	what := "mutating webhook configurations"
+	return cachedList(&rm.clusterLists().mutatingWebhooks, what, !rm.served(what), func() ([]admissionregistrationv1.MutatingWebhookConfiguration, error) {
+		return pagedList(rm, metav1.NamespaceAll, what, func(opts metav1.ListOptions) ([]admissionregistrationv1.MutatingWebhookConfiguration, metav1.ListInterface, error) {
+			list, err := rm.clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().List(rm.ctx, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			return list.Items, list, nil
+		})
+	})
+}
+
+// listValidatingWebhooks returns the validating webhook configurations, none
+// on clusters not serving admissionregistration.k8s.io/v1
+func (rm *ResourceMapper) listValidatingWebhooks() ([]admissionregistrationv1.ValidatingWebhookConfiguration, error) {
+	what := "validating webhook configurations"
+	return cachedList(&rm.clusterLists().validatingWebhooks, what, !rm.served(what), func() ([]admissionregistrationv1.ValidatingWebhookConfiguration, error) {
+		return pagedList(rm, metav1.NamespaceAll, what, func(opts metav1.ListOptions) ([]admissionregistrationv1.ValidatingWebhookConfiguration, metav1.ListInterface, error) {
+			list, err := rm.clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations().List(rm.ctx, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			return list.Items, list, nil
+		})
+	})
+}
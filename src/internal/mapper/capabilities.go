@@ -0,0 +1,212 @@
+package mapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// clusterTypes are the built-in types read beyond the namespaced ones of
+// accessChecks
+var clusterTypes = []accessCheck{
+	{"mutating webhook configurations", "admissionregistration.k8s.io", "mutatingwebhookconfigurations"},
+	{"validating webhook configurations", "admissionregistration.k8s.io", "validatingwebhookconfigurations"},
+}
+
+// operatorTypes are the custom resource types of the Prometheus Operator,
+// which most clusters do not have, so their absence is not reported
+var operatorTypes = []accessCheck{
+	{"ServiceMonitors", "monitoring.coreos.com", "servicemonitors"},
+	{"PodMonitors", "monitoring.coreos.com", "podmonitors"},
+	{"PrometheusRules", "monitoring.coreos.com", "prometheusrules"},
+}
+
+// typeVersions are the versions the mapper reads a type in, by preference.
+// Types missing are read in v1. HPAs are read in autoscaling/v2beta2 on
+// clusters older than 1.23, converted to v2
+var typeVersions = map[string][]string{
+	"HPAs": {"v2", "v2beta2"},
+}
+
+// apiCapabilities are the versions of the types the mapper reads that the
+// cluster serves, discovered once per mapper, so that older or stripped-down
+// clusters skip what they lack instead of failing on it
+type apiCapabilities struct {
+	once sync.Once
+	// versions holds the version each type is read in, "" when the cluster
+	// does not serve it
+	versions map[string]string
+	// calls is the number of discovery calls made
+	calls int
+}
+
+// builtinTypes returns the built-in types the mapper reads
+func builtinTypes() []accessCheck {
+	return append(append([]accessCheck{}, accessChecks...), clusterTypes...)
+}
+
+// versionsOf returns the versions a type may be read in, by preference
+func versionsOf(what string) []string {
+	if versions, ok := typeVersions[what]; ok {
+		return versions
+	}
+	return []string{"v1"}
+}
+
+// discover finds which group versions the cluster serves, then the types
+// served in those the mapper reads. Discovery failing leaves every type in
+// its preferred version, as without discovery. The types skipped or read in
+// an older version are reported on stderr so as not to corrupt JSON outputs
+func (rm *ResourceMapper) discover() {
+	c := rm.capabilities
+	c.versions = map[string]string{}
+	types := append(builtinTypes(), operatorTypes...)
+	for _, t := range types {
+		c.versions[t.what] = versionsOf(t.what)[0]
+	}
+	groups, err := rm.clientset.Discovery().ServerGroups()
+	c.calls = 2
+	if err == nil && len(groups.Groups) == 0 {
+		// Proxies answering anything with an empty list serve no core group
+		err = fmt.Errorf("no API group served")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s[discovery] Cannot discover the APIs of the cluster, reading every type: %v%s\n", colorYellow, err, colorReset)
+		return
+	}
+	servedVersions := map[string]bool{}
+	for _, group := range groups.Groups {
+		for _, version := range group.Versions {
+			servedVersions[version.GroupVersion] = true
+		}
+	}
+
+	// Resources are fetched only for the group versions read, once each
+	resources := map[string]map[string]bool{}
+	served := func(group, version, resource string) bool {
+		gv := schema.GroupVersion{Group: group, Version: version}.String()
+		if !servedVersions[gv] {
+			return false
+		}
+		if _, ok := resources[gv]; !ok {
+			list, err := rm.clientset.Discovery().ServerResourcesForGroupVersion(gv)
+			c.calls++
+			if err != nil {
+				// Unknown, so read as if served
+				resources[gv] = nil
+			} else {
+				resources[gv] = map[string]bool{}
+				for _, res := range list.APIResources {
+					resources[gv][res.Name] = true
+				}
+			}
+		}
+		return resources[gv] == nil || resources[gv][resource]
+	}
+
+	for _, t := range types {
+		c.versions[t.what] = ""
+		for _, version := range versionsOf(t.what) {
+			if served(t.group, version, t.resource) {
+				c.versions[t.what] = version
+				break
+			}
+		}
+	}
+	skipped, older := c.unserved()
+	if len(skipped) > 0 {
+		fmt.Fprintf(os.Stderr, "%s[discovery] Skipping %s: not served by the cluster%s\n", colorYellow, strings.Join(skipped, ", "), colorReset)
+	}
+	if len(older) > 0 {
+		fmt.Fprintf(os.Stderr, "%s[discovery] Reading %s, as the cluster does not serve newer versions%s\n", colorYellow, strings.Join(older, ", "), colorReset)
+	}
+}
+
+// unserved returns the built-in types the cluster does not serve, and those
+// read in an older version than preferred, with their version
+func (c *apiCapabilities) unserved() (skipped, older []string) {
+	for _, t := range builtinTypes() {
+		switch version := c.versions[t.what]; {
+		case version == "":
+			skipped = append(skipped, t.what)
+		case version != versionsOf(t.what)[0]:
+			older = append(older, t.what+" in "+t.group+"/"+version)
+		}
+	}
+	return skipped, older
+}
+
+// apiVersion returns the version a type is read in, "" when the cluster does
+// not serve it. Mappers without discovery, such as those of manifests, read
+// every type in its preferred version
+func (rm *ResourceMapper) apiVersion(what string) string {
+	if rm.capabilities == nil {
+		return versionsOf(what)[0]
+	}
+	rm.capabilities.once.Do(rm.discover)
+	return rm.capabilities.versions[what]
+}
+
+// served reports whether the cluster serves a type in a version the mapper
+// reads
+func (rm *ResourceMapper) served(what string) bool {
+	return rm.apiVersion(what) != ""
+}
+
+// skipped reports whether a type is not listed in a namespace, as it is
+// disabled, the cluster does not serve it or the identity may not list it
+func (rm *ResourceMapper) skipped(namespace, what string) bool {
+	return !rm.enabled(what) || !rm.served(what) || rm.denied(namespace, what)
+}
+
+// unservedTypes returns the built-in types the cluster does not serve, and
+// those read in an older version than preferred, none without discovery
+func (rm *ResourceMapper) unservedTypes() (skipped, older []string) {
+	if rm.capabilities == nil {
+		return nil, nil
+	}
+	rm.capabilities.once.Do(rm.discover)
+	return rm.capabilities.unserved()
+}
+
+// capabilitySummary describes the discovered capabilities for --estimate
+func (rm *ResourceMapper) capabilitySummary() string {
+	skipped, older := rm.unservedTypes()
+	parts := []string{}
+	if len(skipped) > 0 {
+		parts = append(parts, "not served: "+strings.Join(skipped, ", "))
+	}
+	if len(older) > 0 {
+		parts = append(parts, "read in older versions: "+strings.Join(older, ", "))
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "every built-in type served")
+	}
+	if rm.served("ServiceMonitors") || rm.served("PodMonitors") || rm.served("PrometheusRules") {
+		parts = append(parts, "Prometheus Operator installed")
+	}
+	return strings.Join(parts, "; ")
+}
+
+// hpasFromV2beta2 converts autoscaling/v2beta2 HPAs to v2, whose fields are
+// the same
+func hpasFromV2beta2(items []autoscalingv2beta2.HorizontalPodAutoscaler) ([]autoscalingv2.HorizontalPodAutoscaler, error) {
+	data, err := json.Marshal(items)
+	if err != nil {
+		return nil, fmt.Errorf("error converting HPAs: %v", err)
+	}
+	var hpas []autoscalingv2.HorizontalPodAutoscaler
+	if err := json.Unmarshal(data, &hpas); err != nil {
+		return nil, fmt.Errorf("error converting HPAs: %v", err)
+	}
+	for i := range hpas {
+		hpas[i].APIVersion = autoscalingv2.SchemeGroupVersion.String()
+	}
+	return hpas, nil
+}
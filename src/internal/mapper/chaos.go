@@ -0,0 +1,227 @@
+package mapper
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// Chaos experiment formats
+const (
+	chaosMesh   = "chaos-mesh"
+	litmusChaos = "litmus"
+)
+
+// minChaosPods is the fewest replicas a workload needs to keep serving while
+// a pod is killed
+const minChaosPods = 2
+
+// chaosTarget is a workload that can lose a pod without an outage
+type chaosTarget struct {
+	Namespace string
+	Name      string
+	Replicas  int32
+	// Selector selects the pods of the workload
+	Selector map[string]string
+	// PDB is the PodDisruptionBudget protecting the workload
+	PDB string
+}
+
+// chaosCandidates picks the deployments of a namespace fit for fault
+// injection: stateless, with several replicas all ready, and protected by a
+// PodDisruptionBudget that currently allows a disruption. Rejected
+// deployments are returned with the reason
+func chaosCandidates(deployments []appsv1.Deployment, pdbs []policyv1.PodDisruptionBudget) ([]chaosTarget, map[string]string) {
+	targets := []chaosTarget{}
+	rejected := map[string]string{}
+	for _, deploy := range deployments {
+		replicas := int32(1)
+		if deploy.Spec.Replicas != nil {
+			replicas = *deploy.Spec.Replicas
+		}
+		if claims := persistentVolumeClaims(&deploy); len(claims) > 0 {
+			rejected[deploy.Name] = "stateful: mounts " + strings.Join(claims, ", ")
+			continue
+		}
+		if replicas < minChaosPods {
+			rejected[deploy.Name] = fmt.Sprintf("%d replica(s)", replicas)
+			continue
+		}
+		if deploy.Status.ReadyReplicas < replicas {
+			rejected[deploy.Name] = fmt.Sprintf("unhealthy: %d/%d ready", deploy.Status.ReadyReplicas, replicas)
+			continue
+		}
+		// Chaos tools select pods by labels, so expression selectors are out
+		if deploy.Spec.Selector == nil || len(deploy.Spec.Selector.MatchExpressions) > 0 {
+			rejected[deploy.Name] = "selector cannot be expressed as labels"
+			continue
+		}
+		pdb := protectingPDB(deploy.Spec.Template.Labels, pdbs)
+		if pdb == nil {
+			rejected[deploy.Name] = "no PodDisruptionBudget"
+			continue
+		}
+		if pdb.Status.DisruptionsAllowed < 1 {
+			rejected[deploy.Name] = fmt.Sprintf("PodDisruptionBudget %s allows no disruption", pdb.Name)
+			continue
+		}
+		targets = append(targets, chaosTarget{
+			Namespace: deploy.Namespace,
+			Name:      deploy.Name,
+			Replicas:  replicas,
+			Selector:  deploy.Spec.Selector.MatchLabels,
+			PDB:       pdb.Name,
+		})
+	}
+	return targets, rejected
+}
+
+// persistentVolumeClaims returns the claims mounted by a deployment's pods
+func persistentVolumeClaims(deploy *appsv1.Deployment) []string {
+	claims := []string{}
+	for _, volume := range deploy.Spec.Template.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil {
+			claims = append(claims, volume.PersistentVolumeClaim.ClaimName)
+		}
+	}
+	return claims
+}
+
+// protectingPDB returns the PodDisruptionBudget whose selector matches a pod
+// template, if any
+func protectingPDB(podLabels map[string]string, pdbs []policyv1.PodDisruptionBudget) *policyv1.PodDisruptionBudget {
+	for i := range pdbs {
+		selector, err := metav1.LabelSelectorAsSelector(pdbs[i].Spec.Selector)
+		if err != nil || selector.Empty() {
+			continue
+		}
+		if selector.Matches(labels.Set(podLabels)) {
+			return &pdbs[i]
+		}
+	}
+	return nil
+}
+
+// chaosExperiment returns the pod kill experiment of a target in a format
+func chaosExperiment(target chaosTarget, format string) map[string]interface{} {
+	if format == litmusChaos {
+		return map[string]interface{}{
+			"apiVersion": "litmuschaos.io/v1alpha1",
+			"kind":       "ChaosEngine",
+			"metadata":   map[string]interface{}{"name": target.Name + "-pod-delete", "namespace": target.Namespace},
+			"spec": map[string]interface{}{
+				"engineState": "active",
+				"appinfo": map[string]interface{}{
+					"appns":    target.Namespace,
+					"applabel": labels.Set(target.Selector).String(),
+					"appkind":  "deployment",
+				},
+				"chaosServiceAccount": "pod-delete-sa",
+				"experiments":         []interface{}{map[string]interface{}{"name": "pod-delete"}},
+			},
+		}
+	}
+	return map[string]interface{}{
+		"apiVersion": "chaos-mesh.org/v1alpha1",
+		"kind":       "PodChaos",
+		"metadata":   map[string]interface{}{"name": target.Name + "-pod-kill", "namespace": target.Namespace},
+		"spec": map[string]interface{}{
+			"action": "pod-kill",
+			"mode":   "one",
+			"selector": map[string]interface{}{
+				"namespaces":     []string{target.Namespace},
+				"labelSelectors": target.Selector,
+			},
+		},
+	}
+}
+
+// chaosManifests renders the experiments of targets as a multi-document YAML
+func chaosManifests(targets []chaosTarget, format string) ([]byte, error) {
+	docs := []string{}
+	for _, target := range targets {
+		data, err := yaml.Marshal(chaosExperiment(target, format))
+		if err != nil {
+			return nil, fmt.Errorf("error encoding experiment for %s/%s: %v", target.Namespace, target.Name, err)
+		}
+		docs = append(docs, string(data))
+	}
+	return []byte(strings.Join(docs, "---\n")), nil
+}
+
+// runChaos runs the chaos subcommand: exports pod kill experiments for the
+// workloads that can lose a pod safely
+func runChaos(args []string) error {
+	var global globalFlags
+	fs := newSubcommandFlagSet("chaos", &global)
+	format := fs.String("format", chaosMesh, "Experiment format: chaos-mesh (PodChaos) or litmus (ChaosEngine)")
+	output := fs.String("output", "chaos-targets.yaml", "File the experiments are written to, - for stdout")
+	fs.Parse(args)
+
+	if *format != chaosMesh && *format != litmusChaos {
+		return fmt.Errorf("invalid --format value '%s' (expected %s or %s)", *format, chaosMesh, litmusChaos)
+	}
+	rm, err := global.newResourceMapper()
+	if err != nil {
+		return err
+	}
+	namespaces, err := global.namespaces(rm)
+	if err != nil {
+		return err
+	}
+
+	// With the experiments on stdout, the summary is left out
+	quiet := *output == "-"
+	var targets []chaosTarget
+	for _, ns := range namespaces {
+		deployments, err := rm.listDeployments(ns)
+		if err != nil {
+			return err
+		}
+		pdbs, err := rm.listPDBs(ns)
+		if err != nil {
+			return err
+		}
+		nsTargets, rejected := chaosCandidates(deployments, pdbs)
+		targets = append(targets, nsTargets...)
+		if quiet || len(deployments) == 0 {
+			continue
+		}
+
+		lines := []string{}
+		for _, target := range nsTargets {
+			lines = append(lines, fmt.Sprintf("%s%s%s (%d replicas, PDB %s)", colorGreen, target.Name, colorReset, target.Replicas, target.PDB))
+		}
+		for _, name := range sortedKeys(rejected) {
+			lines = append(lines, fmt.Sprintf("%s %s skipped: %s", name, rm.createArrow(4), rejected[name]))
+		}
+		fmt.Printf("\n%sChaos targets in namespace: %s%s\n", colorCyan, ns, colorReset)
+		for i, line := range lines {
+			branch := sym("├──")
+			if i == len(lines)-1 {
+				branch = sym("└──")
+			}
+			fmt.Printf("%s %s\n", branch, line)
+		}
+	}
+
+	data, err := chaosManifests(targets, *format)
+	if err != nil {
+		return err
+	}
+	if quiet {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := writeFile(*output, data); err != nil {
+		return err
+	}
+	fmt.Printf("\n%s%d %s experiment(s) written to %s%s\n", colorGreen, len(targets), *format, *output, colorReset)
+	return nil
+}
@@ -0,0 +1,242 @@
+package mapper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// checkpoint records the progress of a mapping run so that an interrupted
+// run can be resumed with --resume instead of starting over. It is kept in
+// the snapshot store of the cluster, with the result of each namespace
+// mapped so that the resumed run replays them
+type checkpoint struct {
+	Cluster    string   `json:"cluster"`
+	Namespaces []string `json:"namespaces"`
+	// Options digests the flags shaping what the run maps, which the
+	// resumed run must share
+	Options   string    `json:"options"`
+	Completed []string  `json:"completed"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	path string
+}
+
+// checkpointResult is what a namespace of a checkpointed run produced
+type checkpointResult struct {
+	Graph    *Graph    `json:"graph"`
+	Findings []Finding `json:"findings,omitempty"`
+}
+
+// checkpointNeutralFlags change how a run proceeds but not what it maps, so
+// a run may be resumed with other values. Graphs are kept in the checkpoint
+// whatever the flags, so a resumed run may also record them in the history
+var checkpointNeutralFlags = map[string]bool{
+	"resume": true, "checkpoint": true, "timeout": true, "h": true, "help": true, "color": true, "symbols": true,
+	"config": true, "profile": true, "concurrency": true, "qps": true, "burst": true,
+	"adaptive-rate-limit": true, "request-timeout": true, "retries": true, "protobuf": true,
+	"trace-file": true, "otlp-endpoint": true, "history": true,
+}
+
+// optionsDigest digests the flags of a run that shape what it maps
+func optionsDigest(fs *flag.FlagSet) string {
+	h := sha256.New()
+	fs.VisitAll(func(f *flag.Flag) {
+		if !checkpointNeutralFlags[f.Name] {
+			fmt.Fprintf(h, "%s=%s\n", f.Name, f.Value.String())
+		}
+	})
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// stateDir returns the directory holding the mapper's local state
+func stateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "k8s-resource-mapper"), nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting home directory: %v", err)
+	}
+	return filepath.Join(homeDir, ".k8s-resource-mapper"), nil
+}
+
+// clusterFileName turns a cluster API server address into a safe file name
+func clusterFileName(cluster string) string {
+	name := strings.TrimPrefix(strings.TrimPrefix(cluster, "https://"), "http://")
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		}
+		return '_'
+	}, name)
+	if name == "" {
+		name = "default"
+	}
+	return name
+}
+
+// newCheckpoint creates an empty checkpoint for the given cluster,
+// namespaces and options
+func newCheckpoint(cluster string, namespaces []string, options string) (*checkpoint, error) {
+	store, err := openSnapshotStore(cluster)
+	if err != nil {
+		return nil, err
+	}
+	return &checkpoint{
+		Cluster:    cluster,
+		Namespaces: namespaces,
+		Options:    options,
+		path:       filepath.Join(store.dir, "checkpoint.json"),
+	}, nil
+}
+
+// loadCheckpoint reads the checkpoint of a previous run against the cluster.
+// It returns nil without error when no checkpoint exists.
+func loadCheckpoint(cluster string) (*checkpoint, error) {
+	cp, err := newCheckpoint(cluster, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(cp.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading checkpoint: %v", err)
+	}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("error parsing checkpoint %s: %v", cp.path, err)
+	}
+	if cp.Cluster != cluster {
+		return nil, nil
+	}
+	return cp, nil
+}
+
+// mismatch tells why a run with the given namespaces and options cannot
+// resume from the checkpoint, empty when it can
+func (cp *checkpoint) mismatch(namespaces []string, options string) string {
+	if cp.Options != options {
+		return "the options differ"
+	}
+	saved, current := slices.Clone(cp.Namespaces), slices.Clone(namespaces)
+	slices.Sort(saved)
+	slices.Sort(current)
+	if !slices.Equal(saved, current) {
+		return "the namespaces selected differ"
+	}
+	return ""
+}
+
+// isCompleted reports whether a namespace was already mapped
+func (cp *checkpoint) isCompleted(namespace string) bool {
+	for _, ns := range cp.Completed {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// resultPath returns the file holding the result of a namespace
+func (cp *checkpoint) resultPath(namespace string) string {
+	return filepath.Join(strings.TrimSuffix(cp.path, ".json"), namespace+".json")
+}
+
+// markCompleted records a namespace as mapped with its result and persists
+// the checkpoint
+func (cp *checkpoint) markCompleted(namespace string, result checkpointResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("error encoding checkpoint: %v", err)
+	}
+	path := cp.resultPath(namespace)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("error creating checkpoint directory: %v", err)
+	}
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return fmt.Errorf("error writing checkpoint: %v", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("error writing checkpoint: %v", err)
+	}
+	if !cp.isCompleted(namespace) {
+		cp.Completed = append(cp.Completed, namespace)
+	}
+	return cp.save()
+}
+
+// result reads the result of a namespace the checkpointed run mapped
+func (cp *checkpoint) result(namespace string) (*checkpointResult, error) {
+	data, err := os.ReadFile(cp.resultPath(namespace))
+	if err != nil {
+		return nil, fmt.Errorf("error reading checkpoint: %v", err)
+	}
+	var result checkpointResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("error parsing checkpoint of namespace %s: %v", namespace, err)
+	}
+	if result.Graph == nil {
+		result.Graph = &Graph{Resources: []Resource{}, Relationships: []Relationship{}}
+	}
+	return &result, nil
+}
+
+// save writes the checkpoint to disk
+func (cp *checkpoint) save() error {
+	cp.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding checkpoint: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(cp.path), 0o755); err != nil {
+		return fmt.Errorf("error creating checkpoint directory: %v", err)
+	}
+	// Write to a temporary file first so an interruption never leaves a
+	// truncated checkpoint behind
+	tmp := cp.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("error writing checkpoint: %v", err)
+	}
+	if err := os.Rename(tmp, cp.path); err != nil {
+		return fmt.Errorf("error writing checkpoint: %v", err)
+	}
+	return nil
+}
+
+// remove deletes the checkpoint and the results of its namespaces once a
+// run has completed
+func (cp *checkpoint) remove() error {
+	if err := os.Remove(cp.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing checkpoint: %v", err)
+	}
+	if err := os.RemoveAll(strings.TrimSuffix(cp.path, ".json")); err != nil {
+		return fmt.Errorf("error removing checkpoint: %v", err)
+	}
+	return nil
+}
+
+// reportIncomplete lists the namespaces a time-boxed run did not finish.
+// They stay in the checkpoint, so --resume picks them up
+func reportIncomplete(namespaces []string, timeout time.Duration) {
+	fmt.Printf("\n%sMap incomplete: --timeout of %s reached, %d namespace(s) not fully mapped:%s\n",
+		colorYellow, timeout, len(namespaces), colorReset)
+	for i, ns := range namespaces {
+		branch := sym("├──")
+		if i == len(namespaces)-1 {
+			branch = sym("└──")
+		}
+		fmt.Printf("%s %s [incomplete]\n", branch, ns)
+	}
+	fmt.Println("Run again with --resume to map the remaining namespaces")
+}
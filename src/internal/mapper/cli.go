@@ -0,0 +1,539 @@
+package mapper
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// globalFlags are the flags shared by every subcommand: the cluster to talk
+// to, the identity to use and the namespaces to map
+type globalFlags struct {
+	namespace     string
+	excludeNs     stringSliceFlag
+	context       string
+	as            string
+	asGroups      stringSliceFlag
+	clusterDomain string
+	symbols       symbolsFlag
+	otlpEndpoint  otlpEndpointFlag
+	traceFile     traceFileFlag
+	templates     relationshipTemplatesFlag
+	qps           float64
+	burst         int
+	adaptive      bool
+	concurrency   int
+	reqTimeout    time.Duration
+	retries       int
+	accessCheck   bool
+	protobuf      bool
+	includeRaw    bool
+	selector      string
+	fieldSelector string
+	maxResources  int
+	enable        stringSliceFlag
+	disable       stringSliceFlag
+	plugins       bool
+	color         colorFlag
+	config        string
+	profile       string
+}
+
+// register adds the global flags to the flag set of a subcommand
+func (g *globalFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&g.namespace, "n", "", "Process only the specified namespace")
+	fs.StringVar(&g.namespace, "namespace", "", "Process only the specified namespace")
+	fs.Var(&g.excludeNs, "exclude-ns", "Exclude specified namespaces")
+	fs.StringVar(&g.context, "context", "", "Kubeconfig context to map (default: the current context)")
+	fs.StringVar(&g.as, "as", "", "Username to impersonate, to see the cluster as a restricted user would")
+	fs.Var(&g.asGroups, "as-group", "Group to impersonate, together with --as (repeatable)")
+	fs.StringVar(&g.selector, "l", "", "Map only the objects matching a label selector (e.g. app=web), applied to every list")
+	fs.StringVar(&g.selector, "selector", "", "Map only the objects matching a label selector (e.g. app=web), applied to every list")
+	fs.StringVar(&g.fieldSelector, "field-selector", "", "Map only the objects matching a field selector (e.g. status.phase=Running), applied to the lists of the types supporting its fields")
+	fs.StringVar(&g.config, "config", "", "YAML file of flag defaults and profiles (default: ~/.config/k8s-resource-mapper/config.yaml when it exists)")
+	fs.StringVar(&g.profile, "profile", "", "Profile of the config file to use, such as prod-readonly")
+	fs.Var(&g.color, "color", "Color the output: always (default), never, or auto for colors on a terminal unless NO_COLOR is set")
+	fs.StringVar(&g.clusterDomain, "cluster-domain", "cluster.local", "DNS domain of the cluster, used to render service DNS names")
+	fs.Var(&g.symbols, "symbols", "Symbols to draw the output with: unicode (default), ascii, or a YAML file overriding a preset")
+	fs.Var(&g.templates, "relationship-templates", "YAML file of Go templates, per relationship type, rendering the descriptions of relationships")
+	fs.Var(&g.otlpEndpoint, "otlp-endpoint", "Export traces of the mapping steps and API calls to an OTLP/HTTP collector (e.g. http://localhost:4318/v1/traces)")
+	fs.Var(&g.traceFile, "trace-file", "Append traces of the mapping steps and API calls to a file in the OTLP JSON format")
+	fs.Float64Var(&g.qps, "qps", defaultQPS, "Maximum API calls per second")
+	fs.IntVar(&g.burst, "burst", defaultBurst, "Maximum burst of API calls above --qps")
+	fs.BoolVar(&g.adaptive, "adaptive-rate-limit", true, "Slow down while the API server throttles requests (429), recovering as they succeed")
+	fs.IntVar(&g.concurrency, "concurrency", defaultConcurrency, "Maximum API calls made at once (1 to make them one at a time)")
+	fs.DurationVar(&g.reqTimeout, "request-timeout", defaultRequestTimeout, "Timeout of each API call attempt (0 for none)")
+	fs.BoolVar(&g.accessCheck, "access-check", true, "Check which resource types may be listed and got before mapping, skipping and reporting the others")
+	fs.BoolVar(&g.protobuf, "protobuf", true, "Request built-in types in the protobuf encoding, lighter than JSON on large lists")
+	fs.BoolVar(&g.includeRaw, "include-raw", false, "Embed the full manifest of each resource in the JSON outputs and snapshots")
+	fs.Var(&g.enable, "enable", "Map resource types, comma-separated, including those off by default: "+processorNames()+", and plugin:<name> for a plugin on PATH")
+	fs.Var(&g.disable, "disable", "Skip resource types, comma-separated, neither listing nor mapping them (see --enable for the names)")
+	fs.BoolVar(&g.plugins, "plugins", false, "Run the exec plugins found on PATH (k8s-resource-mapper-plugin-<name>) for each namespace")
+	fs.IntVar(&g.maxResources, "max-resources-per-namespace", 0, "Map at most this many objects of each type per namespace, reporting the types truncated (0 for no limit)")
+	fs.IntVar(&g.retries, "retries", defaultRetries, "Retries of API calls failing transiently (429, 5xx, network errors), with exponential backoff")
+}
+
+// clientOptions returns the client options selected by the global flags
+func (g *globalFlags) clientOptions() clientOptions {
+	return clientOptions{Context: g.context, As: g.as, AsGroups: g.asGroups, QPS: g.qps, Burst: g.burst, Adaptive: g.adaptive,
+		Concurrency: g.concurrency, RequestTimeout: g.reqTimeout, Retries: g.retries,
+		AccessCheck: g.accessCheck, Protobuf: g.protobuf}
+}
+
+// newResourceMapper connects to the cluster selected by the global flags
+func (g *globalFlags) newResourceMapper() (*ResourceMapper, error) {
+	rm, err := newResourceMapperWithOptions(g.clientOptions())
+	if err != nil {
+		return nil, fmt.Errorf("error initializing resource mapper: %v", err)
+	}
+	rm.clusterDomain = g.clusterDomain
+	rm.includeRaw = g.includeRaw
+	if err := rm.setSelectors(g.selector, g.fieldSelector); err != nil {
+		return nil, err
+	}
+	if err := rm.setMaxResources(g.maxResources); err != nil {
+		return nil, err
+	}
+	if err := rm.setProcessors(g.enable, g.disable, g.plugins); err != nil {
+		return nil, err
+	}
+	return rm, nil
+}
+
+// namespaces resolves the namespaces selected by the global flags
+func (g *globalFlags) namespaces(rm *ResourceMapper) ([]string, error) {
+	return rm.resolveNamespaces(g.namespace, g.excludeNs)
+}
+
+// subcommand is a verb of the command line
+type subcommand struct {
+	name    string
+	usage   string
+	summary string
+	run     func(args []string) error
+}
+
+// subcommands holds the registered subcommands in the order they are listed
+var subcommands []subcommand
+
+// registerSubcommand makes a subcommand available on the command line
+func registerSubcommand(name, usage, summary string, run func(args []string) error) {
+	subcommands = append(subcommands, subcommand{name: name, usage: usage, summary: summary, run: run})
+}
+
+func init() {
+	registerSubcommand("map", "[flags]", "Map the resources of the cluster and their relationships (default)", func(args []string) error {
+		runMap(args)
+		return nil
+	})
+	registerSubcommand("serve", "[flags]", "Serve the map as a web UI, JSON API, Grafana data source and admission webhook", runServe)
+	registerSubcommand("diff", "[flags] <left> <right>", "Compare two environments ([context:]namespace) or two snapshot files", runDiff)
+	registerSubcommand("drift", "--baseline <snapshot> [flags]", "Report how the cluster departs from an approved baseline snapshot, once or continuously", runDrift)
+	registerSubcommand("query", "[flags] <expression>|<kind>[/<name>]", "Select a subgraph with a query expression and render it", runQuery)
+	registerSubcommand("path", "--from <kind>/<name> --to <kind>/<name> [flags]", "Print every relationship path between two resources", runPath)
+	registerSubcommand("impact", "[flags] <kind>/<name>", "List everything affected by changing or deleting a resource", runImpact)
+	registerSubcommand("who-uses", "[flags] <kind>/<name>", "List the consumers of one ConfigMap, Secret or Service with as few API calls as possible", runWhoUses)
+	registerSubcommand("bootstrap", "[flags]", "Suggest the order to recreate namespaces in when rebuilding the cluster", runBootstrap)
+	registerSubcommand("summary", "[flags]", "Summarize the health of each namespace for quick triage", runSummary)
+	registerSubcommand("audit", "[flags]", "Check namespaces for misconfigurations and export the findings", runAudit)
+	registerSubcommand("usage", "[flags]", "Aggregate requests and limits per namespace and per node from pod specs", runUsage)
+	registerSubcommand("previews", "[flags]", "Report the age and usage of preview environments and flag expired ones", runPreviews)
+	registerSubcommand("security-matrix", "[flags]", "Tabulate the pod security context of every workload, as text, CSV or HTML", runSecurityMatrix)
+	registerSubcommand("chaos", "[flags]", "Export pod kill experiments for workloads that can safely lose a pod", runChaos)
+	registerSubcommand("estimate", "[flags]", "Predict the API calls and duration of a map run without mapping anything", runEstimate)
+	registerSubcommand("history", "[flags]", "List the runs recorded in the history with --history", runHistory)
+	registerSubcommand("snapshot", "save|show [flags] <file>, or save --interval <duration> <dir>|s3://...|gs://...", "Save the map to a file, or render a saved map without cluster access", runSnapshot)
+}
+
+// printUsage lists the subcommands
+func printUsage() {
+	fmt.Printf("Usage: k8s-resource-mapper [command] [flags]\n\nCommands:\n")
+	for _, cmd := range subcommands {
+		fmt.Printf("  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Printf("\nWithout a command, map is run. Use k8s-resource-mapper <command> -h for the flags of a command.\n")
+}
+
+// subcommandFlagSet is the flag set of a subcommand. Invalid flags exit with
+// exitError rather than the status 2 of the flag package, which would read
+// as a partial failure
+type subcommandFlagSet struct {
+	*flag.FlagSet
+}
+
+// Parse parses the arguments of the subcommand, then sets the flags they do
+// not give from the environment and the config file, in that order, exiting
+// after -h or an invalid flag
+func (fs subcommandFlagSet) Parse(args []string) {
+	switch err := fs.FlagSet.Parse(args); {
+	case err == flag.ErrHelp:
+		os.Exit(exitOK)
+	case err != nil:
+		os.Exit(exitError)
+	}
+	err := applyEnv(fs.FlagSet)
+	if err == nil {
+		err = applyConfig(fs.FlagSet)
+	}
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(exitError)
+	}
+}
+
+// newSubcommandFlagSet creates the flag set of a subcommand, with the global
+// flags registered and a usage line naming the subcommand
+func newSubcommandFlagSet(name string, global *globalFlags) subcommandFlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	global.register(fs)
+	fs.Usage = func() {
+		for _, cmd := range subcommands {
+			if cmd.name == name {
+				fmt.Fprintf(fs.Output(), "Usage: k8s-resource-mapper %s %s\n\n%s\n\nFlags:\n", cmd.name, cmd.usage, cmd.summary)
+			}
+		}
+		fs.PrintDefaults()
+	}
+	return subcommandFlagSet{fs}
+}
+
+// runSubcommand runs a subcommand given as the first argument, reporting
+// whether there was one
+func runSubcommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	if args[0] == "help" {
+		printUsage()
+		return true
+	}
+	for _, cmd := range subcommands {
+		if cmd.name != args[0] {
+			continue
+		}
+		if err := cmd.run(args[1:]); err != nil {
+			fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+			os.Exit(exitError)
+		}
+		return true
+	}
+	return false
+}
+
+// isSnapshotFile reports whether a diff argument names a snapshot file
+// rather than an environment
+func isSnapshotFile(arg string) bool {
+	info, err := os.Stat(arg)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// runDiff runs the diff subcommand: compares two environments given as
+// [context:]namespace, or two snapshot files
+func runDiff(args []string) error {
+	var global globalFlags
+	fs := newSubcommandFlagSet("diff", &global)
+	report := fs.String("report", "comparison.html", "Path of the HTML report written when comparing environments")
+	hideDone := fs.Bool("hide-completed", false, "Omit Succeeded pods from the snapshots compared")
+	since := fs.Duration("since", 0, "Compare the cluster with the last run recorded with --history at least this long ago (e.g. 24h)")
+	prComment := fs.String("pr-comment", "", "Post the comparison of two environments to github:owner/repo#pr or gitlab:group/project!mr")
+	fs.Parse(args)
+
+	if *since > 0 {
+		if fs.NArg() != 0 {
+			return fmt.Errorf("diff --since compares the cluster with its history and takes no arguments")
+		}
+		return runHistorySince(&global, *since)
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("diff expects two environments ([context:]namespace) or two snapshot files")
+	}
+	pr, err := prCommentTarget(*prComment)
+	if err != nil {
+		return err
+	}
+	left, right := fs.Arg(0), fs.Arg(1)
+	if isSnapshotFile(left) != isSnapshotFile(right) {
+		return fmt.Errorf("diff cannot compare a snapshot file with an environment")
+	}
+	if isSnapshotFile(left) {
+		if pr != nil {
+			return fmt.Errorf("--pr-comment applies to comparing environments")
+		}
+		offline := &ResourceMapper{hideCompleted: *hideDone}
+		return offline.runFromSnapshots([]string{left, right}, global.namespace, global.excludeNs)
+	}
+
+	rm, err := global.newResourceMapper()
+	if err != nil {
+		return err
+	}
+	return rm.diffEnvironments(parseCompareTarget(left), parseCompareTarget(right), *report, pr)
+}
+
+// diffEnvironments compares two environments, writing the HTML report, and
+// posts the diff to a pull request when one is given
+func (rm *ResourceMapper) diffEnvironments(left, right compareTarget, report string, pr *prReference) error {
+	diffs, err := rm.compareEnvironments(left, right, report)
+	if err != nil {
+		return fmt.Errorf("error comparing environments: %v", err)
+	}
+	if pr == nil {
+		return nil
+	}
+	if err := pr.postComment(comparisonMarkdown(left, right, diffs)); err != nil {
+		return fmt.Errorf("error posting comment to %s: %v", pr, err)
+	}
+	fmt.Printf("%sPosted comparison to %s%s\n", colorGreen, pr, colorReset)
+	return nil
+}
+
+// runEstimate runs the estimate subcommand: predicts the API calls and
+// duration of mapping the selected namespaces without mapping anything
+func runEstimate(args []string) error {
+	var global globalFlags
+	fs := newSubcommandFlagSet("estimate", &global)
+	var crds stringSliceFlag
+	compact := fs.Bool("compact", false, "Estimate a map --compact run, which skips the per-kind listings")
+	fs.Var(&crds, "custom-resources", "Count the custom resources a run would map, given as resource[.version].group (repeatable)")
+	fs.Parse(args)
+
+	rm, err := global.newResourceMapper()
+	if err != nil {
+		return err
+	}
+	rm.compact = *compact
+	if len(crds) > 0 {
+		if rm.customResources, err = rm.resolveCustomResources(crds); err != nil {
+			return err
+		}
+	}
+	namespaces, err := global.namespaces(rm)
+	if err != nil {
+		return err
+	}
+	if err := rm.showEstimate(namespaces); err != nil {
+		return fmt.Errorf("error estimating API budget: %v", err)
+	}
+	return nil
+}
+
+// runQuery runs the query subcommand: selects the subgraph answering a query
+// expression, or the relationships of kind[/name], and renders it
+func runQuery(args []string) error {
+	var global globalFlags
+	fs := newSubcommandFlagSet("query", &global)
+	output := fs.String("output", "text", "Output format: "+graphFormatNames())
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("query expects an expression, or a resource given as kind or kind/name")
+	}
+	if _, ok := graphFormats[*output]; !ok {
+		return fmt.Errorf("unknown output format '%s' (expected one of %s)", *output, graphFormatNames())
+	}
+	expr := strings.Join(fs.Args(), " ")
+	if len(strings.Fields(expr)) == 1 {
+		// kind/name is short for its direct relationships
+		kind, name, _ := strings.Cut(expr, "/")
+		expr = "from " + kind + " traverse both *"
+		if name != "" {
+			expr = "from " + kind + " where name=" + name + " traverse both *"
+		}
+	}
+	q, err := parseQuery(expr)
+	if err != nil {
+		return err
+	}
+
+	rm, err := global.newResourceMapper()
+	if err != nil {
+		return err
+	}
+	rm.resolveQueryKinds(q)
+	namespaces, err := global.namespaces(rm)
+	if err != nil {
+		return err
+	}
+	// Streaming formats print each namespace as soon as it is mapped
+	results, err := rm.newGraphRenderer(*output)
+	if err != nil {
+		return err
+	}
+	// Types that cannot be listed are reported with the results
+	rm.partial = true
+	for _, ns := range namespaces {
+		g, err := rm.buildGraph(rm.ctx, ns)
+		if err != nil {
+			return fmt.Errorf("error mapping namespace %s: %v", ns, err)
+		}
+		sub := q.run(g)
+		if sub == nil && len(g.Errors) > 0 {
+			sub = &Graph{Resources: []Resource{}, Relationships: []Relationship{}}
+		}
+		if sub != nil {
+			sub.Errors, sub.Truncated = g.Errors, g.Truncated
+			if err := results.add(ns, sub); err != nil {
+				return err
+			}
+		}
+	}
+	if results.count == 0 {
+		return fmt.Errorf("no resource matches the query")
+	}
+	return results.close()
+}
+
+// runAudit runs the audit subcommand: collects the findings of the selected
+// namespaces and exports them, to the terminal by default
+func runAudit(args []string) error {
+	var global globalFlags
+	var exportTo stringSliceFlag
+	fs := newSubcommandFlagSet("audit", &global)
+	fs.Var(&exportTo, "export-findings", "Export findings with an exporter: stdout (default), junit=<path>, sarif=<path>, webhook=<url>, github=<owner/repo#pr>, gitlab=<group/project!mr>")
+	policiesPath := fs.String("policies", "", "YAML file of policies reported as findings (their for durations are ignored)")
+	rulesPath := fs.String("audit-rules", "", "YAML file enabling, disabling and setting the severity of built-in rules")
+	failOn := fs.String("fail-on", "", "Exit with status 3 when a finding is at or above this severity: info, warning or error")
+	fs.Parse(args)
+
+	if err := checkFailOn(*failOn); err != nil {
+		return err
+	}
+	if len(exportTo) == 0 {
+		exportTo = stringSliceFlag{"stdout"}
+	}
+	for _, spec := range exportTo {
+		if _, err := newExporter(spec); err != nil {
+			return err
+		}
+	}
+
+	var policies []policy
+	var rules ruleSet
+	var err error
+	if *policiesPath != "" {
+		if policies, err = loadPolicies(*policiesPath); err != nil {
+			return err
+		}
+	}
+	if *rulesPath != "" {
+		if rules, err = loadAuditRules(*rulesPath); err != nil {
+			return err
+		}
+	}
+
+	rm, err := global.newResourceMapper()
+	if err != nil {
+		return err
+	}
+	rm.resolvePolicyKinds(policies)
+	rm.policies = policies
+	rm.rules = rules
+	namespaces, err := global.namespaces(rm)
+	if err != nil {
+		return err
+	}
+	// A namespace that cannot be audited leaves the others to report, and
+	// the run partial
+	var findings []Finding
+	partial := false
+	for _, ns := range namespaces {
+		nsFindings, err := rm.collectFindings(ns)
+		if err != nil {
+			fmt.Printf("%sError collecting findings for namespace %s: %v%s\n", colorRed, ns, err, colorReset)
+			partial = true
+			continue
+		}
+		findings = append(findings, nsFindings...)
+	}
+	if err := exportFindings(exportTo, findings); err != nil {
+		return err
+	}
+	if status := exitStatus(partial, findings, *failOn); status != exitOK {
+		os.Exit(status)
+	}
+	return nil
+}
+
+// runSnapshot runs the snapshot subcommand: save maps the selected
+// namespaces to a file, show renders a saved file without cluster access
+func runSnapshot(args []string) error {
+	if len(args) == 0 || (args[0] != "save" && args[0] != "show") {
+		return fmt.Errorf("snapshot expects save or show")
+	}
+	action := args[0]
+	var global globalFlags
+	fs := newSubcommandFlagSet("snapshot", &global)
+	hideDone := fs.Bool("hide-completed", false, "Omit Succeeded pods when showing a snapshot")
+	history := fs.Bool("history", false, "Also record each snapshot in the history, for history and diff --since")
+	interval := fs.Duration("interval", 0, "Keep running, saving a timestamped snapshot every interval (e.g. 5m) to a directory, s3:// or gs:// URL")
+	notify := addNotifyFlags(fs)
+	pprofAddr := addPprofFlag(fs)
+	fs.Parse(args[1:])
+
+	if fs.NArg() != 1 {
+		if *interval > 0 {
+			return fmt.Errorf("snapshot save --interval expects a directory, s3:// or gs:// URL")
+		}
+		return fmt.Errorf("snapshot %s expects a file", action)
+	}
+	path := fs.Arg(0)
+	if *interval < 0 || (*interval > 0 && action != "save") {
+		return fmt.Errorf("--interval expects a positive duration and applies to snapshot save")
+	}
+	notifier, err := notify.notifier()
+	if err != nil {
+		return err
+	}
+	if notifier != nil && *interval == 0 {
+		return fmt.Errorf("--notify requires --interval")
+	}
+	if *pprofAddr != "" && *interval == 0 {
+		return fmt.Errorf("--pprof requires --interval")
+	}
+	dest := snapshotDestination(path)
+	if action == "save" && *interval == 0 && dest.cloudCLI() != nil {
+		return fmt.Errorf("snapshot save writes to s3:// and gs:// URLs only with --interval")
+	}
+	// The destination is checked before connecting, so a missing CLI fails
+	// at once rather than after mapping
+	if *interval > 0 {
+		if err := dest.check(); err != nil {
+			return err
+		}
+	}
+	if action == "show" {
+		offline := &ResourceMapper{hideCompleted: *hideDone}
+		return offline.runFromSnapshots([]string{path}, global.namespace, global.excludeNs)
+	}
+
+	rm, err := global.newResourceMapper()
+	if err != nil {
+		return err
+	}
+	var hist *historyStore
+	if *history {
+		if hist, err = openHistory(rm.host); err != nil {
+			return err
+		}
+		defer hist.close()
+	}
+	if *interval > 0 {
+		if err := startPprof(*pprofAddr); err != nil {
+			return err
+		}
+		rm.scheduleSnapshots(&global, dest, *interval, hist, notifier)
+		return nil
+	}
+	namespaces, err := global.namespaces(rm)
+	if err != nil {
+		return err
+	}
+	count, err := rm.saveSnapshot(namespaces, path, hist)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%sSnapshot of %d namespace(s) written to %s%s\n", colorGreen, count, path, colorReset)
+	return nil
+}
@@ -0,0 +1,46 @@
+package mapper
+
+import (
+	"fmt"
+	"os"
+)
+
+// ANSI color codes, emptied by --color never
+var (
+	colorRed    = "\033[0;31m"
+	colorGreen  = "\033[0;32m"
+	colorBlue   = "\033[0;34m"
+	colorYellow = "\033[1;33m"
+	colorCyan   = "\033[0;36m"
+	colorReset  = "\033[0m"
+)
+
+// disableColors prints the output without colors
+func disableColors() {
+	colorRed, colorGreen, colorBlue, colorYellow, colorCyan, colorReset = "", "", "", "", "", ""
+}
+
+// colorFlag is the --color flag: always, never, or auto for colors only on
+// a terminal and without NO_COLOR set
+type colorFlag string
+
+func (f *colorFlag) String() string {
+	return string(*f)
+}
+
+func (f *colorFlag) Set(value string) error {
+	switch value {
+	case "always":
+	case "never":
+		disableColors()
+	case "auto":
+		info, err := os.Stdout.Stat()
+		if os.Getenv("NO_COLOR") != "" || err != nil || info.Mode()&os.ModeCharDevice == 0 {
+			disableColors()
+		}
+	default:
+		return fmt.Errorf("invalid color mode '%s' (expected always, never or auto)", value)
+	}
+	*f = colorFlag(value)
+	return nil
+}
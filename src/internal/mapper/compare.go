@@ -0,0 +1,438 @@
+package mapper
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// compareTarget identifies one side of an environment comparison
+type compareTarget struct {
+	Context   string
+	Namespace string
+}
+
+// parseCompareTarget parses "namespace" or "context:namespace"
+func parseCompareTarget(spec string) compareTarget {
+	if i := strings.LastIndex(spec, ":"); i >= 0 {
+		return compareTarget{Context: spec[:i], Namespace: spec[i+1:]}
+	}
+	return compareTarget{Namespace: spec}
+}
+
+func (t compareTarget) String() string {
+	if t.Context == "" {
+		return t.Namespace
+	}
+	return t.Context + ":" + t.Namespace
+}
+
+// attributeChange describes a single differing attribute of a resource
+type attributeChange struct {
+	Field string
+	Left  string
+	Right string
+	// SelectorRelevant is set for label changes on a key used by a service
+	// selector, since those silently rewire service to pod relationships
+	SelectorRelevant bool
+}
+
+// Prefixes distinguishing labels and annotations from structural attributes
+const (
+	labelFieldPrefix      = "label:"
+	annotationFieldPrefix = "annotation:"
+)
+
+// ignoredAnnotations are maintained by controllers and change on every apply
+var ignoredAnnotations = map[string]bool{
+	"kubectl.kubernetes.io/last-applied-configuration": true,
+	"deployment.kubernetes.io/revision":                true,
+}
+
+// resourceFields flattens the attributes, labels and annotations of a resource
+func resourceFields(res *Resource) map[string]string {
+	fields := make(map[string]string, len(res.Attributes)+len(res.Labels)+len(res.Annotations))
+	for key, value := range res.Attributes {
+		fields[key] = value
+	}
+	for key, value := range res.Labels {
+		fields[labelFieldPrefix+key] = value
+	}
+	for key, value := range res.Annotations {
+		if !ignoredAnnotations[key] {
+			fields[annotationFieldPrefix+key] = value
+		}
+	}
+	return fields
+}
+
+// resourceDiff describes how one resource differs between two environments
+type resourceDiff struct {
+	Kind    string
+	Name    string
+	Left    *Resource
+	Right   *Resource
+	Changes []attributeChange
+}
+
+// Status returns "only-left", "only-right", "changed" or "same"
+func (d resourceDiff) Status() string {
+	switch {
+	case d.Left == nil:
+		return "only-right"
+	case d.Right == nil:
+		return "only-left"
+	case len(d.Changes) > 0:
+		return "changed"
+	}
+	return "same"
+}
+
+// changed reports whether an attribute of the resource differs
+func (d resourceDiff) changed(field string) bool {
+	for _, change := range d.Changes {
+		if change.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// diffAttributes compares the attributes, labels and annotations of two
+// versions of a resource
+func diffAttributes(left, right *Resource) []attributeChange {
+	leftFields, rightFields := resourceFields(left), resourceFields(right)
+	fields := map[string]bool{}
+	for field := range leftFields {
+		fields[field] = true
+	}
+	for field := range rightFields {
+		fields[field] = true
+	}
+
+	var changes []attributeChange
+	for _, field := range sortedKeys(fields) {
+		if leftFields[field] != rightFields[field] {
+			changes = append(changes, attributeChange{
+				Field: field,
+				Left:  leftFields[field],
+				Right: rightFields[field],
+			})
+		}
+	}
+	return changes
+}
+
+// isSelectorRelevant reports whether a change affects a label used by a
+// service selector, either on the resource itself or on its pod template
+func isSelectorRelevant(change attributeChange, selectorLabels map[string]bool) bool {
+	if label, ok := strings.CutPrefix(change.Field, labelFieldPrefix); ok {
+		return selectorLabels[label]
+	}
+	if change.Field == "podLabels" {
+		left, right := parseLabels(change.Left), parseLabels(change.Right)
+		for key := range selectorLabels {
+			if left[key] != right[key] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// selectorKeys returns the label keys used by service selectors
+func selectorKeys(resources ...[]Resource) map[string]bool {
+	keys := map[string]bool{}
+	for _, list := range resources {
+		for _, res := range list {
+			if res.Kind != "Service" {
+				continue
+			}
+			for key := range parseLabels(res.Attributes["selector"]) {
+				keys[key] = true
+			}
+		}
+	}
+	return keys
+}
+
+// compareResources matches resources of two environments by kind and name.
+// Pods are skipped since their names are generated and never line up.
+func compareResources(left, right []Resource) []resourceDiff {
+	index := map[string]*resourceDiff{}
+	var keys []string
+
+	add := func(res *Resource, isLeft bool) {
+		if res.Kind == "Pod" {
+			return
+		}
+		key := res.Kind + "/" + res.Name
+		diff, ok := index[key]
+		if !ok {
+			diff = &resourceDiff{Kind: res.Kind, Name: res.Name}
+			index[key] = diff
+			keys = append(keys, key)
+		}
+		if isLeft {
+			diff.Left = res
+		} else {
+			diff.Right = res
+		}
+	}
+	for i := range left {
+		add(&left[i], true)
+	}
+	for i := range right {
+		add(&right[i], false)
+	}
+
+	selectorLabels := selectorKeys(left, right)
+	diffs := make([]resourceDiff, 0, len(keys))
+	for _, key := range keys {
+		diff := index[key]
+		if diff.Left != nil && diff.Right != nil {
+			diff.Changes = diffAttributes(diff.Left, diff.Right)
+			for i, change := range diff.Changes {
+				diff.Changes[i].SelectorRelevant = isSelectorRelevant(change, selectorLabels)
+			}
+		}
+		diffs = append(diffs, *diff)
+	}
+
+	kindOrder := map[string]int{}
+	for i, kind := range inventoryKinds {
+		kindOrder[kind] = i
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].Kind != diffs[j].Kind {
+			return kindOrder[diffs[i].Kind] < kindOrder[diffs[j].Kind]
+		}
+		return diffs[i].Name < diffs[j].Name
+	})
+	return diffs
+}
+
+// comparisonCell is one side of a row in the HTML report
+type comparisonCell struct {
+	Present bool
+	Lines   []comparisonLine
+}
+
+type comparisonLine struct {
+	Text    string
+	Changed bool
+}
+
+type comparisonRow struct {
+	Name   string
+	Status string
+	Left   comparisonCell
+	Right  comparisonCell
+}
+
+type comparisonSection struct {
+	Kind string
+	Rows []comparisonRow
+}
+
+// buildCell renders the attributes of one side of a diff
+func buildCell(diff resourceDiff, res *Resource) comparisonCell {
+	if res == nil {
+		return comparisonCell{}
+	}
+	cell := comparisonCell{Present: true}
+	fields := resourceFields(res)
+	for _, field := range sortedKeys(fields) {
+		cell.Lines = append(cell.Lines, comparisonLine{
+			Text:    field + ": " + fields[field],
+			Changed: diff.changed(field),
+		})
+	}
+	return cell
+}
+
+var comparisonTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Environment comparison: {{.Left}} vs {{.Right}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; vertical-align: top; text-align: left; }
+th { background: #f0f0f0; }
+td.name { font-weight: bold; white-space: nowrap; }
+tr.only-left td.left, tr.only-right td.right { background: #e6ffed; }
+tr.only-left td.right, tr.only-right td.left { background: #ffeef0; }
+tr.changed td.name { background: #fff5b1; }
+.changed-attr { background: #fff5b1; font-weight: bold; }
+.missing { color: #999; font-style: italic; }
+ul { margin: 0; padding-left: 1em; }
+</style>
+</head>
+<body>
+<h1>Environment comparison</h1>
+<p>Generated {{.Generated}} &middot; {{.Summary}}</p>
+{{range .Sections}}
+<h2>{{.Kind}}</h2>
+<table>
+<tr><th>Name</th><th>{{$.Left}}</th><th>{{$.Right}}</th></tr>
+{{range .Rows}}
+<tr class="{{.Status}}">
+<td class="name">{{.Name}}</td>
+<td class="left">{{if .Left.Present}}<ul>{{range .Left.Lines}}<li{{if .Changed}} class="changed-attr"{{end}}>{{.Text}}</li>{{end}}</ul>{{else}}<span class="missing">missing</span>{{end}}</td>
+<td class="right">{{if .Right.Present}}<ul>{{range .Right.Lines}}<li{{if .Changed}} class="changed-attr"{{end}}>{{.Text}}</li>{{end}}</ul>{{else}}<span class="missing">missing</span>{{end}}</td>
+</tr>
+{{end}}
+</table>
+{{end}}
+</body>
+</html>
+`))
+
+// summarizeDiffs counts the resources per comparison status
+func summarizeDiffs(diffs []resourceDiff) map[string]int {
+	counts := map[string]int{}
+	for _, diff := range diffs {
+		counts[diff.Status()]++
+	}
+	return counts
+}
+
+// writeComparisonReport renders a side-by-side HTML report of two environments
+func writeComparisonReport(path string, left, right compareTarget, diffs []resourceDiff) error {
+	var sections []comparisonSection
+	for _, diff := range diffs {
+		if len(sections) == 0 || sections[len(sections)-1].Kind != diff.Kind {
+			sections = append(sections, comparisonSection{Kind: diff.Kind})
+		}
+		section := &sections[len(sections)-1]
+		section.Rows = append(section.Rows, comparisonRow{
+			Name:   diff.Name,
+			Status: diff.Status(),
+			Left:   buildCell(diff, diff.Left),
+			Right:  buildCell(diff, diff.Right),
+		})
+	}
+
+	counts := summarizeDiffs(diffs)
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating report: %v", err)
+	}
+	defer file.Close()
+
+	err = comparisonTemplate.Execute(file, map[string]interface{}{
+		"Left":      left.String(),
+		"Right":     right.String(),
+		"Generated": time.Now().Format(time.RFC3339),
+		"Summary": fmt.Sprintf("%d identical, %d changed, %d only in %s, %d only in %s",
+			counts["same"], counts["changed"], counts["only-left"], left, counts["only-right"], right),
+		"Sections": sections,
+	})
+	if err != nil {
+		return fmt.Errorf("error rendering report: %v", err)
+	}
+	return nil
+}
+
+// comparisonMarkdown renders the differences between two environments as
+// Markdown for PR/MR comments
+func comparisonMarkdown(left, right compareTarget, diffs []resourceDiff) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "### Topology diff: `%s` vs `%s`\n\n", left, right)
+
+	counts := summarizeDiffs(diffs)
+	if counts["changed"]+counts["only-left"]+counts["only-right"] == 0 {
+		sb.WriteString("No structural differences.\n")
+		return sb.String()
+	}
+
+	sb.WriteString("| Change | Resource | Details |\n")
+	sb.WriteString("|--------|----------|---------|\n")
+	for _, diff := range diffs {
+		resource := fmt.Sprintf("`%s/%s`", diff.Kind, diff.Name)
+		switch diff.Status() {
+		case "only-left":
+			fmt.Fprintf(&sb, "| removed | %s | only in `%s` |\n", resource, left)
+		case "only-right":
+			fmt.Fprintf(&sb, "| added | %s | only in `%s` |\n", resource, right)
+		case "changed":
+			details := []string{}
+			for _, change := range diff.Changes {
+				detail := fmt.Sprintf("%s: `%s` → `%s`", change.Field, change.Left, change.Right)
+				if change.SelectorRelevant {
+					detail += " ⚠️ used by a service selector"
+				}
+				details = append(details, detail)
+			}
+			fmt.Fprintf(&sb, "| changed | %s | %s |\n", resource, strings.Join(details, "<br>"))
+		}
+	}
+	return sb.String()
+}
+
+// printComparison prints the differences between two environments
+func (rm *ResourceMapper) printComparison(left, right compareTarget, diffs []resourceDiff) {
+	fmt.Printf("%sComparing %s with %s%s\n", colorBlue, left, right, colorReset)
+	for _, diff := range diffs {
+		switch diff.Status() {
+		case "only-left":
+			fmt.Printf("%s- %s/%s (only in %s)%s\n", colorRed, diff.Kind, diff.Name, left, colorReset)
+		case "only-right":
+			fmt.Printf("%s+ %s/%s (only in %s)%s\n", colorGreen, diff.Kind, diff.Name, right, colorReset)
+		case "changed":
+			fmt.Printf("%s~ %s/%s%s\n", colorYellow, diff.Kind, diff.Name, colorReset)
+			for _, change := range diff.Changes {
+				fmt.Printf("    %s: %s %s %s", change.Field, change.Left, rm.createArrow(2), change.Right)
+				if change.SelectorRelevant {
+					fmt.Printf(" %s(used by a service selector)%s", colorRed, colorReset)
+				}
+				fmt.Println()
+			}
+		}
+	}
+}
+
+// compareEnvironments collects both environments, writes the comparison
+// report and returns the differences
+func (rm *ResourceMapper) compareEnvironments(left, right compareTarget, reportPath string) ([]resourceDiff, error) {
+	collect := func(target compareTarget) ([]Resource, error) {
+		mapper := rm
+		if target.Context != "" {
+			var err error
+			opts := rm.opts
+			opts.Context = target.Context
+			mapper, err = newResourceMapperWithOptions(opts)
+			if err != nil {
+				return nil, err
+			}
+		}
+		resources, err := mapper.collectResources(target.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("error collecting %s: %v", target, err)
+		}
+		return resources, nil
+	}
+
+	leftResources, err := collect(left)
+	if err != nil {
+		return nil, err
+	}
+	rightResources, err := collect(right)
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := compareResources(leftResources, rightResources)
+	rm.printComparison(left, right, diffs)
+
+	if err := writeComparisonReport(reportPath, left, right, diffs); err != nil {
+		return nil, err
+	}
+	fmt.Printf("%sComparison report written to %s%s\n", colorGreen, reportPath, colorReset)
+	return diffs, nil
+}
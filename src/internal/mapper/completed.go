@@ -0,0 +1,69 @@
+package mapper
+
+import (
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// isCompletedPod reports whether a pod ran to completion
+func isCompletedPod(pod *corev1.Pod) bool {
+	return pod.Status.Phase == corev1.PodSucceeded
+}
+
+// isCompletedJob reports whether a job finished successfully
+func isCompletedJob(job *batchv1.Job) bool {
+	for _, cond := range job.Status.Conditions {
+		if cond.Type == batchv1.JobComplete && cond.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutCompletedPods drops the pods that ran to completion
+func withoutCompletedPods(pods []corev1.Pod) []corev1.Pod {
+	kept := make([]corev1.Pod, 0, len(pods))
+	for i := range pods {
+		if !isCompletedPod(&pods[i]) {
+			kept = append(kept, pods[i])
+		}
+	}
+	return kept
+}
+
+// showJobs lists the Jobs of a namespace, leaving out completed ones when
+// completed work is hidden
+func (rm *ResourceMapper) showJobs(namespace string) error {
+	jobs, err := rm.listJobs(namespace)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%sJobs:%s\n", colorYellow, colorReset)
+	hidden := 0
+	for i := range jobs {
+		job := &jobs[i]
+		if rm.hideCompleted && isCompletedJob(job) {
+			hidden++
+			continue
+		}
+		completions := int32(1)
+		if job.Spec.Completions != nil {
+			completions = *job.Spec.Completions
+		}
+		state := "running"
+		switch {
+		case isCompletedJob(job):
+			state = "complete"
+		case job.Status.Failed > 0 && job.Status.Active == 0:
+			state = "failed"
+		}
+		fmt.Printf("%s %d/%d %s\n", job.Name, job.Status.Succeeded, completions, state)
+	}
+	if hidden > 0 {
+		fmt.Printf("(%d completed job(s) hidden)\n", hidden)
+	}
+	return nil
+}
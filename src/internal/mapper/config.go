@@ -0,0 +1,220 @@
+package mapper
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// envPrefix prefixes the environment variables setting flags, named after
+// the flag in upper case with underscores, such as KRM_EXCLUDE_NS
+const envPrefix = "KRM_"
+
+// configFile is the format of the configuration file: flag defaults by flag
+// name, sections of defaults for one command by command name, and profiles
+// of both selected with --profile
+type configFile struct {
+	// Defaults are the flags and command sections outside of profiles
+	Defaults map[string]interface{}
+	Profiles map[string]map[string]interface{}
+}
+
+// defaultConfigPath returns the configuration file read without --config,
+// config.yaml in the k8s-resource-mapper directory of $XDG_CONFIG_HOME or
+// ~/.config
+func defaultConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "k8s-resource-mapper", "config.yaml")
+}
+
+// loadConfig reads a configuration file
+func loadConfig(path string) (*configFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config: %v", err)
+	}
+	var defaults map[string]interface{}
+	if err := yaml.Unmarshal(data, &defaults); err != nil {
+		return nil, fmt.Errorf("error parsing config %s: %v", path, err)
+	}
+	config := &configFile{Defaults: defaults, Profiles: map[string]map[string]interface{}{}}
+	if profiles, ok := defaults["profiles"]; ok {
+		delete(defaults, "profiles")
+		byName, ok := profiles.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("error parsing config %s: profiles must map names to flags", path)
+		}
+		for name, profile := range byName {
+			flags, ok := profile.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("error parsing config %s: profile %s must map flags to values", path, name)
+			}
+			config.Profiles[name] = flags
+		}
+	}
+	return config, nil
+}
+
+// flagValues returns the flag values of a section of the configuration for a
+// command: its flags, overridden by those of its section for the command
+func flagValues(section map[string]interface{}, command string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	for name, value := range section {
+		if name == "config" || name == "profile" {
+			return nil, fmt.Errorf("--%s cannot be set in the config", name)
+		}
+		if _, ok := value.(map[string]interface{}); !ok {
+			values[name] = value
+		}
+	}
+	if commandSection, ok := section[command].(map[string]interface{}); ok {
+		for name, value := range commandSection {
+			values[name] = value
+		}
+	}
+	return values, nil
+}
+
+// flagStrings converts a configured flag value to the arguments of the flag:
+// one per item of lists, which repeatable flags take in turn
+func flagStrings(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+	case bool:
+		return []string{strconv.FormatBool(v)}, nil
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}, nil
+	case []interface{}:
+		args := []string{}
+		for _, item := range v {
+			itemArgs, err := flagStrings(item)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, itemArgs...)
+		}
+		return args, nil
+	}
+	return nil, fmt.Errorf("unsupported value %v", value)
+}
+
+// givenValues returns the values of the flags set, by the command line or
+// the environment. Flags such as -n and --namespace share their value
+func givenValues(fs *flag.FlagSet) map[flag.Value]bool {
+	given := map[flag.Value]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Value] = true })
+	return given
+}
+
+// envName returns the environment variable setting a flag
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnv sets the flags not given on the command line from the
+// environment, which the config file cannot override. Repeatable flags take
+// comma-separated lists, and KRM_NO_COLOR stands for KRM_COLOR=never
+func applyEnv(fs *flag.FlagSet) error {
+	given := givenValues(fs)
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || given[f.Value] || f.Name == "h" || f.Name == "help" {
+			return
+		}
+		value := os.Getenv(envName(f.Name))
+		if value == "" && f.Name == "color" && os.Getenv(envPrefix+"NO_COLOR") != "" {
+			value = "never"
+		}
+		if value == "" {
+			return
+		}
+		args := []string{value}
+		if _, repeatable := f.Value.(*stringSliceFlag); repeatable {
+			args = strings.Split(value, ",")
+		}
+		for _, arg := range args {
+			if err = fs.Set(f.Name, strings.TrimSpace(arg)); err != nil {
+				err = fmt.Errorf("invalid value %q for %s: %v", arg, envName(f.Name), err)
+				return
+			}
+		}
+		given[f.Value] = true
+	})
+	return err
+}
+
+// applyConfig sets the flags not given on the command line or the
+// environment from the configuration file and the profile selected. Flags
+// the command does not have are left out, so that one file serves every
+// command
+func applyConfig(fs *flag.FlagSet) error {
+	path, profile := fs.Lookup("config").Value.String(), fs.Lookup("profile").Value.String()
+	if path == "" {
+		path = defaultConfigPath()
+		if _, err := os.Stat(path); err != nil {
+			if profile != "" {
+				return fmt.Errorf("profile %s not found, no config at %s", profile, path)
+			}
+			return nil
+		}
+	}
+	config, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+	values, err := flagValues(config.Defaults, fs.Name())
+	if err != nil {
+		return fmt.Errorf("error in config %s: %v", path, err)
+	}
+	if profile != "" {
+		section, ok := config.Profiles[profile]
+		if !ok {
+			return fmt.Errorf("profile %s not found in %s (available: %s)", profile, path, profileNames(config))
+		}
+		profileValues, err := flagValues(section, fs.Name())
+		if err != nil {
+			return fmt.Errorf("error in profile %s of %s: %v", profile, path, err)
+		}
+		for name, value := range profileValues {
+			values[name] = value
+		}
+	}
+
+	given := givenValues(fs)
+	for _, name := range sortedKeys(values) {
+		if f := fs.Lookup(name); f == nil || given[f.Value] {
+			continue
+		}
+		args, err := flagStrings(values[name])
+		if err != nil {
+			return fmt.Errorf("error in config %s: --%s: %v", path, name, err)
+		}
+		for _, arg := range args {
+			if err := fs.Set(name, arg); err != nil {
+				return fmt.Errorf("error in config %s: invalid value %q for --%s: %v", path, arg, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// profileNames lists the profiles of a configuration for errors
+func profileNames(config *configFile) string {
+	if len(config.Profiles) == 0 {
+		return "none"
+	}
+	return strings.Join(sortedKeys(config.Profiles), ", ")
+}
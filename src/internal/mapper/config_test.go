@@ -0,0 +1,146 @@
+package mapper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testConfig = `
+qps: 10
+burst: 20
+output-format: tree
+map:
+  burst: 30
+diff:
+  qps: 99
+profiles:
+  prod:
+    qps: 2
+    exclude-ns: [kube-system, monitoring]
+  broken:
+    profile: prod
+`
+
+// parseTestFlags parses the map command line with the configuration above in
+// $XDG_CONFIG_HOME and an environment, returning the values of the flags
+func parseTestFlags(t *testing.T, args []string, env map[string]string) (map[string]string, error) {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "k8s-resource-mapper", "config.yaml")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(testConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	for _, name := range []string{"qps", "burst", "exclude-ns", "profile", "config"} {
+		t.Setenv(envName(name), env[envName(name)])
+	}
+
+	var global globalFlags
+	fs := newSubcommandFlagSet("map", &global)
+	if err := fs.FlagSet.Parse(args); err != nil {
+		t.Fatalf("Parse(%q): %v", args, err)
+	}
+	if err := applyEnv(fs.FlagSet); err != nil {
+		return nil, err
+	}
+	if err := applyConfig(fs.FlagSet); err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"qps":        fs.Lookup("qps").Value.String(),
+		"burst":      fs.Lookup("burst").Value.String(),
+		"exclude-ns": fs.Lookup("exclude-ns").Value.String(),
+	}, nil
+}
+
+func TestFlagPrecedence(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "config defaults and command section",
+			want: map[string]string{"qps": "10", "burst": "30", "exclude-ns": ""},
+		},
+		{
+			name: "profile over command section",
+			args: []string{"--profile", "prod"},
+			want: map[string]string{"qps": "2", "burst": "30", "exclude-ns": "kube-system,monitoring"},
+		},
+		{
+			name: "profile from the environment",
+			env:  map[string]string{"KRM_PROFILE": "prod"},
+			want: map[string]string{"qps": "2", "burst": "30", "exclude-ns": "kube-system,monitoring"},
+		},
+		{
+			name: "environment over profile",
+			args: []string{"--profile", "prod"},
+			env:  map[string]string{"KRM_QPS": "7", "KRM_EXCLUDE_NS": "a, b"},
+			want: map[string]string{"qps": "7", "burst": "30", "exclude-ns": "a,b"},
+		},
+		{
+			name: "command line over environment",
+			args: []string{"--qps", "3", "--exclude-ns", "c"},
+			env:  map[string]string{"KRM_QPS": "7", "KRM_EXCLUDE_NS": "a,b", "KRM_BURST": "40"},
+			want: map[string]string{"qps": "3", "burst": "40", "exclude-ns": "c"},
+		},
+		{
+			name: "command line over profile",
+			args: []string{"--profile", "prod", "--qps", "3", "--exclude-ns", "c"},
+			want: map[string]string{"qps": "3", "burst": "30", "exclude-ns": "c"},
+		},
+		{
+			name:    "unknown profile",
+			args:    []string{"--profile", "staging"},
+			wantErr: true,
+		},
+		{
+			name:    "profile set in the config",
+			args:    []string{"--profile", "broken"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid environment value",
+			env:     map[string]string{"KRM_QPS": "fast"},
+			wantErr: true,
+		},
+		{
+			name:    "missing config file",
+			args:    []string{"--config", "/nonexistent/config.yaml"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTestFlags(t, tt.args, tt.env)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for name, want := range tt.want {
+				if got[name] != want {
+					t.Errorf("--%s = %q, want %q", name, got[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	tests := map[string]string{
+		"qps":                         "KRM_QPS",
+		"exclude-ns":                  "KRM_EXCLUDE_NS",
+		"max-resources-per-namespace": "KRM_MAX_RESOURCES_PER_NAMESPACE",
+	}
+	for flagName, want := range tests {
+		if got := envName(flagName); got != want {
+			t.Errorf("envName(%q) = %q, want %q", flagName, got, want)
+		}
+	}
+}
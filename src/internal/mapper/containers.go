@@ -0,0 +1,222 @@
+package mapper
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Container roles within a pod
+const (
+	roleContainer = "container"
+	roleInit      = "init container"
+	roleSidecar   = "sidecar"
+	roleEphemeral = "ephemeral container"
+)
+
+// podContainer is the configuration-relevant part of any container of a pod
+type podContainer struct {
+	Role         string
+	Name         string
+	Env          []corev1.EnvVar
+	EnvFrom      []corev1.EnvFromSource
+	VolumeMounts []corev1.VolumeMount
+}
+
+// podContainers returns every container of a pod: regular containers, init
+// containers, sidecars (init containers with restartPolicy Always) and
+// ephemeral debug containers
+func podContainers(spec *corev1.PodSpec) []podContainer {
+	containers := []podContainer{}
+	for _, c := range spec.Containers {
+		containers = append(containers, podContainer{Role: roleContainer, Name: c.Name, Env: c.Env, EnvFrom: c.EnvFrom, VolumeMounts: c.VolumeMounts})
+	}
+	for _, c := range spec.InitContainers {
+		role := roleInit
+		if c.RestartPolicy != nil && *c.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			role = roleSidecar
+		}
+		containers = append(containers, podContainer{Role: role, Name: c.Name, Env: c.Env, EnvFrom: c.EnvFrom, VolumeMounts: c.VolumeMounts})
+	}
+	for _, c := range spec.EphemeralContainers {
+		containers = append(containers, podContainer{Role: roleEphemeral, Name: c.Name, Env: c.Env, EnvFrom: c.EnvFrom, VolumeMounts: c.VolumeMounts})
+	}
+	return containers
+}
+
+// configReference is a reference from a pod to a ConfigMap or Secret
+type configReference struct {
+	Kind  string
+	Name  string
+	Usage string
+	// Optional references do not block the pod from starting when the
+	// object or key is missing
+	Optional bool
+	// Keys are the keys the reference selects, none when it reads them all
+	Keys []string
+}
+
+// describe formats the usage of a reference for display
+func (r configReference) describe() string {
+	if r.Optional {
+		return r.Usage + " [optional]"
+	}
+	return r.Usage
+}
+
+// usageIn qualifies a usage with the container it comes from, leaving
+// usages from regular containers unqualified
+func usageIn(usage string, c podContainer) string {
+	if c.Role == roleContainer {
+		return usage
+	}
+	return usage + " (" + c.Role + " " + c.Name + ")"
+}
+
+// withKeys adds the keys selected by volume items to a usage
+func withKeys(usage string, items []corev1.KeyToPath) string {
+	if len(items) == 0 {
+		return usage
+	}
+	return usage + " (keys: " + strings.Join(itemKeys(items), ",") + ")"
+}
+
+// itemKeys returns the keys selected by volume items
+func itemKeys(items []corev1.KeyToPath) []string {
+	keys := make([]string, 0, len(items))
+	for _, item := range items {
+		keys = append(keys, item.Key)
+	}
+	return keys
+}
+
+// isOptional dereferences an optional flag
+func isOptional(optional *bool) bool {
+	return optional != nil && *optional
+}
+
+// podConfigReferences returns the ConfigMaps and Secrets referenced by a pod
+// through plain and projected volumes, subPath mounts, envFrom and env of any
+// of its containers
+func podConfigReferences(pod *corev1.Pod) []configReference {
+	refs := []configReference{}
+	// volumeRefs indexes the references of each volume, so subPath mounts
+	// can be attributed to the objects behind the volume
+	volumeRefs := map[string][]configReference{}
+	addVolumeRef := func(volume string, ref configReference) {
+		refs = append(refs, ref)
+		volumeRefs[volume] = append(volumeRefs[volume], ref)
+	}
+
+	for _, volume := range pod.Spec.Volumes {
+		if cm := volume.ConfigMap; cm != nil {
+			addVolumeRef(volume.Name, configReference{Kind: "ConfigMap", Name: cm.Name,
+				Usage: withKeys("Mounted as volume", cm.Items), Optional: isOptional(cm.Optional), Keys: itemKeys(cm.Items)})
+		}
+		if secret := volume.Secret; secret != nil {
+			addVolumeRef(volume.Name, configReference{Kind: "Secret", Name: secret.SecretName,
+				Usage: withKeys("Mounted as volume", secret.Items), Optional: isOptional(secret.Optional), Keys: itemKeys(secret.Items)})
+		}
+		if volume.Projected == nil {
+			continue
+		}
+		for _, source := range volume.Projected.Sources {
+			if cm := source.ConfigMap; cm != nil {
+				addVolumeRef(volume.Name, configReference{Kind: "ConfigMap", Name: cm.Name,
+					Usage: withKeys("Mounted via projected volume "+volume.Name, cm.Items), Optional: isOptional(cm.Optional), Keys: itemKeys(cm.Items)})
+			}
+			if secret := source.Secret; secret != nil {
+				addVolumeRef(volume.Name, configReference{Kind: "Secret", Name: secret.Name,
+					Usage: withKeys("Mounted via projected volume "+volume.Name, secret.Items), Optional: isOptional(secret.Optional), Keys: itemKeys(secret.Items)})
+			}
+		}
+	}
+
+	for _, c := range podContainers(&pod.Spec) {
+		for _, mount := range c.VolumeMounts {
+			if mount.SubPath == "" && mount.SubPathExpr == "" {
+				continue
+			}
+			subPath := mount.SubPath
+			if subPath == "" {
+				subPath = mount.SubPathExpr
+			}
+			for _, ref := range volumeRefs[mount.Name] {
+				ref.Usage = usageIn(fmt.Sprintf("Mounted with subPath %s at %s", subPath, mount.MountPath), c)
+				refs = append(refs, ref)
+			}
+		}
+		for _, envFrom := range c.EnvFrom {
+			if envFrom.ConfigMapRef != nil {
+				refs = append(refs, configReference{Kind: "ConfigMap", Name: envFrom.ConfigMapRef.Name,
+					Usage: usageIn("Used in envFrom", c), Optional: isOptional(envFrom.ConfigMapRef.Optional)})
+			}
+			if envFrom.SecretRef != nil {
+				refs = append(refs, configReference{Kind: "Secret", Name: envFrom.SecretRef.Name,
+					Usage: usageIn("Used in envFrom", c), Optional: isOptional(envFrom.SecretRef.Optional)})
+			}
+		}
+		for _, env := range c.Env {
+			if env.ValueFrom == nil {
+				continue
+			}
+			if ref := env.ValueFrom.ConfigMapKeyRef; ref != nil {
+				refs = append(refs, configReference{Kind: "ConfigMap", Name: ref.Name,
+					Usage: usageIn("Used in environment variables", c), Optional: isOptional(ref.Optional), Keys: []string{ref.Key}})
+			}
+			if ref := env.ValueFrom.SecretKeyRef; ref != nil {
+				refs = append(refs, configReference{Kind: "Secret", Name: ref.Name,
+					Usage: usageIn("Used in environment variables", c), Optional: isOptional(ref.Optional), Keys: []string{ref.Key}})
+			}
+		}
+	}
+	return refs
+}
+
+// podRequiredReferences returns the ConfigMaps and Secrets, as kind/name, a
+// pod cannot start without: those referenced at least once without optional
+func podRequiredReferences(pod *corev1.Pod) map[string]bool {
+	required := map[string]bool{}
+	for _, ref := range podConfigReferences(pod) {
+		if !ref.Optional {
+			required[ref.Kind+"/"+ref.Name] = true
+		}
+	}
+	return required
+}
+
+// podReferencedNames returns the distinct names of a kind referenced by a pod
+func podReferencedNames(pod *corev1.Pod, kind string) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, ref := range podConfigReferences(pod) {
+		if ref.Kind == kind && !seen[ref.Name] {
+			seen[ref.Name] = true
+			names = append(names, ref.Name)
+		}
+	}
+	return names
+}
+
+// podReferencedKeys returns the distinct keys a pod reads from a ConfigMap or
+// Secret, nil when it reads every key through envFrom or a whole volume
+func podReferencedKeys(pod *corev1.Pod, kind, name string) []string {
+	keys := []string{}
+	seen := map[string]bool{}
+	for _, ref := range podConfigReferences(pod) {
+		if ref.Kind != kind || ref.Name != name {
+			continue
+		}
+		if len(ref.Keys) == 0 {
+			return nil
+		}
+		for _, key := range ref.Keys {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
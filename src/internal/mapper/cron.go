@@ -0,0 +1,213 @@
+package mapper
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed standard 5-field cron schedule, as understood by
+// the CronJob controller. Each field is a bitset of the values it matches
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// Unrestricted day fields change how day of month and day of week
+	// combine: both must match when either is *, otherwise either matches
+	domStar, dowStar bool
+}
+
+// cronDescriptors are the predefined schedules accepted instead of 5 fields
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronField describes the values allowed in one field of a schedule
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	cronMinute = cronField{name: "minute", min: 0, max: 59}
+	cronHour   = cronField{name: "hour", min: 0, max: 23}
+	cronDom    = cronField{name: "day of month", min: 1, max: 31}
+	cronMonth  = cronField{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	cronDow = cronField{name: "day of week", min: 0, max: 6, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// splitCronTimeZone splits a CRON_TZ= or TZ= prefix from a schedule
+func splitCronTimeZone(schedule string) (string, string) {
+	for _, prefix := range []string{"CRON_TZ=", "TZ="} {
+		if strings.HasPrefix(schedule, prefix) {
+			tz, rest, _ := strings.Cut(strings.TrimPrefix(schedule, prefix), " ")
+			return tz, strings.TrimSpace(rest)
+		}
+	}
+	return "", schedule
+}
+
+// parseCronSchedule parses a standard cron schedule or descriptor
+func parseCronSchedule(spec string) (*cronSchedule, error) {
+	if expanded, ok := cronDescriptors[strings.ToLower(strings.TrimSpace(spec))]; ok {
+		spec = expanded
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields, found %d in %q", len(fields), spec)
+	}
+
+	var s cronSchedule
+	var err error
+	if s.minute, _, err = parseCronField(fields[0], cronMinute); err != nil {
+		return nil, err
+	}
+	if s.hour, _, err = parseCronField(fields[1], cronHour); err != nil {
+		return nil, err
+	}
+	if s.dom, s.domStar, err = parseCronField(fields[2], cronDom); err != nil {
+		return nil, err
+	}
+	if s.month, _, err = parseCronField(fields[3], cronMonth); err != nil {
+		return nil, err
+	}
+	if s.dow, s.dowStar, err = parseCronField(fields[4], cronDow); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// parseCronValue parses a number or name of a field
+func parseCronValue(value string, f cronField) (int, error) {
+	if n, ok := f.names[strings.ToLower(value)]; ok {
+		return n, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s value %q", f.name, value)
+	}
+	if n < f.min || n > f.max {
+		return 0, fmt.Errorf("%s value %d out of range %d-%d", f.name, n, f.min, f.max)
+	}
+	return n, nil
+}
+
+// parseCronField parses a comma separated list of values, ranges and steps
+// into a bitset, reporting whether the field is an unrestricted * or ?
+func parseCronField(field string, f cronField) (uint64, bool, error) {
+	var bits uint64
+	star := false
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, false, fmt.Errorf("invalid %s step %q", f.name, stepPart)
+			}
+			step = n
+		}
+
+		var start, end int
+		switch {
+		case rangePart == "*" || rangePart == "?":
+			start, end = f.min, f.max
+			star = star || !hasStep || step == 1
+		case strings.Contains(rangePart, "-"):
+			low, high, _ := strings.Cut(rangePart, "-")
+			var err error
+			if start, err = parseCronValue(low, f); err != nil {
+				return 0, false, err
+			}
+			if end, err = parseCronValue(high, f); err != nil {
+				return 0, false, err
+			}
+			if start > end {
+				return 0, false, fmt.Errorf("invalid %s range %q", f.name, rangePart)
+			}
+		default:
+			var err error
+			if start, err = parseCronValue(rangePart, f); err != nil {
+				return 0, false, err
+			}
+			end = start
+			// "N/step" means from N to the end of the range
+			if hasStep {
+				end = f.max
+			}
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, star, nil
+}
+
+// dayMatches reports whether the schedule fires on the day of a time
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// cronSearchYears bounds the search for the next run; a schedule that does
+// not fire within it (such as February 30th) never fires
+const cronSearchYears = 5
+
+// next returns the first time after the given one at which the schedule
+// fires, in the location of the given time
+func (s *cronSchedule) next(after time.Time) (time.Time, bool) {
+	loc := after.Location()
+	t := time.Date(after.Year(), after.Month(), after.Day(), after.Hour(), after.Minute()+1, 0, 0, loc)
+	limit := t.AddDate(cronSearchYears, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// minInterval returns the shortest time between consecutive runs among the
+// next few runs after the given time
+func (s *cronSchedule) minInterval(after time.Time, runs int) (time.Duration, bool) {
+	prev, ok := s.next(after)
+	if !ok {
+		return 0, false
+	}
+	shortest := time.Duration(0)
+	for i := 0; i < runs; i++ {
+		t, ok := s.next(prev)
+		if !ok {
+			break
+		}
+		if gap := t.Sub(prev); shortest == 0 || gap < shortest {
+			shortest = gap
+		}
+		prev = t
+	}
+	return shortest, shortest > 0
+}
@@ -0,0 +1,122 @@
+package mapper
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronSchedule(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr bool
+	}{
+		{spec: "*/5 * * * *"},
+		{spec: "0 3 * * mon-fri"},
+		{spec: "30 2 1,15 jan,JUL ?"},
+		{spec: "5/15 8-18 * * *"},
+		{spec: "@daily"},
+		{spec: " @Hourly "},
+		{spec: "* * * *", wantErr: true},
+		{spec: "* * * * * *", wantErr: true},
+		{spec: "60 * * * *", wantErr: true},
+		{spec: "0 24 * * *", wantErr: true},
+		{spec: "0 0 0 * *", wantErr: true},
+		{spec: "0 0 * 13 *", wantErr: true},
+		{spec: "0 0 * * 7", wantErr: true},
+		{spec: "*/0 * * * *", wantErr: true},
+		{spec: "*/x * * * *", wantErr: true},
+		{spec: "0 5-2 * * *", wantErr: true},
+		{spec: "0 0 * * someday", wantErr: true},
+		{spec: "@every 5m", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			_, err := parseCronSchedule(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseCronSchedule(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSplitCronTimeZone(t *testing.T) {
+	tests := []struct {
+		schedule, wantTZ, wantSpec string
+	}{
+		{schedule: "0 3 * * *", wantTZ: "", wantSpec: "0 3 * * *"},
+		{schedule: "CRON_TZ=Europe/Paris 0 3 * * *", wantTZ: "Europe/Paris", wantSpec: "0 3 * * *"},
+		{schedule: "TZ=UTC @daily", wantTZ: "UTC", wantSpec: "@daily"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.schedule, func(t *testing.T) {
+			tz, spec := splitCronTimeZone(tt.schedule)
+			if tz != tt.wantTZ || spec != tt.wantSpec {
+				t.Errorf("splitCronTimeZone(%q) = %q, %q, want %q, %q", tt.schedule, tz, spec, tt.wantTZ, tt.wantSpec)
+			}
+		})
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	// Wednesday 2025-01-15 10:07
+	after := time.Date(2025, time.January, 15, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		spec   string
+		want   string
+		wantOK bool
+	}{
+		{spec: "*/5 * * * *", want: "2025-01-15 10:10", wantOK: true},
+		{spec: "7 10 * * *", want: "2025-01-16 10:07", wantOK: true},
+		{spec: "@hourly", want: "2025-01-15 11:00", wantOK: true},
+		{spec: "0 0 1 * *", want: "2025-02-01 00:00", wantOK: true},
+		{spec: "0 9 * * mon", want: "2025-01-20 09:00", wantOK: true},
+		{spec: "5/20 * * * *", want: "2025-01-15 10:25", wantOK: true},
+		// Either restricted day field matches: the 20th or the next Friday
+		{spec: "0 0 20 * fri", want: "2025-01-17 00:00", wantOK: true},
+		// An unrestricted day field requires both to match
+		{spec: "0 0 * * fri", want: "2025-01-17 00:00", wantOK: true},
+		{spec: "0 0 29 feb *", want: "2028-02-29 00:00", wantOK: true},
+		{spec: "0 0 30 feb *", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := parseCronSchedule(tt.spec)
+			if err != nil {
+				t.Fatalf("parseCronSchedule(%q): %v", tt.spec, err)
+			}
+			got, ok := s.next(after)
+			if ok != tt.wantOK {
+				t.Fatalf("next ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && got.Format("2006-01-02 15:04") != tt.want {
+				t.Errorf("next = %s, want %s", got.Format("2006-01-02 15:04"), tt.want)
+			}
+		})
+	}
+}
+
+func TestCronScheduleMinInterval(t *testing.T) {
+	after := time.Date(2025, time.January, 15, 10, 7, 0, 0, time.UTC)
+	tests := []struct {
+		spec   string
+		want   time.Duration
+		wantOK bool
+	}{
+		{spec: "*/5 * * * *", want: 5 * time.Minute, wantOK: true},
+		{spec: "0,10 * * * *", want: 10 * time.Minute, wantOK: true},
+		{spec: "@daily", want: 24 * time.Hour, wantOK: true},
+		{spec: "0 0 30 feb *", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := parseCronSchedule(tt.spec)
+			if err != nil {
+				t.Fatalf("parseCronSchedule(%q): %v", tt.spec, err)
+			}
+			got, ok := s.minInterval(after, 5)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("minInterval = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package mapper
+
+import (
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+// cronJobLocation returns the time zone a CronJob is scheduled in and its
+// schedule without any time zone prefix. Without a time zone the controller
+// manager's own zone applies, which is UTC on almost every cluster
+func cronJobLocation(cj *batchv1.CronJob) (*time.Location, string, string, error) {
+	prefixZone, schedule := splitCronTimeZone(cj.Spec.Schedule)
+	zone := prefixZone
+	if cj.Spec.TimeZone != nil {
+		zone = *cj.Spec.TimeZone
+	}
+	if zone == "" {
+		return time.UTC, "UTC (controller default)", schedule, nil
+	}
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return nil, zone, schedule, fmt.Errorf("unknown time zone %q", zone)
+	}
+	return loc, zone, schedule, nil
+}
+
+// cronJobOverlap describes how runs of a CronJob collide when a job may run
+// longer than the shortest interval between runs
+func cronJobOverlap(cj *batchv1.CronJob, interval time.Duration) string {
+	deadline := cj.Spec.JobTemplate.Spec.ActiveDeadlineSeconds
+	if deadline == nil {
+		return ""
+	}
+	runtime := time.Duration(*deadline) * time.Second
+	if runtime <= interval {
+		return ""
+	}
+	detail := fmt.Sprintf("activeDeadlineSeconds (%s) exceeds the %s between runs", runtime, interval)
+	switch cj.Spec.ConcurrencyPolicy {
+	case batchv1.ForbidConcurrent:
+		return "runs can be skipped: " + detail
+	case batchv1.ReplaceConcurrent:
+		return "running jobs can be replaced: " + detail
+	}
+	return "runs can overlap: " + detail
+}
+
+// showCronJobs lists the CronJobs of a namespace with their next scheduled
+// run, and flags schedules that never fire or whose runs collide
+func (rm *ResourceMapper) showCronJobs(namespace string) error {
+	cronJobs, err := rm.listCronJobs(namespace)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%sCronJobs:%s\n", colorYellow, colorReset)
+	now := time.Now()
+	for i := range cronJobs {
+		cj := &cronJobs[i]
+		loc, zone, schedule, err := cronJobLocation(cj)
+		if err != nil {
+			fmt.Printf("%s \"%s\" %s%v%s\n", cj.Name, cj.Spec.Schedule, colorRed, err, colorReset)
+			continue
+		}
+		sched, err := parseCronSchedule(schedule)
+		if err != nil {
+			fmt.Printf("%s \"%s\" %sinvalid schedule: %v%s\n", cj.Name, cj.Spec.Schedule, colorRed, err, colorReset)
+			continue
+		}
+
+		next, ok := sched.next(now.In(loc))
+		if !ok {
+			fmt.Printf("%s \"%s\" %s %snever fires (no run in the next %d years)%s\n",
+				cj.Name, schedule, zone, colorRed, cronSearchYears, colorReset)
+			continue
+		}
+		suspended := ""
+		if cj.Spec.Suspend != nil && *cj.Spec.Suspend {
+			suspended = fmt.Sprintf(" %s(suspended)%s", colorYellow, colorReset)
+		}
+		fmt.Printf("%s \"%s\" %s next run: %s%s\n", cj.Name, schedule, zone, next.Format("2006-01-02 15:04 MST"), suspended)
+
+		if interval, ok := sched.minInterval(now.In(loc), 20); ok {
+			if overlap := cronJobOverlap(cj, interval); overlap != "" {
+				fmt.Printf("    %s%s%s\n", colorYellow, overlap, colorReset)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package mapper
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/yaml"
+)
+
+// ResourceStatus is the health of a resource as shown in the map
+type ResourceStatus struct {
+	Phase   string `json:"phase,omitempty"`
+	Ready   *bool  `json:"ready,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// customResourceType is a custom resource type mapped through the dynamic client
+type customResourceType struct {
+	gvr  schema.GroupVersionResource
+	kind string
+}
+
+// statusRule holds the JSONPath expressions that extract the status of a
+// custom resource kind; empty expressions fall back to defaultStatusRule
+type statusRule struct {
+	Group   string `json:"group"`
+	Kind    string `json:"kind"`
+	Phase   string `json:"phase,omitempty"`
+	Ready   string `json:"ready,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// statusRulesFile is the format of the --status-rules file
+type statusRulesFile struct {
+	Rules []statusRule `json:"rules"`
+}
+
+// defaultStatusRule follows the common status.phase and Ready condition conventions
+var defaultStatusRule = statusRule{
+	Phase:   "{.status.phase}",
+	Ready:   `{.status.conditions[?(@.type=="Ready")].status}`,
+	Message: `{.status.conditions[?(@.type=="Ready")].message}`,
+}
+
+// loadStatusRules reads status extraction rules from a YAML file
+func loadStatusRules(path string) ([]statusRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading status rules: %v", err)
+	}
+	var file statusRulesFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing status rules %s: %v", path, err)
+	}
+	for _, rule := range file.Rules {
+		if rule.Kind == "" {
+			return nil, fmt.Errorf("status rule for group %q has no kind", rule.Group)
+		}
+		for _, expr := range []string{rule.Phase, rule.Ready, rule.Message} {
+			if expr == "" {
+				continue
+			}
+			if err := jsonpath.New(rule.Kind).Parse(expr); err != nil {
+				return nil, fmt.Errorf("invalid JSONPath %q in status rule for %s: %v", expr, rule.Kind, err)
+			}
+		}
+	}
+	return file.Rules, nil
+}
+
+// statusRuleFor returns the rule for a group and kind, filling unset
+// expressions from the default rule
+func statusRuleFor(rules []statusRule, group, kind string) statusRule {
+	rule := defaultStatusRule
+	for _, r := range rules {
+		if r.Group != group || r.Kind != kind {
+			continue
+		}
+		if r.Phase != "" {
+			rule.Phase = r.Phase
+		}
+		if r.Ready != "" {
+			rule.Ready = r.Ready
+		}
+		if r.Message != "" {
+			rule.Message = r.Message
+		}
+		break
+	}
+	return rule
+}
+
+// evalJSONPath evaluates a JSONPath expression, returning an empty string
+// when the fields are missing
+func evalJSONPath(expr string, data interface{}) (string, error) {
+	jp := jsonpath.New("status").AllowMissingKeys(true)
+	if err := jp.Parse(expr); err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := jp.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// extractStatus extracts the status of a custom resource with a rule
+func extractStatus(obj *unstructured.Unstructured, rule statusRule) (*ResourceStatus, error) {
+	phase, err := evalJSONPath(rule.Phase, obj.Object)
+	if err != nil {
+		return nil, fmt.Errorf("error extracting phase: %v", err)
+	}
+	ready, err := evalJSONPath(rule.Ready, obj.Object)
+	if err != nil {
+		return nil, fmt.Errorf("error extracting ready: %v", err)
+	}
+	message, err := evalJSONPath(rule.Message, obj.Object)
+	if err != nil {
+		return nil, fmt.Errorf("error extracting message: %v", err)
+	}
+
+	status := &ResourceStatus{Phase: phase, Message: message}
+	if ready != "" {
+		isReady := strings.EqualFold(ready, "true")
+		status.Ready = &isReady
+	}
+	return status, nil
+}
+
+// resolveCustomResources resolves resource[.version].group names, such as
+// certificates.cert-manager.io, through API discovery
+func (rm *ResourceMapper) resolveCustomResources(specs []string) ([]customResourceType, error) {
+	groupResources, err := restmapper.GetAPIGroupResources(rm.clientset.Discovery())
+	if err != nil {
+		return nil, fmt.Errorf("error discovering API resources: %v", err)
+	}
+	mapper := restmapper.NewDiscoveryRESTMapper(groupResources)
+
+	types := []customResourceType{}
+	for _, spec := range specs {
+		var gvr schema.GroupVersionResource
+		fullySpecified, groupResource := schema.ParseResourceArg(spec)
+		if fullySpecified != nil {
+			gvr, err = mapper.ResourceFor(*fullySpecified)
+		}
+		if fullySpecified == nil || err != nil {
+			gvr, err = mapper.ResourceFor(groupResource.WithVersion(""))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error resolving custom resource %s: %v", spec, err)
+		}
+
+		gvk, err := mapper.KindFor(gvr)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving kind of %s: %v", spec, err)
+		}
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving custom resource %s: %v", spec, err)
+		}
+		if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+			return nil, fmt.Errorf("custom resource %s is cluster-scoped, only namespaced resources can be mapped", spec)
+		}
+		types = append(types, customResourceType{gvr: gvr, kind: gvk.Kind})
+	}
+	return types, nil
+}
+
+// listCustomResources summarizes the custom resources of a namespace with
+// their extracted status, and the objects their relationship rules reference
+func (rm *ResourceMapper) listCustomResources(namespace string) ([]Resource, []ruleReference, error) {
+	resources := []Resource{}
+	refs := []ruleReference{}
+	if !rm.enabled("custom resources") {
+		return resources, refs, nil
+	}
+	for _, crt := range rm.customResources {
+		items, err := pagedList(rm, namespace, crt.gvr.GroupResource().String(), func(opts metav1.ListOptions) ([]unstructured.Unstructured, metav1.ListInterface, error) {
+			list, err := rm.dynamic.Resource(crt.gvr).Namespace(namespace).List(rm.ctx, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			return list.Items, list, nil
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("error getting %s: %v", crt.gvr.GroupResource(), err)
+		}
+		rule := statusRuleFor(rm.statusRules, crt.gvr.Group, crt.kind)
+		for i := range items {
+			obj := &items[i]
+			status, err := extractStatus(obj, rule)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error getting status of %s %s: %v", crt.kind, obj.GetName(), err)
+			}
+			objRefs, err := ruleReferences(rm.relationshipRules, crt.gvr.Group, crt.kind, obj)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error relating %s %s: %v", crt.kind, obj.GetName(), err)
+			}
+			refs = append(refs, objRefs...)
+			res := Resource{
+				Kind:        crt.kind,
+				Namespace:   obj.GetNamespace(),
+				Name:        obj.GetName(),
+				UID:         string(obj.GetUID()),
+				Labels:      obj.GetLabels(),
+				Annotations: trimAnnotations(obj.GetAnnotations()),
+				Attributes:  map[string]string{"apiVersion": obj.GetAPIVersion()},
+				Status:      status,
+			}
+			if rm.includeRaw {
+				res.Raw = unstructuredManifest(obj)
+			}
+			resources = append(resources, res)
+		}
+	}
+	return resources, refs, nil
+}
+
+// formatStatus formats a resource status for display
+func formatStatus(status *ResourceStatus) string {
+	if status == nil {
+		return ""
+	}
+	parts := []string{}
+	if status.Phase != "" {
+		parts = append(parts, status.Phase)
+	}
+	if status.Ready != nil {
+		if *status.Ready {
+			parts = append(parts, colorGreen+"ready"+colorReset)
+		} else {
+			parts = append(parts, colorRed+"not ready"+colorReset)
+		}
+	}
+	formatted := ""
+	if len(parts) > 0 {
+		formatted = " [" + strings.Join(parts, ", ") + "]"
+	}
+	if status.Message != "" {
+		formatted += " " + status.Message
+	}
+	return formatted
+}
+
+// showCustomResources lists the custom resources of a namespace with the
+// health extracted from their status
+func (rm *ResourceMapper) showCustomResources(namespace string) error {
+	resources, _, err := rm.listCustomResources(namespace)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%sCustom resources in namespace: %s%s\n", colorCyan, namespace, colorReset)
+	if len(resources) == 0 {
+		fmt.Println(sym("└── None"))
+		return nil
+	}
+	for i, res := range resources {
+		branch := sym("├──")
+		if i == len(resources)-1 {
+			branch = sym("└──")
+		}
+		fmt.Printf("%s %s: %s%s\n", branch, res.Kind, res.Name, formatStatus(res.Status))
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package mapper
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+
+	"sigs.k8s.io/yaml"
+)
+
+// relationshipDetails are the facts of a relationship, beyond its ends and
+// type, that description templates may use. Each is set for the types it
+// applies to and empty otherwise
+type relationshipDetails struct {
+	// Host, Path and Port are the rule and backend port of an ingress route
+	Host string
+	Path string
+	Port string
+	// Hosts are the hosts an ingress TLS certificate is used for
+	Hosts string
+	// Ports are the ports of a service selecting pods
+	Ports string
+	// Keys are the keys a pod reads from a ConfigMap or Secret, empty when it
+	// reads them all
+	Keys string
+	// Container is the init container a workload waits on a service in
+	Container string
+	// Alerts are the alerts a PrometheusRule raises on a workload
+	Alerts string
+	// Endpoints are the endpoints a monitor scrapes
+	Endpoints string
+}
+
+// relationshipData is what a description template is executed with
+type relationshipData struct {
+	From, To ResourceKey
+	Type     string
+	// Description is the built-in description
+	Description string
+	Broken      bool
+	relationshipDetails
+}
+
+// descriptionTemplates are the description templates in use per
+// relationship type; types without one keep the built-in descriptions
+var descriptionTemplates map[string]*template.Template
+
+// describeRelationship returns the description of a relationship, rendered
+// with the template of its type when there is one
+func describeRelationship(rel Relationship, details []relationshipDetails) string {
+	tmpl := descriptionTemplates[rel.Type]
+	if tmpl == nil {
+		return rel.Description
+	}
+	data := relationshipData{From: rel.From, To: rel.To, Type: rel.Type, Description: rel.Description, Broken: rel.Broken}
+	if len(details) > 0 {
+		data.relationshipDetails = details[0]
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return rel.Description
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// loadDescriptionTemplates reads a YAML file of description templates keyed
+// by relationship type, checking each type exists and each template only
+// uses the fields of a relationship
+func loadDescriptionTemplates(path string) (map[string]*template.Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading relationship templates: %v", err)
+	}
+	var sources map[string]string
+	if err := yaml.UnmarshalStrict(data, &sources); err != nil {
+		return nil, fmt.Errorf("error parsing relationship templates %s: %v", path, err)
+	}
+	types := []string{}
+	known := map[string]bool{}
+	for _, rt := range ontology().RelationshipTypes {
+		types = append(types, rt.Type)
+		known[rt.Type] = true
+	}
+	templates := map[string]*template.Template{}
+	for _, relType := range sortedKeys(sources) {
+		if !known[relType] {
+			sort.Strings(types)
+			return nil, fmt.Errorf("unknown relationship type '%s' in %s (expected one of %s)", relType, path, strings.Join(types, ", "))
+		}
+		tmpl, err := template.New(relType).Option("missingkey=error").Parse(sources[relType])
+		if err != nil {
+			return nil, fmt.Errorf("error parsing template of %s relationships: %v", relType, err)
+		}
+		if err := tmpl.Execute(&strings.Builder{}, relationshipData{Type: relType}); err != nil {
+			return nil, fmt.Errorf("error in template of %s relationships: %v", relType, err)
+		}
+		templates[relType] = tmpl
+	}
+	return templates, nil
+}
+
+// relationshipTemplatesFlag is the --relationship-templates flag, putting
+// the description templates of a file in use as soon as it is parsed
+type relationshipTemplatesFlag string
+
+func (f *relationshipTemplatesFlag) String() string {
+	return string(*f)
+}
+
+func (f *relationshipTemplatesFlag) Set(value string) error {
+	templates, err := loadDescriptionTemplates(value)
+	if err != nil {
+		return err
+	}
+	descriptionTemplates = templates
+	*f = relationshipTemplatesFlag(value)
+	return nil
+}
@@ -0,0 +1,268 @@
+package mapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// attributeDrift is an attribute whose live value departs from the baseline
+type attributeDrift struct {
+	Field    string `json:"field"`
+	Baseline string `json:"baseline"`
+	Live     string `json:"live"`
+}
+
+// resourceDrift is a resource that exists in the baseline and live but
+// differs
+type resourceDrift struct {
+	Resource   ResourceKey      `json:"resource"`
+	Attributes []attributeDrift `json:"attributes"`
+}
+
+// namespaceDrift is how the live topology of a namespace departs from the
+// baseline: resources and relationships added or removed since, and resources
+// changed. Pods are left out, as their names change with every rollout
+type namespaceDrift struct {
+	Namespace            string          `json:"namespace"`
+	Added                []ResourceKey   `json:"added,omitempty"`
+	Removed              []ResourceKey   `json:"removed,omitempty"`
+	Changed              []resourceDrift `json:"changed,omitempty"`
+	RelationshipsAdded   []Relationship  `json:"relationshipsAdded,omitempty"`
+	RelationshipsRemoved []Relationship  `json:"relationshipsRemoved,omitempty"`
+}
+
+// empty reports whether the namespace matches the baseline
+func (d *namespaceDrift) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 &&
+		len(d.RelationshipsAdded) == 0 && len(d.RelationshipsRemoved) == 0
+}
+
+// driftReport is the drift of the selected namespaces from a baseline
+// snapshot, listing only the namespaces that drifted
+type driftReport struct {
+	APIVersion string           `json:"apiVersion"`
+	Baseline   string           `json:"baseline"`
+	Taken      time.Time        `json:"taken"`
+	Checked    time.Time        `json:"checked"`
+	Namespaces []namespaceDrift `json:"namespaces"`
+}
+
+// driftFrom compares the live graphs of namespaces with the baseline
+func driftFrom(baseline *mapSnapshot, path string, live map[string]*Graph) *driftReport {
+	report := &driftReport{APIVersion: apiVersion, Baseline: path, Taken: baseline.Taken, Checked: time.Now(),
+		Namespaces: []namespaceDrift{}}
+	namespaces := map[string]bool{}
+	for ns := range baseline.Namespaces {
+		namespaces[ns] = true
+	}
+	for ns := range live {
+		namespaces[ns] = true
+	}
+	for _, ns := range sortedKeys(namespaces) {
+		drift := namespaceDrift{Namespace: ns}
+		var before, after []Resource
+		if g := baseline.Namespaces[ns]; g != nil {
+			before = g.Resources
+		}
+		if g := live[ns]; g != nil {
+			after = g.Resources
+		}
+		for _, diff := range compareResources(before, after) {
+			switch diff.Status() {
+			case "only-left":
+				drift.Removed = append(drift.Removed, diff.Left.Key())
+			case "only-right":
+				drift.Added = append(drift.Added, diff.Right.Key())
+			case "changed":
+				changed := resourceDrift{Resource: diff.Right.Key()}
+				for _, change := range diff.Changes {
+					changed.Attributes = append(changed.Attributes, attributeDrift{Field: change.Field, Baseline: change.Left, Live: change.Right})
+				}
+				drift.Changed = append(drift.Changed, changed)
+			}
+		}
+		for _, event := range diffGraphs(ns, baseline.Namespaces[ns], live[ns]) {
+			rel := event.Relationship
+			if rel == nil || rel.From.Kind == "Pod" || rel.To.Kind == "Pod" {
+				continue
+			}
+			switch event.Type {
+			case eventAdded:
+				drift.RelationshipsAdded = append(drift.RelationshipsAdded, *rel)
+			case eventRemoved:
+				drift.RelationshipsRemoved = append(drift.RelationshipsRemoved, *rel)
+			}
+		}
+		if !drift.empty() {
+			report.Namespaces = append(report.Namespaces, drift)
+		}
+	}
+	return report
+}
+
+// printDrift prints the drift of each namespace as a tree
+func (rm *ResourceMapper) printDrift(report *driftReport) {
+	fmt.Printf("%sDrift from baseline %s (taken %s)%s\n", colorBlue, report.Baseline,
+		report.Taken.Local().Format("2006-01-02 15:04"), colorReset)
+	if len(report.Namespaces) == 0 {
+		fmt.Printf("%sNo drift%s\n", colorGreen, colorReset)
+		return
+	}
+	for _, drift := range report.Namespaces {
+		fmt.Printf("%s%s%s\n", colorCyan, drift.Namespace, colorReset)
+		var lines []string
+		for _, key := range drift.Added {
+			lines = append(lines, fmt.Sprintf("%s+ %s/%s (not in baseline)%s", colorGreen, key.Kind, key.Name, colorReset))
+		}
+		for _, key := range drift.Removed {
+			lines = append(lines, fmt.Sprintf("%s- %s/%s (missing)%s", colorRed, key.Kind, key.Name, colorReset))
+		}
+		for _, changed := range drift.Changed {
+			line := fmt.Sprintf("%s~ %s/%s%s", colorYellow, changed.Resource.Kind, changed.Resource.Name, colorReset)
+			for _, attr := range changed.Attributes {
+				line += fmt.Sprintf("\n\t%s: %s %s %s", attr.Field, attr.Baseline, rm.createArrow(2), attr.Live)
+			}
+			lines = append(lines, line)
+		}
+		for _, rel := range drift.RelationshipsAdded {
+			lines = append(lines, fmt.Sprintf("%s+ %s/%s %s %s %s %s/%s%s", colorGreen, rel.From.Kind, rel.From.Name,
+				rm.createArrow(2), rel.Type, rm.createArrow(2), rel.To.Kind, rel.To.Name, colorReset))
+		}
+		for _, rel := range drift.RelationshipsRemoved {
+			lines = append(lines, fmt.Sprintf("%s- %s/%s %s %s %s %s/%s%s", colorRed, rel.From.Kind, rel.From.Name,
+				rm.createArrow(2), rel.Type, rm.createArrow(2), rel.To.Kind, rel.To.Name, colorReset))
+		}
+		for i, line := range lines {
+			branch, indent := sym("├──"), sym("│   ")
+			if i == len(lines)-1 {
+				branch, indent = sym("└──"), "    "
+			}
+			fmt.Printf("%s %s\n", branch, strings.ReplaceAll(line, "\t", indent+"    "))
+		}
+	}
+}
+
+// checkDrift maps the selected namespaces and compares them with the
+// baseline
+func (rm *ResourceMapper) checkDrift(global *globalFlags, baseline *mapSnapshot, path string) (*driftReport, error) {
+	namespaces, err := global.namespaces(rm)
+	if err != nil {
+		return nil, err
+	}
+	live, err := rm.captureSnapshot(namespaces)
+	if err != nil {
+		return nil, err
+	}
+	for _, ns := range sortedKeys(live.Namespaces) {
+		for _, e := range live.Namespaces[ns].Errors {
+			fmt.Printf("%sWarning: %s not mapped in %s (%s), so they show as removed%s\n", colorYellow, e.Source, ns, e.Message, colorReset)
+		}
+		for _, t := range live.Namespaces[ns].Truncated {
+			fmt.Printf("%sWarning: %s truncated in %s (%s), so the others show as removed%s\n", colorYellow, t.Source, ns, t, colorReset)
+		}
+	}
+	return driftFrom(baseline, path, live.Namespaces), nil
+}
+
+// watchDrift checks the drift every interval, reporting it whenever it
+// differs from the last check. Failed checks are reported and retried at the
+// next interval
+func (rm *ResourceMapper) watchDrift(global *globalFlags, baseline *mapSnapshot, path string, interval time.Duration, output string) {
+	fmt.Printf("%sChecking drift from %s every %s%s\n", colorGreen, path, interval, colorReset)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var last []namespaceDrift
+	for first := true; ; first = false {
+		if err := rm.reloadClients(); err != nil {
+			fmt.Printf("%sError reloading kubeconfig, still mapping %s: %v%s\n", colorRed, rm.host, err, colorReset)
+		}
+		// Every check sees the current nodes and namespaces
+		rm.clusterCache = nil
+		report, err := rm.checkDrift(global, baseline, path)
+		switch {
+		case err != nil:
+			fmt.Printf("%s[%s] Error: %v%s\n", colorRed, time.Now().Format("15:04:05"), err, colorReset)
+		case first || !reflect.DeepEqual(report.Namespaces, last):
+			last = report.Namespaces
+			if err := rm.writeDrift(report, output); err != nil {
+				fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+			}
+		}
+		<-ticker.C
+	}
+}
+
+// writeDrift prints a drift report as text or JSON
+func (rm *ResourceMapper) writeDrift(report *driftReport, output string) error {
+	if output == "json" {
+		data, err := json.Marshal(report)
+		if err != nil {
+			return fmt.Errorf("error encoding drift: %v", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	fmt.Printf("[%s] ", report.Checked.Format("15:04:05"))
+	rm.printDrift(report)
+	return nil
+}
+
+// runDrift runs the drift subcommand: compares the live topology with an
+// approved baseline snapshot, once or every --interval
+func runDrift(args []string) error {
+	var global globalFlags
+	fs := newSubcommandFlagSet("drift", &global)
+	baselinePath := fs.String("baseline", "", "Approved snapshot to compare with, as written by snapshot save")
+	interval := fs.Duration("interval", 0, "Keep running, checking the drift every interval (e.g. 5m) and reporting it when it changes")
+	output := fs.String("output", "text", "Output format: text or json (one line per report with --interval)")
+	exitCode := fs.Bool("exit-code", false, fmt.Sprintf("Exit with status %d when the cluster drifted from the baseline", exitFindings))
+	fs.Parse(args)
+
+	if *baselinePath == "" {
+		return fmt.Errorf("drift requires --baseline, a snapshot written by snapshot save")
+	}
+	if *output != "text" && *output != "json" {
+		return fmt.Errorf("invalid --output value '%s' (expected text or json)", *output)
+	}
+	if *interval < 0 || (*interval > 0 && *exitCode) {
+		return fmt.Errorf("--interval expects a positive duration and cannot be combined with --exit-code")
+	}
+	baseline, err := loadMapSnapshot(*baselinePath)
+	if err != nil {
+		return err
+	}
+	baseline.filter(global.namespace, global.excludeNs, false)
+
+	rm, err := global.newResourceMapper()
+	if err != nil {
+		return err
+	}
+	if baseline.Cluster != rm.host {
+		fmt.Printf("%sWarning: the baseline was taken of %s, comparing it with %s%s\n", colorYellow, baseline.Cluster, rm.host, colorReset)
+	}
+	if *interval > 0 {
+		rm.watchDrift(&global, baseline, *baselinePath, *interval, *output)
+		return nil
+	}
+	report, err := rm.checkDrift(&global, baseline, *baselinePath)
+	if err != nil {
+		return err
+	}
+	if *output == "json" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error encoding drift: %v", err)
+		}
+		fmt.Println(string(data))
+	} else {
+		rm.printDrift(report)
+	}
+	if *exitCode && len(report.Namespaces) > 0 {
+		os.Exit(exitFindings)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package mapper
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+)
+
+// leaderAnnotation marks the Endpoints objects old components use as
+// leader election locks, which belong to no service
+const leaderAnnotation = "control-plane.alpha.kubernetes.io/leader"
+
+// endpointObjects holds the EndpointSlices and Endpoints of a namespace with
+// the services and pods they should point at
+type endpointObjects struct {
+	slices    []discoveryv1.EndpointSlice
+	endpoints []corev1.Endpoints
+	services  map[string]bool
+	pods      map[string]bool
+}
+
+// endpointOrphan is an EndpointSlice or Endpoints object pointing at a
+// service or pods that do not exist
+type endpointOrphan struct {
+	Kind    string
+	Name    string
+	Problem string
+}
+
+// listEndpointObjects lists the endpoint objects of a namespace
+func (rm *ResourceMapper) listEndpointObjects(namespace string) (*endpointObjects, error) {
+	slices, err := rm.listEndpointSlices(namespace)
+	if err != nil {
+		return nil, err
+	}
+	endpoints, err := rm.listEndpoints(namespace)
+	if err != nil {
+		return nil, err
+	}
+	services, err := rm.listServices(namespace)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := rm.listPods(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	objs := &endpointObjects{slices: slices, endpoints: endpoints, services: map[string]bool{}, pods: map[string]bool{}}
+	for _, svc := range services {
+		objs.services[svc.Name] = true
+	}
+	for _, pod := range pods {
+		objs.pods[pod.Name] = true
+	}
+	return objs, nil
+}
+
+// missingPods returns the pods referenced by endpoint target references that
+// do not exist
+func (objs *endpointObjects) missingPods(refs []*corev1.ObjectReference) []string {
+	missing := []string{}
+	seen := map[string]bool{}
+	for _, ref := range refs {
+		if ref == nil || ref.Kind != "Pod" || objs.pods[ref.Name] || seen[ref.Name] {
+			continue
+		}
+		seen[ref.Name] = true
+		missing = append(missing, ref.Name)
+	}
+	return missing
+}
+
+// orphans returns the endpoint objects pointing at missing services or pods.
+// Terminating endpoints are skipped, as their pods may already be gone
+func (objs *endpointObjects) orphans() []endpointOrphan {
+	orphans := []endpointOrphan{}
+	for _, slice := range objs.slices {
+		service := slice.Labels[discoveryv1.LabelServiceName]
+		switch {
+		case service == "":
+			orphans = append(orphans, endpointOrphan{"EndpointSlice", slice.Name, "not attached to a service (no " + discoveryv1.LabelServiceName + " label)"})
+			continue
+		case !objs.services[service]:
+			orphans = append(orphans, endpointOrphan{"EndpointSlice", slice.Name, "service " + service + " does not exist"})
+			continue
+		}
+		refs := []*corev1.ObjectReference{}
+		for _, endpoint := range slice.Endpoints {
+			if endpoint.Conditions.Terminating == nil || !*endpoint.Conditions.Terminating {
+				refs = append(refs, endpoint.TargetRef)
+			}
+		}
+		for _, pod := range objs.missingPods(refs) {
+			orphans = append(orphans, endpointOrphan{"EndpointSlice", slice.Name, "points at missing pod " + pod})
+		}
+	}
+
+	for _, ep := range objs.endpoints {
+		if _, lock := ep.Annotations[leaderAnnotation]; lock {
+			continue
+		}
+		if !objs.services[ep.Name] {
+			orphans = append(orphans, endpointOrphan{"Endpoints", ep.Name, "service " + ep.Name + " does not exist"})
+			continue
+		}
+		refs := []*corev1.ObjectReference{}
+		for _, subset := range ep.Subsets {
+			for _, address := range subset.Addresses {
+				refs = append(refs, address.TargetRef)
+			}
+			for _, address := range subset.NotReadyAddresses {
+				refs = append(refs, address.TargetRef)
+			}
+		}
+		for _, pod := range objs.missingPods(refs) {
+			orphans = append(orphans, endpointOrphan{"Endpoints", ep.Name, "points at missing pod " + pod})
+		}
+	}
+	return orphans
+}
+
+// showEndpointInventory lists the EndpointSlices and Endpoints of a namespace
+// and flags those pointing at services or pods that no longer exist
+func (rm *ResourceMapper) showEndpointInventory(namespace string) error {
+	objs, err := rm.listEndpointObjects(namespace)
+	if err != nil {
+		return err
+	}
+	if len(objs.slices) == 0 && len(objs.endpoints) == 0 {
+		return nil
+	}
+
+	fmt.Printf("\n%sEndpoint objects in namespace: %s%s\n", colorCyan, namespace, colorReset)
+	fmt.Printf(sym("├── EndpointSlices: %d\n"), len(objs.slices))
+	for _, slice := range objs.slices {
+		ready := 0
+		for _, endpoint := range slice.Endpoints {
+			if endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready {
+				ready++
+			}
+		}
+		service := slice.Labels[discoveryv1.LabelServiceName]
+		if service == "" {
+			service = "-"
+		}
+		fmt.Printf(sym("│   %s %s (service %s, %d/%d endpoints ready)\n"), rm.createArrow(4), slice.Name, service, ready, len(slice.Endpoints))
+	}
+	fmt.Printf(sym("├── Endpoints: %d\n"), len(objs.endpoints))
+
+	orphans := objs.orphans()
+	if len(orphans) == 0 {
+		fmt.Printf(sym("└── %sNo orphaned endpoint objects%s\n"), colorGreen, colorReset)
+		return nil
+	}
+	fmt.Printf(sym("└── %sOrphaned:%s\n"), colorRed, colorReset)
+	for _, o := range orphans {
+		fmt.Printf("    %s %s %s: %s\n", rm.createArrow(4), o.Kind, o.Name, o.Problem)
+	}
+	return nil
+}
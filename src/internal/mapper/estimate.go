@@ -0,0 +1,185 @@
+package mapper
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Calls a namespace costs beyond the lists of its processors: the namespace
+// get of the logging coverage
+const fixedCallsPerNamespace = 1
+
+// Calls a run costs once beyond the lists of its processors: webhook
+// configurations (2) and the namespaces they select, and the DaemonSets of
+// log shippers
+const fixedCallsPerRun = 4
+
+// namespaceEstimate holds the predicted cost of mapping one namespace
+type namespaceEstimate struct {
+	namespace  string
+	pods       int
+	services   int
+	configMaps int
+	calls      int
+}
+
+// objects returns the objects counted in the namespace, which the time and
+// memory its lists take grow with
+func (est namespaceEstimate) objects() int {
+	return est.pods + est.services + est.configMaps
+}
+
+// processorCalls returns the lists the enabled processors make in each
+// namespace and once per run, leaving out the types the cluster does not
+// serve and, with --compact, those only the per-kind listings use
+func (rm *ResourceMapper) processorCalls() (perNamespace, perRun int) {
+	for _, p := range processors {
+		if !rm.enabled(p.what) {
+			continue
+		}
+		switch {
+		case p.what == "custom resources":
+			perNamespace += len(rm.customResources)
+		case p.listing == notListed || !rm.served(p.what):
+		case p.listing == listedPerNamespace, p.listing == listedUnlessCompact && !rm.compact:
+			perNamespace++
+		case p.listing == listedPerRun:
+			perRun++
+		}
+	}
+	return perNamespace, perRun
+}
+
+// countFromList returns the total number of items of a list fetched with
+// Limit: 1, using the remaining item count reported by the API server
+func countFromList(items int, meta metav1.ListMeta) int {
+	if meta.RemainingItemCount != nil {
+		return items + int(*meta.RemainingItemCount)
+	}
+	return items
+}
+
+// mappingDuration predicts how long the calls of a run take at a latency per
+// call: the lists of each namespace are spread over workers calls at once,
+// the calls made once per run are made one at a time
+func mappingDuration(latency time.Duration, perRun, perNamespace, namespaces, workers int) time.Duration {
+	workers = max(min(workers, perNamespace), 1)
+	rounds := (perNamespace + workers - 1) / workers
+	return latency * time.Duration(perRun+namespaces*rounds)
+}
+
+// estimateNamespace counts the objects of a namespace that weigh most on
+// mapping it
+func (rm *ResourceMapper) estimateNamespace(namespace string, calls int) (namespaceEstimate, error) {
+	est := namespaceEstimate{namespace: namespace, calls: calls}
+
+	// Only a single item is fetched, the totals come from the list metadata
+	pods, err := rm.clientset.CoreV1().Pods(namespace).List(rm.ctx, metav1.ListOptions{Limit: 1})
+	if err != nil {
+		return est, fmt.Errorf("error counting pods: %v", err)
+	}
+	est.pods = countFromList(len(pods.Items), pods.ListMeta)
+
+	services, err := rm.clientset.CoreV1().Services(namespace).List(rm.ctx, metav1.ListOptions{Limit: 1})
+	if err != nil {
+		return est, fmt.Errorf("error counting services: %v", err)
+	}
+	est.services = countFromList(len(services.Items), services.ListMeta)
+
+	configMaps, err := rm.clientset.CoreV1().ConfigMaps(namespace).List(rm.ctx, metav1.ListOptions{Limit: 1})
+	if err != nil {
+		return est, fmt.Errorf("error counting configmaps: %v", err)
+	}
+	est.configMaps = countFromList(len(configMaps.Items), configMaps.ListMeta)
+	return est, nil
+}
+
+// showEstimate predicts how many API calls and how long a full mapping of the
+// given namespaces will take, without running it
+func (rm *ResourceMapper) showEstimate(namespaces []string) error {
+	fmt.Printf("%sAPI budget estimate%s\n", colorBlue, colorReset)
+
+	start := time.Now()
+	version, err := rm.clientset.Discovery().ServerVersion()
+	if err != nil {
+		return fmt.Errorf("error querying server version: %v", err)
+	}
+	probeCalls := 1
+	capabilities := rm.capabilitySummary()
+
+	perNamespace, perRun := rm.processorCalls()
+	perNamespace += fixedCallsPerNamespace
+	estimates := make([]namespaceEstimate, 0, len(namespaces))
+	totalCalls := 1 + fixedCallsPerRun + perRun // and listing or getting the namespaces
+	if rm.capabilities != nil {
+		// Discovery, made once at startup
+		totalCalls += rm.capabilities.calls
+	}
+	if rm.access != nil {
+		// One access review per enabled type and verb, for identities allowed
+		// everywhere
+		for _, check := range accessChecks {
+			if rm.enabled(check.what) {
+				totalCalls += len(accessVerbs)
+			}
+		}
+	}
+	totalPods, totalServices, totalConfigMaps := 0, 0, 0
+	for _, ns := range namespaces {
+		est, err := rm.estimateNamespace(ns, perNamespace)
+		if err != nil {
+			return fmt.Errorf("error estimating namespace %s: %v", ns, err)
+		}
+		probeCalls += 3
+		estimates = append(estimates, est)
+		totalCalls += est.calls
+		totalPods += est.pods
+		totalServices += est.services
+		totalConfigMaps += est.configMaps
+	}
+	avgLatency := time.Since(start) / time.Duration(probeCalls)
+	workers := 1
+	if rm.pool != nil {
+		workers = cap(rm.pool.slots)
+	}
+	runCalls := totalCalls - len(namespaces)*perNamespace
+	duration := mappingDuration(avgLatency, runCalls, perNamespace, len(namespaces), workers)
+	serial := mappingDuration(avgLatency, runCalls, perNamespace, len(namespaces), 1)
+	// Calls beyond the burst wait for the client rate limit, unless there is
+	// none, as for mappers created for clients
+	rate := "no client rate limit"
+	if rm.opts.QPS > 0 {
+		rate = fmt.Sprintf("at most %g calls/s", rm.opts.QPS)
+		limited := time.Duration(float64(max(totalCalls-rm.opts.Burst, 0)) / rm.opts.QPS * float64(time.Second))
+		duration = max(duration, limited)
+		serial = max(serial, limited)
+	}
+
+	fmt.Printf(sym("├── Server: %s (%s)\n"), version.GitVersion, rm.host)
+	fmt.Printf(sym("├── APIs: %s\n"), capabilities)
+	fmt.Printf(sym("├── Namespaces: %d\n"), len(namespaces))
+	fmt.Printf(sym("├── Pods: %d, Services: %d, ConfigMaps: %d\n"), totalPods, totalServices, totalConfigMaps)
+	fmt.Printf(sym("├── Estimated API calls: %d (%d per namespace)\n"), totalCalls, perNamespace)
+	fmt.Printf(sym("└── Estimated duration: ~%s with up to %d calls at once, ~%s one at a time (%s per call measured over %d probe calls, %s)\n"),
+		duration.Round(100*time.Millisecond), workers, serial.Round(100*time.Millisecond),
+		avgLatency.Round(time.Millisecond), probeCalls, rate)
+
+	// Every namespace makes the same calls, the objects they return make
+	// the difference
+	sort.SliceStable(estimates, func(i, j int) bool {
+		return estimates[i].objects() > estimates[j].objects()
+	})
+	if len(estimates) > 10 {
+		estimates = estimates[:10]
+	}
+	fmt.Printf("\n%sLargest namespaces:%s\n", colorYellow, colorReset)
+	for _, est := range estimates {
+		fmt.Printf("    %s %s: %d objects (%d pods, %d services, %d configmaps)\n",
+			rm.createArrow(4), est.namespace, est.objects(), est.pods, est.services, est.configMaps)
+	}
+
+	return nil
+}
@@ -0,0 +1,30 @@
+package mapper
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMappingDuration(t *testing.T) {
+	tests := []struct {
+		name         string
+		perRun       int
+		perNamespace int
+		namespaces   int
+		workers      int
+		want         time.Duration
+	}{
+		{name: "one at a time", perRun: 5, perNamespace: 16, namespaces: 3, workers: 1, want: 53 * time.Second},
+		{name: "worker pool", perRun: 5, perNamespace: 16, namespaces: 3, workers: 4, want: 17 * time.Second},
+		{name: "partial round", perRun: 5, perNamespace: 18, namespaces: 3, workers: 4, want: 20 * time.Second},
+		{name: "more workers than calls", perRun: 5, perNamespace: 2, namespaces: 3, workers: 8, want: 8 * time.Second},
+		{name: "no namespaces", perRun: 5, perNamespace: 16, workers: 4, want: 5 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mappingDuration(time.Second, tt.perRun, tt.perNamespace, tt.namespaces, tt.workers); got != tt.want {
+				t.Errorf("mappingDuration = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package mapper
+
+import (
+	"fmt"
+)
+
+// Exit codes, so that pipelines can tell a broken run from a run with
+// findings: 1 is returned for any error stopping the run
+const (
+	exitOK       = 0
+	exitError    = 1
+	exitPartial  = 2
+	exitFindings = 3
+)
+
+// severityRank orders severities from info (1) to error (3), 0 being unknown
+func severityRank(severity string) int {
+	switch severity {
+	case severityInfo:
+		return 1
+	case severityWarning:
+		return 2
+	case severityError:
+		return 3
+	}
+	return 0
+}
+
+// checkFailOn validates a --fail-on severity; empty disables the threshold
+func checkFailOn(failOn string) error {
+	if failOn != "" && severityRank(failOn) == 0 {
+		return fmt.Errorf("invalid --fail-on value '%s' (expected info, warning or error)", failOn)
+	}
+	return nil
+}
+
+// findingsAtOrAbove counts the findings at or above a severity
+func findingsAtOrAbove(findings []Finding, severity string) int {
+	count := 0
+	for _, f := range findings {
+		if severityRank(f.Severity) >= severityRank(severity) {
+			count++
+		}
+	}
+	return count
+}
+
+// exitStatus returns the exit code of a run that completed: findings at or
+// above the --fail-on severity take precedence over partial failures, as
+// they fail the gate whatever the namespaces left unchecked hold
+func exitStatus(partial bool, findings []Finding, failOn string) int {
+	if failOn != "" {
+		if count := findingsAtOrAbove(findings, failOn); count > 0 {
+			fmt.Printf("%s%d finding(s) at or above severity %s%s\n", colorRed, count, failOn, colorReset)
+			return exitFindings
+		}
+	}
+	if partial {
+		return exitPartial
+	}
+	return exitOK
+}
@@ -0,0 +1,386 @@
+package mapper
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FindingsExporter publishes findings to an external destination
+type FindingsExporter interface {
+	Export(findings []Finding) error
+}
+
+// exporterFactory creates an exporter for a destination argument
+// (a file path, URL or PR reference depending on the exporter)
+type exporterFactory func(target string) (FindingsExporter, error)
+
+// findingsExporters holds the registered exporters by name
+var findingsExporters = map[string]exporterFactory{}
+
+// registerExporter makes an exporter available to --export-findings
+func registerExporter(name string, factory exporterFactory) {
+	findingsExporters[name] = factory
+}
+
+func init() {
+	registerExporter("stdout", newStdoutExporter)
+	registerExporter("junit", newJUnitExporter)
+	registerExporter("sarif", newSARIFExporter)
+	registerExporter("webhook", newWebhookExporter)
+	registerExporter("github", newGitHubExporter)
+	registerExporter("gitlab", newGitLabExporter)
+}
+
+// newExporter creates an exporter from a "name" or "name=target" spec
+func newExporter(spec string) (FindingsExporter, error) {
+	name, target, _ := strings.Cut(spec, "=")
+	factory, ok := findingsExporters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown findings exporter '%s' (available: %s)",
+			name, strings.Join(sortedKeys(findingsExporters), ", "))
+	}
+	return factory(target)
+}
+
+// exportFindings sends findings to every configured exporter
+func exportFindings(specs []string, findings []Finding) error {
+	for _, spec := range specs {
+		exporter, err := newExporter(spec)
+		if err != nil {
+			return err
+		}
+		if err := exporter.Export(findings); err != nil {
+			return fmt.Errorf("error exporting findings to %s: %v", spec, err)
+		}
+	}
+	return nil
+}
+
+// stdoutExporter prints findings to the terminal
+type stdoutExporter struct{}
+
+func newStdoutExporter(string) (FindingsExporter, error) {
+	return stdoutExporter{}, nil
+}
+
+func (stdoutExporter) Export(findings []Finding) error {
+	fmt.Printf("\n%sFindings (%d):%s\n", colorBlue, len(findings), colorReset)
+	for _, f := range findings {
+		color := colorCyan
+		switch f.Severity {
+		case severityError:
+			color = colorRed
+		case severityWarning:
+			color = colorYellow
+		}
+		fmt.Printf("%s[%s]%s %s %s: %s\n", color, f.Severity, colorReset, f.Resource(), f.Rule, f.Message)
+	}
+	return nil
+}
+
+// requireTarget returns an error when an exporter was given no destination
+func requireTarget(exporter, target, what string) error {
+	if target == "" {
+		return fmt.Errorf("the %s exporter requires a %s (%s=<%s>)", exporter, what, exporter, what)
+	}
+	return nil
+}
+
+// writeFile writes an encoded report to a file
+func writeFile(path string, data []byte) error {
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+	return nil
+}
+
+// junitExporter writes findings as a JUnit XML report for CI test dashboards
+type junitExporter struct {
+	path string
+}
+
+func newJUnitExporter(target string) (FindingsExporter, error) {
+	if err := requireTarget("junit", target, "path"); err != nil {
+		return nil, err
+	}
+	return junitExporter{path: target}, nil
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitTestCase struct {
+	Name      string       `xml:"name,attr"`
+	ClassName string       `xml:"classname,attr"`
+	Failure   junitFailure `xml:"failure"`
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+func (e junitExporter) Export(findings []Finding) error {
+	suite := junitTestSuite{
+		Name:      "k8s-resource-mapper",
+		Tests:     len(findings),
+		Failures:  len(findings),
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+	for _, f := range findings {
+		suite.TestCases = append(suite.TestCases, junitTestCase{
+			Name:      fmt.Sprintf("%s/%s: %s", f.Kind, f.Name, f.Rule),
+			ClassName: f.Namespace,
+			Failure: junitFailure{
+				Message: f.Message,
+				Type:    f.Severity,
+				Text:    fmt.Sprintf("%s %s: %s", f.Resource(), f.Rule, f.Message),
+			},
+		})
+	}
+
+	data, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding JUnit report: %v", err)
+	}
+	return writeFile(e.path, append([]byte(xml.Header), data...))
+}
+
+// sarifExporter writes findings in the SARIF format used by code scanning tools
+type sarifExporter struct {
+	path string
+}
+
+func newSARIFExporter(target string) (FindingsExporter, error) {
+	if err := requireTarget("sarif", target, "path"); err != nil {
+		return nil, err
+	}
+	return sarifExporter{path: target}, nil
+}
+
+// sarifLevel maps finding severities to SARIF result levels
+func sarifLevel(severity string) string {
+	switch severity {
+	case severityError:
+		return "error"
+	case severityWarning:
+		return "warning"
+	}
+	return "note"
+}
+
+// sarifFingerprint identifies a finding across runs by its rule, resource
+// and rank among the findings of both, so that code scanning tracks it while
+// its message changes
+func sarifFingerprint(f Finding, rank int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%d", f.Rule, f.Resource(), rank)))
+	return hex.EncodeToString(sum[:])
+}
+
+// sarifURI returns the artifact URI of a manifest, relative to the working
+// directory where possible as code scanning expects repository paths
+func sarifURI(path string) string {
+	if wd, err := os.Getwd(); err == nil && filepath.IsAbs(path) {
+		if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			path = rel
+		}
+	}
+	return filepath.ToSlash(filepath.Clean(path))
+}
+
+// sarifRule describes a rule of the report, from the built-in rules or the
+// policy it comes from
+func sarifRule(id string) map[string]interface{} {
+	rule := map[string]interface{}{"id": id}
+	for _, builtin := range auditRules {
+		if builtin.name == id {
+			rule["shortDescription"] = map[string]string{"text": builtin.description}
+			rule["defaultConfiguration"] = map[string]string{"level": sarifLevel(builtin.severity)}
+		}
+	}
+	if name, ok := strings.CutPrefix(id, "policy/"); ok {
+		rule["shortDescription"] = map[string]string{"text": "Policy " + name}
+	}
+	return rule
+}
+
+func (e sarifExporter) Export(findings []Finding) error {
+	rules := map[string]bool{}
+	ranks := map[string]int{}
+	results := []map[string]interface{}{}
+	for _, f := range findings {
+		rules[f.Rule] = true
+		rank := ranks[f.Rule+"|"+f.Resource()]
+		ranks[f.Rule+"|"+f.Resource()]++
+		// Code scanning needs a file: the manifest declaring the object, or
+		// else the resource reference standing in for one
+		uri := f.Resource()
+		if f.Source != "" {
+			uri = sarifURI(f.Source)
+		}
+		results = append(results, map[string]interface{}{
+			"ruleId":  f.Rule,
+			"level":   sarifLevel(f.Severity),
+			"message": map[string]string{"text": fmt.Sprintf("%s %s: %s", f.Kind, f.Name, f.Message)},
+			"locations": []map[string]interface{}{{
+				"physicalLocation": map[string]interface{}{
+					"artifactLocation": map[string]string{"uri": uri},
+				},
+				"logicalLocations": []map[string]string{{
+					"fullyQualifiedName": f.Resource(),
+					"kind":               "resource",
+				}},
+			}},
+			"partialFingerprints": map[string]string{"resourceRule/v1": sarifFingerprint(f, rank)},
+			"properties":          map[string]string{"namespace": f.Namespace, "kind": f.Kind, "name": f.Name},
+		})
+	}
+
+	ruleList := []map[string]interface{}{}
+	for _, rule := range sortedKeys(rules) {
+		ruleList = append(ruleList, sarifRule(rule))
+	}
+
+	report := map[string]interface{}{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": []map[string]interface{}{{
+			"tool": map[string]interface{}{
+				"driver": map[string]interface{}{
+					"name":           "k8s-resource-mapper",
+					"informationUri": "https://github.com/ai4design/k8s-resource-mapper",
+					"rules":          ruleList,
+				},
+			},
+			"results": results,
+		}},
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding SARIF report: %v", err)
+	}
+	return writeFile(e.path, data)
+}
+
+// webhookExporter POSTs findings as JSON to an HTTP endpoint
+type webhookExporter struct {
+	url string
+}
+
+func newWebhookExporter(target string) (FindingsExporter, error) {
+	if err := requireTarget("webhook", target, "url"); err != nil {
+		return nil, err
+	}
+	return webhookExporter{url: target}, nil
+}
+
+// postJSON sends a JSON payload and checks for a successful response
+func postJSON(url string, payload interface{}, headers map[string]string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error encoding payload: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+	return nil
+}
+
+func (e webhookExporter) Export(findings []Finding) error {
+	return postJSON(e.url, map[string]interface{}{
+		"source":   "k8s-resource-mapper",
+		"time":     time.Now().Format(time.RFC3339),
+		"findings": findings,
+	}, nil)
+}
+
+// prCommentExporter posts a findings summary as a comment on a GitHub pull
+// request or a GitLab merge request
+type prCommentExporter struct {
+	ref prReference
+}
+
+// newGitHubExporter parses an "owner/repo#number" pull request reference.
+// The token is read from GITHUB_TOKEN.
+func newGitHubExporter(target string) (FindingsExporter, error) {
+	return newPRCommentExporter("github", target)
+}
+
+// newGitLabExporter parses a "group/project!iid" merge request reference.
+// The token is read from GITLAB_TOKEN.
+func newGitLabExporter(target string) (FindingsExporter, error) {
+	return newPRCommentExporter("gitlab", target)
+}
+
+func newPRCommentExporter(provider, target string) (FindingsExporter, error) {
+	if err := requireTarget(provider, target, "pr"); err != nil {
+		return nil, err
+	}
+	ref, err := parsePRReference(provider + ":" + target)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ref.token(); err != nil {
+		return nil, err
+	}
+	return prCommentExporter{ref: ref}, nil
+}
+
+// findingsMarkdown renders a findings summary as a Markdown table
+func findingsMarkdown(findings []Finding) string {
+	var sb strings.Builder
+	sb.WriteString("### Kubernetes Resource Mapper findings\n\n")
+	if len(findings) == 0 {
+		sb.WriteString("No findings.\n")
+		return sb.String()
+	}
+
+	sorted := append([]Finding(nil), findings...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Resource() < sorted[j].Resource()
+	})
+
+	sb.WriteString("| Severity | Resource | Rule | Message |\n")
+	sb.WriteString("|----------|----------|------|---------|\n")
+	for _, f := range sorted {
+		fmt.Fprintf(&sb, "| %s | `%s` | %s | %s |\n", f.Severity, f.Resource(), f.Rule, f.Message)
+	}
+	return sb.String()
+}
+
+func (e prCommentExporter) Export(findings []Finding) error {
+	return e.ref.postComment(findingsMarkdown(findings))
+}
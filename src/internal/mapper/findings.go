@@ -0,0 +1,135 @@
+package mapper
+
+import (
+	"fmt"
+)
+
+// Finding severities
+const (
+	severityInfo    = "info"
+	severityWarning = "warning"
+	severityError   = "error"
+)
+
+// Finding is an issue detected while mapping a namespace
+type Finding struct {
+	Rule      string `json:"rule"`
+	Severity  string `json:"severity"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Message   string `json:"message"`
+	// Source is the manifest file declaring the object, when known
+	Source string `json:"source,omitempty"`
+}
+
+// Resource returns the kind/namespace/name reference of the affected object
+func (f Finding) Resource() string {
+	return fmt.Sprintf("%s/%s/%s", f.Kind, f.Namespace, f.Name)
+}
+
+// collectFindings checks a namespace for common misconfigurations
+func (rm *ResourceMapper) collectFindings(namespace string) ([]Finding, error) {
+	var findings []Finding
+
+	pods, err := rm.listPods(namespace)
+	if err != nil {
+		return nil, err
+	}
+	index, err := rm.podIndexFor(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	services, err := rm.listServices(namespace)
+	if err != nil {
+		return nil, err
+	}
+	for _, service := range services {
+		if len(service.Spec.Selector) == 0 {
+			continue
+		}
+		if len(index.matchLabels(service.Spec.Selector)) == 0 {
+			findings = append(findings, Finding{
+				Rule:      "service-without-pods",
+				Severity:  severityWarning,
+				Kind:      "Service",
+				Namespace: namespace,
+				Name:      service.Name,
+				Message:   fmt.Sprintf("selector %s matches no pods", formatLabels(service.Spec.Selector)),
+			})
+		}
+	}
+
+	configMaps, err := rm.listConfigMaps(namespace)
+	if err != nil {
+		return nil, err
+	}
+	used := map[string]bool{}
+	for i := range pods {
+		for _, name := range podConfigMaps(&pods[i]) {
+			used[name] = true
+		}
+	}
+	for _, cm := range configMaps {
+		// Published into every namespace by the control plane
+		if cm.Name == "kube-root-ca.crt" || used[cm.Name] {
+			continue
+		}
+		findings = append(findings, Finding{
+			Rule:      "unused-configmap",
+			Severity:  severityInfo,
+			Kind:      "ConfigMap",
+			Namespace: namespace,
+			Name:      cm.Name,
+			Message:   "not referenced by any pod",
+		})
+	}
+
+	endpoints, err := rm.listEndpointObjects(namespace)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range endpoints.orphans() {
+		findings = append(findings, Finding{
+			Rule:      "orphaned-endpoints",
+			Severity:  severityWarning,
+			Kind:      o.Kind,
+			Namespace: namespace,
+			Name:      o.Name,
+			Message:   o.Problem,
+		})
+	}
+
+	portFindings, err := rm.portFindings(namespace)
+	if err != nil {
+		return nil, err
+	}
+	findings = append(findings, portFindings...)
+
+	objs, err := rm.listNamespaceObjects(namespace)
+	if err != nil {
+		return nil, err
+	}
+	findings = append(findings, objs.lintFindings()...)
+	g := objs.graph()
+	for _, rel := range g.brokenRelationships() {
+		findings = append(findings, Finding{
+			Rule:      "broken-reference",
+			Severity:  severityError,
+			Kind:      rel.From.Kind,
+			Namespace: namespace,
+			Name:      rel.From.Name,
+			Message:   formatBrokenReference(rel),
+		})
+	}
+	for _, v := range evaluatePolicies(rm.policies, namespace, g) {
+		findings = append(findings, v.finding())
+	}
+
+	findings = rm.rules.apply(findings)
+	for i := range findings {
+		findings[i].Source = rm.sources[findings[i].Resource()]
+	}
+	return findings, nil
+}
@@ -0,0 +1,77 @@
+package mapper
+
+import (
+	"fmt"
+	"sort"
+)
+
+// focusTree expands outward from a resource over relationships in either
+// direction, up to depth hops. Each resource reached hangs below the
+// resource it was first reached from, so every resource appears once, at its
+// shortest distance
+func focusTree(g *Graph, from ResourceKey, depth int) map[ResourceKey][]pathStep {
+	children := map[ResourceKey][]pathStep{}
+	visited := map[ResourceKey]bool{from: true}
+	frontier := []ResourceKey{from}
+	for hop := 0; hop < depth && len(frontier) > 0; hop++ {
+		next := []ResourceKey{}
+		for _, key := range frontier {
+			for _, step := range g.steps(key) {
+				if visited[step.next()] {
+					continue
+				}
+				visited[step.next()] = true
+				children[key] = append(children[key], step)
+				next = append(next, step.next())
+			}
+		}
+		frontier = next
+	}
+	return children
+}
+
+// printFocusTree prints the resources below a resource of a focus tree, with
+// the direction of the relationship leading to each
+func printFocusTree(children map[ResourceKey][]pathStep, key ResourceKey, prefix string) {
+	steps := children[key]
+	sort.SliceStable(steps, func(i, j int) bool {
+		return formatResourceKey(steps[i].next()) < formatResourceKey(steps[j].next())
+	})
+	for i, step := range steps {
+		branch, indent := sym("├──"), sym("│   ")
+		if i == len(steps)-1 {
+			branch, indent = sym("└──"), "    "
+		}
+		arrow := fmt.Sprintf("--%s-->", step.rel.Type)
+		if !step.forward {
+			arrow = fmt.Sprintf("<--%s--", step.rel.Type)
+		}
+		fmt.Printf("%s%s %s %s\n", prefix, branch, arrow, formatResourceKey(step.next()))
+		printFocusTree(children, step.next(), prefix+indent)
+	}
+}
+
+// showFocus maps only the neighbourhood of a resource, depth relationship
+// hops around it, instead of whole namespaces
+func (rm *ResourceMapper) showFocus(namespaces []string, kind, name string, depth int) error {
+	graphs, err := rm.buildGraphs(namespaces)
+	if err != nil {
+		return err
+	}
+	g := mergeGraphs(graphs)
+	sources := findResources(g, kind, name)
+	if len(sources) == 0 {
+		return fmt.Errorf("%s/%s not found", kind, name)
+	}
+	for _, from := range sources {
+		children := focusTree(g, from, depth)
+		fmt.Printf("\n%sFocus on %s (%d hop(s)):%s\n", colorCyan, formatResourceKey(from), depth, colorReset)
+		fmt.Println(formatResourceKey(from))
+		if len(children[from]) == 0 {
+			fmt.Printf(sym("└── %sNo relationships%s\n"), colorYellow, colorReset)
+			continue
+		}
+		printFocusTree(children, from, "")
+	}
+	return nil
+}
@@ -0,0 +1,300 @@
+package mapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// graphFormat renders the graphs of some namespaces
+type graphFormat func(rm *ResourceMapper, graphs map[string]*Graph) error
+
+// graphFormats holds the output formats of graph renderings, by name
+var graphFormats = map[string]graphFormat{}
+
+// streamFormat renders graphs one namespace at a time, as soon as each is
+// built, instead of holding every namespace until the end
+type streamFormat struct {
+	// namespace renders the graph of a namespace; first is set for the first
+	// namespace rendered
+	namespace func(rm *ResourceMapper, ns string, g *Graph, first bool) error
+	// end completes the output after count namespaces, nil when not needed
+	end func(rm *ResourceMapper, count int) error
+}
+
+// streamFormats holds the output formats that can stream, by name. Every one
+// is also a graph format
+var streamFormats = map[string]streamFormat{}
+
+// registerGraphFormat makes an output format available to --output
+func registerGraphFormat(name string, format graphFormat) {
+	graphFormats[name] = format
+}
+
+// registerStreamFormat makes an output format stream namespaces as they are
+// mapped
+func registerStreamFormat(name string, format streamFormat) {
+	streamFormats[name] = format
+}
+
+func init() {
+	registerGraphFormat("text", renderText)
+	registerGraphFormat("json", renderJSON)
+	registerGraphFormat("dot", renderDOT)
+	registerGraphFormat("mermaid", renderMermaid)
+	registerGraphFormat("grafana", renderGrafana)
+	registerStreamFormat("text", streamFormat{namespace: renderTextNamespace})
+	registerStreamFormat("json", streamFormat{namespace: renderJSONNamespace, end: endJSON})
+}
+
+// graphFormatNames lists the output formats for flag help and errors
+func graphFormatNames() string {
+	names := make([]string, 0, len(graphFormats))
+	for name := range graphFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// renderGraphs renders graphs in a named format
+func (rm *ResourceMapper) renderGraphs(format string, graphs map[string]*Graph) error {
+	render, ok := graphFormats[format]
+	if !ok {
+		return fmt.Errorf("unknown output format '%s' (expected one of %s)", format, graphFormatNames())
+	}
+	return render(rm, graphs)
+}
+
+// graphRenderer renders graphs in a format as they are built: one namespace at
+// a time when the format streams, and all together on close otherwise
+type graphRenderer struct {
+	rm     *ResourceMapper
+	format string
+	stream *streamFormat
+	graphs map[string]*Graph
+	count  int
+}
+
+// newGraphRenderer starts rendering graphs in a named format
+func (rm *ResourceMapper) newGraphRenderer(format string) (*graphRenderer, error) {
+	if _, ok := graphFormats[format]; !ok {
+		return nil, fmt.Errorf("unknown output format '%s' (expected one of %s)", format, graphFormatNames())
+	}
+	s := &graphRenderer{rm: rm, format: format, graphs: map[string]*Graph{}}
+	if stream, ok := streamFormats[format]; ok {
+		s.stream = &stream
+	}
+	return s, nil
+}
+
+// add renders the graph of a namespace, or keeps it for close
+func (s *graphRenderer) add(ns string, g *Graph) error {
+	s.count++
+	if s.stream == nil {
+		s.graphs[ns] = g
+		return nil
+	}
+	return s.stream.namespace(s.rm, ns, g, s.count == 1)
+}
+
+// close completes the output
+func (s *graphRenderer) close() error {
+	if s.stream == nil {
+		return s.rm.renderGraphs(s.format, s.graphs)
+	}
+	if s.stream.end == nil {
+		return nil
+	}
+	return s.stream.end(s.rm, s.count)
+}
+
+// renderText prints the resources and relationships of each namespace
+func renderText(rm *ResourceMapper, graphs map[string]*Graph) error {
+	for i, ns := range sortedKeys(graphs) {
+		if err := renderTextNamespace(rm, ns, graphs[ns], i == 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderTextNamespace prints the resources and relationships of a namespace
+func renderTextNamespace(rm *ResourceMapper, ns string, g *Graph, first bool) error {
+	fmt.Printf("\n%sResources in namespace: %s%s\n", colorGreen, ns, colorReset)
+	for i, res := range g.Resources {
+		branch := sym("├──")
+		if i == len(g.Resources)-1 {
+			branch = sym("└──")
+		}
+		fmt.Printf("%s %s: %s\n", branch, res.Kind, res.Name)
+	}
+	if len(g.Relationships) > 0 {
+		fmt.Printf("\n%sRelationships in namespace: %s%s\n", colorBlue, ns, colorReset)
+	}
+	for i, rel := range g.Relationships {
+		branch := sym("├──")
+		if i == len(g.Relationships)-1 {
+			branch = sym("└──")
+		}
+		line := fmt.Sprintf("%s/%s %s %s %s/%s", rel.From.Kind, rel.From.Name, rm.createArrow(4), rel.Type, rel.To.Kind, rel.To.Name)
+		if rel.Description != "" {
+			line += " (" + rel.Description + ")"
+		}
+		if rel.Broken {
+			line = colorRed + line + " [broken]" + colorReset
+		}
+		fmt.Printf("%s %s\n", branch, line)
+	}
+	if len(g.Errors) > 0 {
+		fmt.Printf("\n%sNot mapped in namespace: %s%s\n", colorRed, ns, colorReset)
+	}
+	for i, e := range g.Errors {
+		branch := sym("├──")
+		if i == len(g.Errors)-1 {
+			branch = sym("└──")
+		}
+		fmt.Printf("%s %s: %s\n", branch, e.Source, e.Message)
+	}
+	if len(g.Truncated) > 0 {
+		fmt.Printf("\n%sTruncated in namespace: %s%s\n", colorYellow, ns, colorReset)
+	}
+	for i, t := range g.Truncated {
+		branch := sym("├──")
+		if i == len(g.Truncated)-1 {
+			branch = sym("└──")
+		}
+		fmt.Printf("%s %s\n", branch, t)
+	}
+	return nil
+}
+
+// renderJSON prints the graphs keyed by namespace
+func renderJSON(rm *ResourceMapper, graphs map[string]*Graph) error {
+	data, err := json.MarshalIndent(graphs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding graphs: %v", err)
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// renderJSONNamespace prints the graph of a namespace as a member of the
+// object renderJSON prints
+func renderJSONNamespace(rm *ResourceMapper, ns string, g *Graph, first bool) error {
+	data, err := json.MarshalIndent(g, "  ", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding graph of namespace %s: %v", ns, err)
+	}
+	name, _ := json.Marshal(ns)
+	separator := ",\n"
+	if first {
+		separator = "{\n"
+	}
+	fmt.Printf("%s  %s: %s", separator, name, data)
+	return nil
+}
+
+// endJSON closes the object of streamed namespaces
+func endJSON(rm *ResourceMapper, count int) error {
+	if count == 0 {
+		fmt.Println("{}")
+		return nil
+	}
+	fmt.Println("\n}")
+	return nil
+}
+
+// renderDOT prints the graphs as a Graphviz digraph with a cluster per
+// namespace
+func renderDOT(rm *ResourceMapper, graphs map[string]*Graph) error {
+	var b strings.Builder
+	b.WriteString("digraph resources {\n  rankdir=LR;\n  node [shape=box];\n")
+	seen := map[ResourceKey]bool{}
+	for i, ns := range sortedKeys(graphs) {
+		fmt.Fprintf(&b, "  subgraph cluster_%d {\n    label=%q;\n", i, ns)
+		for _, res := range graphs[ns].Resources {
+			// Cluster-scoped nodes and external targets are shared between
+			// namespaces
+			if seen[res.Key()] || res.Namespace == "" {
+				continue
+			}
+			seen[res.Key()] = true
+			fmt.Fprintf(&b, "    %q [label=%q%s];\n", res.Key().String(), res.Kind+"\n"+res.Name, dotMissingStyle(res))
+		}
+		b.WriteString("  }\n")
+	}
+	for _, ns := range sortedKeys(graphs) {
+		for _, res := range graphs[ns].Resources {
+			if res.Namespace == "" && !seen[res.Key()] {
+				seen[res.Key()] = true
+				fmt.Fprintf(&b, "  %q [label=%q, shape=ellipse];\n", res.Key().String(), res.Kind+"\n"+res.Name)
+			}
+		}
+		for _, rel := range graphs[ns].Relationships {
+			style := ""
+			if rel.Broken {
+				style = ", color=red, fontcolor=red, style=dashed"
+			}
+			fmt.Fprintf(&b, "  %q -> %q [label=%q%s];\n", rel.From.String(), rel.To.String(), rel.Type, style)
+		}
+	}
+	b.WriteString("}\n")
+	fmt.Print(b.String())
+	return nil
+}
+
+// dotMissingStyle outlines the stand-ins for missing objects in red
+func dotMissingStyle(res Resource) string {
+	if res.Attributes["missing"] == "true" {
+		return ", color=red, style=dashed"
+	}
+	return ""
+}
+
+// renderMermaid prints the graphs as a Mermaid flowchart with a subgraph per
+// namespace
+func renderMermaid(rm *ResourceMapper, graphs map[string]*Graph) error {
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	// Mermaid node IDs cannot hold slashes, so resources are numbered
+	ids := map[ResourceKey]string{}
+	node := func(res Resource) string {
+		id := fmt.Sprintf("n%d", len(ids))
+		ids[res.Key()] = id
+		return fmt.Sprintf("%s[\"%s: %s\"]", id, res.Kind, strings.ReplaceAll(res.Name, `"`, "#quot;"))
+	}
+	for i, ns := range sortedKeys(graphs) {
+		fmt.Fprintf(&b, "  subgraph ns%d[\"%s\"]\n", i, ns)
+		for _, res := range graphs[ns].Resources {
+			if _, ok := ids[res.Key()]; ok || res.Namespace == "" {
+				continue
+			}
+			fmt.Fprintf(&b, "    %s\n", node(res))
+		}
+		b.WriteString("  end\n")
+	}
+	// Links are styled by their position in the chart
+	links := 0
+	broken := []string{}
+	for _, ns := range sortedKeys(graphs) {
+		for _, res := range graphs[ns].Resources {
+			if _, ok := ids[res.Key()]; !ok {
+				fmt.Fprintf(&b, "  %s\n", node(res))
+			}
+		}
+		for _, rel := range graphs[ns].Relationships {
+			fmt.Fprintf(&b, "  %s -->|%s| %s\n", ids[rel.From], rel.Type, ids[rel.To])
+			if rel.Broken {
+				broken = append(broken, fmt.Sprint(links))
+			}
+			links++
+		}
+	}
+	if len(broken) > 0 {
+		fmt.Fprintf(&b, "  linkStyle %s stroke:red,stroke-dasharray:4\n", strings.Join(broken, ","))
+	}
+	fmt.Print(b.String())
+	return nil
+}
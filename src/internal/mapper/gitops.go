@@ -0,0 +1,93 @@
+package mapper
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Labels and annotations set by GitOps controllers on the objects they manage
+const (
+	argoInstanceLabel         = "argocd.argoproj.io/instance"
+	argoTrackingAnnotation    = "argocd.argoproj.io/tracking-id"
+	fluxKustomizeNameLabel    = "kustomize.toolkit.fluxcd.io/name"
+	fluxKustomizeNsLabel      = "kustomize.toolkit.fluxcd.io/namespace"
+	fluxHelmReleaseNameLabel  = "helm.toolkit.fluxcd.io/name"
+	fluxHelmReleaseNsLabel    = "helm.toolkit.fluxcd.io/namespace"
+	unmanagedApplicationGroup = "Unmanaged resources"
+)
+
+// gitopsApplication returns the GitOps application managing a resource,
+// or an empty string when no controller claims it
+func gitopsApplication(res Resource) string {
+	if app := res.Labels[argoInstanceLabel]; app != "" {
+		return "Argo CD application: " + app
+	}
+	// Annotation based tracking: "<app>:<group>/<kind>:<namespace>/<name>"
+	if tracking := res.Annotations[argoTrackingAnnotation]; tracking != "" {
+		app, _, _ := strings.Cut(tracking, ":")
+		return "Argo CD application: " + app
+	}
+	if name := res.Labels[fluxKustomizeNameLabel]; name != "" {
+		return "Flux Kustomization: " + res.Labels[fluxKustomizeNsLabel] + "/" + name
+	}
+	if name := res.Labels[fluxHelmReleaseNameLabel]; name != "" {
+		return "Flux HelmRelease: " + res.Labels[fluxHelmReleaseNsLabel] + "/" + name
+	}
+	return ""
+}
+
+// showApplicationGroups shows the resources of a namespace grouped by the
+// GitOps application that manages them
+func (rm *ResourceMapper) showApplicationGroups(namespace string) error {
+	rm.printLine()
+	fmt.Printf("%sGitOps applications in namespace: %s%s\n", colorBlue, namespace, colorReset)
+	rm.printLine()
+
+	resources, err := rm.collectResources(namespace)
+	if err != nil {
+		return err
+	}
+
+	groups := map[string][]Resource{}
+	for _, res := range resources {
+		// Pods carry the labels of their template rather than the
+		// controller's tracking labels, so they follow their workload
+		if res.Kind == "Pod" {
+			continue
+		}
+		app := gitopsApplication(res)
+		if app == "" {
+			app = unmanagedApplicationGroup
+		}
+		groups[app] = append(groups[app], res)
+	}
+
+	apps := []string{}
+	for app := range groups {
+		if app != unmanagedApplicationGroup {
+			apps = append(apps, app)
+		}
+	}
+	sort.Strings(apps)
+	if _, ok := groups[unmanagedApplicationGroup]; ok {
+		apps = append(apps, unmanagedApplicationGroup)
+	}
+
+	for i, app := range apps {
+		branch, indent := sym("├──"), sym("│   ")
+		if i == len(apps)-1 {
+			branch, indent = sym("└──"), "    "
+		}
+		color := colorYellow
+		if app == unmanagedApplicationGroup {
+			color = colorRed
+		}
+		fmt.Printf("%s %s%s (%d)%s\n", branch, color, app, len(groups[app]), colorReset)
+		for _, res := range groups[app] {
+			fmt.Printf("%s%s %s: %s\n", indent, rm.createArrow(4), res.Kind, res.Name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,259 @@
+package mapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// grafanaField describes a field of the nodes or edges frame of Grafana's
+// Node Graph API data source
+type grafanaField struct {
+	FieldName   string `json:"field_name"`
+	Type        string `json:"type"`
+	DisplayName string `json:"displayName,omitempty"`
+	Color       string `json:"color,omitempty"`
+}
+
+// grafanaFields is the response of /api/graph/fields
+type grafanaFields struct {
+	EdgesFields []grafanaField `json:"edges_fields"`
+	NodesFields []grafanaField `json:"nodes_fields"`
+}
+
+// grafanaNode is a row of the nodes frame
+type grafanaNode struct {
+	ID            string `json:"id"`
+	Title         string `json:"title"`
+	SubTitle      string `json:"subTitle"`
+	MainStat      string `json:"mainStat"`
+	SecondaryStat string `json:"secondaryStat,omitempty"`
+	Labels        string `json:"detail__labels,omitempty"`
+}
+
+// grafanaEdge is a row of the edges frame
+type grafanaEdge struct {
+	ID            string `json:"id"`
+	Source        string `json:"source"`
+	Target        string `json:"target"`
+	MainStat      string `json:"mainStat"`
+	SecondaryStat string `json:"secondaryStat,omitempty"`
+}
+
+// grafanaGraph is the response of /api/graph/data
+type grafanaGraph struct {
+	Nodes []grafanaNode `json:"nodes"`
+	Edges []grafanaEdge `json:"edges"`
+}
+
+// grafanaNodeFields and grafanaEdgeFields are the fields of the nodes and
+// edges frames, in the order of their columns
+var (
+	grafanaNodeFields = []grafanaField{
+		{FieldName: "id", Type: "string"},
+		{FieldName: "title", Type: "string", DisplayName: "Name"},
+		{FieldName: "subTitle", Type: "string", DisplayName: "Kind"},
+		{FieldName: "mainStat", Type: "string", DisplayName: "Namespace"},
+		{FieldName: "secondaryStat", Type: "string", DisplayName: "Status"},
+		{FieldName: "detail__labels", Type: "string", DisplayName: "Labels"},
+	}
+	grafanaEdgeFields = []grafanaField{
+		{FieldName: "id", Type: "string"},
+		{FieldName: "source", Type: "string"},
+		{FieldName: "target", Type: "string"},
+		{FieldName: "mainStat", Type: "string", DisplayName: "Relationship"},
+		{FieldName: "secondaryStat", Type: "string", DisplayName: "Description"},
+	}
+)
+
+// grafanaNodeGraph converts graphs into the nodes and edges frames
+func grafanaNodeGraph(graphs []*Graph) grafanaGraph {
+	data := grafanaGraph{Nodes: []grafanaNode{}, Edges: []grafanaEdge{}}
+	seen := map[ResourceKey]bool{}
+	for _, g := range graphs {
+		for _, res := range g.Resources {
+			// External targets are shared between namespaces
+			if seen[res.Key()] {
+				continue
+			}
+			seen[res.Key()] = true
+			node := grafanaNode{
+				ID:       res.Key().String(),
+				Title:    res.Name,
+				SubTitle: res.Kind,
+				MainStat: res.Namespace,
+				Labels:   formatLabels(res.Labels),
+			}
+			node.SecondaryStat = res.Attributes["phase"]
+			if res.Attributes["missing"] == "true" {
+				node.SecondaryStat = "missing"
+			}
+			if res.Status != nil {
+				parts := []string{}
+				if res.Status.Phase != "" {
+					parts = append(parts, res.Status.Phase)
+				}
+				if res.Status.Ready != nil && *res.Status.Ready {
+					parts = append(parts, "ready")
+				} else if res.Status.Ready != nil {
+					parts = append(parts, "not ready")
+				}
+				node.SecondaryStat = strings.Join(parts, ", ")
+			}
+			data.Nodes = append(data.Nodes, node)
+		}
+		for _, rel := range g.Relationships {
+			edge := grafanaEdge{
+				ID:            fmt.Sprintf("%s|%s|%s", rel.From, rel.Type, rel.To),
+				Source:        rel.From.String(),
+				Target:        rel.To.String(),
+				MainStat:      rel.Type,
+				SecondaryStat: rel.Description,
+			}
+			if rel.Broken {
+				edge.SecondaryStat = "broken"
+			}
+			data.Edges = append(data.Edges, edge)
+		}
+	}
+	return data
+}
+
+// Grafana data frames in their JSON encoding, the form panels receive query
+// results in, as accepted by the TestData "Raw frames" scenario
+type (
+	grafanaFrame struct {
+		Schema grafanaFrameSchema `json:"schema"`
+		Data   grafanaFrameData   `json:"data"`
+	}
+	grafanaFrameSchema struct {
+		Name   string                    `json:"name"`
+		Meta   grafanaFrameMeta          `json:"meta"`
+		Fields []grafanaFrameFieldSchema `json:"fields"`
+	}
+	grafanaFrameMeta struct {
+		PreferredVisualisationType string `json:"preferredVisualisationType"`
+	}
+	grafanaFrameFieldSchema struct {
+		Name   string                   `json:"name"`
+		Type   string                   `json:"type"`
+		Config *grafanaFrameFieldConfig `json:"config,omitempty"`
+	}
+	grafanaFrameFieldConfig struct {
+		DisplayName string `json:"displayName"`
+	}
+	grafanaFrameData struct {
+		Values [][]string `json:"values"`
+	}
+)
+
+// newGrafanaFrame builds a frame of Node Graph columns. Frames name their fields
+// in lower case, as the Node Graph panel expects them
+func newGrafanaFrame(name string, fields []grafanaField, rows [][]string) grafanaFrame {
+	frame := grafanaFrame{
+		Schema: grafanaFrameSchema{Name: name, Meta: grafanaFrameMeta{PreferredVisualisationType: "nodeGraph"}},
+		Data:   grafanaFrameData{Values: make([][]string, len(fields))},
+	}
+	for i, field := range fields {
+		schema := grafanaFrameFieldSchema{Name: strings.ToLower(field.FieldName), Type: field.Type}
+		if field.DisplayName != "" {
+			schema.Config = &grafanaFrameFieldConfig{DisplayName: field.DisplayName}
+		}
+		frame.Schema.Fields = append(frame.Schema.Fields, schema)
+		frame.Data.Values[i] = []string{}
+		for _, row := range rows {
+			frame.Data.Values[i] = append(frame.Data.Values[i], row[i])
+		}
+	}
+	return frame
+}
+
+// grafanaDataFrames converts the nodes and edges into the nodes and edges
+// data frames of a Node Graph panel
+func grafanaDataFrames(data grafanaGraph) []grafanaFrame {
+	nodes := [][]string{}
+	for _, n := range data.Nodes {
+		nodes = append(nodes, []string{n.ID, n.Title, n.SubTitle, n.MainStat, n.SecondaryStat, n.Labels})
+	}
+	edges := [][]string{}
+	for _, e := range data.Edges {
+		edges = append(edges, []string{e.ID, e.Source, e.Target, e.MainStat, e.SecondaryStat})
+	}
+	return []grafanaFrame{
+		newGrafanaFrame("nodes", grafanaNodeFields, nodes),
+		newGrafanaFrame("edges", grafanaEdgeFields, edges),
+	}
+}
+
+// renderGrafana prints the graphs as the nodes and edges data frames of a
+// Grafana Node Graph panel
+func renderGrafana(rm *ResourceMapper, graphs map[string]*Graph) error {
+	ordered := []*Graph{}
+	for _, ns := range sortedKeys(graphs) {
+		ordered = append(ordered, graphs[ns])
+	}
+	data, err := json.MarshalIndent(grafanaDataFrames(grafanaNodeGraph(ordered)), "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding Grafana frames: %v", err)
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// handleGrafanaHealth answers the data source health check
+func (s *graphServer) handleGrafanaHealth(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleGrafanaFields serves the fields of the nodes and edges frames
+func (s *graphServer) handleGrafanaFields(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, grafanaFields{NodesFields: grafanaNodeFields, EdgesFields: grafanaEdgeFields})
+}
+
+// grafanaGraphs returns the graphs of all namespaces, or of the one given by
+// the namespace query parameter, answering 404 when it is not mapped. The
+// caller holds the read lock
+func (s *graphServer) grafanaGraphs(w http.ResponseWriter, r *http.Request) ([]*Graph, bool) {
+	namespace := r.URL.Query().Get("namespace")
+	var graphs []*Graph
+	for _, ns := range sortedKeys(s.graphs) {
+		if namespace == "" || ns == namespace {
+			graphs = append(graphs, s.graphs[ns])
+		}
+	}
+	if namespace != "" && len(graphs) == 0 {
+		writeAPIError(w, http.StatusNotFound, "namespace %s is not mapped", namespace)
+		return nil, false
+	}
+	return graphs, true
+}
+
+// handleGrafanaData serves the nodes and edges of all namespaces, or of the
+// one given by the namespace query parameter
+func (s *graphServer) handleGrafanaData(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if graphs, ok := s.grafanaGraphs(w, r); ok {
+		writeJSON(w, http.StatusOK, grafanaNodeGraph(graphs))
+	}
+}
+
+// handleGrafanaFrames serves the nodes and edges as Grafana data frames, for
+// data sources other than the Node Graph API one
+func (s *graphServer) handleGrafanaFrames(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if graphs, ok := s.grafanaGraphs(w, r); ok {
+		writeJSON(w, http.StatusOK, grafanaDataFrames(grafanaNodeGraph(graphs)))
+	}
+}
+
+// registerGrafana adds the routes of Grafana's Node Graph API data source;
+// the data source URL is the server address followed by /grafana
+func (s *graphServer) registerGrafana(mux *http.ServeMux) {
+	mux.HandleFunc("GET /grafana/api/health", s.handleGrafanaHealth)
+	mux.HandleFunc("GET /grafana/api/graph/fields", s.handleGrafanaFields)
+	mux.HandleFunc("GET /grafana/api/graph/data", s.handleGrafanaData)
+	mux.HandleFunc("GET /grafana/frames", s.handleGrafanaFrames)
+}
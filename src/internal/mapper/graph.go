@@ -0,0 +1,472 @@
+package mapper
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// Relationship types between resources
+const (
+	RelRoutes      = "routes"       // Ingress -> Service
+	RelSelects     = "selects"      // Service -> Pod
+	RelManages     = "manages"      // Deployment, StatefulSet -> Pod
+	RelScales      = "scales"       // HorizontalPodAutoscaler -> Deployment
+	RelUses        = "uses"         // Pod -> ConfigMap, Secret; Ingress -> Secret
+	RelTargets     = "targets"      // Service -> External
+	RelGoverns     = "governs"      // headless Service -> StatefulSet
+	RelScrapes     = "scrapes"      // ServiceMonitor -> Service, PodMonitor -> Pod
+	RelAlerts      = "alerts"       // PrometheusRule -> Deployment, StatefulSet
+	RelRunsOn      = "runs-on"      // Pod -> Node
+	RelStartsAfter = "starts-after" // Deployment, StatefulSet, Pod -> Service
+	RelDependsOn   = "depends-on"   // any -> any, from the dependsOnAnnotation hint
+)
+
+// ResourceKey uniquely identifies a resource in the graph
+type ResourceKey struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+func (k ResourceKey) String() string {
+	return fmt.Sprintf("%s/%s/%s", k.Kind, k.Namespace, k.Name)
+}
+
+// Key returns the graph key of a resource
+func (r Resource) Key() ResourceKey {
+	return ResourceKey{Kind: r.Kind, Namespace: r.Namespace, Name: r.Name}
+}
+
+// Relationship is a directed edge between two resources
+type Relationship struct {
+	From        ResourceKey `json:"from"`
+	To          ResourceKey `json:"to"`
+	Type        string      `json:"type"`
+	Description string      `json:"description,omitempty"`
+	// Broken relationships reference an object that does not exist
+	Broken bool `json:"broken,omitempty"`
+}
+
+// Graph holds resources and the relationships between them
+type Graph struct {
+	Resources     []Resource     `json:"resources"`
+	Relationships []Relationship `json:"relationships"`
+	// Errors are the resource types that could not be listed when mapping
+	// partial results, missing from the graph
+	Errors []MappingError `json:"errors,omitempty"`
+	// Truncated are the resource types with more objects than
+	// --max-resources-per-namespace, only partly in the graph
+	Truncated []Truncation `json:"truncated,omitempty"`
+
+	// index is built on first lookup, see indexed
+	index *graphIndex
+}
+
+// hasResource reports whether the graph contains a resource
+func (g *Graph) hasResource(key ResourceKey) bool {
+	return g.resource(key) != nil
+}
+
+// addResource adds a resource to the graph once: a resource with the key of
+// one already added is the same object, reached again by another view or
+// listed by another type (such as a custom resource type mapping monitors).
+// It completes the one in the graph with the details it lacks, unless their
+// UIDs show the object was recreated in between, and addResource returns
+// false
+func (g *Graph) addResource(res Resource) bool {
+	existing := g.resource(res.Key())
+	if existing == nil {
+		g.Resources = append(g.Resources, res)
+		return true
+	}
+	if existing.UID != "" && res.UID != "" && existing.UID != res.UID {
+		return false
+	}
+	if existing.UID == "" {
+		existing.UID = res.UID
+	}
+	if existing.Labels == nil {
+		existing.Labels = res.Labels
+	}
+	if existing.Annotations == nil {
+		existing.Annotations = res.Annotations
+	}
+	if existing.Status == nil {
+		existing.Status = res.Status
+	}
+	if existing.Raw == nil {
+		existing.Raw = res.Raw
+	}
+	var added map[string]string
+	for key, value := range res.Attributes {
+		if _, ok := existing.Attributes[key]; !ok {
+			if added == nil {
+				added = map[string]string{}
+			}
+			added[key] = value
+		}
+	}
+	if added != nil {
+		// The attributes may be shared with the graph the resource came from
+		attributes := make(map[string]string, len(existing.Attributes)+len(added))
+		maps.Copy(attributes, existing.Attributes)
+		maps.Copy(attributes, added)
+		existing.Attributes = attributes
+	}
+	return false
+}
+
+// addEdge adds a relationship to the graph once, dropping exact duplicates
+// such as a pod behind two endpoint slices of a service
+func (g *Graph) addEdge(rel Relationship) {
+	if g.indexed().relationships[rel] {
+		return
+	}
+	g.Relationships = append(g.Relationships, rel)
+}
+
+// addRelationship adds an edge when both ends exist in the graph. Details
+// are passed on to the description template of the type
+func (g *Graph) addRelationship(from, to ResourceKey, relType, description string, details ...relationshipDetails) {
+	if !g.hasResource(from) || !g.hasResource(to) {
+		return
+	}
+	rel := Relationship{
+		From:        from,
+		To:          to,
+		Type:        relType,
+		Description: description,
+	}
+	rel.Description = describeRelationship(rel, details)
+	g.addEdge(rel)
+}
+
+// addExternal adds a node for a target outside the cluster
+func (g *Graph) addExternal(name string) {
+	g.addResource(Resource{Kind: externalKind, Name: name})
+}
+
+// addBroken adds an edge to an object that does not exist, with a node
+// standing in for the missing object
+func (g *Graph) addBroken(from ResourceKey, kind, namespace, name, relType, description string, details ...relationshipDetails) {
+	if !g.hasResource(from) {
+		return
+	}
+	to := ResourceKey{Kind: kind, Namespace: namespace, Name: name}
+	if !g.hasResource(to) {
+		g.addResource(Resource{Kind: kind, Namespace: namespace, Name: name,
+			Attributes: map[string]string{"missing": "true"}})
+	}
+	rel := Relationship{
+		From:        from,
+		To:          to,
+		Type:        relType,
+		Description: description,
+		Broken:      true,
+	}
+	rel.Description = describeRelationship(rel, details)
+	g.addEdge(rel)
+}
+
+// brokenRelationships returns the relationships to missing objects
+func (g *Graph) brokenRelationships() []Relationship {
+	broken := []Relationship{}
+	for _, rel := range g.Relationships {
+		if rel.Broken {
+			broken = append(broken, rel)
+		}
+	}
+	return broken
+}
+
+// addReferenced adds a node for an object known only from the references of
+// pods, such as a Secret, whose data is never read, or the Node a pod runs on
+func (g *Graph) addReferenced(kind, namespace, name string) ResourceKey {
+	res := Resource{Kind: kind, Namespace: namespace, Name: name}
+	g.addResource(res)
+	return res.Key()
+}
+
+// buildGraph builds the graph of a namespace, in a span child of the one in
+// ctx. Objects not cached yet are listed with the context of the span
+func (rm *ResourceMapper) buildGraph(ctx context.Context, namespace string) (g *Graph, err error) {
+	ctx, end := startSpan(ctx, "buildGraph", attribute.String("k8s.namespace.name", namespace))
+	defer func() { end(err) }()
+	rm.cacheIn(ctx, namespace)
+	objs, err := rm.listNamespaceObjects(namespace)
+	if err != nil {
+		return nil, err
+	}
+	g = objs.graph()
+	if err := rm.runPlugins(namespace, g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// buildGraphs builds the graphs of several namespaces
+func (rm *ResourceMapper) buildGraphs(namespaces []string) (map[string]*Graph, error) {
+	graphs := map[string]*Graph{}
+	for _, ns := range namespaces {
+		g, err := rm.buildGraph(rm.ctx, ns)
+		if err != nil {
+			return nil, fmt.Errorf("error mapping namespace %s: %v", ns, err)
+		}
+		graphs[ns] = g
+	}
+	return graphs, nil
+}
+
+// podConfigMaps returns the configmaps referenced by a pod
+func podConfigMaps(pod *corev1.Pod) []string {
+	return podReferencedNames(pod, "ConfigMap")
+}
+
+// graph builds the relationship graph of the listed objects. Objects left
+// out by selectors are not reported as broken references
+func (objs *namespaceObjects) graph() *Graph {
+	ns := objs.namespace
+	g := &Graph{Errors: objs.errors, Truncated: objs.truncated}
+	for _, res := range objs.resources() {
+		g.addResource(res)
+	}
+	index := newPodIndex(objs.pods)
+	key := func(kind, name string) ResourceKey {
+		return ResourceKey{Kind: kind, Namespace: ns, Name: name}
+	}
+
+	// routeTo links an ingress to a backend service, flagging services that
+	// do not exist
+	routeTo := func(ing string, backend *networkingv1.IngressServiceBackend, description string, details relationshipDetails) {
+		details.Port = backend.Port.Name
+		if backend.Port.Number != 0 {
+			details.Port = fmt.Sprint(backend.Port.Number)
+		}
+		if !objs.selected && !g.hasResource(key("Service", backend.Name)) {
+			g.addBroken(key("Ingress", ing), "Service", ns, backend.Name, RelRoutes, description, details)
+			return
+		}
+		g.addRelationship(key("Ingress", ing), key("Service", backend.Name), RelRoutes, description, details)
+	}
+	for _, ing := range objs.ingresses {
+		if ing.Spec.DefaultBackend != nil && ing.Spec.DefaultBackend.Service != nil {
+			routeTo(ing.Name, ing.Spec.DefaultBackend.Service, "default backend", relationshipDetails{})
+		}
+		for _, rule := range ing.Spec.Rules {
+			if rule.HTTP == nil {
+				continue
+			}
+			for _, path := range rule.HTTP.Paths {
+				if path.Backend.Service != nil {
+					routeTo(ing.Name, path.Backend.Service, rule.Host+path.Path, relationshipDetails{Host: rule.Host, Path: path.Path})
+				}
+			}
+		}
+		for _, tls := range ing.Spec.TLS {
+			// Without a secret name the controller's default certificate is used
+			if tls.SecretName == "" {
+				continue
+			}
+			details := relationshipDetails{Hosts: strings.Join(tls.Hosts, ", ")}
+			if !objs.selected && objs.secrets != nil && !objs.secrets[tls.SecretName] {
+				g.addBroken(key("Ingress", ing.Name), "Secret", ns, tls.SecretName, RelUses, "TLS certificate", details)
+				continue
+			}
+			g.addRelationship(key("Ingress", ing.Name), g.addReferenced("Secret", ns, tls.SecretName), RelUses, "TLS certificate", details)
+		}
+	}
+
+	for _, svc := range objs.services {
+		if svc.Spec.Type == corev1.ServiceTypeExternalName {
+			g.addExternal(svc.Spec.ExternalName)
+			g.addRelationship(key("Service", svc.Name), ResourceKey{Kind: externalKind, Name: svc.Spec.ExternalName},
+				RelTargets, "external name")
+			continue
+		}
+		if len(svc.Spec.Selector) == 0 {
+			for _, backend := range endpointSliceBackends(objs.endpointSlices, svc.Name) {
+				if backend.Pod != "" {
+					g.addRelationship(key("Service", svc.Name), key("Pod", backend.Pod), RelSelects, "endpoints")
+					continue
+				}
+				g.addExternal(backend.Address)
+				g.addRelationship(key("Service", svc.Name), ResourceKey{Kind: externalKind, Name: backend.Address},
+					RelTargets, "endpoints")
+			}
+			continue
+		}
+		details := relationshipDetails{Ports: formatServicePorts(svc.Spec.Ports)}
+		for _, pod := range index.matchLabels(svc.Spec.Selector) {
+			g.addRelationship(key("Service", svc.Name), key("Pod", pod.Name), RelSelects, "", details)
+		}
+	}
+
+	for _, deploy := range objs.deployments {
+		pods, err := index.matchSelector(deploy.Spec.Selector)
+		if err != nil {
+			continue
+		}
+		for _, pod := range pods {
+			g.addRelationship(key("Deployment", deploy.Name), key("Pod", pod.Name), RelManages, "")
+		}
+	}
+
+	for _, sts := range objs.statefulSets {
+		g.addRelationship(key("Service", sts.Spec.ServiceName), key("StatefulSet", sts.Name), RelGoverns, "pod DNS")
+		pods, err := index.matchSelector(sts.Spec.Selector)
+		if err != nil {
+			continue
+		}
+		for _, pod := range pods {
+			g.addRelationship(key("StatefulSet", sts.Name), key("Pod", pod.Name), RelManages, "")
+		}
+	}
+
+	for _, hpa := range objs.hpas {
+		target := hpa.Spec.ScaleTargetRef
+		// Targets of other kinds, such as custom resources, cannot be checked
+		tracked := target.Kind == "Deployment" || target.Kind == "StatefulSet"
+		if tracked && !objs.selected && !g.hasResource(key(target.Kind, target.Name)) {
+			g.addBroken(key("HorizontalPodAutoscaler", hpa.Name), target.Kind, ns, target.Name, RelScales, "scale target")
+			continue
+		}
+		g.addRelationship(key("HorizontalPodAutoscaler", hpa.Name), key(target.Kind, target.Name), RelScales, "")
+	}
+
+	for i := range objs.pods {
+		pod := &objs.pods[i]
+		required := podRequiredReferences(pod)
+		for _, cm := range podConfigMaps(pod) {
+			details := relationshipDetails{Keys: strings.Join(podReferencedKeys(pod, "ConfigMap", cm), ", ")}
+			if required["ConfigMap/"+cm] && !objs.selected && !g.hasResource(key("ConfigMap", cm)) {
+				g.addBroken(key("Pod", pod.Name), "ConfigMap", ns, cm, RelUses, "", details)
+				continue
+			}
+			g.addRelationship(key("Pod", pod.Name), key("ConfigMap", cm), RelUses, "", details)
+		}
+		for _, secret := range podReferencedNames(pod, "Secret") {
+			// Secrets are only checked when they may be listed
+			details := relationshipDetails{Keys: strings.Join(podReferencedKeys(pod, "Secret", secret), ", ")}
+			if objs.secrets != nil && required["Secret/"+secret] && !objs.selected && !objs.secrets[secret] {
+				g.addBroken(key("Pod", pod.Name), "Secret", ns, secret, RelUses, "", details)
+				continue
+			}
+			g.addRelationship(key("Pod", pod.Name), g.addReferenced("Secret", ns, secret), RelUses, "", details)
+		}
+		if pod.Spec.NodeName != "" {
+			g.addRelationship(key("Pod", pod.Name), g.addReferenced("Node", "", pod.Spec.NodeName), RelRunsOn, "")
+		}
+	}
+
+	for i := range objs.monitors {
+		m := &objs.monitors[i]
+		from := ResourceKey{Kind: m.Kind, Namespace: m.Namespace, Name: m.Name}
+		target := "Service"
+		if m.Kind == "PodMonitor" {
+			target = "Pod"
+		}
+		for _, name := range monitorTargets(m, objs.services, objs.pods) {
+			g.addRelationship(from, key(target, name), RelScrapes, m.endpoints(), relationshipDetails{Endpoints: m.endpoints()})
+		}
+	}
+
+	for _, c := range objs.alertCoverages() {
+		g.addRelationship(c.rule, key(c.kind, c.name), RelAlerts, strings.Join(c.alerts, ", "),
+			relationshipDetails{Alerts: strings.Join(c.alerts, ", ")})
+	}
+
+	objs.addStartupDependencies(g)
+	objs.addReferences(g, objs.ruleReferences)
+	objs.addReferences(g, hintReferences(g.Resources))
+
+	attachFindings(g, objs.rules.apply(objs.lintFindings()))
+	return g
+}
+
+// isSystemResource reports whether a resource is created by the control
+// plane in every cluster or namespace, and so is expected to stand alone
+func isSystemResource(res Resource) bool {
+	switch {
+	case res.Kind == "ConfigMap" && res.Name == "kube-root-ca.crt":
+		return true
+	case res.Kind == "Service" && res.Namespace == "default" && res.Name == "kubernetes":
+		return true
+	case res.Kind == "Pod" && res.Attributes["static"] == "true":
+		// Static pods, such as the control plane of self-managed clusters,
+		// are run by the kubelet without a controller or service
+		return true
+	}
+	return false
+}
+
+// isolatedResources returns the resources that take part in no relationship;
+// running on a node does not count for the pod, as every scheduled pod does
+func isolatedResources(g *Graph) []Resource {
+	connected := map[ResourceKey]bool{}
+	for _, rel := range g.Relationships {
+		if rel.Type != RelRunsOn {
+			connected[rel.From] = true
+		}
+		connected[rel.To] = true
+	}
+
+	isolated := []Resource{}
+	for _, res := range g.Resources {
+		if !connected[res.Key()] && !isSystemResource(res) {
+			isolated = append(isolated, res)
+		}
+	}
+	return isolated
+}
+
+// formatBrokenReference describes a relationship to a missing object
+func formatBrokenReference(rel Relationship) string {
+	text := fmt.Sprintf("%s missing %s %s", rel.Type, rel.To.Kind, rel.To.Name)
+	if rel.Description != "" {
+		text += " (" + rel.Description + ")"
+	}
+	return text
+}
+
+// showBrokenReferences lists the references to objects that do not exist:
+// ingress backends and TLS secrets, HPA scale targets and required
+// ConfigMaps and Secrets
+func (rm *ResourceMapper) showBrokenReferences(namespace string, g *Graph) {
+	broken := g.brokenRelationships()
+	if len(broken) == 0 {
+		return
+	}
+
+	fmt.Printf("\n%sBroken references in namespace: %s%s\n", colorRed, namespace, colorReset)
+	for i, rel := range broken {
+		branch := sym("├──")
+		if i == len(broken)-1 {
+			branch = sym("└──")
+		}
+		fmt.Printf("%s %s/%s %s%s%s\n", branch, rel.From.Kind, rel.From.Name, colorRed, formatBrokenReference(rel), colorReset)
+	}
+}
+
+// showIsolatedResources lists resources with no relationships at all, which
+// often are abandoned experiments or have misconfigured selectors
+func (rm *ResourceMapper) showIsolatedResources(namespace string, g *Graph) {
+	isolated := isolatedResources(g)
+	if len(isolated) == 0 {
+		return
+	}
+
+	fmt.Printf("\n%sIsolated resources in namespace: %s%s\n", colorRed, namespace, colorReset)
+	for i, res := range isolated {
+		branch := sym("├──")
+		if i == len(isolated)-1 {
+			branch = sym("└──")
+		}
+		fmt.Printf("%s %s: %s\n", branch, res.Kind, res.Name)
+	}
+}
@@ -0,0 +1,205 @@
+package mapper
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testMapper creates a mapper of a fake cluster holding objects
+func testMapper(objects ...runtime.Object) *ResourceMapper {
+	return NewResourceMapperForClients(fake.NewClientset(objects...), nil, "test")
+}
+
+// testGraph maps the shop namespace of a fake cluster holding objects
+func testGraph(t *testing.T, objects ...runtime.Object) *Graph {
+	t.Helper()
+	g, err := testMapper(objects...).buildGraph(context.Background(), "shop")
+	if err != nil {
+		t.Fatalf("buildGraph: %v", err)
+	}
+	return g
+}
+
+// relationshipStrings formats the relationships of a graph, sorted, as
+// "From type To", marking broken ones
+func relationshipStrings(g *Graph) []string {
+	rels := []string{}
+	for _, rel := range g.Relationships {
+		text := fmt.Sprintf("%s %s %s", rel.From, rel.Type, rel.To)
+		if rel.Broken {
+			text += " (broken)"
+		}
+		rels = append(rels, text)
+	}
+	sort.Strings(rels)
+	return rels
+}
+
+func testMeta(name string, labels map[string]string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{Name: name, Namespace: "shop", Labels: labels}
+}
+
+func testPod(name string, labels map[string]string, spec corev1.PodSpec) *corev1.Pod {
+	if len(spec.Containers) == 0 {
+		spec.Containers = []corev1.Container{{Name: "app", Image: "app"}}
+	}
+	return &corev1.Pod{ObjectMeta: testMeta(name, labels), Spec: spec,
+		Status: corev1.PodStatus{Phase: corev1.PodRunning}}
+}
+
+func testService(name string, selector map[string]string) *corev1.Service {
+	return &corev1.Service{ObjectMeta: testMeta(name, nil), Spec: corev1.ServiceSpec{Selector: selector}}
+}
+
+func testDeployment(name string, labels map[string]string) *appsv1.Deployment {
+	return &appsv1.Deployment{ObjectMeta: testMeta(name, nil), Spec: appsv1.DeploymentSpec{
+		Selector: &metav1.LabelSelector{MatchLabels: labels},
+		Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: labels}},
+	}}
+}
+
+func testIngress(name string, backends ...string) *networkingv1.Ingress {
+	paths := []networkingv1.HTTPIngressPath{}
+	for _, backend := range backends {
+		paths = append(paths, networkingv1.HTTPIngressPath{Path: "/" + backend, Backend: networkingv1.IngressBackend{
+			Service: &networkingv1.IngressServiceBackend{Name: backend, Port: networkingv1.ServiceBackendPort{Number: 80}},
+		}})
+	}
+	return &networkingv1.Ingress{ObjectMeta: testMeta(name, nil), Spec: networkingv1.IngressSpec{
+		Rules: []networkingv1.IngressRule{{Host: "shop.example.com", IngressRuleValue: networkingv1.IngressRuleValue{
+			HTTP: &networkingv1.HTTPIngressRuleValue{Paths: paths},
+		}}},
+	}}
+}
+
+func testHPA(name, target string) *autoscalingv2.HorizontalPodAutoscaler {
+	return &autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: testMeta(name, nil), Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+		ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: target},
+		MaxReplicas:    3,
+	}}
+}
+
+func configMapVolume(name string, optional bool) corev1.Volume {
+	return corev1.Volume{Name: name, VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+		LocalObjectReference: corev1.LocalObjectReference{Name: name}, Optional: &optional,
+	}}}
+}
+
+func TestBuildGraphRelationships(t *testing.T) {
+	web := map[string]string{"app": "web"}
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		want    []string
+	}{
+		{
+			name: "service selects the pods carrying its labels",
+			objects: []runtime.Object{
+				testService("web", web),
+				testPod("web-1", web, corev1.PodSpec{}),
+				testPod("other", map[string]string{"app": "other"}, corev1.PodSpec{}),
+			},
+			want: []string{"Service/shop/web selects Pod/shop/web-1"},
+		},
+		{
+			name: "service without selector selects nothing",
+			objects: []runtime.Object{
+				testService("web", nil),
+				testPod("web-1", web, corev1.PodSpec{}),
+			},
+			want: []string{},
+		},
+		{
+			name: "deployment manages the pods of its selector",
+			objects: []runtime.Object{
+				testDeployment("web", web),
+				testPod("web-1", web, corev1.PodSpec{}),
+				testPod("web-2", web, corev1.PodSpec{}),
+			},
+			want: []string{
+				"Deployment/shop/web manages Pod/shop/web-1",
+				"Deployment/shop/web manages Pod/shop/web-2",
+			},
+		},
+		{
+			name: "ingress routes to its backends, missing ones broken",
+			objects: []runtime.Object{
+				testIngress("web", "web", "api"),
+				testService("web", nil),
+			},
+			want: []string{
+				"Ingress/shop/web routes Service/shop/api (broken)",
+				"Ingress/shop/web routes Service/shop/web",
+			},
+		},
+		{
+			name: "HPA scales its target, a missing one broken",
+			objects: []runtime.Object{
+				testHPA("web", "web"),
+				testHPA("api", "api"),
+				testDeployment("web", web),
+			},
+			want: []string{
+				"HorizontalPodAutoscaler/shop/api scales Deployment/shop/api (broken)",
+				"HorizontalPodAutoscaler/shop/web scales Deployment/shop/web",
+			},
+		},
+		{
+			name: "pod uses its ConfigMaps, a missing required one broken",
+			objects: []runtime.Object{
+				testPod("web-1", nil, corev1.PodSpec{Volumes: []corev1.Volume{
+					configMapVolume("app-config", false),
+					configMapVolume("missing", false),
+					configMapVolume("optional", true),
+				}}),
+				&corev1.ConfigMap{ObjectMeta: testMeta("app-config", nil)},
+			},
+			want: []string{
+				"Pod/shop/web-1 uses ConfigMap/shop/app-config",
+				"Pod/shop/web-1 uses ConfigMap/shop/missing (broken)",
+			},
+		},
+		{
+			name: "pod uses its secrets and runs on its node",
+			objects: []runtime.Object{
+				testPod("web-1", nil, corev1.PodSpec{NodeName: "node-1", Containers: []corev1.Container{{
+					Name: "app", Image: "app",
+					EnvFrom: []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "db-creds"}}}},
+				}}}),
+				&corev1.Secret{ObjectMeta: testMeta("db-creds", nil)},
+			},
+			want: []string{
+				"Pod/shop/web-1 runs-on Node//node-1",
+				"Pod/shop/web-1 uses Secret/shop/db-creds",
+			},
+		},
+		{
+			name: "ExternalName service targets an external name",
+			objects: []runtime.Object{
+				&corev1.Service{ObjectMeta: testMeta("db", nil), Spec: corev1.ServiceSpec{
+					Type: corev1.ServiceTypeExternalName, ExternalName: "db.example.com",
+				}},
+			},
+			want: []string{"Service/shop/db targets External//db.example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := relationshipStrings(testGraph(t, tt.objects...))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("relationships = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
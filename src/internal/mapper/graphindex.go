@@ -0,0 +1,122 @@
+package mapper
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// graphIndex indexes a graph by resource key: where each resource is in
+// Resources, and which relationships leave and enter it, by their position
+// in Relationships. It turns the membership checks of graph building and the
+// neighbour lookups of traversals from scans of the whole graph into map
+// lookups
+type graphIndex struct {
+	resources map[ResourceKey]int
+	out, in   map[ResourceKey][]int
+	// relationships holds the relationships of the graph, to add each once
+	relationships map[Relationship]bool
+	// pods indexes the pods of the graph by label
+	pods *podIndex
+	// The slices indexed, by their first element and length: appending
+	// extends the index, while other changes rebuild it
+	firstResource     *Resource
+	firstRelationship *Relationship
+	resourceCount     int
+	relationshipCount int
+}
+
+// indexed returns the index of the graph, building or extending it to the
+// current resources and relationships. Graphs shared between goroutines must
+// be indexed before they are shared, after which lookups only read the index
+func (g *Graph) indexed() *graphIndex {
+	idx := g.index
+	if idx == nil || !idx.extends(g) {
+		idx = &graphIndex{resources: map[ResourceKey]int{}, out: map[ResourceKey][]int{}, in: map[ResourceKey][]int{},
+			relationships: map[Relationship]bool{}, pods: newPodIndex(nil)}
+		g.index = idx
+	}
+	for i := idx.resourceCount; i < len(g.Resources); i++ {
+		res := &g.Resources[i]
+		if _, ok := idx.resources[res.Key()]; !ok {
+			idx.resources[res.Key()] = i
+			if res.Kind == "Pod" {
+				idx.pods.add(corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: res.Name, Namespace: res.Namespace, Labels: res.Labels}})
+			}
+		}
+	}
+	for i := idx.relationshipCount; i < len(g.Relationships); i++ {
+		rel := &g.Relationships[i]
+		idx.out[rel.From] = append(idx.out[rel.From], i)
+		idx.in[rel.To] = append(idx.in[rel.To], i)
+		idx.relationships[*rel] = true
+	}
+	idx.resourceCount, idx.relationshipCount = len(g.Resources), len(g.Relationships)
+	if len(g.Resources) > 0 {
+		idx.firstResource = &g.Resources[0]
+	}
+	if len(g.Relationships) > 0 {
+		idx.firstRelationship = &g.Relationships[0]
+	}
+	return idx
+}
+
+// extends reports whether the graph only had resources and relationships
+// appended since it was indexed, in the same backing arrays
+func (idx *graphIndex) extends(g *Graph) bool {
+	if len(g.Resources) < idx.resourceCount || len(g.Relationships) < idx.relationshipCount {
+		return false
+	}
+	if idx.resourceCount > 0 && &g.Resources[0] != idx.firstResource {
+		return false
+	}
+	if idx.relationshipCount > 0 && &g.Relationships[0] != idx.firstRelationship {
+		return false
+	}
+	return true
+}
+
+// resource returns a resource of the graph, nil when missing
+func (g *Graph) resource(key ResourceKey) *Resource {
+	if i, ok := g.indexed().resources[key]; ok {
+		return &g.Resources[i]
+	}
+	return nil
+}
+
+// outgoing returns the relationships from a resource
+func (g *Graph) outgoing(key ResourceKey) []Relationship {
+	return g.relationshipsAt(g.indexed().out[key])
+}
+
+// incoming returns the relationships to a resource
+func (g *Graph) incoming(key ResourceKey) []Relationship {
+	return g.relationshipsAt(g.indexed().in[key])
+}
+
+// steps returns the relationships of a resource in either direction, as
+// steps away from it, in the order of the relationships
+func (g *Graph) steps(key ResourceKey) []pathStep {
+	idx := g.indexed()
+	out, in := idx.out[key], idx.in[key]
+	steps := make([]pathStep, 0, len(out)+len(in))
+	for len(out) > 0 || len(in) > 0 {
+		// A relationship of the resource to itself is a step out first
+		if len(in) == 0 || len(out) > 0 && out[0] <= in[0] {
+			steps = append(steps, pathStep{rel: g.Relationships[out[0]], forward: true})
+			out = out[1:]
+		} else {
+			steps = append(steps, pathStep{rel: g.Relationships[in[0]], forward: false})
+			in = in[1:]
+		}
+	}
+	return steps
+}
+
+// relationshipsAt returns the relationships at positions of Relationships
+func (g *Graph) relationshipsAt(positions []int) []Relationship {
+	rels := make([]Relationship, len(positions))
+	for i, pos := range positions {
+		rels[i] = g.Relationships[pos]
+	}
+	return rels
+}
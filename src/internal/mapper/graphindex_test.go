@@ -0,0 +1,205 @@
+package mapper
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// indexTestGraph maps a service and a deployment over two pods, and indexes
+// the graph before the test changes it
+func indexTestGraph(t *testing.T) *Graph {
+	t.Helper()
+	web := map[string]string{"app": "web"}
+	g := testGraph(t,
+		testService("web", web),
+		testDeployment("web", web),
+		testPod("web-1", web, corev1.PodSpec{}),
+		testPod("web-2", web, corev1.PodSpec{}),
+	)
+	g.indexed()
+	return g
+}
+
+func relationshipEnds(rels []Relationship, from bool) []string {
+	ends := []string{}
+	for _, rel := range rels {
+		end := rel.To
+		if from {
+			end = rel.From
+		}
+		ends = append(ends, rel.Type+" "+end.String())
+	}
+	return ends
+}
+
+func TestGraphIndex(t *testing.T) {
+	svc := ResourceKey{Kind: "Service", Namespace: "shop", Name: "web"}
+	pod1 := ResourceKey{Kind: "Pod", Namespace: "shop", Name: "web-1"}
+	pod3 := ResourceKey{Kind: "Pod", Namespace: "shop", Name: "web-3"}
+	tests := []struct {
+		name      string
+		change    func(g *Graph)
+		key       ResourceKey
+		wantFound bool
+		wantOut   []string
+		wantIn    []string
+	}{
+		{
+			name:      "indexed graph",
+			change:    func(g *Graph) {},
+			key:       svc,
+			wantFound: true,
+			wantOut:   []string{"selects Pod/shop/web-1", "selects Pod/shop/web-2"},
+			wantIn:    []string{},
+		},
+		{
+			name:      "incoming relationships",
+			change:    func(g *Graph) {},
+			key:       pod1,
+			wantFound: true,
+			wantOut:   []string{},
+			wantIn:    []string{"selects Service/shop/web", "manages Deployment/shop/web"},
+		},
+		{
+			name: "appended resource and relationship extend the index",
+			change: func(g *Graph) {
+				g.addResource(Resource{Kind: "Pod", Namespace: "shop", Name: "web-3"})
+				g.addRelationship(svc, pod3, RelSelects, "")
+			},
+			key:       pod3,
+			wantFound: true,
+			wantOut:   []string{},
+			wantIn:    []string{"selects Service/shop/web"},
+		},
+		{
+			name: "duplicate relationship is added once",
+			change: func(g *Graph) {
+				g.addEdge(g.Relationships[0])
+				g.addRelationship(svc, pod1, RelSelects, "")
+			},
+			key:       pod1,
+			wantFound: true,
+			wantOut:   []string{},
+			wantIn:    []string{"selects Service/shop/web", "manages Deployment/shop/web"},
+		},
+		{
+			name: "replaced slices rebuild the index",
+			change: func(g *Graph) {
+				g.Resources = []Resource{{Kind: "Service", Namespace: "shop", Name: "web"}}
+				g.Relationships = []Relationship{}
+			},
+			key:       pod1,
+			wantFound: false,
+			wantOut:   []string{},
+			wantIn:    []string{},
+		},
+		{
+			name:      "missing resource",
+			change:    func(g *Graph) {},
+			key:       pod3,
+			wantFound: false,
+			wantOut:   []string{},
+			wantIn:    []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := indexTestGraph(t)
+			tt.change(g)
+			if found := g.resource(tt.key) != nil; found != tt.wantFound {
+				t.Errorf("resource(%s) found = %v, want %v", tt.key, found, tt.wantFound)
+			}
+			if got := relationshipEnds(g.outgoing(tt.key), false); !reflect.DeepEqual(got, tt.wantOut) {
+				t.Errorf("outgoing(%s) = %q, want %q", tt.key, got, tt.wantOut)
+			}
+			if got := relationshipEnds(g.incoming(tt.key), true); !reflect.DeepEqual(got, tt.wantIn) {
+				t.Errorf("incoming(%s) = %q, want %q", tt.key, got, tt.wantIn)
+			}
+		})
+	}
+}
+
+func TestGraphSteps(t *testing.T) {
+	a := ResourceKey{Kind: "Pod", Name: "a"}
+	b := ResourceKey{Kind: "Pod", Name: "b"}
+	g := &Graph{
+		Resources: []Resource{{Kind: "Pod", Name: "a"}, {Kind: "Pod", Name: "b"}},
+		Relationships: []Relationship{
+			{From: b, To: a, Type: RelStartsAfter},
+			{From: a, To: b, Type: RelUses},
+			{From: a, To: a, Type: RelDependsOn},
+		},
+	}
+	tests := []struct {
+		key  ResourceKey
+		want []string
+	}{
+		{key: a, want: []string{"in starts-after", "out uses", "out depends-on", "in depends-on"}},
+		{key: b, want: []string{"out starts-after", "in uses"}},
+		{key: ResourceKey{Kind: "Pod", Name: "c"}, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key.Name, func(t *testing.T) {
+			got := []string{}
+			for _, step := range g.steps(tt.key) {
+				direction := "in"
+				if step.forward {
+					direction = "out"
+				}
+				got = append(got, direction+" "+step.rel.Type)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("steps(%s) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectsAny(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(g *Graph)
+		selector map[string]string
+		want     bool
+	}{
+		{name: "matching pods", change: func(g *Graph) {}, selector: map[string]string{"app": "web"}, want: true},
+		{name: "no matching pod", change: func(g *Graph) {}, selector: map[string]string{"app": "db"}, want: false},
+		{name: "one label missing", change: func(g *Graph) {}, selector: map[string]string{"app": "web", "tier": "front"}, want: false},
+		{name: "empty selector", change: func(g *Graph) {}, selector: map[string]string{}, want: false},
+		{
+			name: "appended pod",
+			change: func(g *Graph) {
+				g.addResource(Resource{Kind: "Pod", Namespace: "shop", Name: "db-1", Labels: map[string]string{"app": "db"}})
+			},
+			selector: map[string]string{"app": "db"},
+			want:     true,
+		},
+		{
+			name: "labels of other kinds",
+			change: func(g *Graph) {
+				g.addResource(Resource{Kind: "ConfigMap", Namespace: "shop", Name: "cache", Labels: map[string]string{"app": "cache"}})
+			},
+			selector: map[string]string{"app": "cache"},
+			want:     false,
+		},
+		{
+			name: "removed pods rebuild the index",
+			change: func(g *Graph) {
+				g.Resources = append([]Resource{}, g.Resources[:2]...)
+			},
+			selector: map[string]string{"app": "web"},
+			want:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := indexTestGraph(t)
+			tt.change(g)
+			if got := selectsAny(g, tt.selector); got != tt.want {
+				t.Errorf("selectsAny(%v) = %v, want %v", tt.selector, got, tt.want)
+			}
+		})
+	}
+}
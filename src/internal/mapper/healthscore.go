@@ -0,0 +1,147 @@
+package mapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Weights of the parts of the health score, adding up to 1
+const (
+	scoreWeightWorkloads = 0.4
+	scoreWeightServices  = 0.3
+	scoreWeightFindings  = 0.3
+)
+
+// Points an error and a warning finding take off the findings part of the
+// health score; info findings take none
+const (
+	scorePenaltyError   = 10
+	scorePenaltyWarning = 3
+)
+
+// healthScoreSeries is the snapshot store series health scores are recorded in
+const healthScoreSeries = "health-scores"
+
+// ratioScore scores the share of healthy items out of 100, full marks when
+// there is nothing to check
+func ratioScore(healthy, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return 100 * float64(healthy) / float64(total)
+}
+
+// score weighs the share of fully ready deployments, the share of services
+// with ready endpoints and the findings of the namespace into a score from 0
+// to 100, rounded to one decimal
+func (h *namespaceHealth) score() float64 {
+	workloads := ratioScore(h.Deployments-len(h.UnreadyDeployments), h.Deployments)
+	services := ratioScore(h.Services-len(h.ServicesWithoutEndpoints), h.Services)
+	findings := math.Max(0, 100-scorePenaltyError*float64(h.Findings[severityError])-scorePenaltyWarning*float64(h.Findings[severityWarning]))
+	score := scoreWeightWorkloads*workloads + scoreWeightServices*services + scoreWeightFindings*findings
+	return math.Round(score*10) / 10
+}
+
+// clusterHealthScore averages the scores of namespaces, weighted by the
+// deployments and services they hold so that a broken empty namespace weighs
+// less than a broken busy one
+func clusterHealthScore(summaries []*namespaceHealth) float64 {
+	total, weights := 0.0, 0.0
+	for _, h := range summaries {
+		weight := math.Max(1, float64(h.Deployments+h.Services))
+		total += weight * h.Score
+		weights += weight
+	}
+	if weights == 0 {
+		return 100
+	}
+	return math.Round(total/weights*10) / 10
+}
+
+// formatScore colours a health score: green from 90, yellow from 70, red below
+func formatScore(score float64) string {
+	color := colorRed
+	switch {
+	case score >= 90:
+		color = colorGreen
+	case score >= 70:
+		color = colorYellow
+	}
+	return fmt.Sprintf("%s%.1f%s", color, score, colorReset)
+}
+
+// healthScores is a record of the health scores of a run
+type healthScores struct {
+	Taken      time.Time          `json:"taken"`
+	Cluster    float64            `json:"cluster"`
+	Namespaces map[string]float64 `json:"namespaces"`
+}
+
+// formatScoreDelta formats the change of the score of a namespace, or of the
+// cluster when namespace is empty, since the previous run. A rising score is
+// good news, unlike the rising counts of formatDelta
+func formatScoreDelta(score float64, previous *healthScores, namespace string) string {
+	if previous == nil {
+		return ""
+	}
+	prev, ok := previous.Cluster, true
+	if namespace != "" {
+		prev, ok = previous.Namespaces[namespace]
+	}
+	if !ok {
+		return ""
+	}
+	diff := score - prev
+	switch {
+	case diff >= 0.05:
+		return fmt.Sprintf(" %s(+%.1f)%s", colorGreen, diff, colorReset)
+	case diff <= -0.05:
+		return fmt.Sprintf(" %s(%.1f)%s", colorRed, diff, colorReset)
+	}
+	return ""
+}
+
+// recordHealthScores records the scores of a run in the snapshot store and
+// returns those of the previous run, nil on the first
+func recordHealthScores(store *snapshotStore, summaries []*namespaceHealth) (*healthScores, error) {
+	records, err := store.records(healthScoreSeries)
+	if err != nil {
+		return nil, err
+	}
+	var previous *healthScores
+	if len(records) > 0 {
+		var last healthScores
+		if err := json.Unmarshal(records[len(records)-1], &last); err == nil {
+			previous = &last
+		}
+	}
+	current := healthScores{Taken: time.Now(), Cluster: clusterHealthScore(summaries), Namespaces: map[string]float64{}}
+	for _, h := range summaries {
+		current.Namespaces[h.Namespace] = h.Score
+	}
+	if err := store.append(healthScoreSeries, current); err != nil {
+		return nil, err
+	}
+	return previous, nil
+}
+
+// healthScoreMetrics formats the health scores in the Prometheus text
+// format, for the textfile collector of node_exporter or a Pushgateway
+func healthScoreMetrics(summaries []*namespaceHealth) string {
+	namespaces := []metricSample{}
+	for _, h := range summaries {
+		namespaces = append(namespaces, metricSample{labels: []string{"namespace", h.Namespace}, value: h.Score})
+	}
+	var b strings.Builder
+	for _, f := range []*metricFamily{
+		{name: "health_score", help: "Health score of the namespace, from 0 to 100.", metricType: "gauge", samples: namespaces},
+		{name: "cluster_health_score", help: "Health score of the cluster, from 0 to 100.", metricType: "gauge",
+			samples: []metricSample{{value: clusterHealthScore(summaries)}}},
+	} {
+		f.write(&b)
+	}
+	return b.String()
+}
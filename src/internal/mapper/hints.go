@@ -0,0 +1,54 @@
+package mapper
+
+import (
+	"strings"
+)
+
+// dependsOnAnnotation lets application teams declare dependencies the API
+// cannot show, such as a service calling another by its DNS name. It holds
+// comma-separated kind/name references to objects of the same namespace,
+// kind/namespace/name to objects of another one and kind//name to
+// cluster-scoped objects
+const dependsOnAnnotation = "resource-map.io/depends-on"
+
+// hintReferences returns the dependencies resources declare in their
+// dependsOnAnnotation. Kinds may be given by their kubectl names, and
+// malformed references are ignored
+func hintReferences(resources []Resource) []ruleReference {
+	refs := []ruleReference{}
+	for _, res := range resources {
+		hint := res.Annotations[dependsOnAnnotation]
+		if hint == "" {
+			continue
+		}
+		for _, entry := range strings.Split(hint, ",") {
+			to, ok := parseHint(strings.TrimSpace(entry), res.Namespace)
+			if !ok || to == res.Key() {
+				continue
+			}
+			refs = append(refs, ruleReference{from: res.Key(), to: to, relType: RelDependsOn, description: "declared dependency"})
+		}
+	}
+	return refs
+}
+
+// parseHint parses a kind/name, kind/namespace/name or kind//name reference
+func parseHint(entry, namespace string) (ResourceKey, bool) {
+	parts := strings.Split(entry, "/")
+	var key ResourceKey
+	switch len(parts) {
+	case 2:
+		key = ResourceKey{Kind: parts[0], Namespace: namespace, Name: parts[1]}
+	case 3:
+		key = ResourceKey{Kind: parts[0], Namespace: parts[1], Name: parts[2]}
+	default:
+		return ResourceKey{}, false
+	}
+	if key.Kind == "" || key.Name == "" {
+		return ResourceKey{}, false
+	}
+	if kind, ok := builtinKindAliases[strings.ToLower(key.Kind)]; ok {
+		key.Kind = kind
+	}
+	return key, true
+}
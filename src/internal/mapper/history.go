@@ -0,0 +1,440 @@
+package mapper
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	// The embedded SQLite engine of the history database
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// historySchema creates the tables of the history database. Namespaces are
+// those a run mapped, empty ones included. Resources and relationships are
+// stored under the namespace whose graph they belong to, which for nodes and
+// services of other namespaces is not their own
+const historySchema = `
+CREATE TABLE IF NOT EXISTS runs (
+  id INTEGER PRIMARY KEY,
+  cluster TEXT NOT NULL,
+  taken TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS namespaces (
+  run_id INTEGER NOT NULL REFERENCES runs(id),
+  namespace TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS resources (
+  run_id INTEGER NOT NULL REFERENCES runs(id),
+  namespace TEXT NOT NULL,
+  kind TEXT NOT NULL,
+  name TEXT NOT NULL,
+  data TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS relationships (
+  run_id INTEGER NOT NULL REFERENCES runs(id),
+  namespace TEXT NOT NULL,
+  type TEXT NOT NULL,
+  from_kind TEXT NOT NULL,
+  from_namespace TEXT NOT NULL,
+  from_name TEXT NOT NULL,
+  to_kind TEXT NOT NULL,
+  to_namespace TEXT NOT NULL,
+  to_name TEXT NOT NULL,
+  description TEXT NOT NULL,
+  broken INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS runs_by_cluster ON runs(cluster, taken);
+CREATE INDEX IF NOT EXISTS namespaces_by_run ON namespaces(run_id);
+CREATE INDEX IF NOT EXISTS resources_by_run ON resources(run_id, namespace);
+CREATE INDEX IF NOT EXISTS relationships_by_run ON relationships(run_id, namespace);
+`
+
+// historyTimeFormat is how run times are stored, UTC so that they sort and
+// compare as text
+const historyTimeFormat = "2006-01-02T15:04:05Z"
+
+// historyStore records the graphs of the mapping runs of a cluster in the
+// embedded SQLite database of the state directory
+type historyStore struct {
+	db      *sql.DB
+	path    string
+	cluster string
+}
+
+// historyRun is a recorded run with the size of what it recorded of the
+// selected namespaces
+type historyRun struct {
+	ID            int
+	Taken         time.Time
+	Namespaces    int
+	Resources     int
+	Relationships int
+}
+
+// openHistory opens the history database under the state directory for the
+// runs of a cluster, creating its tables on first use
+func openHistory(cluster string) (*historyStore, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating state directory: %v", err)
+	}
+	path := filepath.Join(dir, "history.db")
+	// Writers of other runs wait for the database rather than fail
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=10000&_foreign_keys=on")
+	if err != nil {
+		return nil, fmt.Errorf("error opening history database %s: %v", path, err)
+	}
+	if _, err := db.Exec(historySchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating history database %s: %v", path, err)
+	}
+	return &historyStore{db: db, path: path, cluster: cluster}, nil
+}
+
+// close closes the history database
+func (h *historyStore) close() error {
+	return h.db.Close()
+}
+
+// record stores the graphs of a snapshot as a run, in one transaction, so
+// that an interrupted run is never recorded
+func (h *historyStore) record(snapshot *mapSnapshot) error {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error writing history database %s: %v", h.path, err)
+	}
+	if err := h.insertRun(tx, snapshot); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error writing history database %s: %v", h.path, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error writing history database %s: %v", h.path, err)
+	}
+	return nil
+}
+
+// insertRun inserts the rows of a run in a transaction
+func (h *historyStore) insertRun(tx *sql.Tx, snapshot *mapSnapshot) error {
+	result, err := tx.Exec("INSERT INTO runs (cluster, taken) VALUES (?, ?)",
+		h.cluster, snapshot.Taken.UTC().Format(historyTimeFormat))
+	if err != nil {
+		return err
+	}
+	run, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	insertNamespace, err := tx.Prepare("INSERT INTO namespaces VALUES (?, ?)")
+	if err != nil {
+		return err
+	}
+	defer insertNamespace.Close()
+	insertResource, err := tx.Prepare("INSERT INTO resources VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer insertResource.Close()
+	insertRelationship, err := tx.Prepare("INSERT INTO relationships VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer insertRelationship.Close()
+
+	for _, ns := range sortedKeys(snapshot.Namespaces) {
+		g := snapshot.Namespaces[ns]
+		if _, err := insertNamespace.Exec(run, ns); err != nil {
+			return err
+		}
+		for _, res := range g.Resources {
+			data, err := json.Marshal(res)
+			if err != nil {
+				return fmt.Errorf("error encoding resource %s: %v", res.Key(), err)
+			}
+			if _, err := insertResource.Exec(run, ns, res.Kind, res.Name, string(data)); err != nil {
+				return err
+			}
+		}
+		for _, rel := range g.Relationships {
+			if _, err := insertRelationship.Exec(run, ns, rel.Type,
+				rel.From.Kind, rel.From.Namespace, rel.From.Name,
+				rel.To.Kind, rel.To.Namespace, rel.To.Name,
+				rel.Description, rel.Broken); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// namespaceFilter restricts a query on a table to the namespaces selected by
+// -n and --exclude-ns, returning the condition and its arguments
+func namespaceFilter(namespace string, excludeNs []string) (string, []any) {
+	var filter strings.Builder
+	var args []any
+	if namespace != "" {
+		filter.WriteString(" AND namespace = ?")
+		args = append(args, namespace)
+	}
+	for _, ns := range excludeNs {
+		filter.WriteString(" AND namespace != ?")
+		args = append(args, ns)
+	}
+	return filter.String(), args
+}
+
+// runs lists the runs recorded for the cluster, newest first, counting what
+// they recorded of the selected namespaces
+func (h *historyStore) runs(namespace string, excludeNs []string, limit int) ([]historyRun, error) {
+	filter, filterArgs := namespaceFilter(namespace, excludeNs)
+	query := fmt.Sprintf(`SELECT id, taken,
+  (SELECT count(*) FROM namespaces WHERE run_id = runs.id%[1]s),
+  (SELECT count(*) FROM resources WHERE run_id = runs.id%[1]s),
+  (SELECT count(*) FROM relationships WHERE run_id = runs.id%[1]s)
+FROM runs WHERE cluster = ? ORDER BY taken DESC, id DESC LIMIT ?`, filter)
+	var args []any
+	for i := 0; i < 3; i++ {
+		args = append(args, filterArgs...)
+	}
+	rows, err := h.db.Query(query, append(args, h.cluster, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("error reading history database %s: %v", h.path, err)
+	}
+	defer rows.Close()
+	runs := []historyRun{}
+	for rows.Next() {
+		var run historyRun
+		var taken string
+		if err := rows.Scan(&run.ID, &taken, &run.Namespaces, &run.Resources, &run.Relationships); err != nil {
+			return nil, fmt.Errorf("error reading history database %s: %v", h.path, err)
+		}
+		if run.Taken, err = time.Parse(historyTimeFormat, taken); err != nil {
+			return nil, fmt.Errorf("error parsing time of run %d: %v", run.ID, err)
+		}
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading history database %s: %v", h.path, err)
+	}
+	return runs, nil
+}
+
+// runBefore loads the graphs of the selected namespaces from the last run of
+// the cluster taken at or before a time, nil when there is none
+func (h *historyStore) runBefore(before time.Time, namespace string, excludeNs []string) (*mapSnapshot, error) {
+	var id int
+	var taken string
+	err := h.db.QueryRow("SELECT id, taken FROM runs WHERE cluster = ? AND taken <= ? ORDER BY taken DESC, id DESC LIMIT 1",
+		h.cluster, before.UTC().Format(historyTimeFormat)).Scan(&id, &taken)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading history database %s: %v", h.path, err)
+	}
+	snapshot := newMapSnapshot(h.cluster)
+	if snapshot.Taken, err = time.Parse(historyTimeFormat, taken); err != nil {
+		return nil, fmt.Errorf("error parsing time of run %d: %v", id, err)
+	}
+	if err := h.loadRun(snapshot, id, namespace, excludeNs); err != nil {
+		return nil, fmt.Errorf("error reading run %d from %s: %v", id, h.path, err)
+	}
+	return snapshot, nil
+}
+
+// loadRun reads the graphs a run recorded of the selected namespaces
+func (h *historyStore) loadRun(snapshot *mapSnapshot, id int, namespace string, excludeNs []string) error {
+	filter, filterArgs := namespaceFilter(namespace, excludeNs)
+	args := append([]any{id}, filterArgs...)
+	graphOf := func(ns string) *Graph {
+		if snapshot.Namespaces[ns] == nil {
+			snapshot.Namespaces[ns] = &Graph{Resources: []Resource{}, Relationships: []Relationship{}}
+		}
+		return snapshot.Namespaces[ns]
+	}
+
+	rows, err := h.db.Query("SELECT namespace FROM namespaces WHERE run_id = ?"+filter, args...)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var ns string
+		if err := rows.Scan(&ns); err != nil {
+			rows.Close()
+			return err
+		}
+		graphOf(ns)
+	}
+	rows.Close()
+
+	rows, err = h.db.Query("SELECT namespace, data FROM resources WHERE run_id = ?"+filter+" ORDER BY rowid", args...)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var ns, data string
+		if err := rows.Scan(&ns, &data); err != nil {
+			rows.Close()
+			return err
+		}
+		var res Resource
+		if err := json.Unmarshal([]byte(data), &res); err != nil {
+			rows.Close()
+			return fmt.Errorf("error decoding resource: %v", err)
+		}
+		g := graphOf(ns)
+		g.Resources = append(g.Resources, res)
+	}
+	rows.Close()
+
+	rows, err = h.db.Query(`SELECT namespace, type, from_kind, from_namespace, from_name,
+  to_kind, to_namespace, to_name, description, broken
+FROM relationships WHERE run_id = ?`+filter+" ORDER BY rowid", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ns string
+		var rel Relationship
+		if err := rows.Scan(&ns, &rel.Type, &rel.From.Kind, &rel.From.Namespace, &rel.From.Name,
+			&rel.To.Kind, &rel.To.Namespace, &rel.To.Name, &rel.Description, &rel.Broken); err != nil {
+			return err
+		}
+		g := graphOf(ns)
+		g.Relationships = append(g.Relationships, rel)
+	}
+	return rows.Err()
+}
+
+// printHistoryDiff prints what changed in each namespace between a recorded
+// run and the current graphs: resources as diff does, then relationships.
+// It reports whether anything changed
+func (rm *ResourceMapper) printHistoryDiff(then *mapSnapshot, now map[string]*Graph) bool {
+	changed := false
+	namespaces := map[string]bool{}
+	for ns := range then.Namespaces {
+		namespaces[ns] = true
+	}
+	for ns := range now {
+		namespaces[ns] = true
+	}
+	left := then.Taken.Local().Format("2006-01-02 15:04")
+	for _, ns := range sortedKeys(namespaces) {
+		var before, after []Resource
+		if g := then.Namespaces[ns]; g != nil {
+			before = g.Resources
+		}
+		if g := now[ns]; g != nil {
+			after = g.Resources
+		}
+		var diffs []resourceDiff
+		for _, diff := range compareResources(before, after) {
+			if diff.Status() != "same" {
+				diffs = append(diffs, diff)
+			}
+		}
+		var relationships []graphEvent
+		for _, event := range diffGraphs(ns, then.Namespaces[ns], now[ns]) {
+			if event.Relationship != nil {
+				relationships = append(relationships, event)
+			}
+		}
+		if len(diffs) == 0 && len(relationships) == 0 {
+			continue
+		}
+		changed = true
+		rm.printComparison(compareTarget{Context: left, Namespace: ns}, compareTarget{Context: "now", Namespace: ns}, diffs)
+		for _, event := range relationships {
+			rel := event.Relationship
+			sign, color := "+", colorGreen
+			if event.Type == eventRemoved {
+				sign, color = "-", colorRed
+			}
+			fmt.Printf("%s%s %s/%s %s %s %s/%s%s\n", color, sign, rel.From.Kind, rel.From.Name, rm.createArrow(2), rel.Type,
+				rel.To.Kind, rel.To.Name, colorReset)
+		}
+		rm.printLine()
+	}
+	return changed
+}
+
+// runHistorySince runs diff --since: maps the selected namespaces and
+// compares them with the last run recorded at least the given time ago
+func runHistorySince(global *globalFlags, since time.Duration) error {
+	rm, err := global.newResourceMapper()
+	if err != nil {
+		return err
+	}
+	history, err := openHistory(rm.host)
+	if err != nil {
+		return err
+	}
+	defer history.close()
+	then, err := history.runBefore(time.Now().Add(-since), global.namespace, global.excludeNs)
+	if err != nil {
+		return err
+	}
+	if then == nil {
+		return fmt.Errorf("no run of %s recorded %s ago or earlier; record runs with --history", rm.host, since)
+	}
+	namespaces, err := global.namespaces(rm)
+	if err != nil {
+		return err
+	}
+	now, err := rm.captureSnapshot(namespaces)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%sChanges in %s since %s%s\n", colorGreen, rm.host, then.Taken.Local().Format("2006-01-02 15:04"), colorReset)
+	if !rm.printHistoryDiff(then, now.Namespaces) {
+		fmt.Println("No changes")
+	}
+	return nil
+}
+
+// runHistory runs the history subcommand: lists the runs recorded for the
+// cluster
+func runHistory(args []string) error {
+	var global globalFlags
+	fs := newSubcommandFlagSet("history", &global)
+	limit := fs.Int("limit", 20, "Number of runs to list, newest first")
+	fs.Parse(args)
+	if *limit < 0 {
+		return fmt.Errorf("--limit may not be negative")
+	}
+
+	rm, err := global.newResourceMapper()
+	if err != nil {
+		return err
+	}
+	history, err := openHistory(rm.host)
+	if err != nil {
+		return err
+	}
+	defer history.close()
+	runs, err := history.runs(global.namespace, global.excludeNs, *limit)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		fmt.Printf("%sNo runs of %s recorded; record runs with --history%s\n", colorYellow, rm.host, colorReset)
+		return nil
+	}
+	fmt.Printf("%sRuns of %s recorded in %s:%s\n", colorCyan, rm.host, history.path, colorReset)
+	for i, run := range runs {
+		branch := sym("├──")
+		if i == len(runs)-1 {
+			branch = sym("└──")
+		}
+		fmt.Printf("%s #%d %s: %d namespace(s), %d resource(s), %d relationship(s)\n", branch, run.ID,
+			run.Taken.Local().Format("2006-01-02 15:04"), run.Namespaces, run.Resources, run.Relationships)
+	}
+	return nil
+}
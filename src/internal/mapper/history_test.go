@@ -0,0 +1,104 @@
+package mapper
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHistoryStore(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	h, err := openHistory("test")
+	if err != nil {
+		t.Fatalf("openHistory: %v", err)
+	}
+	defer h.close()
+
+	web := ResourceKey{Kind: "Service", Namespace: "shop", Name: "web"}
+	pod := ResourceKey{Kind: "Pod", Namespace: "shop", Name: "web-1"}
+	first := time.Date(2025, time.March, 1, 9, 0, 0, 0, time.UTC)
+	for i, namespaces := range []map[string]*Graph{
+		{
+			"shop": {Resources: []Resource{{Kind: "Service", Namespace: "shop", Name: "web"}}, Relationships: []Relationship{}},
+			"ops":  {Resources: []Resource{}, Relationships: []Relationship{}},
+		},
+		{
+			"shop": {
+				Resources:     []Resource{{Kind: "Service", Namespace: "shop", Name: "web"}, {Kind: "Pod", Namespace: "shop", Name: "web-1"}},
+				Relationships: []Relationship{{From: web, To: pod, Type: RelSelects, Broken: true}},
+			},
+		},
+	} {
+		snapshot := newMapSnapshot("test")
+		snapshot.Taken = first.Add(time.Duration(i) * time.Hour)
+		snapshot.Namespaces = namespaces
+		if err := h.record(snapshot); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		namespace string
+		excludeNs []string
+		limit     int
+		want      []historyRun
+	}{
+		{
+			name:  "newest first",
+			limit: 20,
+			want: []historyRun{
+				{ID: 2, Taken: first.Add(time.Hour), Namespaces: 1, Resources: 2, Relationships: 1},
+				{ID: 1, Taken: first, Namespaces: 2, Resources: 1, Relationships: 0},
+			},
+		},
+		{
+			name:  "limit",
+			limit: 1,
+			want:  []historyRun{{ID: 2, Taken: first.Add(time.Hour), Namespaces: 1, Resources: 2, Relationships: 1}},
+		},
+		{
+			name:      "excluded namespace",
+			excludeNs: []string{"shop"},
+			limit:     20,
+			want: []historyRun{
+				{ID: 2, Taken: first.Add(time.Hour)},
+				{ID: 1, Taken: first, Namespaces: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs, err := h.runs(tt.namespace, tt.excludeNs, tt.limit)
+			if err != nil {
+				t.Fatalf("runs: %v", err)
+			}
+			if !reflect.DeepEqual(runs, tt.want) {
+				t.Errorf("runs = %+v, want %+v", runs, tt.want)
+			}
+		})
+	}
+
+	then, err := h.runBefore(first.Add(90*time.Minute), "shop", nil)
+	if err != nil {
+		t.Fatalf("runBefore: %v", err)
+	}
+	if then == nil || !then.Taken.Equal(first.Add(time.Hour)) {
+		t.Fatalf("runBefore = %+v, want the second run", then)
+	}
+	if got := relationshipStrings(then.Namespaces["shop"]); !reflect.DeepEqual(got, []string{"Service/shop/web selects Pod/shop/web-1 (broken)"}) {
+		t.Errorf("relationships = %q", got)
+	}
+	if then, err := h.runBefore(first.Add(-time.Minute), "", nil); err != nil || then != nil {
+		t.Errorf("runBefore the first run = %v, %v, want none", then, err)
+	}
+
+	other, err := openHistory("other")
+	if err != nil {
+		t.Fatalf("openHistory: %v", err)
+	}
+	defer other.close()
+	if runs, _ := other.runs("", nil, 20); len(runs) != 0 {
+		t.Errorf("runs of another cluster = %+v, want none", runs)
+	}
+}
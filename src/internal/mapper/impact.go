@@ -0,0 +1,126 @@
+package mapper
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// impactOf walks relationships backwards from a resource, up to depth hops,
+// returning the distance of every resource depending on it and the subgraph
+// walked. A pod uses a configmap, so changing the configmap affects the pod,
+// the deployment managing it, the services selecting it and so on
+func impactOf(g *Graph, from ResourceKey, depth int) (map[ResourceKey]int, *Graph) {
+	distance := map[ResourceKey]int{from: 0}
+	sub := &Graph{Resources: []Resource{}, Relationships: []Relationship{}}
+	frontier := []ResourceKey{from}
+	for hop := 1; hop <= depth && len(frontier) > 0; hop++ {
+		next := []ResourceKey{}
+		for _, key := range frontier {
+			for _, rel := range g.incoming(key) {
+				sub.Relationships = append(sub.Relationships, rel)
+				if _, seen := distance[rel.From]; !seen {
+					distance[rel.From] = hop
+					next = append(next, rel.From)
+				}
+			}
+		}
+		frontier = next
+	}
+	for _, res := range g.Resources {
+		if _, ok := distance[res.Key()]; ok {
+			sub.Resources = append(sub.Resources, res)
+		}
+	}
+	return distance, sub
+}
+
+// printImpact lists the resources affected by a change, level by level
+func (rm *ResourceMapper) printImpact(from ResourceKey, distance map[ResourceKey]int) {
+	levels := map[int][]string{}
+	kinds := map[string]int{}
+	maxLevel := 0
+	for key, d := range distance {
+		if d == 0 {
+			continue
+		}
+		levels[d] = append(levels[d], formatResourceKey(key))
+		kinds[key.Kind]++
+		if d > maxLevel {
+			maxLevel = d
+		}
+	}
+
+	fmt.Printf("\n%sImpact of changing or deleting %s:%s\n", colorCyan, formatResourceKey(from), colorReset)
+	if maxLevel == 0 {
+		fmt.Printf(sym("└── %sNothing depends on it%s\n"), colorGreen, colorReset)
+		return
+	}
+	for level := 1; level <= maxLevel; level++ {
+		branch := sym("├──")
+		if level == maxLevel {
+			branch = sym("└──")
+		}
+		sort.Strings(levels[level])
+		fmt.Printf("%s Level %d: %s\n", branch, level, strings.Join(levels[level], ", "))
+	}
+	counts := []string{}
+	for _, kind := range sortedKeys(kinds) {
+		counts = append(counts, fmt.Sprintf("%d %s", kinds[kind], kind))
+	}
+	fmt.Printf("%s%d resource(s) affected: %s%s\n", colorYellow, len(distance)-1, strings.Join(counts, ", "), colorReset)
+}
+
+// runImpact runs the impact subcommand: lists everything transitively
+// affected by changing or deleting a resource
+func runImpact(args []string) error {
+	var global globalFlags
+	fs := newSubcommandFlagSet("impact", &global)
+	depth := fs.Int("depth", 10, "Most relationships walked back from the resource")
+	output := fs.String("output", "text", "Output format: "+graphFormatNames())
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("impact expects a resource given as kind/name")
+	}
+	kind, name, err := parseResourceRef(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *depth < 1 {
+		return fmt.Errorf("--depth must be positive")
+	}
+	if _, ok := graphFormats[*output]; !ok {
+		return fmt.Errorf("unknown output format '%s' (expected one of %s)", *output, graphFormatNames())
+	}
+
+	rm, err := global.newResourceMapper()
+	if err != nil {
+		return err
+	}
+	namespaces, err := global.namespaces(rm)
+	if err != nil {
+		return err
+	}
+	graphs, err := rm.buildGraphs(namespaces)
+	if err != nil {
+		return err
+	}
+	g := mergeGraphs(graphs)
+	sources := findResources(g, rm.resolveKind(kind), name)
+	if len(sources) == 0 {
+		return fmt.Errorf("%s not found", fs.Arg(0))
+	}
+
+	for _, from := range sources {
+		distance, sub := impactOf(g, from, *depth)
+		if *output == "text" {
+			rm.printImpact(from, distance)
+			continue
+		}
+		if err := rm.renderGraphs(*output, splitGraph(sub)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
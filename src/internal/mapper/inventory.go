@@ -0,0 +1,382 @@
+package mapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Resource summarizes a single Kubernetes object for comparisons and reports
+type Resource struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// UID tells a recreated object from the one it replaced
+	UID         string            `json:"uid,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Attributes holds the structural properties of the object (replicas,
+	// ports, hosts, ...) as display strings
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// Status is the health extracted from custom resources
+	Status *ResourceStatus `json:"status,omitempty"`
+	// Raw is the full manifest of the object, only kept with --include-raw
+	Raw json.RawMessage `json:"raw,omitempty"`
+}
+
+// inventoryKinds lists the kinds collected by collectResources, in display order
+var inventoryKinds = []string{"Deployment", "StatefulSet", "HorizontalPodAutoscaler", "Service", "Ingress", "ConfigMap", "Pod"}
+
+// newResource creates a Resource from object metadata
+func newResource(kind string, meta metav1.ObjectMeta) Resource {
+	return Resource{
+		Kind:        kind,
+		Namespace:   meta.Namespace,
+		Name:        meta.Name,
+		UID:         string(meta.UID),
+		Labels:      meta.Labels,
+		Annotations: trimAnnotations(meta.Annotations),
+		Attributes:  map[string]string{},
+	}
+}
+
+// sortedKeys returns the keys of a string-keyed map in sorted order
+func sortedKeys[K ~string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// formatLabels formats a label map as a stable, comma separated string
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for _, key := range sortedKeys(labels) {
+		pairs = append(pairs, key+"="+labels[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// parseLabels parses a string produced by formatLabels
+func parseLabels(formatted string) map[string]string {
+	parsed := map[string]string{}
+	for _, pair := range strings.Split(formatted, ",") {
+		if key, value, ok := strings.Cut(pair, "="); ok {
+			parsed[key] = value
+		}
+	}
+	return parsed
+}
+
+// namespaceObjects holds the typed objects listed from a namespace
+type namespaceObjects struct {
+	namespace      string
+	deployments    []appsv1.Deployment
+	statefulSets   []appsv1.StatefulSet
+	hpas           []autoscalingv2.HorizontalPodAutoscaler
+	services       []corev1.Service
+	ingresses      []networkingv1.Ingress
+	configMaps     []corev1.ConfigMap
+	pods           []corev1.Pod
+	endpointSlices []discoveryv1.EndpointSlice
+	pdbs           []policyv1.PodDisruptionBudget
+	// secrets holds the names of the Secrets, nil when they may not be listed
+	secrets map[string]bool
+	// monitors are the ServiceMonitors and PodMonitors scraping the
+	// namespace, possibly from other namespaces
+	monitors []monitor
+	// prometheusRules are the alerting rules of the cluster
+	prometheusRules []prometheusRule
+	// customResources are already summarized, as they are listed untyped
+	customResources []Resource
+	// ruleReferences are the objects custom resources reference, found by
+	// relationship rules
+	ruleReferences []ruleReference
+	// rules configures the lint rules whose findings are attached to the graph
+	rules ruleSet
+	// clusterDomain is the DNS suffix of service names
+	clusterDomain string
+	// includeRaw embeds the manifests of the objects in their resources
+	includeRaw bool
+	// selected is set when selectors, --max-resources-per-namespace or
+	// disabled processors restricted the lists, so that an object missing
+	// from them may exist all the same
+	selected bool
+	// errors are the types that could not be listed, with partial results
+	errors []MappingError
+	// truncated are the types listed only up to the maximum of objects
+	truncated []Truncation
+}
+
+// listNamespaceObjects lists every tracked resource type in a namespace. With
+// partial results, a type that cannot be listed is mapped as empty and
+// reported in the graph instead of failing it
+func (rm *ResourceMapper) listNamespaceObjects(namespace string) (*namespaceObjects, error) {
+	objs := &namespaceObjects{namespace: namespace, rules: rm.rules, clusterDomain: rm.clusterDomain,
+		includeRaw: rm.includeRaw, selected: rm.selecting(), errors: rm.skippedErrors(namespace)}
+	// failed records a list that failed, and tells to stop unless mapping
+	// partial results
+	failed := func(source string, err error) bool {
+		if err == nil {
+			return false
+		}
+		objs.errors = append(objs.errors, newMappingError(namespace, source, err))
+		return !rm.partial
+	}
+
+	deployments, err := rm.listDeployments(namespace)
+	if failed("deployments", err) {
+		return nil, err
+	}
+	objs.deployments = deployments
+
+	statefulSets, err := rm.listStatefulSets(namespace)
+	if failed("statefulsets", err) {
+		return nil, err
+	}
+	objs.statefulSets = statefulSets
+
+	hpas, err := rm.listHPAs(namespace)
+	if failed("HPAs", err) {
+		return nil, err
+	}
+	objs.hpas = hpas
+
+	services, err := rm.listServices(namespace)
+	if failed("services", err) {
+		return nil, err
+	}
+	objs.services = services
+
+	ingresses, err := rm.listIngresses(namespace)
+	if failed("ingresses", err) {
+		return nil, err
+	}
+	objs.ingresses = ingresses
+
+	configMaps, err := rm.listConfigMaps(namespace)
+	if failed("configmaps", err) {
+		return nil, err
+	}
+	objs.configMaps = configMaps
+
+	objs.pods, err = rm.listPods(namespace)
+	if failed("pods", err) {
+		return nil, err
+	}
+
+	objs.endpointSlices, err = rm.listEndpointSlices(namespace)
+	if failed("endpoint slices", err) {
+		return nil, err
+	}
+
+	objs.pdbs, err = rm.listPDBs(namespace)
+	if failed("pod disruption budgets", err) {
+		return nil, err
+	}
+
+	secrets, allowed, err := rm.listSecretNames(namespace)
+	if failed("secrets", err) {
+		return nil, err
+	}
+	if allowed {
+		objs.secrets = secrets
+	}
+
+	objs.monitors, _, err = rm.listMonitors(namespace)
+	if failed("monitors", err) {
+		return nil, err
+	}
+
+	objs.prometheusRules, _, err = rm.listPrometheusRules()
+	if failed("PrometheusRules", err) {
+		return nil, err
+	}
+
+	objs.customResources, objs.ruleReferences, err = rm.listCustomResources(namespace)
+	if failed("custom resources", err) {
+		return nil, err
+	}
+
+	objs.truncated = rm.truncatedIn(namespace)
+	objs.selected = objs.selected || len(objs.truncated) > 0 || rm.disabling()
+	return objs, nil
+}
+
+// collectResources gathers a summary of every tracked resource in a namespace
+func (rm *ResourceMapper) collectResources(namespace string) ([]Resource, error) {
+	objs, err := rm.listNamespaceObjects(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return objs.resources(), nil
+}
+
+// withRaw embeds the manifest of an object in its resource, with --include-raw
+func (objs *namespaceObjects) withRaw(res Resource, obj runtime.Object) Resource {
+	if objs.includeRaw {
+		res.Raw = rawManifest(obj)
+	}
+	return res
+}
+
+// resources summarizes the listed objects
+func (objs *namespaceObjects) resources() []Resource {
+	var resources []Resource
+
+	for _, deploy := range objs.deployments {
+		res := newResource("Deployment", deploy.ObjectMeta)
+		if deploy.Spec.Replicas != nil {
+			res.Attributes["replicas"] = strconv.Itoa(int(*deploy.Spec.Replicas))
+		}
+		images := []string{}
+		for _, container := range deploy.Spec.Template.Spec.Containers {
+			images = append(images, container.Image)
+		}
+		res.Attributes["images"] = strings.Join(images, ",")
+		res.Attributes["ports"] = formatContainerPorts(&deploy.Spec.Template.Spec)
+		res.Attributes["strategy"] = string(deploy.Spec.Strategy.Type)
+		res.Attributes["podLabels"] = formatLabels(deploy.Spec.Template.Labels)
+		if deploy.Spec.Template.Spec.PriorityClassName != "" {
+			res.Attributes["priorityClass"] = deploy.Spec.Template.Spec.PriorityClassName
+		}
+		if deploy.Spec.Template.Spec.RuntimeClassName != nil {
+			res.Attributes["runtimeClass"] = *deploy.Spec.Template.Spec.RuntimeClassName
+		}
+		resources = append(resources, objs.withRaw(res, &deploy))
+	}
+
+	for _, sts := range objs.statefulSets {
+		res := newResource("StatefulSet", sts.ObjectMeta)
+		if sts.Spec.Replicas != nil {
+			res.Attributes["replicas"] = strconv.Itoa(int(*sts.Spec.Replicas))
+		}
+		images := []string{}
+		for _, container := range sts.Spec.Template.Spec.Containers {
+			images = append(images, container.Image)
+		}
+		res.Attributes["images"] = strings.Join(images, ",")
+		res.Attributes["ports"] = formatContainerPorts(&sts.Spec.Template.Spec)
+		res.Attributes["serviceName"] = sts.Spec.ServiceName
+		res.Attributes["podLabels"] = formatLabels(sts.Spec.Template.Labels)
+		resources = append(resources, objs.withRaw(res, &sts))
+	}
+
+	for _, hpa := range objs.hpas {
+		res := newResource("HorizontalPodAutoscaler", hpa.ObjectMeta)
+		res.Attributes["target"] = hpa.Spec.ScaleTargetRef.Kind + "/" + hpa.Spec.ScaleTargetRef.Name
+		if hpa.Spec.MinReplicas != nil {
+			res.Attributes["minReplicas"] = strconv.Itoa(int(*hpa.Spec.MinReplicas))
+		}
+		res.Attributes["maxReplicas"] = strconv.Itoa(int(hpa.Spec.MaxReplicas))
+		metrics := []string{}
+		for _, metric := range hpa.Spec.Metrics {
+			if metric.Resource != nil && metric.Resource.Target.AverageUtilization != nil {
+				metrics = append(metrics, fmt.Sprintf("%s=%d%%", metric.Resource.Name, *metric.Resource.Target.AverageUtilization))
+			}
+		}
+		res.Attributes["metrics"] = strings.Join(metrics, ",")
+		resources = append(resources, objs.withRaw(res, &hpa))
+	}
+
+	for _, svc := range objs.services {
+		res := newResource("Service", svc.ObjectMeta)
+		res.Attributes["type"] = string(svc.Spec.Type)
+		res.Attributes["ports"] = formatServicePorts(svc.Spec.Ports)
+		res.Attributes["selector"] = formatLabels(svc.Spec.Selector)
+		if svc.Spec.ExternalName != "" {
+			res.Attributes["externalName"] = svc.Spec.ExternalName
+		}
+		resources = append(resources, objs.withRaw(res, &svc))
+	}
+
+	for _, ing := range objs.ingresses {
+		res := newResource("Ingress", ing.ObjectMeta)
+		hosts := []string{}
+		backends := []string{}
+		for _, rule := range ing.Spec.Rules {
+			hosts = append(hosts, rule.Host)
+			if rule.HTTP == nil {
+				continue
+			}
+			for _, path := range rule.HTTP.Paths {
+				if path.Backend.Service != nil {
+					backends = append(backends, path.Path+"->"+path.Backend.Service.Name)
+				}
+			}
+		}
+		res.Attributes["hosts"] = strings.Join(hosts, ",")
+		res.Attributes["routes"] = strings.Join(ingressRoutes(&ing), ",")
+		res.Attributes["backends"] = strings.Join(backends, ",")
+		res.Attributes["tls"] = strconv.FormatBool(len(ing.Spec.TLS) > 0)
+		if ing.Spec.IngressClassName != nil {
+			res.Attributes["class"] = *ing.Spec.IngressClassName
+		}
+		resources = append(resources, objs.withRaw(res, &ing))
+	}
+
+	for _, cm := range objs.configMaps {
+		res := newResource("ConfigMap", cm.ObjectMeta)
+		keys := append(sortedKeys(cm.Data), sortedKeys(cm.BinaryData)...)
+		res.Attributes["keys"] = strings.Join(keys, ",")
+		resources = append(resources, objs.withRaw(res, &cm))
+	}
+
+	for _, pod := range objs.pods {
+		res := newResource("Pod", pod.ObjectMeta)
+		res.Attributes["phase"] = string(pod.Status.Phase)
+		res.Attributes["node"] = pod.Spec.NodeName
+		if isMirrorPod(&pod) {
+			res.Attributes["static"] = "true"
+		}
+		resources = append(resources, objs.withRaw(res, &pod))
+	}
+
+	for _, m := range objs.monitors {
+		resources = append(resources, Resource{
+			Kind:       m.Kind,
+			Namespace:  m.Namespace,
+			Name:       m.Name,
+			Attributes: map[string]string{"selector": m.selector.String(), "endpoints": m.endpoints()},
+		})
+	}
+
+	// Rules are listed cluster-wide; only those alerting on the namespace's
+	// workloads belong to its graph
+	rules := map[ResourceKey]map[string]bool{}
+	for _, c := range objs.alertCoverages() {
+		if rules[c.rule] == nil {
+			rules[c.rule] = map[string]bool{}
+		}
+		for _, alert := range c.alerts {
+			rules[c.rule][alert] = true
+		}
+	}
+	for _, rule := range objs.prometheusRules {
+		key := ResourceKey{Kind: "PrometheusRule", Namespace: rule.Namespace, Name: rule.Name}
+		if _, ok := rules[key]; !ok {
+			continue
+		}
+		resources = append(resources, Resource{
+			Kind:       key.Kind,
+			Namespace:  key.Namespace,
+			Name:       key.Name,
+			Attributes: map[string]string{"alerts": strings.Join(sortedKeys(rules[key]), ",")},
+		})
+	}
+
+	return append(resources, objs.customResources...)
+}
@@ -0,0 +1,104 @@
+package mapper
+
+import (
+	"strings"
+)
+
+// builtinKindAliases maps the kubectl short names and resource names of the
+// built-in kinds the mapper knows, lower-cased, to their kinds. Discovery
+// adds those of the cluster, custom resources included
+var builtinKindAliases = map[string]string{
+	"po": "Pod", "pod": "Pod", "pods": "Pod",
+	"svc": "Service", "service": "Service", "services": "Service",
+	"deploy": "Deployment", "deployment": "Deployment", "deployments": "Deployment",
+	"sts": "StatefulSet", "statefulset": "StatefulSet", "statefulsets": "StatefulSet",
+	"ds": "DaemonSet", "daemonset": "DaemonSet", "daemonsets": "DaemonSet",
+	"rs": "ReplicaSet", "replicaset": "ReplicaSet", "replicasets": "ReplicaSet",
+	"job": "Job", "jobs": "Job",
+	"cj": "CronJob", "cronjob": "CronJob", "cronjobs": "CronJob",
+	"cm": "ConfigMap", "configmap": "ConfigMap", "configmaps": "ConfigMap",
+	"secret": "Secret", "secrets": "Secret",
+	"ing": "Ingress", "ingress": "Ingress", "ingresses": "Ingress",
+	"hpa": "HorizontalPodAutoscaler", "horizontalpodautoscaler": "HorizontalPodAutoscaler", "horizontalpodautoscalers": "HorizontalPodAutoscaler",
+	"pdb": "PodDisruptionBudget", "poddisruptionbudget": "PodDisruptionBudget", "poddisruptionbudgets": "PodDisruptionBudget",
+	"ep": "Endpoints", "endpoints": "Endpoints",
+	"endpointslice": "EndpointSlice", "endpointslices": "EndpointSlice",
+	"no": "Node", "node": "Node", "nodes": "Node",
+	"ns": "Namespace", "namespace": "Namespace", "namespaces": "Namespace",
+	"sa": "ServiceAccount", "serviceaccount": "ServiceAccount", "serviceaccounts": "ServiceAccount",
+	"pvc": "PersistentVolumeClaim", "persistentvolumeclaim": "PersistentVolumeClaim", "persistentvolumeclaims": "PersistentVolumeClaim",
+	"netpol": "NetworkPolicy", "networkpolicy": "NetworkPolicy", "networkpolicies": "NetworkPolicy",
+	"servicemonitor": "ServiceMonitor", "servicemonitors": "ServiceMonitor",
+	"podmonitor": "PodMonitor", "podmonitors": "PodMonitor",
+	"prometheusrule": "PrometheusRule", "prometheusrules": "PrometheusRule",
+}
+
+// kindAliases returns the aliases of kinds, discovering those of the cluster
+// on first use. Discovery failing, partly or entirely, leaves the built-in
+// aliases, so that offline mapping still resolves them
+func (rm *ResourceMapper) kindAliases() map[string]string {
+	if rm.aliases != nil {
+		return rm.aliases
+	}
+	rm.aliases = map[string]string{}
+	// Partial results come with an error for the groups that failed
+	_, lists, _ := rm.clientset.Discovery().ServerGroupsAndResources()
+	for _, list := range lists {
+		for _, res := range list.APIResources {
+			// Subresources such as pods/log are not kinds of their own
+			if strings.Contains(res.Name, "/") {
+				continue
+			}
+			names := append([]string{res.Name, res.SingularName, res.Kind}, res.ShortNames...)
+			for _, name := range names {
+				if name != "" {
+					rm.aliases[strings.ToLower(name)] = res.Kind
+				}
+			}
+		}
+	}
+	// The kinds the mapper knows win over clashing names of other groups
+	for alias, kind := range builtinKindAliases {
+		rm.aliases[alias] = kind
+	}
+	return rm.aliases
+}
+
+// resolveKind returns the kind a kind, short name or resource name given on
+// the command line stands for, such as Deployment for deploy. Unknown names
+// are returned as given, "*" included
+func (rm *ResourceMapper) resolveKind(name string) string {
+	return resolveKindIn(rm.kindAliases(), name)
+}
+
+// resolveKindIn returns the kind a name stands for in a map of aliases, the
+// name as given when unknown
+func resolveKindIn(aliases map[string]string, name string) string {
+	if kind, ok := aliases[strings.ToLower(name)]; ok {
+		return kind
+	}
+	return name
+}
+
+// resolveQueryKinds resolves the kind a query selects from and the kinds
+// its conditions compare with; regular expressions are left as written
+func (rm *ResourceMapper) resolveQueryKinds(q *graphQuery) {
+	q.Kind = rm.resolveKind(q.Kind)
+	for i := range q.Conditions {
+		if cond := &q.Conditions[i]; cond.Field == "kind" && cond.Op != "=~" {
+			cond.Value = rm.resolveKind(cond.Value)
+		}
+	}
+}
+
+// resolvePolicyKinds resolves the kinds policies select and count
+// relationships to
+func (rm *ResourceMapper) resolvePolicyKinds(policies []policy) {
+	for i := range policies {
+		p := &policies[i]
+		rm.resolveQueryKinds(p.query)
+		if p.To != "" {
+			p.To = rm.resolveKind(p.To)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package mapper
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"time"
+)
+
+// kubeconfigPollInterval is how often long-running modes check the
+// kubeconfig for changes
+const kubeconfigPollInterval = 2 * time.Second
+
+// kubeconfigPath returns the kubeconfig in use: $KUBECONFIG, or
+// ~/.kube/config
+func kubeconfigPath() (string, error) {
+	if kubeconfig := os.Getenv("KUBECONFIG"); kubeconfig != "" {
+		return kubeconfig, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting home directory: %v", err)
+	}
+	return homeDir + "/.kube/config", nil
+}
+
+// kubeconfigChecksum returns the checksum of a kubeconfig's content. The
+// content is compared rather than the modification time, as mounted Secrets
+// and tools like kubectx replace the file through symlinks and renames
+func kubeconfigChecksum(path string) ([sha256.Size]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
+
+// reloadClients rebuilds the clients when the kubeconfig changed since they
+// were built: a switched context, a rotated token or certificate, or another
+// cluster altogether. Cluster-wide objects cached for the run are dropped,
+// as they may belong to the previous cluster. On error the current clients
+// are kept, and the change is tried again on the next call
+func (rm *ResourceMapper) reloadClients() error {
+	if rm.kubeconfig == "" {
+		return nil
+	}
+	sum, err := kubeconfigChecksum(rm.kubeconfig)
+	if err != nil || sum == rm.kubeconfigSum {
+		// A kubeconfig being replaced may briefly be missing
+		return nil
+	}
+	fresh, err := newResourceMapperWithOptions(rm.opts)
+	if err != nil {
+		return err
+	}
+	if fresh.host != rm.host {
+		fmt.Printf("%s[kubeconfig] Changed, now mapping %s instead of %s%s\n", colorYellow, fresh.host, rm.host, colorReset)
+	} else {
+		fmt.Printf("%s[kubeconfig] Changed, clients rebuilt for %s%s\n", colorYellow, fresh.host, colorReset)
+	}
+	rm.clientset, rm.dynamic, rm.host = fresh.clientset, fresh.dynamic, fresh.host
+	rm.kubeconfig, rm.kubeconfigSum = fresh.kubeconfig, fresh.kubeconfigSum
+	rm.cache = nil
+	rm.clusterCache = nil
+	rm.aliases = nil
+	rm.logShippers = nil
+	rm.prometheusRules, rm.alerting = nil, false
+	return nil
+}
+
+// watchKubeconfig polls a kubeconfig and signals each time its content
+// changes from the last seen checksum. Nothing is signalled without one
+func watchKubeconfig(path string, sum [sha256.Size]byte) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+	if path == "" {
+		return changes
+	}
+	go func() {
+		for range time.Tick(kubeconfigPollInterval) {
+			current, err := kubeconfigChecksum(path)
+			if err != nil || current == sum {
+				continue
+			}
+			sum = current
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return changes
+}
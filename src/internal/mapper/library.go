@@ -0,0 +1,136 @@
+// Package mapper is the engine and command line of k8s-resource-mapper: it
+// maps the resources of a cluster and their relationships, and renders them
+// as the commands Main runs. Go programs embed it through the Map and New
+// API that pkg/resourcemap exports
+package mapper
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Options select the cluster, namespaces and objects Map maps. The zero value
+// maps every namespace of the current kubeconfig context
+type Options struct {
+	// Context is the kubeconfig context, the current one when empty
+	Context string
+	// As and AsGroups impersonate a user and its groups, like kubectl --as
+	As       string
+	AsGroups []string
+	// Clientset and Dynamic are used instead of the kubeconfig when set, such
+	// as fake clientsets in tests. Dynamic may be nil, leaving custom
+	// resources and the Prometheus Operator out
+	Clientset kubernetes.Interface
+	Dynamic   dynamic.Interface
+
+	// Namespaces are mapped, all of them but ExcludeNamespaces when empty
+	Namespaces        []string
+	ExcludeNamespaces []string
+	// LabelSelector and FieldSelector restrict the objects listed, with the
+	// syntax of kubectl
+	LabelSelector string
+	FieldSelector string
+	// MaxResourcesPerNamespace caps the objects of each type listed per
+	// namespace, 0 for no limit; Graph.Truncated tells the types capped
+	MaxResourcesPerNamespace int
+	// HideCompleted leaves Succeeded pods and completed Jobs out
+	HideCompleted bool
+	// IncludeRaw embeds the full manifest of each resource in Resource.Raw
+	IncludeRaw bool
+	// ClusterDomain is the DNS domain of the cluster, cluster.local when
+	// empty
+	ClusterDomain string
+	// FailFast fails on the first type that cannot be listed, instead of
+	// mapping the rest and reporting it in Graph.Errors
+	FailFast bool
+	// Enable and Disable switch resource types on and off by the names of
+	// --enable and --disable
+	Enable  []string
+	Disable []string
+	// Plugins runs the exec plugins found on PATH, as --plugins
+	Plugins bool
+}
+
+// New creates the mapper of the cluster selected by options, returning an
+// error rather than exiting when the cluster cannot be reached
+func New(ctx context.Context, opts Options) (*ResourceMapper, error) {
+	var rm *ResourceMapper
+	if opts.Clientset != nil {
+		rm = NewResourceMapperForClients(opts.Clientset, opts.Dynamic, "injected")
+	} else {
+		var err error
+		rm, err = newResourceMapperWithOptions(clientOptions{Context: opts.Context, As: opts.As, AsGroups: opts.AsGroups,
+			Adaptive: true, RequestTimeout: defaultRequestTimeout, Retries: defaultRetries, AccessCheck: true, Protobuf: true})
+		if err != nil {
+			return nil, fmt.Errorf("error initializing resource mapper: %v", err)
+		}
+	}
+	rm.ctx = ctx
+	if opts.ClusterDomain != "" {
+		rm.clusterDomain = opts.ClusterDomain
+	}
+	rm.includeRaw = opts.IncludeRaw
+	rm.hideCompleted = opts.HideCompleted
+	rm.partial = !opts.FailFast
+	if err := rm.setSelectors(opts.LabelSelector, opts.FieldSelector); err != nil {
+		return nil, err
+	}
+	if err := rm.setMaxResources(opts.MaxResourcesPerNamespace); err != nil {
+		return nil, err
+	}
+	if err := rm.setProcessors(opts.Enable, opts.Disable, opts.Plugins); err != nil {
+		return nil, err
+	}
+	return rm, nil
+}
+
+// Namespaces returns the namespaces of the cluster but those excluded
+func (rm *ResourceMapper) Namespaces(ctx context.Context, exclude []string) ([]string, error) {
+	rm.ctx = ctx
+	rm.clusterCache = nil
+	return rm.resolveNamespaces("", exclude)
+}
+
+// Graph maps one namespace into a graph, with the types that could not be
+// listed or were capped reported in it
+func (rm *ResourceMapper) Graph(ctx context.Context, namespace string) (*Graph, error) {
+	rm.ctx = ctx
+	rm.cache = nil
+	return rm.buildGraph(rm.ctx, namespace)
+}
+
+// Map maps namespaces into one graph, where cluster-scoped resources such as
+// nodes connect them. The types that could not be listed or were capped are
+// reported in the graph
+func (rm *ResourceMapper) Map(ctx context.Context, namespaces []string) (*Graph, error) {
+	rm.ctx = ctx
+	graphs, err := rm.buildGraphs(namespaces)
+	if err != nil {
+		return nil, err
+	}
+	g := mergeGraphs(graphs)
+	for _, ns := range sortedKeys(graphs) {
+		g.Errors = append(g.Errors, graphs[ns].Errors...)
+		g.Truncated = append(g.Truncated, graphs[ns].Truncated...)
+	}
+	return g, nil
+}
+
+// Map maps the namespaces selected by options into one graph, all of them
+// but ExcludeNamespaces when none is given
+func Map(ctx context.Context, opts Options) (*Graph, error) {
+	rm, err := New(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	namespaces := opts.Namespaces
+	if len(namespaces) == 0 {
+		if namespaces, err = rm.Namespaces(ctx, opts.ExcludeNamespaces); err != nil {
+			return nil, err
+		}
+	}
+	return rm.Map(ctx, namespaces)
+}
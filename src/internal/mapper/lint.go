@@ -0,0 +1,251 @@
+package mapper
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// auditRule is a built-in rule producing findings, with its default severity
+type auditRule struct {
+	name        string
+	severity    string
+	description string
+}
+
+// auditRules lists the built-in rules, which a rules file may configure
+var auditRules = []auditRule{
+	{"service-without-pods", severityWarning, "Service selector matching no pods"},
+	{"unused-configmap", severityInfo, "ConfigMap referenced by no pod"},
+	{"orphaned-endpoints", severityWarning, "Endpoints or EndpointSlices without their service"},
+	{"broken-reference", severityError, "Reference to an object that does not exist"},
+	{"undeclared-target-port", severityInfo, "Service port declared by no selected container"},
+	{"missing-resource-limits", severityWarning, "Container without a CPU or memory limit"},
+	{"single-replica", severityWarning, "Workload running a single replica"},
+	{"no-pdb", severityWarning, "Workload not covered by a PodDisruptionBudget"},
+	{"latest-image-tag", severityWarning, "Image without a tag, or tagged latest, and not pinned by digest"},
+	{"no-probes", severityWarning, "Container without a readiness or liveness probe"},
+}
+
+// ruleConfig configures a built-in rule; unset fields keep the defaults
+type ruleConfig struct {
+	Name              string   `json:"name"`
+	Enabled           *bool    `json:"enabled,omitempty"`
+	Severity          string   `json:"severity,omitempty"`
+	ExcludeNamespaces []string `json:"excludeNamespaces,omitempty"`
+}
+
+// auditRulesFile is the format of the --audit-rules file
+type auditRulesFile struct {
+	Rules []ruleConfig `json:"rules"`
+}
+
+// ruleSet holds the configuration of the built-in rules by name; an empty
+// set runs every rule with its default severity
+type ruleSet map[string]ruleConfig
+
+// loadAuditRules reads the configuration of built-in rules from a YAML file
+func loadAuditRules(path string) (ruleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading audit rules: %v", err)
+	}
+	var file auditRulesFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing audit rules %s: %v", path, err)
+	}
+	known := map[string]bool{}
+	for _, rule := range auditRules {
+		known[rule.name] = true
+	}
+	rules := ruleSet{}
+	for _, config := range file.Rules {
+		if !known[config.Name] {
+			return nil, fmt.Errorf("unknown audit rule '%s'", config.Name)
+		}
+		switch config.Severity {
+		case "", severityInfo, severityWarning, severityError:
+		default:
+			return nil, fmt.Errorf("invalid severity '%s' of audit rule %s", config.Severity, config.Name)
+		}
+		rules[config.Name] = config
+	}
+	return rules, nil
+}
+
+// enabled reports whether a rule runs in a namespace
+func (rules ruleSet) enabled(name, namespace string) bool {
+	config, ok := rules[name]
+	if !ok {
+		return true
+	}
+	if config.Enabled != nil && !*config.Enabled {
+		return false
+	}
+	for _, excluded := range config.ExcludeNamespaces {
+		if excluded == namespace {
+			return false
+		}
+	}
+	return true
+}
+
+// apply drops the findings of disabled rules and overrides severities.
+// Findings of other origins, such as policies, pass unchanged
+func (rules ruleSet) apply(findings []Finding) []Finding {
+	kept := []Finding{}
+	for _, f := range findings {
+		if !rules.enabled(f.Rule, f.Namespace) {
+			continue
+		}
+		if severity := rules[f.Rule].Severity; severity != "" {
+			f.Severity = severity
+		}
+		kept = append(kept, f)
+	}
+	return kept
+}
+
+// lintWorkload is a workload checked by the lint rules
+type lintWorkload struct {
+	kind     string
+	meta     metav1.ObjectMeta
+	replicas *int32
+	template *corev1.PodTemplateSpec
+}
+
+// imageUsesLatest reports whether an image is not pinned to a version: no
+// digest, and no tag or the latest tag
+func imageUsesLatest(image string) bool {
+	if strings.Contains(image, "@") {
+		return false
+	}
+	// A colon after the last slash separates the tag; one before it belongs
+	// to a registry port
+	name := image[strings.LastIndex(image, "/")+1:]
+	_, tag, ok := strings.Cut(name, ":")
+	return !ok || tag == "latest"
+}
+
+// missingLimits lists the resources a container sets no limit for
+func missingLimits(c *corev1.Container) []string {
+	missing := []string{}
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		if _, ok := c.Resources.Limits[name]; !ok {
+			missing = append(missing, string(name))
+		}
+	}
+	return missing
+}
+
+// missingProbes lists the readiness and liveness probes a container lacks
+func missingProbes(c *corev1.Container) []string {
+	missing := []string{}
+	if c.ReadinessProbe == nil {
+		missing = append(missing, "readiness")
+	}
+	if c.LivenessProbe == nil {
+		missing = append(missing, "liveness")
+	}
+	return missing
+}
+
+// minReplicas returns the replicas a workload runs at least, taking an HPA
+// scaling it into account
+func (objs *namespaceObjects) minReplicas(w lintWorkload) int32 {
+	replicas := int32(1)
+	if w.replicas != nil {
+		replicas = *w.replicas
+	}
+	for _, hpa := range objs.hpas {
+		target := hpa.Spec.ScaleTargetRef
+		if target.Kind != w.kind || target.Name != w.meta.Name {
+			continue
+		}
+		replicas = 1
+		if hpa.Spec.MinReplicas != nil {
+			replicas = *hpa.Spec.MinReplicas
+		}
+	}
+	return replicas
+}
+
+// lintFindings runs the enabled lint rules over the deployments and
+// statefulsets of the namespace
+func (objs *namespaceObjects) lintFindings() []Finding {
+	workloads := []lintWorkload{}
+	for i := range objs.deployments {
+		d := &objs.deployments[i]
+		workloads = append(workloads, lintWorkload{"Deployment", d.ObjectMeta, d.Spec.Replicas, &d.Spec.Template})
+	}
+	for i := range objs.statefulSets {
+		s := &objs.statefulSets[i]
+		workloads = append(workloads, lintWorkload{"StatefulSet", s.ObjectMeta, s.Spec.Replicas, &s.Spec.Template})
+	}
+
+	severities := map[string]string{}
+	for _, rule := range auditRules {
+		severities[rule.name] = rule.severity
+	}
+	findings := []Finding{}
+	for _, w := range workloads {
+		add := func(rule, message string) {
+			if !objs.rules.enabled(rule, objs.namespace) {
+				return
+			}
+			findings = append(findings, Finding{Rule: rule, Severity: severities[rule], Kind: w.kind,
+				Namespace: objs.namespace, Name: w.meta.Name, Message: message})
+		}
+
+		containers := w.template.Spec.Containers
+		for i := range containers {
+			c := &containers[i]
+			if missing := missingLimits(c); len(missing) > 0 {
+				add("missing-resource-limits", fmt.Sprintf("container %s has no %s limit", c.Name, strings.Join(missing, " or ")))
+			}
+			if imageUsesLatest(c.Image) {
+				add("latest-image-tag", fmt.Sprintf("container %s runs %s, not pinned to a version", c.Name, c.Image))
+			}
+			if missing := missingProbes(c); len(missing) > 0 {
+				add("no-probes", fmt.Sprintf("container %s has no %s probe", c.Name, strings.Join(missing, " or ")))
+			}
+		}
+		if replicas := objs.minReplicas(w); replicas == 1 {
+			add("single-replica", "runs a single replica, unavailable while it restarts")
+		}
+		if protectingPDB(w.template.Labels, objs.pdbs) == nil {
+			add("no-pdb", "no PodDisruptionBudget limits voluntary disruptions")
+		}
+	}
+	return findings
+}
+
+// attachFindings records the rules a resource breaks in its findings
+// attribute, so that graph output carries them
+func attachFindings(g *Graph, findings []Finding) {
+	rules := map[ResourceKey][]string{}
+	for _, f := range findings {
+		key := ResourceKey{Kind: f.Kind, Namespace: f.Namespace, Name: f.Name}
+		rules[key] = append(rules[key], f.Rule)
+	}
+	for i := range g.Resources {
+		res := &g.Resources[i]
+		names := rules[res.Key()]
+		if len(names) == 0 {
+			continue
+		}
+		sort.Strings(names)
+		unique := []string{}
+		for _, name := range names {
+			if len(unique) == 0 || unique[len(unique)-1] != name {
+				unique = append(unique, name)
+			}
+		}
+		res.Attributes["findings"] = strings.Join(unique, ",")
+	}
+}
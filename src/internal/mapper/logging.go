@@ -0,0 +1,233 @@
+package mapper
+
+import (
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// logExclusion is a pod or namespace marker telling a log shipper to skip
+// the logs of the pods carrying it
+type logExclusion struct {
+	key        string
+	annotation bool // annotation rather than label
+	namespace  bool // set on the namespace rather than the pod
+}
+
+// logShipperType describes a log shipper and the exclusions it honours by
+// default
+type logShipperType struct {
+	name       string
+	imageHints []string
+	exclusions []logExclusion
+}
+
+// logShipperTypes lists the recognized log shippers
+var logShipperTypes = []logShipperType{
+	{
+		name:       "Fluent Bit",
+		imageHints: []string{"fluent-bit"},
+		exclusions: []logExclusion{{key: "fluentbit.io/exclude", annotation: true}},
+	},
+	{
+		name:       "Fluentd",
+		imageHints: []string{"fluentd"},
+	},
+	{
+		name:       "Vector",
+		imageHints: []string{"timberio/vector", "vectordotdev/vector"},
+		exclusions: []logExclusion{
+			{key: "vector.dev/exclude"},
+			{key: "vector.dev/exclude", namespace: true},
+		},
+	},
+}
+
+// logShipper is a log shipper DaemonSet found in the cluster
+type logShipper struct {
+	kind      *logShipperType
+	namespace string
+	name      string
+	// nodes are the nodes a shipper pod runs on
+	nodes map[string]bool
+}
+
+// shipperTypeOf recognizes a log shipper DaemonSet by its container images
+func shipperTypeOf(ds *appsv1.DaemonSet) *logShipperType {
+	for i := range logShipperTypes {
+		for _, container := range ds.Spec.Template.Spec.Containers {
+			for _, hint := range logShipperTypes[i].imageHints {
+				if strings.Contains(container.Image, hint) {
+					return &logShipperTypes[i]
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// listLogShippers finds the log shipper DaemonSets of the cluster and the
+// nodes they run on, once per run
+func (rm *ResourceMapper) listLogShippers() ([]logShipper, error) {
+	if rm.logShippers != nil {
+		return rm.logShippers, nil
+	}
+	daemonSets, err := rm.listAllDaemonSets()
+	if err != nil {
+		return nil, err
+	}
+	var pods []corev1.Pod
+
+	shippers := []logShipper{}
+	for i := range daemonSets {
+		ds := &daemonSets[i]
+		kind := shipperTypeOf(ds)
+		if kind == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(ds.Spec.Selector)
+		if err != nil {
+			continue
+		}
+		// The pods of every namespace are listed once, for all the shippers
+		if pods == nil {
+			if pods, err = rm.listAllPods(); err != nil {
+				return nil, fmt.Errorf("error getting pods of daemonset %s/%s: %v", ds.Namespace, ds.Name, err)
+			}
+		}
+		shipper := logShipper{kind: kind, namespace: ds.Namespace, name: ds.Name, nodes: map[string]bool{}}
+		for _, pod := range pods {
+			if pod.Namespace != ds.Namespace || !selector.Matches(labels.Set(pod.Labels)) {
+				continue
+			}
+			if pod.Spec.NodeName != "" && pod.Status.Phase == corev1.PodRunning {
+				shipper.nodes[pod.Spec.NodeName] = true
+			}
+		}
+		shippers = append(shippers, shipper)
+	}
+	rm.logShippers = shippers
+	return shippers, nil
+}
+
+// excludedBy returns the exclusion of a shipper matching a pod, if any
+func (s *logShipper) excludedBy(pod *corev1.Pod, ns *corev1.Namespace) string {
+	for _, ex := range s.kind.exclusions {
+		meta := &pod.ObjectMeta
+		if ex.namespace {
+			meta = &ns.ObjectMeta
+		}
+		values := meta.Labels
+		if ex.annotation {
+			values = meta.Annotations
+		}
+		if strings.EqualFold(values[ex.key], "true") {
+			if ex.namespace {
+				return "namespace " + ex.key
+			}
+			return ex.key
+		}
+	}
+	return ""
+}
+
+// podWorkload names the workload a pod belongs to, resolving ReplicaSets to
+// their deployment
+func podWorkload(pod *corev1.Pod, revisions podRevisions) string {
+	if rev, ok := revisionOf(pod, revisions); ok {
+		return "Deployment " + rev.Deployment
+	}
+	if owner := metav1.GetControllerOfNoCopy(pod); owner != nil && !isMirrorPod(pod) {
+		return owner.Kind + " " + owner.Name
+	}
+	return "Pod " + pod.Name
+}
+
+// showLoggingCoverage reports which workloads of a namespace have their logs
+// shipped, and why the others don't
+func (rm *ResourceMapper) showLoggingCoverage(namespace string) error {
+	shippers, err := rm.listLogShippers()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\n%sLogging coverage in namespace: %s%s\n", colorCyan, namespace, colorReset)
+	if len(shippers) == 0 {
+		names := []string{}
+		for _, kind := range logShipperTypes {
+			names = append(names, kind.name)
+		}
+		fmt.Printf(sym("└── %sNo log shipper found (%s)%s\n"), colorYellow, strings.Join(names, ", "), colorReset)
+		return nil
+	}
+
+	ns, err := rm.clientset.CoreV1().Namespaces().Get(rm.ctx, namespace, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("error getting namespace %s: %v", namespace, err)
+	}
+	pods, err := rm.listPods(namespace)
+	if err != nil {
+		return err
+	}
+	revisions, err := rm.podRevisionsFor(namespace)
+	if err != nil {
+		return err
+	}
+
+	// A workload is shipped when any shipper picks up the logs of each of its
+	// scheduled pods; otherwise the reasons are collected per workload
+	shipped := map[string]bool{}
+	reasons := map[string]map[string]bool{}
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Spec.NodeName == "" {
+			continue
+		}
+		workload := podWorkload(pod, revisions)
+		podReasons := []string{}
+		covered := false
+		for j := range shippers {
+			s := &shippers[j]
+			if exclusion := s.excludedBy(pod, ns); exclusion != "" {
+				podReasons = append(podReasons, fmt.Sprintf("excluded from %s by %s", s.kind.name, exclusion))
+				continue
+			}
+			if !s.nodes[pod.Spec.NodeName] {
+				podReasons = append(podReasons, fmt.Sprintf("no %s pod on node %s", s.kind.name, pod.Spec.NodeName))
+				continue
+			}
+			covered = true
+			break
+		}
+		if covered {
+			if _, missed := reasons[workload]; !missed {
+				shipped[workload] = true
+			}
+			continue
+		}
+		delete(shipped, workload)
+		if reasons[workload] == nil {
+			reasons[workload] = map[string]bool{}
+		}
+		for _, reason := range podReasons {
+			reasons[workload][reason] = true
+		}
+	}
+
+	for _, s := range shippers {
+		fmt.Printf(sym("├── Shipper: %s (%s/%s on %d node(s))\n"), s.kind.name, s.namespace, s.name, len(s.nodes))
+	}
+	fmt.Printf(sym("├── %sShipped:%s %s\n"), colorGreen, colorReset, strings.Join(sortedKeys(shipped), ", "))
+	if len(reasons) == 0 {
+		fmt.Printf(sym("└── %sEvery workload's logs are shipped%s\n"), colorGreen, colorReset)
+		return nil
+	}
+	fmt.Printf(sym("└── %sNot shipped:%s\n"), colorYellow, colorReset)
+	for _, workload := range sortedKeys(reasons) {
+		fmt.Printf("    %s %s (%s)\n", rm.createArrow(4), workload, strings.Join(sortedKeys(reasons[workload]), "; "))
+	}
+	return nil
+}
@@ -0,0 +1,1256 @@
+package mapper
+
+import (
+	"context"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ResourceMapper holds the Kubernetes client and context
+type ResourceMapper struct {
+	clientset kubernetes.Interface
+	dynamic   dynamic.Interface
+	// metadata lists the metadata of objects only, such as the names of
+	// Secrets; nil to list the full objects
+	metadata metadata.Interface
+	ctx      context.Context
+	host     string
+	// opts are the client options the mapper was created with
+	opts clientOptions
+
+	// cache holds the objects shared by the views of the current namespace,
+	// clusterCache those of the cluster-wide lists of the run
+	cache        *processorCache
+	clusterCache *clusterCache
+	// pool bounds the concurrent work of the mapper, nil to work sequentially
+	pool *workerPool
+	// watcher serves the watched types from memory, nil to list them
+	watcher *graphWatcher
+
+	// access skips the types the identity may not list, nil to list them all
+	access *accessChecker
+	// capabilities skips the types the cluster does not serve, nil to read
+	// every type in its preferred version
+	capabilities *apiCapabilities
+	// processorStates holds whether each processor is enabled, nil for the
+	// defaults
+	processorStates map[string]bool
+
+	// partial maps what can be mapped when views or resource types fail,
+	// keeping their errors for the report instead of failing the namespace
+	partial bool
+	errors  []MappingError
+
+	// clusterDomain is the DNS suffix of the cluster, used for service DNS names
+	clusterDomain string
+	// includeRaw embeds the full manifests of the objects in their resources
+	includeRaw bool
+	// labelSelector and fieldSelector restrict the lists of the mapped
+	// namespaces, see listOptions
+	labelSelector string
+	fieldSelector fields.Selector
+	// maxResources caps the objects listed per type and namespace, 0 for
+	// none, and truncated holds the types that reached it
+	maxResources int
+	truncated    truncations
+
+	// customResources are the custom resource types mapped in each namespace
+	customResources   []customResourceType
+	statusRules       []statusRule
+	relationshipRules []relationshipRule
+
+	// hideCompleted leaves Succeeded pods and completed Jobs out of the map
+	hideCompleted bool
+	// compact skips the per-kind listings and the configuration usage views
+	compact bool
+
+	// logShippers are the log shipper DaemonSets of the cluster, listed once
+	logShippers []logShipper
+	// prometheusRules are the alerting rules of the cluster, listed once, and
+	// alerting whether PrometheusRules could be read
+	prometheusRules []prometheusRule
+	alerting        bool
+
+	// policies are checked by collectFindings, reported as findings
+	policies []policy
+	// rules configures the built-in audit rules
+	rules ruleSet
+
+	// sources maps kind/namespace/name to the manifest file declaring an
+	// object, when mapping manifests from files
+	sources map[string]string
+
+	// aliases maps kind aliases to kinds, discovered on first use
+	aliases map[string]string
+
+	// kubeconfig is the kubeconfig the clients were built from, empty when
+	// mapping manifests, and kubeconfigSum its checksum at the time
+	kubeconfig    string
+	kubeconfigSum [sha256.Size]byte
+}
+
+// stringSliceFlag implements flag.Value interface for string slice flags
+type stringSliceFlag []string
+
+func (s *stringSliceFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSliceFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// clientOptions selects the kubeconfig context and the identity used to
+// talk to the cluster
+type clientOptions struct {
+	// Context is the kubeconfig context, the current one when empty
+	Context string
+	// As and AsGroups impersonate a user and its groups, like kubectl --as
+	As       string
+	AsGroups []string
+	// QPS and Burst limit the rate of API calls, the client-go defaults when
+	// zero; Adaptive slows down further while the API server throttles
+	QPS      float64
+	Burst    int
+	Adaptive bool
+	// Concurrency bounds the API calls made at once, defaultConcurrency when
+	// zero
+	Concurrency int
+	// RequestTimeout bounds each attempt of an API call, none when zero, and
+	// Retries is the number of attempts after the first on transient errors
+	RequestTimeout time.Duration
+	Retries        int
+	// AccessCheck reviews which types the identity may list, skipping the
+	// others instead of failing on them
+	AccessCheck bool
+	// Protobuf requests the built-in types in the protobuf encoding
+	Protobuf bool
+}
+
+// NewResourceMapper creates a new ResourceMapper instance
+func NewResourceMapper() (*ResourceMapper, error) {
+	return newResourceMapperWithOptions(clientOptions{})
+}
+
+// NewResourceMapperForClients creates a ResourceMapper reading the cluster
+// through the given clients, such as fake clientsets in tests or clients
+// configured by a library consumer. The dynamic client may be nil, leaving
+// custom resources and the Prometheus Operator out. Without options, every
+// type is listed in its preferred version and API calls are not bounded
+func NewResourceMapperForClients(clientset kubernetes.Interface, dynamicClient dynamic.Interface, host string) *ResourceMapper {
+	return &ResourceMapper{
+		clientset: clientset,
+		dynamic:   dynamicClient,
+		ctx:       context.Background(),
+		host:      host,
+
+		clusterDomain: "cluster.local",
+	}
+}
+
+// newResourceMapperWithOptions creates a ResourceMapper for a kubeconfig
+// context, impersonating a user when requested
+func newResourceMapperWithOptions(opts clientOptions) (*ResourceMapper, error) {
+	if len(opts.AsGroups) > 0 && opts.As == "" {
+		return nil, fmt.Errorf("--as-group requires --as")
+	}
+	if opts.QPS < 0 || opts.Burst < 0 {
+		return nil, fmt.Errorf("--qps and --burst cannot be negative")
+	}
+	if opts.Concurrency < 0 {
+		return nil, fmt.Errorf("--concurrency cannot be negative")
+	}
+	if opts.RequestTimeout < 0 || opts.Retries < 0 {
+		return nil, fmt.Errorf("--request-timeout and --retries cannot be negative")
+	}
+	if opts.Concurrency == 0 {
+		opts.Concurrency = defaultConcurrency
+	}
+	kubeconfig, err := kubeconfigPath()
+	if err != nil {
+		return nil, err
+	}
+	// Read before the clients are built, so a change while they are is seen
+	sum, _ := kubeconfigChecksum(kubeconfig)
+
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfig},
+		&clientcmd.ConfigOverrides{
+			CurrentContext: opts.Context,
+			AuthInfo: clientcmdapi.AuthInfo{
+				Impersonate:       opts.As,
+				ImpersonateGroups: opts.AsGroups,
+			},
+		},
+	).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error building kubeconfig: %v", err)
+	}
+
+	if opts.QPS == 0 {
+		opts.QPS = defaultQPS
+	}
+	if opts.Burst == 0 {
+		opts.Burst = defaultBurst
+	}
+	// One limiter for both clients, so the limits hold for the whole mapper
+	limiter := newAdaptiveRateLimiter(opts.QPS, opts.Burst, opts.Adaptive)
+	config.RateLimiter = limiter
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper { return rateLimitTransport{next: rt, limiter: limiter} })
+	if tracingEnabled() {
+		config.Wrap(func(rt http.RoundTripper) http.RoundTripper { return tracingTransport{next: rt} })
+	}
+	// Outermost, so that each attempt is rate limited and traced
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return retryTransport{next: rt, limiter: limiter, timeout: opts.RequestTimeout, retries: opts.Retries}
+	})
+
+	var access *accessChecker
+	if opts.AccessCheck {
+		access = &accessChecker{}
+	}
+
+	// Built-in types have a protobuf encoding, much cheaper than JSON for
+	// the API server and the client to produce and parse on large lists;
+	// JSON stays accepted for servers or proxies that answer with it. The
+	// dynamic client only speaks JSON, so it keeps the original config
+	typedConfig := config
+	if opts.Protobuf {
+		typedConfig = rest.CopyConfig(config)
+		typedConfig.ContentType = runtime.ContentTypeProtobuf
+		typedConfig.AcceptContentTypes = runtime.ContentTypeProtobuf + "," + runtime.ContentTypeJSON
+	}
+
+	clientset, err := kubernetes.NewForConfig(typedConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error creating kubernetes client: %v", err)
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating dynamic client: %v", err)
+	}
+
+	metadataClient, err := metadata.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating metadata client: %v", err)
+	}
+
+	rm := NewResourceMapperForClients(clientset, dynamicClient, config.Host)
+	rm.metadata = metadataClient
+	rm.opts = opts
+	rm.pool = newWorkerPool(opts.Concurrency)
+	rm.access = access
+	rm.capabilities = &apiCapabilities{}
+	rm.kubeconfig, rm.kubeconfigSum = kubeconfig, sum
+	return rm, nil
+}
+
+// printLine prints a horizontal line
+func (rm *ResourceMapper) printLine() {
+	fmt.Println(strings.Repeat("-", 80))
+}
+
+// createArrow creates an ASCII arrow of specified length
+func (rm *ResourceMapper) createArrow(length int) string {
+	return strings.Repeat(symbols.Arrow, length) + symbols.ArrowHead
+}
+
+// getResources gets all resources in a namespace
+func (rm *ResourceMapper) getResources(namespace string) error {
+	fmt.Printf("%sResources in namespace: %s%s\n", colorGreen, namespace, colorReset)
+
+	// Get deployments
+	fmt.Printf("\n%sDeployments:%s\n", colorYellow, colorReset)
+	deployments, err := rm.listDeployments(namespace)
+	if err != nil {
+		return err
+	}
+	for _, deploy := range deployments {
+		replicas := int32(1)
+		if deploy.Spec.Replicas != nil {
+			replicas = *deploy.Spec.Replicas
+		}
+		fmt.Printf("%s %d %d\n", deploy.Name, replicas, deploy.Status.AvailableReplicas)
+	}
+	if err := rm.showSchedulingClasses(deployments); err != nil {
+		return err
+	}
+
+	// Get statefulsets
+	fmt.Printf("\n%sStatefulSets:%s\n", colorYellow, colorReset)
+	statefulSets, err := rm.listStatefulSets(namespace)
+	if err != nil {
+		return err
+	}
+	for _, sts := range statefulSets {
+		replicas := int32(1)
+		if sts.Spec.Replicas != nil {
+			replicas = *sts.Spec.Replicas
+		}
+		fmt.Printf("%s %d %d %s\n", sts.Name, replicas, sts.Status.ReadyReplicas, sts.Spec.ServiceName)
+	}
+
+	// Get cronjobs
+	if err := rm.showCronJobs(namespace); err != nil {
+		return err
+	}
+
+	// Get jobs
+	if err := rm.showJobs(namespace); err != nil {
+		return err
+	}
+
+	// Get HPA
+	fmt.Printf("\n%sHpa:%s\n", colorYellow, colorReset)
+	hpas, err := rm.listHPAs(namespace)
+	if err != nil {
+		return err
+	}
+	for _, hpa := range hpas {
+		fmt.Printf("%s ", hpa.Name)
+		for _, metric := range hpa.Spec.Metrics {
+			if metric.Resource != nil {
+				fmt.Printf("%s %d ", metric.Resource.Name, *metric.Resource.Target.AverageUtilization)
+			}
+		}
+		fmt.Println()
+	}
+
+	// Get services
+	fmt.Printf("\n%sServices:%s\n", colorYellow, colorReset)
+	services, err := rm.listServices(namespace)
+	if err != nil {
+		return err
+	}
+	for _, svc := range services {
+		fmt.Printf("%s %s %s %v\n", svc.Name, svc.Spec.Type, svc.Spec.ClusterIP, svc.Spec.ExternalIPs)
+	}
+
+	// Get Ingresses
+	fmt.Printf("\n%sIngress:%s\n", colorYellow, colorReset)
+	ingresses, err := rm.listIngresses(namespace)
+	if err != nil {
+		return err
+	}
+	for _, ing := range ingresses {
+		hosts := []string{}
+		for _, rule := range ing.Spec.Rules {
+			hosts = append(hosts, rule.Host)
+		}
+		fmt.Printf("%s %s\n", ing.Name, strings.Join(hosts, ","))
+	}
+
+	// Get pods
+	fmt.Printf("\n%sPods:%s\n", colorYellow, colorReset)
+	pods, err := rm.listPods(namespace)
+	if err != nil {
+		return err
+	}
+	for i := range pods {
+		fmt.Printf("%s %s %s%s\n", pods[i].Name, pods[i].Status.Phase, pods[i].Spec.NodeName, formatStaticPod(&pods[i]))
+	}
+
+	// Get configmaps
+	fmt.Printf("\n%sConfigMaps:%s\n", colorYellow, colorReset)
+	configmaps, err := rm.listConfigMaps(namespace)
+	if err != nil {
+		return err
+	}
+	for _, cm := range configmaps {
+		fmt.Printf("%s\n", cm.Name)
+	}
+
+	return nil
+}
+
+// mapServiceConnections maps service connections in a namespace
+func (rm *ResourceMapper) mapServiceConnections(namespace string) error {
+	fmt.Printf("\n%sService connections in namespace: %s%s\n", colorBlue, namespace, colorReset)
+
+	services, err := rm.listServices(namespace)
+	if err != nil {
+		return err
+	}
+	index, err := rm.podIndexFor(namespace)
+	if err != nil {
+		return err
+	}
+	revisions, err := rm.podRevisionsFor(namespace)
+	if err != nil {
+		return err
+	}
+
+	for _, service := range services {
+		headless := ""
+		if isHeadless(&service) {
+			headless = " (headless)"
+		}
+		fmt.Printf("\n%sService: %s%s%s\n", colorYellow, service.Name, headless, colorReset)
+
+		if service.Spec.Type == corev1.ServiceTypeExternalName {
+			fmt.Printf(sym("└── External name: %s\n"), service.Spec.ExternalName)
+			continue
+		}
+
+		if len(service.Spec.Selector) == 0 {
+			backends, err := rm.selectorlessBackends(namespace, service.Name)
+			if err != nil {
+				return err
+			}
+			if len(backends) == 0 {
+				fmt.Println(sym("└── No selector and no endpoints"))
+				continue
+			}
+			fmt.Println(sym("└── Manually managed endpoints:"))
+			for _, backend := range backends {
+				fmt.Printf("    %s %s\n", rm.createArrow(4), backend)
+			}
+			continue
+		}
+
+		fmt.Printf(sym("├── Selectors: %v\n"), service.Spec.Selector)
+
+		pods := index.matchLabels(service.Spec.Selector)
+		if len(pods) > 0 {
+			for _, mix := range trafficMix(pods, revisions) {
+				fmt.Printf(sym("├── %sTraffic mix: %s%s\n"), colorYellow, mix, colorReset)
+			}
+			fmt.Println(sym("└── Connected Pods:"))
+			for i := range pods {
+				fmt.Printf("    %s %s%s\n", rm.createArrow(4), pods[i].Name, formatPodRevision(&pods[i], revisions))
+			}
+		}
+	}
+
+	return nil
+}
+
+// showResourceRelationships shows resource relationships in a namespace
+func (rm *ResourceMapper) showResourceRelationships(namespace string) error {
+	fmt.Printf("\n%sResource relationships in namespace: %s%s\n\n", colorBlue, namespace, colorReset)
+
+	fmt.Println("External Traffic")
+	fmt.Println(sym("│"))
+
+	// Handle Ingresses
+	ingresses, err := rm.listIngresses(namespace)
+	if err != nil {
+		return err
+	}
+
+	services, err := rm.listServices(namespace)
+	if err != nil {
+		return err
+	}
+	exists := map[string]bool{}
+	for _, service := range services {
+		exists[service.Name] = true
+	}
+
+	if len(ingresses) > 0 {
+		fmt.Println(sym("▼"))
+		fmt.Println("[Ingress Layer]")
+		for _, ingress := range ingresses {
+			fmt.Printf(sym("├── %s\n"), ingress.Name)
+			for _, rule := range ingress.Spec.Rules {
+				if rule.HTTP == nil {
+					continue
+				}
+				for _, path := range rule.HTTP.Paths {
+					if path.Backend.Service == nil {
+						continue
+					}
+					if !exists[path.Backend.Service.Name] {
+						fmt.Printf(sym("│   %s %sService: %s [broken: not found]%s\n"), rm.createArrow(4), colorRed, path.Backend.Service.Name, colorReset)
+						continue
+					}
+					fmt.Printf(sym("│   %s Service: %s\n"), rm.createArrow(4), path.Backend.Service.Name)
+				}
+			}
+		}
+		fmt.Println(sym("│"))
+	}
+
+	// Handle Services
+	fmt.Println(sym("▼"))
+	fmt.Println("[Service Layer]")
+	index, err := rm.podIndexFor(namespace)
+	if err != nil {
+		return err
+	}
+	revisions, err := rm.podRevisionsFor(namespace)
+	if err != nil {
+		return err
+	}
+
+	for _, service := range services {
+		fmt.Printf(sym("├── %s\n"), service.Name)
+
+		if service.Spec.Type == corev1.ServiceTypeExternalName {
+			fmt.Printf(sym("│   %s External: %s\n"), rm.createArrow(4), service.Spec.ExternalName)
+			continue
+		}
+
+		if len(service.Spec.Selector) == 0 {
+			backends, err := rm.selectorlessBackends(namespace, service.Name)
+			if err != nil {
+				return err
+			}
+			for _, backend := range backends {
+				fmt.Printf(sym("│   %s %s (endpoints)\n"), rm.createArrow(4), backend)
+			}
+			continue
+		}
+
+		pods := index.matchLabels(service.Spec.Selector)
+		for i := range pods {
+			fmt.Printf(sym("│   %s Pod: %s%s\n"), rm.createArrow(4), pods[i].Name, formatPodRevision(&pods[i], revisions))
+		}
+	}
+
+	return nil
+}
+
+// showConfigMapUsage shows ConfigMap usage in a namespace
+func (rm *ResourceMapper) showConfigMapUsage(namespace string) error {
+	fmt.Printf("\n%sConfigMap usage in namespace: %s%s\n", colorCyan, namespace, colorReset)
+
+	configMaps, err := rm.listConfigMaps(namespace)
+	if err != nil {
+		return err
+	}
+	pods, err := rm.listPods(namespace)
+	if err != nil {
+		return err
+	}
+
+	for _, cm := range configMaps {
+		fmt.Printf("\nConfigMap: %s\n", cm.Name)
+
+		usagePods := make(map[string][]string)
+		for i := range pods {
+			for _, ref := range podConfigReferences(&pods[i]) {
+				if ref.Kind == "ConfigMap" && ref.Name == cm.Name {
+					usagePods[pods[i].Name] = append(usagePods[pods[i].Name], ref.describe())
+				}
+			}
+		}
+
+		if len(usagePods) > 0 {
+			fmt.Println(sym("└── Used by pods:"))
+			podNames := make([]string, 0, len(usagePods))
+			for podName := range usagePods {
+				podNames = append(podNames, podName)
+			}
+			sort.Strings(podNames)
+
+			for _, podName := range podNames {
+				fmt.Printf("    %s %s\n", rm.createArrow(4), podName)
+				for _, usage := range usagePods[podName] {
+					fmt.Printf("        - %s\n", usage)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// showSecretUsage shows which pods reference which Secrets in a namespace.
+// Only pod specs are read, so no access to the Secrets themselves is needed
+func (rm *ResourceMapper) showSecretUsage(namespace string) error {
+	pods, err := rm.listPods(namespace)
+	if err != nil {
+		return err
+	}
+
+	usage := map[string]map[string][]string{}
+	for i := range pods {
+		for _, ref := range podConfigReferences(&pods[i]) {
+			if ref.Kind != "Secret" {
+				continue
+			}
+			if usage[ref.Name] == nil {
+				usage[ref.Name] = map[string][]string{}
+			}
+			usage[ref.Name][pods[i].Name] = append(usage[ref.Name][pods[i].Name], ref.describe())
+		}
+	}
+	if len(usage) == 0 {
+		return nil
+	}
+
+	fmt.Printf("\n%sSecret usage in namespace: %s%s\n", colorCyan, namespace, colorReset)
+	for _, secret := range sortedKeys(usage) {
+		fmt.Printf("\nSecret: %s\n", secret)
+		fmt.Println(sym("└── Used by pods:"))
+		for _, podName := range sortedKeys(usage[secret]) {
+			fmt.Printf("    %s %s\n", rm.createArrow(4), podName)
+			for _, use := range usage[secret][podName] {
+				fmt.Printf("        - %s\n", use)
+			}
+		}
+	}
+	return nil
+}
+
+// resolveNamespaces returns the namespace to map when one is given, or all
+// namespaces except the excluded ones
+func (rm *ResourceMapper) resolveNamespaces(namespace string, excludeNs []string) ([]string, error) {
+	if namespace != "" {
+		// Check if specified namespace exists
+		if _, err := rm.clientset.CoreV1().Namespaces().Get(rm.ctx, namespace, metav1.GetOptions{}); err != nil {
+			return nil, fmt.Errorf("namespace '%s' not found", namespace)
+		}
+		return []string{namespace}, nil
+	}
+
+	// Get all namespaces
+	nsList, err := rm.listNamespaces()
+	if err != nil {
+		return nil, err
+	}
+
+	// Filter out excluded namespaces
+	var namespaces []string
+	for _, ns := range nsList {
+		excluded := false
+		for _, excludedNs := range excludeNs {
+			if ns.Name == excludedNs {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			namespaces = append(namespaces, ns.Name)
+		}
+	}
+	return namespaces, nil
+}
+
+// processNamespace processes a single namespace, in the span of ctx. With
+// partial results, a view that fails is reported and the next ones still run
+func (rm *ResourceMapper) processNamespace(ctx context.Context, namespace string) error {
+	// Start from fresh objects, even when the namespace was mapped before,
+	// listed in the span of the namespace
+	rm.cache = nil
+	rm.cacheIn(ctx, namespace)
+
+	rm.printLine()
+	fmt.Printf("%sAnalyzing namespace: %s%s\n", colorRed, namespace, colorReset)
+	rm.printLine()
+
+	traced(ctx, "prefetch", namespace, func(namespace string) error {
+		rm.prefetch(namespace)
+		return nil
+	})
+
+	view := func(name string, process func(string) error) error {
+		err := traced(ctx, name, namespace, process)
+		if err == nil || !rm.partial || rm.ctx.Err() != nil {
+			return err
+		}
+		rm.recordError(newMappingError(namespace, name, err))
+		return nil
+	}
+
+	if !rm.compact {
+		if err := view("getResources", rm.getResources); err != nil {
+			return err
+		}
+	}
+
+	if err := view("mapServiceConnections", rm.mapServiceConnections); err != nil {
+		return err
+	}
+
+	if err := view("showHeadlessServices", rm.showHeadlessServices); err != nil {
+		return err
+	}
+
+	if err := view("showEndpointInventory", rm.showEndpointInventory); err != nil {
+		return err
+	}
+
+	if err := view("showResourceRelationships", rm.showResourceRelationships); err != nil {
+		return err
+	}
+
+	if err := view("showEdgeResilience", rm.showEdgeResilience); err != nil {
+		return err
+	}
+
+	if !rm.compact {
+		if err := view("showPortInventory", rm.showPortInventory); err != nil {
+			return err
+		}
+
+		if err := view("showConfigMapUsage", rm.showConfigMapUsage); err != nil {
+			return err
+		}
+
+		if err := view("showSecretUsage", rm.showSecretUsage); err != nil {
+			return err
+		}
+
+		if err := view("showTrustBundles", rm.showTrustBundles); err != nil {
+			return err
+		}
+	}
+
+	if err := view("showMonitoringCoverage", rm.showMonitoringCoverage); err != nil {
+		return err
+	}
+
+	if err := view("showAlertCoverage", rm.showAlertCoverage); err != nil {
+		return err
+	}
+
+	if err := view("showLoggingCoverage", rm.showLoggingCoverage); err != nil {
+		return err
+	}
+
+	if len(rm.customResources) > 0 {
+		if err := view("showCustomResources", rm.showCustomResources); err != nil {
+			return err
+		}
+	}
+
+	g, err := rm.buildGraph(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	for _, e := range g.Errors {
+		rm.recordError(e)
+	}
+	rm.showBrokenReferences(namespace, g)
+	rm.showStartupOrder(namespace, g)
+	rm.showIsolatedResources(namespace, g)
+
+	rm.printLine()
+	return nil
+}
+
+// Main runs the k8s-resource-mapper command line with the arguments of the
+// process
+func Main() {
+	tracingFromEnv()
+	if runSubcommand(os.Args[1:]) {
+		return
+	}
+	runMap(os.Args[1:])
+}
+
+// warnDeprecated warns that a map flag is kept as an alias of a subcommand
+func warnDeprecated(flagName, command string) {
+	fmt.Printf("%sWarning: --%s is deprecated, use %s%s\n", colorYellow, flagName, command, colorReset)
+}
+
+// runMap runs the map subcommand, also run when no subcommand is given
+func runMap(args []string) {
+	var global globalFlags
+	fs := newSubcommandFlagSet("map", &global)
+	var (
+		exportTo  stringSliceFlag
+		crds      stringSliceFlag
+		fromSnap  stringSliceFlag
+		resume    = fs.Bool("resume", false, "Resume an interrupted run, skipping namespaces already mapped")
+		saveProg  = fs.Bool("checkpoint", false, "Checkpoint the progress of the run so that --resume can finish it if interrupted (on with --resume and --timeout)")
+		groupBy   = fs.String("group-by", "namespace", "Group the map by namespace, node or app (GitOps application)")
+		estimate  = fs.Bool("estimate", false, "Deprecated, use estimate: predict the API calls and duration of a run without mapping anything")
+		compare   = fs.String("compare", "", "Deprecated, use diff: compare two environments, given as [context:]namespace,[context:]namespace")
+		report    = fs.String("report", "comparison.html", "Deprecated, use diff --report: path of the HTML report written by --compare")
+		stats     = fs.Bool("stats", false, "Show graph complexity metrics per namespace and track them across runs")
+		trends    = fs.Bool("trends", false, "Track findings across runs, showing new and resolved findings since the last run")
+		timeout   = fs.Duration("timeout", 0, "Stop mapping after this long and report the namespaces left incomplete (e.g. 5m)")
+		failFast  = fs.Bool("fail-fast", false, "Stop mapping a namespace at its first error instead of mapping the rest and reporting the errors")
+		rulesPath = fs.String("status-rules", "", "YAML file of JSONPath rules extracting phase, ready and message from custom resources")
+		relPath   = fs.String("relationship-rules", "", "YAML file of rules relating custom resources to the objects named by their fields")
+		auditPath = fs.String("audit-rules", "", "YAML file enabling, disabling and setting the severity of built-in audit rules")
+		compact   = fs.Bool("compact", false, "Show only the relationship views, skipping the per-kind listings and ConfigMap/Secret usage")
+		hideDone  = fs.Bool("hide-completed", false, "Omit Succeeded pods and completed Jobs from the map (default true with --compact)")
+		showOnto  = fs.Bool("ontology", false, "Print the supported resource and relationship types as JSON and exit")
+		fromDir   = fs.String("from-dir", "", "Map local manifests (a directory, a file, or - for stdin) instead of a cluster")
+		kustomize = fs.String("kustomize", "", "Map the manifests built from a kustomization directory instead of a cluster")
+		helmChart = fs.String("helm-chart", "", "Map the manifests rendered from a Helm chart (directory or .tgz) instead of a cluster")
+		values    stringSliceFlag
+		saveSnap  = fs.String("save-snapshot", "", "Deprecated, use snapshot save: save the mapped graphs to a JSON file instead of printing the map")
+		history   = fs.Bool("history", false, "Record the mapped graphs in the history, for history and diff --since")
+		focus     = fs.String("focus", "", "Map only the neighbourhood of one resource, given as kind/name")
+		depth     = fs.Int("depth", 2, "Relationship hops expanded around the --focus resource")
+		prComment = fs.String("pr-comment", "", "Post the comparison diff or findings summary to github:owner/repo#pr or gitlab:group/project!mr")
+		failOn    = fs.String("fail-on", "", "Exit with status 3 when a finding is at or above this severity: info, warning or error")
+		help      = fs.Bool("h", false, "Show help message")
+	)
+
+	fs.Var(&exportTo, "export-findings", "Export findings with an exporter: stdout, junit=<path>, sarif=<path>, webhook=<url>, github=<owner/repo#pr>, gitlab=<group/project!mr>")
+	fs.Var(&crds, "custom-resources", "Map custom resources, given as resource[.version].group (repeatable)")
+	fs.Var(&fromSnap, "from-snapshot", "Deprecated, use snapshot show or diff: render a saved snapshot without cluster access; given twice, diff the two")
+	fs.Var(&values, "values", "Values file for --helm-chart (repeatable)")
+	fs.BoolVar(help, "help", false, "Show help message")
+
+	fs.Parse(args)
+
+	if *help {
+		printUsage()
+		fmt.Println()
+		fs.Usage()
+		os.Exit(exitOK)
+	}
+
+	if *showOnto {
+		if err := printOntology(); err != nil {
+			fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+			os.Exit(exitError)
+		}
+		return
+	}
+
+	if *groupBy != "namespace" && *groupBy != "node" && *groupBy != "app" {
+		fmt.Printf("%sError: invalid --group-by value '%s' (expected namespace, node or app)%s\n", colorRed, *groupBy, colorReset)
+		os.Exit(exitError)
+	}
+
+	var focusKind, focusName string
+	if *focus != "" {
+		var err error
+		if focusKind, focusName, err = parseResourceRef(*focus); err != nil {
+			fmt.Printf("%sError: --focus: %v%s\n", colorRed, err, colorReset)
+			os.Exit(exitError)
+		}
+		if *depth < 1 {
+			fmt.Printf("%sError: --depth must be positive%s\n", colorRed, colorReset)
+			os.Exit(exitError)
+		}
+	}
+
+	if err := checkFailOn(*failOn); err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(exitError)
+	}
+
+	// Validate exporters and PR references up front rather than after a long run
+	for _, spec := range exportTo {
+		if _, err := newExporter(spec); err != nil {
+			fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+			os.Exit(exitError)
+		}
+	}
+	pr, err := prCommentTarget(*prComment)
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(exitError)
+	}
+
+	// Compact mode hides completed work unless --hide-completed says otherwise
+	hideCompleted := *hideDone || *compact
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "hide-completed" {
+			hideCompleted = *hideDone
+		}
+	})
+
+	// Snapshots are rendered without a cluster connection
+	if len(fromSnap) > 0 {
+		if len(fromSnap) == 1 {
+			warnDeprecated("from-snapshot", "snapshot show")
+		} else {
+			warnDeprecated("from-snapshot", "diff")
+		}
+		offline := &ResourceMapper{hideCompleted: hideCompleted}
+		if err := offline.runFromSnapshots(fromSnap, global.namespace, global.excludeNs); err != nil {
+			fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+			os.Exit(exitError)
+		}
+		return
+	}
+
+	// Manifests are mapped offline, from files or rendered by kustomize or helm
+	sources := 0
+	for _, source := range []string{*fromDir, *kustomize, *helmChart} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		fmt.Printf("%sError: --from-dir, --kustomize and --helm-chart cannot be combined%s\n", colorRed, colorReset)
+		os.Exit(exitError)
+	}
+	if len(values) > 0 && *helmChart == "" {
+		fmt.Printf("%sError: --values requires --helm-chart%s\n", colorRed, colorReset)
+		os.Exit(exitError)
+	}
+	if sources > 0 && len(crds) > 0 {
+		fmt.Printf("%sError: --custom-resources needs a cluster and cannot be combined with offline manifests%s\n", colorRed, colorReset)
+		os.Exit(exitError)
+	}
+	if sources > 0 && *relPath != "" {
+		fmt.Printf("%sError: --relationship-rules needs a cluster and cannot be combined with offline manifests%s\n", colorRed, colorReset)
+		os.Exit(exitError)
+	}
+	defaultNs := global.namespace
+	if defaultNs == "" {
+		defaultNs = metav1.NamespaceDefault
+	}
+
+	var rm *ResourceMapper
+	switch {
+	case *fromDir != "":
+		rm, err = newManifestResourceMapper(*fromDir, defaultNs)
+	case *kustomize != "":
+		var rendered []byte
+		if rendered, err = renderKustomize(*kustomize); err == nil {
+			rm, err = newRenderedResourceMapper("kustomize:"+*kustomize, rendered, defaultNs)
+		}
+	case *helmChart != "":
+		var rendered []byte
+		if rendered, err = renderHelmChart(*helmChart, values, defaultNs); err == nil {
+			rm, err = newRenderedResourceMapper("helm:"+*helmChart, rendered, defaultNs)
+		}
+	default:
+		rm, err = newResourceMapperWithOptions(global.clientOptions())
+	}
+	if err != nil {
+		fmt.Printf("%sError initializing resource mapper: %v%s\n", colorRed, err, colorReset)
+		os.Exit(exitError)
+	}
+
+	rm.clusterDomain = global.clusterDomain
+	rm.includeRaw = global.includeRaw
+	if err := rm.setSelectors(global.selector, global.fieldSelector); err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(exitError)
+	}
+	if err := rm.setMaxResources(global.maxResources); err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(exitError)
+	}
+	if err := rm.setProcessors(global.enable, global.disable, global.plugins); err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(exitError)
+	}
+	rm.compact = *compact
+	rm.partial = !*failFast
+	rm.hideCompleted = hideCompleted
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		rm.ctx, cancel = context.WithTimeout(rm.ctx, *timeout)
+		defer cancel()
+	}
+	if *rulesPath != "" {
+		rm.statusRules, err = loadStatusRules(*rulesPath)
+		if err != nil {
+			fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+			os.Exit(exitError)
+		}
+	}
+	if *auditPath != "" {
+		rm.rules, err = loadAuditRules(*auditPath)
+		if err != nil {
+			fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+			os.Exit(exitError)
+		}
+	}
+	if len(crds) > 0 {
+		rm.customResources, err = rm.resolveCustomResources(crds)
+		if err != nil {
+			fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+			os.Exit(exitError)
+		}
+	}
+	if *relPath != "" {
+		rules, err := loadRelationshipRules(*relPath)
+		if err == nil {
+			err = rm.resolveRelationshipRules(rules)
+		}
+		if err != nil {
+			fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+			os.Exit(exitError)
+		}
+	}
+
+	fmt.Printf("%sKubernetes Resource Mapper%s\n", colorGreen, colorReset)
+	rm.printLine()
+
+	if *compare != "" {
+		warnDeprecated("compare", "diff")
+		sides := strings.Split(*compare, ",")
+		if len(sides) != 2 {
+			fmt.Printf("%sError: --compare expects exactly two environments%s\n", colorRed, colorReset)
+			os.Exit(exitError)
+		}
+		if err := rm.diffEnvironments(parseCompareTarget(sides[0]), parseCompareTarget(sides[1]), *report, pr); err != nil {
+			fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+			os.Exit(exitError)
+		}
+		return
+	}
+
+	namespaces, err := global.namespaces(rm)
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		os.Exit(exitError)
+	}
+
+	if *estimate {
+		warnDeprecated("estimate", "estimate")
+		if err := rm.showEstimate(namespaces); err != nil {
+			fmt.Printf("%sError estimating API budget: %v%s\n", colorRed, err, colorReset)
+			os.Exit(exitError)
+		}
+		return
+	}
+
+	if *focus != "" {
+		if err := rm.showFocus(namespaces, rm.resolveKind(focusKind), focusName, *depth); err != nil {
+			fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+			os.Exit(exitError)
+		}
+		fmt.Printf("%sResource mapping complete!%s\n", colorGreen, colorReset)
+		return
+	}
+
+	if *groupBy == "node" {
+		if err := rm.showNodeView(namespaces); err != nil {
+			fmt.Printf("%sError building node view: %v%s\n", colorRed, err, colorReset)
+			os.Exit(exitError)
+		}
+		fmt.Printf("%sResource mapping complete!%s\n", colorGreen, colorReset)
+		return
+	}
+
+	// Pick up where an interrupted run left off, if it mapped the same
+	// namespaces with the same options. Progress is only checkpointed when
+	// asked for, or when the run may be cut short; cp is nil otherwise
+	var cp *checkpoint
+	options := optionsDigest(fs.FlagSet)
+	if *resume {
+		cp, err = loadCheckpoint(rm.host)
+		if err != nil {
+			fmt.Printf("%sError loading checkpoint: %v%s\n", colorRed, err, colorReset)
+			os.Exit(exitError)
+		}
+		switch {
+		case cp == nil:
+			fmt.Printf("%sNo checkpoint found, starting a full run%s\n", colorYellow, colorReset)
+		case cp.mismatch(namespaces, options) != "":
+			fmt.Printf("%sCheckpoint not resumed, %s from the interrupted run: starting a full run%s\n",
+				colorYellow, cp.mismatch(namespaces, options), colorReset)
+			cp = nil
+		default:
+			fmt.Printf("%sResuming run: %d namespace(s) already mapped%s\n", colorYellow, len(cp.Completed), colorReset)
+		}
+	}
+	if cp == nil && (*saveProg || *resume || *timeout > 0) {
+		cp, err = newCheckpoint(rm.host, namespaces, options)
+		if err != nil {
+			fmt.Printf("%sError creating checkpoint: %v%s\n", colorRed, err, colorReset)
+			os.Exit(exitError)
+		}
+	}
+
+	var store *snapshotStore
+	if *stats || *trends {
+		store, err = openSnapshotStore(rm.host)
+		if err != nil {
+			fmt.Printf("%sError opening snapshot store: %v%s\n", colorRed, err, colorReset)
+			os.Exit(exitError)
+		}
+	}
+	var hist *historyStore
+	if *history {
+		if hist, err = openHistory(rm.host); err != nil {
+			fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+			os.Exit(exitError)
+		}
+		defer hist.close()
+	}
+
+	if *saveSnap != "" {
+		warnDeprecated("save-snapshot", "snapshot save")
+		count, err := rm.saveSnapshot(namespaces, *saveSnap, hist)
+		if err != nil {
+			fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+			os.Exit(exitError)
+		}
+		fmt.Printf("%sSnapshot of %d namespace(s) written to %s%s\n", colorGreen, count, *saveSnap, colorReset)
+		return
+	}
+
+	// Process namespaces
+	failed := false
+	process := rm.processNamespace
+	if *groupBy == "app" {
+		process = func(_ context.Context, namespace string) error {
+			return rm.showApplicationGroups(namespace)
+		}
+	} else {
+		// Webhooks are cluster-scoped, so they are mapped once for all namespaces
+		if err := rm.showAdmissionWebhooks(namespaces); err != nil {
+			fmt.Printf("%sError mapping admission webhooks: %v%s\n", colorRed, err, colorReset)
+			failed = true
+		}
+	}
+	var findings []Finding
+	var incomplete []string
+	// The graphs are kept for the history, which records the run at once
+	var snapshot *mapSnapshot
+	if hist != nil {
+		snapshot = newMapSnapshot(rm.host)
+	}
+	for _, ns := range namespaces {
+		// Namespaces the interrupted run mapped are replayed from their
+		// graphs and findings; their statistics and trends are already
+		// recorded
+		if cp != nil && cp.isCompleted(ns) {
+			result, err := cp.result(ns)
+			if err != nil {
+				fmt.Printf("%sError resuming namespace %s: %v%s\n", colorRed, ns, err, colorReset)
+				failed = true
+				continue
+			}
+			fmt.Printf("\n%sNamespace %s was mapped by the interrupted run%s\n", colorYellow, ns, colorReset)
+			rm.showSnapshotNamespace(ns, result.Graph)
+			findings = append(findings, result.Findings...)
+			if snapshot != nil {
+				snapshot.Namespaces[ns] = result.Graph
+			}
+			continue
+		}
+		// Past the deadline the remaining namespaces are only reported
+		if rm.ctx.Err() != nil {
+			incomplete = append(incomplete, ns)
+			continue
+		}
+		ctx, end := startSpan(rm.ctx, "namespace", attribute.String("k8s.namespace.name", ns))
+		errorsBefore := len(rm.errors)
+		err := process(ctx, ns)
+		end(err)
+		if err != nil {
+			if rm.ctx.Err() != nil {
+				fmt.Printf("\n%s[incomplete] Namespace %s: deadline reached while mapping, the output above is partial%s\n", colorYellow, ns, colorReset)
+				incomplete = append(incomplete, ns)
+			} else {
+				fmt.Printf("%sError processing namespace %s: %v%s\n", colorRed, ns, err, colorReset)
+			}
+			failed = true
+			continue
+		}
+		if *stats {
+			if err := rm.showGraphStats(ns, store); err != nil {
+				fmt.Printf("%sError computing graph statistics for namespace %s: %v%s\n", colorRed, ns, err, colorReset)
+				failed = true
+				continue
+			}
+		}
+		var nsFindings []Finding
+		if len(exportTo) > 0 || pr != nil || *trends || *failOn != "" {
+			nsFindings, err = rm.collectFindings(ns)
+			if err != nil {
+				fmt.Printf("%sError collecting findings for namespace %s: %v%s\n", colorRed, ns, err, colorReset)
+				failed = true
+				continue
+			}
+			if *trends {
+				if err := rm.showFindingsTrend(ns, nsFindings, store); err != nil {
+					fmt.Printf("%sError tracking findings for namespace %s: %v%s\n", colorRed, ns, err, colorReset)
+					failed = true
+					continue
+				}
+			}
+			findings = append(findings, nsFindings...)
+		}
+		// Namespaces mapped with errors are retried by --resume
+		mappedWithErrors := len(rm.errors) > errorsBefore
+		if mappedWithErrors {
+			failed = true
+		}
+		if cp == nil && snapshot == nil {
+			continue
+		}
+		// The graph is kept in the checkpoint too, for --resume to replay
+		g, err := rm.buildGraph(rm.ctx, ns)
+		if err != nil {
+			fmt.Printf("%sError capturing graph of namespace %s: %v%s\n", colorRed, ns, err, colorReset)
+			failed = true
+			continue
+		}
+		if snapshot != nil {
+			snapshot.Namespaces[ns] = g
+		}
+		if cp == nil || mappedWithErrors {
+			continue
+		}
+		if err := cp.markCompleted(ns, checkpointResult{Graph: g, Findings: nsFindings}); err != nil {
+			fmt.Printf("%sWarning: %v%s\n", colorYellow, err, colorReset)
+		}
+	}
+	rm.printSkippedTypes()
+	rm.printTruncations()
+	printMappingErrors(rm.errors)
+
+	if len(incomplete) > 0 {
+		reportIncomplete(incomplete, *timeout)
+		failed = true
+	}
+
+	// The operator rollup spans all namespaces, so it follows the per-namespace maps
+	if *groupBy == "namespace" && len(rm.customResources) > 0 && rm.ctx.Err() == nil {
+		if err := rm.showOperatorHealth(namespaces); err != nil {
+			fmt.Printf("%sError rolling up operator health: %v%s\n", colorRed, err, colorReset)
+			failed = true
+		}
+	}
+
+	if hist != nil {
+		if err := hist.record(snapshot); err != nil {
+			fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+			failed = true
+		} else {
+			fmt.Printf("%sRun of %d namespace(s) recorded in %s%s\n", colorGreen, len(snapshot.Namespaces), hist.path, colorReset)
+		}
+	}
+
+	if err := exportFindings(exportTo, findings); err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		failed = true
+	}
+	if pr != nil {
+		if err := pr.postComment(findingsMarkdown(findings)); err != nil {
+			fmt.Printf("%sError posting comment to %s: %v%s\n", colorRed, pr, err, colorReset)
+			failed = true
+		} else {
+			fmt.Printf("%sPosted findings summary to %s%s\n", colorGreen, pr, colorReset)
+		}
+	}
+
+	// Keep the checkpoint around when namespaces failed so they can be retried
+	if cp != nil && !failed {
+		if err := cp.remove(); err != nil {
+			fmt.Printf("%sWarning: %v%s\n", colorYellow, err, colorReset)
+		}
+	}
+
+	fmt.Printf("%sResource mapping complete!%s\n", colorGreen, colorReset)
+	os.Exit(exitStatus(failed, findings, *failOn))
+}
@@ -0,0 +1,254 @@
+package mapper
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/yaml"
+)
+
+// clusterScopedKinds are the built-in kinds that never carry a namespace
+var clusterScopedKinds = map[string]bool{
+	"Namespace":                      true,
+	"Node":                           true,
+	"PersistentVolume":               true,
+	"StorageClass":                   true,
+	"PriorityClass":                  true,
+	"RuntimeClass":                   true,
+	"IngressClass":                   true,
+	"ClusterRole":                    true,
+	"ClusterRoleBinding":             true,
+	"MutatingWebhookConfiguration":   true,
+	"ValidatingWebhookConfiguration": true,
+}
+
+// manifestSet holds the objects decoded from manifest files
+type manifestSet struct {
+	objects []runtime.Object
+	// skipped counts documents of kinds the mapper does not know
+	skipped map[string]int
+	// sources maps kind/namespace/name to the file declaring the object,
+	// nil when the manifests do not come from files
+	sources map[string]string
+}
+
+// decodeManifests decodes the YAML or JSON documents of a stream, expanding
+// List objects. Objects without a namespace are placed in defaultNamespace
+func (set *manifestSet) decodeManifests(r io.Reader, source, defaultNamespace string) error {
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(r))
+	decoder := scheme.Codecs.UniversalDeserializer()
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", source, err)
+		}
+
+		var typeMeta metav1.TypeMeta
+		if err := yaml.Unmarshal(doc, &typeMeta); err != nil {
+			return fmt.Errorf("error parsing %s: %v", source, err)
+		}
+		if typeMeta.Kind == "" {
+			// Empty documents and comments between separators
+			continue
+		}
+		if typeMeta.Kind == "List" || strings.HasSuffix(typeMeta.Kind, "List") {
+			var list corev1.List
+			if err := yaml.Unmarshal(doc, &list); err != nil {
+				return fmt.Errorf("error parsing list in %s: %v", source, err)
+			}
+			for _, item := range list.Items {
+				if err := set.decodeManifests(bytes.NewReader(item.Raw), source, defaultNamespace); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		obj, _, err := decoder.Decode(doc, nil, nil)
+		if runtime.IsNotRegisteredError(err) {
+			set.skipped[typeMeta.Kind]++
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error decoding %s in %s: %v", typeMeta.Kind, source, err)
+		}
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return fmt.Errorf("error decoding %s in %s: %v", typeMeta.Kind, source, err)
+		}
+		if accessor.GetNamespace() == "" && !clusterScopedKinds[typeMeta.Kind] {
+			accessor.SetNamespace(defaultNamespace)
+		}
+		if set.sources != nil {
+			set.sources[typeMeta.Kind+"/"+accessor.GetNamespace()+"/"+accessor.GetName()] = source
+		}
+		set.objects = append(set.objects, obj)
+	}
+}
+
+// loadManifests reads the manifests of a directory, walked recursively, of a
+// single file, or of stdin when path is "-"
+func loadManifests(path, defaultNamespace string) (*manifestSet, error) {
+	set := &manifestSet{skipped: map[string]int{}}
+	if path == "-" {
+		return set, set.decodeManifests(os.Stdin, "stdin", defaultNamespace)
+	}
+
+	set.sources = map[string]string{}
+	err := filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return set.decodeManifests(f, file, defaultNamespace)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error loading manifests: %v", err)
+	}
+	return set, nil
+}
+
+// templatePods stands in a pod for the pod template of each workload, since
+// manifests declare no pods, so that selectors and configuration references
+// resolve as they will once the workloads run
+func templatePods(objects []runtime.Object) []runtime.Object {
+	var pods []runtime.Object
+	add := func(owner metav1.Object, kind string, template corev1.PodTemplateSpec) {
+		isController := true
+		pod := &corev1.Pod{
+			ObjectMeta: *template.ObjectMeta.DeepCopy(),
+			Spec:       *template.Spec.DeepCopy(),
+			Status:     corev1.PodStatus{Phase: corev1.PodPending},
+		}
+		pod.Name = owner.GetName() + "-template"
+		pod.Namespace = owner.GetNamespace()
+		pod.OwnerReferences = []metav1.OwnerReference{{Kind: kind, Name: owner.GetName(), Controller: &isController}}
+		pods = append(pods, pod)
+	}
+	for _, obj := range objects {
+		switch o := obj.(type) {
+		case *appsv1.Deployment:
+			add(o, "Deployment", o.Spec.Template)
+		case *appsv1.StatefulSet:
+			add(o, "StatefulSet", o.Spec.Template)
+		case *appsv1.DaemonSet:
+			add(o, "DaemonSet", o.Spec.Template)
+		case *batchv1.Job:
+			add(o, "Job", o.Spec.Template)
+		case *batchv1.CronJob:
+			add(o, "CronJob", o.Spec.JobTemplate.Spec.Template)
+		}
+	}
+	return pods
+}
+
+// withRuntimeOverhead sets the overhead of the RuntimeClass among the
+// manifests on the pods using it, as the RuntimeClass admission controller
+// does for pods created in a cluster
+func withRuntimeOverhead(pods, objects []runtime.Object) []runtime.Object {
+	overheads := map[string]corev1.ResourceList{}
+	for _, obj := range objects {
+		if rc, ok := obj.(*nodev1.RuntimeClass); ok && rc.Overhead != nil {
+			overheads[rc.Name] = rc.Overhead.PodFixed
+		}
+	}
+	for _, obj := range pods {
+		pod := obj.(*corev1.Pod)
+		if pod.Spec.RuntimeClassName != nil && pod.Spec.Overhead == nil {
+			pod.Spec.Overhead = overheads[*pod.Spec.RuntimeClassName]
+		}
+	}
+	return pods
+}
+
+// newManifestResourceMapper creates a ResourceMapper serving the objects of
+// local manifests from an in-memory clientset, so every view runs unchanged
+// without a cluster
+func newManifestResourceMapper(path, defaultNamespace string) (*ResourceMapper, error) {
+	set, err := loadManifests(path, defaultNamespace)
+	if err != nil {
+		return nil, err
+	}
+	return newManifestSetResourceMapper(set, "manifests:"+path)
+}
+
+// newManifestSetResourceMapper creates a ResourceMapper serving decoded
+// manifests, with host naming where they came from
+func newManifestSetResourceMapper(set *manifestSet, host string) (*ResourceMapper, error) {
+	for _, kind := range sortedKeys(set.skipped) {
+		fmt.Printf("%sSkipped %d %s object(s): kind not mapped offline%s\n", colorYellow, set.skipped[kind], kind, colorReset)
+	}
+
+	// Later manifests override earlier ones of the same object, as with
+	// kubectl apply; namespaces are listed by the mapper, so declare the
+	// ones in use
+	type objectKey struct{ kind, namespace, name string }
+	latest := map[objectKey]int{}
+	for i, obj := range set.objects {
+		accessor, _ := meta.Accessor(obj)
+		latest[objectKey{fmt.Sprintf("%T", obj), accessor.GetNamespace(), accessor.GetName()}] = i
+	}
+	declared := map[string]bool{}
+	used := map[string]bool{}
+	objects := []runtime.Object{}
+	for i, obj := range set.objects {
+		accessor, _ := meta.Accessor(obj)
+		if latest[objectKey{fmt.Sprintf("%T", obj), accessor.GetNamespace(), accessor.GetName()}] != i {
+			continue
+		}
+		objects = append(objects, obj)
+		if _, ok := obj.(*corev1.Namespace); ok {
+			declared[accessor.GetName()] = true
+		} else if accessor.GetNamespace() != "" {
+			used[accessor.GetNamespace()] = true
+		}
+	}
+	objects = append(objects, withRuntimeOverhead(templatePods(objects), objects)...)
+	for _, ns := range sortedKeys(used) {
+		if !declared[ns] {
+			objects = append(objects, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}})
+		}
+	}
+
+	api, err := newMemoryAPI(objects)
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := newMemoryClientset(api)
+	if err != nil {
+		return nil, fmt.Errorf("error creating in-memory client: %v", err)
+	}
+	rm := NewResourceMapperForClients(clientset, nil, host)
+	rm.sources = set.sources
+	return rm, nil
+}
@@ -0,0 +1,97 @@
+package mapper
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// undefaultedManifests leave out every field the API server defaults
+const undefaultedManifests = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: shop
+spec:
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+      - name: web
+        image: nginx
+        ports:
+        - containerPort: 8080
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: shop
+spec:
+  selector:
+    app: web
+  ports:
+  - port: 80
+`
+
+func TestOfflineDefaults(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "app.yaml"), []byte(undefaultedManifests), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rm, err := newManifestResourceMapper(dir, "")
+	if err != nil {
+		t.Fatalf("newManifestResourceMapper: %v", err)
+	}
+
+	deployments, err := rm.listDeployments("shop")
+	if err != nil {
+		t.Fatalf("listDeployments: %v", err)
+	}
+	if len(deployments) != 1 || deployments[0].Spec.Replicas == nil || *deployments[0].Spec.Replicas != 1 {
+		t.Fatalf("deployments = %+v, want web with 1 replica", deployments)
+	}
+	if got := deployments[0].Spec.Template.Spec.Containers[0].Ports[0].Protocol; got != corev1.ProtocolTCP {
+		t.Errorf("container port protocol = %q, want TCP", got)
+	}
+	services, err := rm.listServices("shop")
+	if err != nil {
+		t.Fatalf("listServices: %v", err)
+	}
+	if len(services) != 1 || services[0].Spec.Type != corev1.ServiceTypeClusterIP || services[0].Spec.Ports[0].TargetPort.IntValue() != 80 {
+		t.Errorf("services = %+v, want a ClusterIP service targeting port 80", services)
+	}
+
+	if err := rm.getResources("shop"); err != nil {
+		t.Errorf("getResources: %v", err)
+	}
+	g, err := rm.buildGraph(rm.ctx, "shop")
+	if err != nil {
+		t.Fatalf("buildGraph: %v", err)
+	}
+	want := []string{
+		"Deployment/shop/web manages Pod/shop/web-template",
+		"Service/shop/web selects Pod/shop/web-template",
+	}
+	if got := relationshipStrings(g); !reflect.DeepEqual(got, want) {
+		t.Errorf("relationships = %q, want %q", got, want)
+	}
+}
+
+func TestGetResourcesWithoutReplicas(t *testing.T) {
+	// A fake clientset applies no defaults, as manifests read without the
+	// in-memory API would not have them
+	rm := testMapper(testDeployment("web", map[string]string{"app": "web"}))
+	if err := rm.getResources("shop"); err != nil {
+		t.Errorf("getResources: %v", err)
+	}
+}
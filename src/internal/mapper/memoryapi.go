@@ -0,0 +1,324 @@
+package mapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+)
+
+// memoryAPI answers the get and list requests of the Kubernetes API from
+// objects held in memory, as the transport of a clientset, so that manifests
+// are mapped offline by the same clients as a cluster. Other verbs, watches
+// and discovery are not served
+type memoryAPI struct {
+	// resources holds the objects by group, version and resource
+	resources map[schema.GroupVersionResource]*memoryResource
+}
+
+// memoryResource holds the objects of one resource
+type memoryResource struct {
+	listKind schema.GroupVersionKind
+	objects  []runtime.Object
+}
+
+// newMemoryAPI indexes objects of the types registered in the client-go
+// scheme by the resource serving them. Every type with a list is served,
+// those without objects as empty lists
+func newMemoryAPI(objects []runtime.Object) (*memoryAPI, error) {
+	api := &memoryAPI{resources: map[schema.GroupVersionResource]*memoryResource{}}
+	known := scheme.Scheme.AllKnownTypes()
+	for gvk := range known {
+		listKind := gvk.GroupVersion().WithKind(gvk.Kind + "List")
+		if _, ok := known[listKind]; ok {
+			gvr, _ := meta.UnsafeGuessKindToResource(gvk)
+			api.resources[gvr] = &memoryResource{listKind: listKind}
+		}
+	}
+	for _, obj := range objects {
+		gvks, _, err := scheme.Scheme.ObjectKinds(obj)
+		if err != nil {
+			return nil, fmt.Errorf("error indexing %T: %v", obj, err)
+		}
+		gvk := gvks[0]
+		gvr, _ := meta.UnsafeGuessKindToResource(gvk)
+		res := api.resources[gvr]
+		// Served objects carry their kind and defaults, as the API server's do
+		obj = obj.DeepCopyObject()
+		obj.GetObjectKind().SetGroupVersionKind(gvk)
+		memoryDefaults.Default(obj)
+		res.objects = append(res.objects, obj)
+	}
+	// Lists come in the order of the API server's, by namespace and name
+	for _, res := range api.resources {
+		sort.SliceStable(res.objects, func(i, j int) bool {
+			a, _ := meta.Accessor(res.objects[i])
+			b, _ := meta.Accessor(res.objects[j])
+			return a.GetNamespace()+"/"+a.GetName() < b.GetNamespace()+"/"+b.GetName()
+		})
+	}
+	return api, nil
+}
+
+// memoryDefaults sets the defaults the API server gives the fields left out
+// of manifests and read by the mapper, such as the replicas of workloads
+var memoryDefaults = func() *runtime.Scheme {
+	s := runtime.NewScheme()
+	s.AddTypeDefaultingFunc(&appsv1.Deployment{}, func(obj interface{}) {
+		d := obj.(*appsv1.Deployment)
+		defaultReplicas(&d.Spec.Replicas)
+		if d.Spec.Strategy.Type == "" {
+			d.Spec.Strategy.Type = appsv1.RollingUpdateDeploymentStrategyType
+		}
+		defaultPodSpec(&d.Spec.Template.Spec)
+	})
+	s.AddTypeDefaultingFunc(&appsv1.StatefulSet{}, func(obj interface{}) {
+		sts := obj.(*appsv1.StatefulSet)
+		defaultReplicas(&sts.Spec.Replicas)
+		if sts.Spec.PodManagementPolicy == "" {
+			sts.Spec.PodManagementPolicy = appsv1.OrderedReadyPodManagement
+		}
+		defaultPodSpec(&sts.Spec.Template.Spec)
+	})
+	s.AddTypeDefaultingFunc(&appsv1.ReplicaSet{}, func(obj interface{}) {
+		rs := obj.(*appsv1.ReplicaSet)
+		defaultReplicas(&rs.Spec.Replicas)
+		defaultPodSpec(&rs.Spec.Template.Spec)
+	})
+	s.AddTypeDefaultingFunc(&appsv1.DaemonSet{}, func(obj interface{}) {
+		defaultPodSpec(&obj.(*appsv1.DaemonSet).Spec.Template.Spec)
+	})
+	s.AddTypeDefaultingFunc(&batchv1.Job{}, func(obj interface{}) {
+		defaultJobSpec(&obj.(*batchv1.Job).Spec)
+	})
+	s.AddTypeDefaultingFunc(&batchv1.CronJob{}, func(obj interface{}) {
+		cj := obj.(*batchv1.CronJob)
+		if cj.Spec.ConcurrencyPolicy == "" {
+			cj.Spec.ConcurrencyPolicy = batchv1.AllowConcurrent
+		}
+		defaultJobSpec(&cj.Spec.JobTemplate.Spec)
+	})
+	s.AddTypeDefaultingFunc(&corev1.Pod{}, func(obj interface{}) {
+		defaultPodSpec(&obj.(*corev1.Pod).Spec)
+	})
+	s.AddTypeDefaultingFunc(&corev1.Service{}, func(obj interface{}) {
+		svc := obj.(*corev1.Service)
+		if svc.Spec.Type == "" {
+			svc.Spec.Type = corev1.ServiceTypeClusterIP
+		}
+		for i := range svc.Spec.Ports {
+			port := &svc.Spec.Ports[i]
+			if port.Protocol == "" {
+				port.Protocol = corev1.ProtocolTCP
+			}
+			if port.TargetPort == (intstr.IntOrString{}) {
+				port.TargetPort = intstr.FromInt32(port.Port)
+			}
+		}
+	})
+	s.AddTypeDefaultingFunc(&autoscalingv2.HorizontalPodAutoscaler{}, func(obj interface{}) {
+		defaultReplicas(&obj.(*autoscalingv2.HorizontalPodAutoscaler).Spec.MinReplicas)
+	})
+	return s
+}()
+
+// defaultReplicas sets a replica count left out to 1
+func defaultReplicas(replicas **int32) {
+	if *replicas == nil {
+		one := int32(1)
+		*replicas = &one
+	}
+}
+
+// defaultJobSpec sets the defaults of a job, run once by one pod
+func defaultJobSpec(spec *batchv1.JobSpec) {
+	if spec.Completions == nil && spec.Parallelism == nil {
+		defaultReplicas(&spec.Completions)
+	}
+	defaultReplicas(&spec.Parallelism)
+	if spec.BackoffLimit == nil {
+		limit := int32(6)
+		spec.BackoffLimit = &limit
+	}
+	defaultPodSpec(&spec.Template.Spec)
+}
+
+// defaultPodSpec sets the restart policy and port protocols of a pod
+func defaultPodSpec(spec *corev1.PodSpec) {
+	if spec.RestartPolicy == "" {
+		spec.RestartPolicy = corev1.RestartPolicyAlways
+	}
+	for _, containers := range [][]corev1.Container{spec.InitContainers, spec.Containers} {
+		for i := range containers {
+			for j := range containers[i].Ports {
+				if containers[i].Ports[j].Protocol == "" {
+					containers[i].Ports[j].Protocol = corev1.ProtocolTCP
+				}
+			}
+		}
+	}
+}
+
+// newMemoryClientset creates a clientset reading the objects of api
+func newMemoryClientset(api *memoryAPI) (kubernetes.Interface, error) {
+	// A negative QPS leaves the clients without a rate limiter
+	config := &rest.Config{Host: "http://memory", QPS: -1}
+	return kubernetes.NewForConfigAndClient(config, &http.Client{Transport: api})
+}
+
+// RoundTrip answers a request from the objects in memory
+func (api *memoryAPI) RoundTrip(req *http.Request) (*http.Response, error) {
+	status, body := api.serve(req)
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding response: %v", err)
+	}
+	return &http.Response{
+		Status:        http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request:       req,
+	}, nil
+}
+
+// serve returns the status and body answering a request
+func (api *memoryAPI) serve(req *http.Request) (int, any) {
+	if req.URL.Path == "/version" {
+		return http.StatusOK, version.Info{GitVersion: "offline"}
+	}
+	gvr, namespace, name, ok := parseResourcePath(req.URL.Path)
+	if !ok || req.Method != http.MethodGet || req.URL.Query().Get("watch") == "true" {
+		return notServed(req)
+	}
+	res := api.resources[gvr]
+
+	if name != "" {
+		if res != nil {
+			for _, obj := range res.objects {
+				accessor, _ := meta.Accessor(obj)
+				if accessor.GetName() == name && accessor.GetNamespace() == namespace {
+					return http.StatusOK, obj
+				}
+			}
+		}
+		return statusOf(apierrors.NewNotFound(gvr.GroupResource(), name))
+	}
+
+	query := req.URL.Query()
+	labelSelector, err := labels.Parse(query.Get("labelSelector"))
+	if err != nil {
+		return statusOf(apierrors.NewBadRequest(err.Error()))
+	}
+	fieldSelector, err := fields.ParseSelector(query.Get("fieldSelector"))
+	if err != nil {
+		return statusOf(apierrors.NewBadRequest(err.Error()))
+	}
+	if res == nil {
+		return statusOf(apierrors.NewNotFound(gvr.GroupResource(), ""))
+	}
+	items := []runtime.Object{}
+	for _, obj := range res.objects {
+		accessor, _ := meta.Accessor(obj)
+		if namespace != "" && accessor.GetNamespace() != namespace {
+			continue
+		}
+		if !labelSelector.Matches(labels.Set(accessor.GetLabels())) {
+			continue
+		}
+		if !fieldSelector.Empty() && !fieldSelector.Matches(objectFields(obj, fieldSelector)) {
+			continue
+		}
+		items = append(items, obj)
+	}
+	return http.StatusOK, map[string]any{
+		"apiVersion": res.listKind.GroupVersion().String(),
+		"kind":       res.listKind.Kind,
+		"metadata":   metav1.ListMeta{},
+		"items":      items,
+	}
+}
+
+// parseResourcePath parses the path of a request for a resource, in the
+// core group (/api/v1/...) or another (/apis/group/version/...), in a
+// namespace or not, for one object or a list
+func parseResourcePath(path string) (gvr schema.GroupVersionResource, namespace, name string, ok bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case len(parts) >= 3 && parts[0] == "api":
+		gvr.Version, parts = parts[1], parts[2:]
+	case len(parts) >= 4 && parts[0] == "apis":
+		gvr.Group, gvr.Version, parts = parts[1], parts[2], parts[3:]
+	default:
+		return gvr, "", "", false
+	}
+	// namespaces/<name> is a namespace, namespaces/<name>/<resource> a
+	// resource in it
+	if len(parts) >= 3 && parts[0] == "namespaces" {
+		namespace, parts = parts[1], parts[2:]
+	}
+	switch len(parts) {
+	case 1:
+		gvr.Resource = parts[0]
+	case 2:
+		gvr.Resource, name = parts[0], parts[1]
+	default:
+		// Subresources are not served
+		return gvr, "", "", false
+	}
+	return gvr, namespace, name, true
+}
+
+// objectFields returns the values of the fields of an object a selector
+// compares, read from the object's JSON form, such as spec.nodeName
+func objectFields(obj runtime.Object, selector fields.Selector) fields.Set {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return fields.Set{}
+	}
+	set := fields.Set{}
+	for _, req := range selector.Requirements() {
+		value, found, _ := unstructured.NestedFieldNoCopy(content, strings.Split(req.Field, ".")...)
+		if found && value != nil {
+			set[req.Field] = fmt.Sprint(value)
+		}
+	}
+	return set
+}
+
+// notServed answers a request the objects in memory cannot
+func notServed(req *http.Request) (int, any) {
+	return statusOf(apierrors.NewMethodNotSupported(schema.GroupResource{Resource: req.URL.Path}, strings.ToLower(req.Method)))
+}
+
+// statusOf returns the status code and Status object of an API error
+func statusOf(err *apierrors.StatusError) (int, any) {
+	status := err.Status()
+	status.APIVersion, status.Kind = "v1", "Status"
+	return int(status.Code), status
+}
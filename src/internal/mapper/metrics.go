@@ -0,0 +1,120 @@
+package mapper
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// metricsPrefix namespaces the metrics served on /metrics
+const metricsPrefix = "k8s_resource_mapper_"
+
+// metricSample is a sample of a metric with its labels, given as name/value pairs
+type metricSample struct {
+	labels []string
+	value  float64
+}
+
+// metricFamily is a metric with its help text, type and samples
+type metricFamily struct {
+	name       string
+	help       string
+	metricType string
+	samples    []metricSample
+}
+
+// escapeLabelValue escapes a label value for the Prometheus text format
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// write writes the family in the Prometheus text exposition format
+func (f *metricFamily) write(b *strings.Builder) {
+	fmt.Fprintf(b, "# HELP %s%s %s\n", metricsPrefix, f.name, f.help)
+	fmt.Fprintf(b, "# TYPE %s%s %s\n", metricsPrefix, f.name, f.metricType)
+	for _, s := range f.samples {
+		labels := []string{}
+		for i := 0; i+1 < len(s.labels); i += 2 {
+			labels = append(labels, fmt.Sprintf(`%s="%s"`, s.labels[i], escapeLabelValue(s.labels[i+1])))
+		}
+		name := metricsPrefix + f.name
+		if len(labels) > 0 {
+			name += "{" + strings.Join(labels, ",") + "}"
+		}
+		fmt.Fprintf(b, "%s %v\n", name, s.value)
+	}
+}
+
+// countSamples turns counts keyed by label values into samples sorted by them
+func countSamples(counts map[[2]string]int, names ...string) []metricSample {
+	keys := make([][2]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i][0] < keys[j][0] || (keys[i][0] == keys[j][0] && keys[i][1] < keys[j][1])
+	})
+	samples := []metricSample{}
+	for _, key := range keys {
+		labels := []string{}
+		for i, name := range names {
+			labels = append(labels, name, key[i])
+		}
+		samples = append(samples, metricSample{labels: labels, value: float64(counts[key])})
+	}
+	return samples
+}
+
+// topologyMetrics computes the metrics of the latest graphs. Resources are
+// counted in their own namespace only, leaving out the cluster-scoped nodes,
+// services of other namespaces and missing objects a graph refers to
+func topologyMetrics(graphs map[string]*Graph) []*metricFamily {
+	resources := map[[2]string]int{}
+	relationships := map[[2]string]int{}
+	broken := map[[2]string]int{}
+	for _, ns := range sortedKeys(graphs) {
+		g := graphs[ns]
+		for _, res := range g.Resources {
+			if res.Namespace == ns && res.Attributes["missing"] != "true" {
+				resources[[2]string{res.Kind, ns}]++
+			}
+		}
+		for _, rel := range g.Relationships {
+			relationships[[2]string{rel.Type, ns}]++
+		}
+		broken[[2]string{ns}] = len(g.brokenRelationships())
+	}
+	return []*metricFamily{
+		{name: "resources_total", help: "Resources mapped, by kind and namespace.", metricType: "gauge",
+			samples: countSamples(resources, "kind", "namespace")},
+		{name: "relationships_total", help: "Relationships mapped, by type and namespace.", metricType: "gauge",
+			samples: countSamples(relationships, "type", "namespace")},
+		{name: "broken_references_total", help: "Relationships to objects that do not exist, by namespace.", metricType: "gauge",
+			samples: countSamples(broken, "namespace")},
+	}
+}
+
+// handleMetrics serves the topology of the latest refresh and the health of
+// the refreshes in the Prometheus text format
+func (s *graphServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	families := topologyMetrics(s.graphs)
+	families = append(families,
+		&metricFamily{name: "mapping_duration_seconds", help: "Duration of the last successful refresh.", metricType: "gauge",
+			samples: []metricSample{{value: s.duration.Seconds()}}},
+		&metricFamily{name: "last_refresh_timestamp_seconds", help: "Unix time of the last successful refresh.", metricType: "gauge",
+			samples: []metricSample{{value: float64(s.updated.UnixNano()) / float64(time.Second)}}},
+		&metricFamily{name: "refresh_failures_total", help: "Refreshes that failed since the server started.", metricType: "counter",
+			samples: []metricSample{{value: float64(s.failures)}}},
+	)
+	s.mu.RUnlock()
+
+	var b strings.Builder
+	for _, f := range families {
+		f.write(&b)
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
@@ -0,0 +1,289 @@
+package mapper
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Prometheus Operator resources describing scrape targets
+var (
+	serviceMonitorResource = schema.GroupVersionResource{Group: "monitoring.coreos.com", Version: "v1", Resource: "servicemonitors"}
+	podMonitorResource     = schema.GroupVersionResource{Group: "monitoring.coreos.com", Version: "v1", Resource: "podmonitors"}
+)
+
+// monitorEndpoint is a scrape endpoint of a ServiceMonitor or PodMonitor
+type monitorEndpoint struct {
+	Port       string `json:"port"`
+	TargetPort string `json:"targetPort"`
+	Path       string `json:"path"`
+}
+
+// monitorSpec holds the fields of ServiceMonitor and PodMonitor specs used
+// to find their targets
+type monitorSpec struct {
+	Selector          metav1.LabelSelector `json:"selector"`
+	NamespaceSelector struct {
+		Any        bool     `json:"any"`
+		MatchNames []string `json:"matchNames"`
+	} `json:"namespaceSelector"`
+	Endpoints           []monitorEndpoint `json:"endpoints"`
+	PodMetricsEndpoints []monitorEndpoint `json:"podMetricsEndpoints"`
+}
+
+// monitor is a ServiceMonitor or PodMonitor
+type monitor struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Spec      monitorSpec
+	selector  labels.Selector
+}
+
+// watches reports whether a monitor looks for targets in a namespace; without
+// a namespace selector only its own namespace is watched
+func (m *monitor) watches(namespace string) bool {
+	if m.Spec.NamespaceSelector.Any {
+		return true
+	}
+	if len(m.Spec.NamespaceSelector.MatchNames) == 0 {
+		return m.Namespace == namespace
+	}
+	for _, name := range m.Spec.NamespaceSelector.MatchNames {
+		if name == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// endpoints describes the scrape endpoints of a monitor
+func (m *monitor) endpoints() string {
+	endpoints := m.Spec.Endpoints
+	if m.Kind == "PodMonitor" {
+		endpoints = m.Spec.PodMetricsEndpoints
+	}
+	parts := []string{}
+	for _, ep := range endpoints {
+		port := ep.Port
+		if port == "" {
+			port = ep.TargetPort
+		}
+		path := ep.Path
+		if path == "" {
+			path = "/metrics"
+		}
+		parts = append(parts, port+path)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// listMonitorsOf lists the monitors of one kind in all namespaces, reporting
+// whether the kind can be read. Clusters without the Prometheus Operator,
+// users not allowed to list monitors and mappers without a dynamic client
+// have none. The monitors are listed once per run
+func (rm *ResourceMapper) listMonitorsOf(gvr schema.GroupVersionResource, kind string) ([]monitor, bool, error) {
+	cache := rm.clusterLists()
+	if monitors, ok := cache.monitors[kind]; ok {
+		return monitors, cache.monitoring[kind], nil
+	}
+	monitors, readable, err := rm.readMonitorsOf(gvr, kind)
+	if err != nil {
+		return nil, false, err
+	}
+	if cache.monitors == nil {
+		cache.monitors, cache.monitoring = map[string][]monitor{}, map[string]bool{}
+	}
+	cache.monitors[kind], cache.monitoring[kind] = monitors, readable
+	return monitors, readable, nil
+}
+
+// readMonitorsOf lists the monitors of one kind for listMonitorsOf
+func (rm *ResourceMapper) readMonitorsOf(gvr schema.GroupVersionResource, kind string) ([]monitor, bool, error) {
+	if rm.dynamic == nil || !rm.enabled(kind+"s") || !rm.served(kind+"s") {
+		return nil, false, nil
+	}
+	items, err := pagedList(rm, metav1.NamespaceAll, kind+"s", func(opts metav1.ListOptions) ([]unstructured.Unstructured, metav1.ListInterface, error) {
+		list, err := rm.dynamic.Resource(gvr).Namespace(metav1.NamespaceAll).List(rm.ctx, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		return list.Items, list, nil
+	})
+	if apierrors.IsNotFound(err) || apierrors.IsForbidden(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("error getting %s: %v", gvr.GroupResource(), err)
+	}
+
+	monitors := []monitor{}
+	for _, item := range items {
+		m := monitor{Kind: kind, Namespace: item.GetNamespace(), Name: item.GetName()}
+		if spec, ok := item.Object["spec"].(map[string]interface{}); ok {
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(spec, &m.Spec); err != nil {
+				return nil, false, fmt.Errorf("error reading %s %s/%s: %v", kind, m.Namespace, m.Name, err)
+			}
+		}
+		// An empty selector matches every object, as in the operator
+		m.selector, err = metav1.LabelSelectorAsSelector(&m.Spec.Selector)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid selector in %s %s/%s: %v", kind, m.Namespace, m.Name, err)
+		}
+		monitors = append(monitors, m)
+	}
+	return monitors, true, nil
+}
+
+// listMonitors returns the ServiceMonitors and PodMonitors watching a
+// namespace, listing them on first use, and whether the Prometheus Operator
+// is installed
+func (rm *ResourceMapper) listMonitors(namespace string) ([]monitor, bool, error) {
+	cache := rm.cacheFor(namespace)
+	if cache.monitors == nil {
+		serviceMonitors, withServiceMonitors, err := rm.listMonitorsOf(serviceMonitorResource, "ServiceMonitor")
+		if err != nil {
+			return nil, false, err
+		}
+		podMonitors, withPodMonitors, err := rm.listMonitorsOf(podMonitorResource, "PodMonitor")
+		if err != nil {
+			return nil, false, err
+		}
+		cache.monitoring = withServiceMonitors || withPodMonitors
+		cache.monitors = []monitor{}
+		for _, m := range append(serviceMonitors, podMonitors...) {
+			if m.watches(namespace) {
+				cache.monitors = append(cache.monitors, m)
+			}
+		}
+	}
+	return cache.monitors, cache.monitoring, nil
+}
+
+// monitorTargets returns the services a ServiceMonitor scrapes, or the pods
+// a PodMonitor scrapes, by name
+func monitorTargets(m *monitor, services []corev1.Service, pods []corev1.Pod) []string {
+	targets := []string{}
+	if m.Kind == "ServiceMonitor" {
+		for _, svc := range services {
+			if m.selector.Matches(labels.Set(svc.Labels)) {
+				targets = append(targets, svc.Name)
+			}
+		}
+		return targets
+	}
+	for _, pod := range pods {
+		if m.selector.Matches(labels.Set(pod.Labels)) {
+			targets = append(targets, pod.Name)
+		}
+	}
+	return targets
+}
+
+// scrapedPods returns the names of the pods scraped by any monitor, either
+// directly or through a service
+func scrapedPods(monitors []monitor, services []corev1.Service, index *podIndex) map[string]bool {
+	scraped := map[string]bool{}
+	for i := range monitors {
+		m := &monitors[i]
+		if m.Kind == "PodMonitor" {
+			for _, name := range monitorTargets(m, nil, index.pods) {
+				scraped[name] = true
+			}
+			continue
+		}
+		for _, svc := range services {
+			if !m.selector.Matches(labels.Set(svc.Labels)) {
+				continue
+			}
+			for _, pod := range index.matchLabels(svc.Spec.Selector) {
+				scraped[pod.Name] = true
+			}
+		}
+	}
+	return scraped
+}
+
+// showMonitoringCoverage links ServiceMonitors and PodMonitors to what they
+// scrape, and flags workloads whose pods no monitor scrapes
+func (rm *ResourceMapper) showMonitoringCoverage(namespace string) error {
+	monitors, installed, err := rm.listMonitors(namespace)
+	if err != nil || !installed {
+		return err
+	}
+	services, err := rm.listServices(namespace)
+	if err != nil {
+		return err
+	}
+	index, err := rm.podIndexFor(namespace)
+	if err != nil {
+		return err
+	}
+	deployments, err := rm.listDeployments(namespace)
+	if err != nil {
+		return err
+	}
+	statefulSets, err := rm.listStatefulSets(namespace)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%sMonitoring coverage in namespace: %s%s\n", colorCyan, namespace, colorReset)
+	for i := range monitors {
+		m := &monitors[i]
+		targets := monitorTargets(m, services, index.pods)
+		fmt.Printf(sym("├── %s %s/%s (%s)\n"), m.Kind, m.Namespace, m.Name, m.endpoints())
+		if len(targets) == 0 {
+			fmt.Printf(sym("│   %s %sselects nothing%s\n"), rm.createArrow(4), colorRed, colorReset)
+		}
+		target := "Service"
+		if m.Kind == "PodMonitor" {
+			target = "Pod"
+		}
+		for _, name := range targets {
+			fmt.Printf(sym("│   %s %s: %s\n"), rm.createArrow(4), target, name)
+		}
+	}
+
+	// A workload is covered when any of its pods is scraped
+	scraped := scrapedPods(monitors, services, index)
+	unscraped := []string{}
+	covered := func(selector *metav1.LabelSelector) bool {
+		pods, err := index.matchSelector(selector)
+		if err != nil {
+			return false
+		}
+		for _, pod := range pods {
+			if scraped[pod.Name] {
+				return true
+			}
+		}
+		return false
+	}
+	for _, deploy := range deployments {
+		if !covered(deploy.Spec.Selector) {
+			unscraped = append(unscraped, "Deployment "+deploy.Name)
+		}
+	}
+	for _, sts := range statefulSets {
+		if !covered(sts.Spec.Selector) {
+			unscraped = append(unscraped, "StatefulSet "+sts.Name)
+		}
+	}
+	if len(unscraped) == 0 {
+		fmt.Printf(sym("└── %sEvery workload is scraped%s\n"), colorGreen, colorReset)
+		return nil
+	}
+	fmt.Printf(sym("└── %sNot scraped:%s\n"), colorYellow, colorReset)
+	for _, workload := range unscraped {
+		fmt.Printf("    %s %s\n", rm.createArrow(4), workload)
+	}
+	return nil
+}
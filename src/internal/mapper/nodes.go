@@ -0,0 +1,220 @@
+package mapper
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// podRequests returns the resources a pod requests from its node, as the
+// scheduler computes them
+func podRequests(pod *corev1.Pod) corev1.ResourceList {
+	reqs := corev1.ResourceList{}
+	for _, container := range pod.Spec.Containers {
+		addResources(reqs, container.Resources.Requests)
+	}
+
+	// Init containers run one at a time before the app containers start,
+	// alongside the sidecars (init containers with restartPolicy Always)
+	// started before them, and sidecars keep running with the app
+	// containers. The pod needs at least as much as the largest init step
+	sidecars := corev1.ResourceList{}
+	initReqs := corev1.ResourceList{}
+	for _, container := range pod.Spec.InitContainers {
+		step := corev1.ResourceList{}
+		addResources(step, sidecars)
+		addResources(step, container.Resources.Requests)
+		if container.RestartPolicy != nil && *container.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			addResources(reqs, container.Resources.Requests)
+			addResources(sidecars, container.Resources.Requests)
+		}
+		for name, qty := range step {
+			if total, ok := initReqs[name]; !ok || qty.Cmp(total) > 0 {
+				initReqs[name] = qty.DeepCopy()
+			}
+		}
+	}
+	for name, qty := range initReqs {
+		if total, ok := reqs[name]; !ok || qty.Cmp(total) > 0 {
+			reqs[name] = qty.DeepCopy()
+		}
+	}
+	return reqs
+}
+
+// addResources adds the quantities of add to total
+func addResources(total, add corev1.ResourceList) {
+	for name, qty := range add {
+		sum := total[name]
+		sum.Add(qty)
+		total[name] = sum
+	}
+}
+
+// podFootprint returns what the scheduler reserves on a node for a pod: its
+// requests plus the overhead of its RuntimeClass, which admission copies
+// into the pod spec
+func podFootprint(pod *corev1.Pod) corev1.ResourceList {
+	footprint := podRequests(pod)
+	addResources(footprint, pod.Spec.Overhead)
+	return footprint
+}
+
+// formatFootprint formats the CPU and memory of a pod's footprint, with the
+// overhead of its RuntimeClass when it has one
+func formatFootprint(pod *corev1.Pod) string {
+	footprint := podFootprint(pod)
+	cpu, memory := footprint[corev1.ResourceCPU], footprint[corev1.ResourceMemory]
+	text := fmt.Sprintf("cpu %s, memory %s", cpu.String(), memory.String())
+	if len(pod.Spec.Overhead) == 0 {
+		return text
+	}
+	cpu, memory = pod.Spec.Overhead[corev1.ResourceCPU], pod.Spec.Overhead[corev1.ResourceMemory]
+	runtime := ""
+	if pod.Spec.RuntimeClassName != nil {
+		runtime = " of " + *pod.Spec.RuntimeClassName
+	}
+	return fmt.Sprintf("%s, including overhead%s: cpu %s, memory %s", text, runtime, cpu.String(), memory.String())
+}
+
+// formatNodeConditions formats the node conditions worth reporting
+func formatNodeConditions(node *corev1.Node) string {
+	conditions := []string{}
+	for _, cond := range node.Status.Conditions {
+		// Pressure conditions are only interesting when they are set
+		if cond.Type != corev1.NodeReady && cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		conditions = append(conditions, fmt.Sprintf("%s=%s", cond.Type, cond.Status))
+	}
+	if len(conditions) == 0 {
+		return "unknown"
+	}
+	return strings.Join(conditions, ", ")
+}
+
+// formatTaints formats node taints the way kubectl describes them
+func formatTaints(taints []corev1.Taint) string {
+	formatted := make([]string, 0, len(taints))
+	for _, taint := range taints {
+		if taint.Value != "" {
+			formatted = append(formatted, fmt.Sprintf("%s=%s:%s", taint.Key, taint.Value, taint.Effect))
+		} else {
+			formatted = append(formatted, fmt.Sprintf("%s:%s", taint.Key, taint.Effect))
+		}
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// formatAllocation formats requested vs allocatable for a single resource
+func formatAllocation(requested, allocatable corev1.ResourceList, name corev1.ResourceName) string {
+	req := requested[name]
+	alloc := allocatable[name]
+	percent := 0.0
+	if alloc.AsApproximateFloat64() > 0 {
+		percent = req.AsApproximateFloat64() / alloc.AsApproximateFloat64() * 100
+	}
+	return fmt.Sprintf("%s requested / %s allocatable (%.0f%%)", req.String(), alloc.String(), percent)
+}
+
+// showNodeView shows the pods of the given namespaces grouped by the node they run on
+func (rm *ResourceMapper) showNodeView(namespaces []string) error {
+	fmt.Printf("%sNode placement%s\n", colorBlue, colorReset)
+
+	nodes, err := rm.listNodes()
+	if err != nil {
+		return err
+	}
+
+	pods, err := rm.listAllPods()
+	if err != nil {
+		return err
+	}
+
+	selected := make(map[string]bool, len(namespaces))
+	for _, ns := range namespaces {
+		selected[ns] = true
+	}
+
+	// Footprints are summed over every pod on a node, not only the selected
+	// namespaces, so that the numbers reflect the node's real load
+	requested := make(map[string]corev1.ResourceList)
+	overhead := make(map[string]corev1.ResourceList)
+	podsByNode := make(map[string][]string)
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		if pod.Spec.NodeName != "" {
+			total, ok := requested[pod.Spec.NodeName]
+			if !ok {
+				total = corev1.ResourceList{}
+				requested[pod.Spec.NodeName] = total
+			}
+			for name, qty := range podFootprint(pod) {
+				sum := total[name]
+				sum.Add(qty)
+				total[name] = sum
+			}
+			if len(pod.Spec.Overhead) > 0 {
+				if overhead[pod.Spec.NodeName] == nil {
+					overhead[pod.Spec.NodeName] = corev1.ResourceList{}
+				}
+				for name, qty := range pod.Spec.Overhead {
+					sum := overhead[pod.Spec.NodeName][name]
+					sum.Add(qty)
+					overhead[pod.Spec.NodeName][name] = sum
+				}
+			}
+		}
+		if selected[pod.Namespace] {
+			podsByNode[pod.Spec.NodeName] = append(podsByNode[pod.Spec.NodeName],
+				fmt.Sprintf("%s/%s%s (%s)", pod.Namespace, pod.Name, formatStaticPod(pod), formatFootprint(pod)))
+		}
+	}
+
+	// Sorted in a copy, as the cached list is shared
+	nodes = slices.Clone(nodes)
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+
+	for i := range nodes {
+		node := &nodes[i]
+		fmt.Printf("\n%sNode: %s%s\n", colorYellow, node.Name, colorReset)
+		fmt.Printf(sym("├── Conditions: %s\n"), formatNodeConditions(node))
+		if node.Spec.Unschedulable {
+			fmt.Println(sym("├── Scheduling: disabled (cordoned)"))
+		}
+		if len(node.Spec.Taints) > 0 {
+			fmt.Printf(sym("├── Taints: %s\n"), formatTaints(node.Spec.Taints))
+		}
+		fmt.Printf(sym("├── CPU: %s\n"), formatAllocation(requested[node.Name], node.Status.Allocatable, corev1.ResourceCPU))
+		fmt.Printf(sym("├── Memory: %s\n"), formatAllocation(requested[node.Name], node.Status.Allocatable, corev1.ResourceMemory))
+		if extra := overhead[node.Name]; extra != nil {
+			cpu, memory := extra[corev1.ResourceCPU], extra[corev1.ResourceMemory]
+			fmt.Printf(sym("├── Pod overhead included: cpu %s, memory %s\n"), cpu.String(), memory.String())
+		}
+
+		nodePods := podsByNode[node.Name]
+		sort.Strings(nodePods)
+		fmt.Printf(sym("└── Pods (%d):\n"), len(nodePods))
+		for _, pod := range nodePods {
+			fmt.Printf("    %s %s\n", rm.createArrow(4), pod)
+		}
+	}
+
+	if unscheduled := podsByNode[""]; len(unscheduled) > 0 {
+		sort.Strings(unscheduled)
+		fmt.Printf("\n%sUnscheduled pods:%s\n", colorRed, colorReset)
+		for _, pod := range unscheduled {
+			fmt.Printf("    %s %s\n", rm.createArrow(4), pod)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package mapper
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestPodRequests(t *testing.T) {
+	always := corev1.ContainerRestartPolicyAlways
+	container := func(cpu string) corev1.Container {
+		return corev1.Container{Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)}}}
+	}
+	sidecar := func(cpu string) corev1.Container {
+		c := container(cpu)
+		c.RestartPolicy = &always
+		return c
+	}
+	tests := []struct {
+		name string
+		init []corev1.Container
+		app  []corev1.Container
+		want string
+	}{
+		{name: "app containers", app: []corev1.Container{container("100m"), container("200m")}, want: "300m"},
+		{name: "larger init container", init: []corev1.Container{container("500m")}, app: []corev1.Container{container("100m")}, want: "500m"},
+		{name: "smaller init container", init: []corev1.Container{container("50m")}, app: []corev1.Container{container("100m")}, want: "100m"},
+		{name: "sidecar", init: []corev1.Container{sidecar("50m")}, app: []corev1.Container{container("100m")}, want: "150m"},
+		{name: "init container after a sidecar", init: []corev1.Container{sidecar("50m"), container("400m")}, app: []corev1.Container{container("100m")}, want: "450m"},
+		{name: "init container before a sidecar", init: []corev1.Container{container("400m"), sidecar("50m")}, app: []corev1.Container{container("100m")}, want: "400m"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := testPod("web-1", nil, corev1.PodSpec{InitContainers: tt.init, Containers: tt.app})
+			cpu := podRequests(pod)[corev1.ResourceCPU]
+			if got := cpu.String(); got != tt.want {
+				t.Errorf("cpu request = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
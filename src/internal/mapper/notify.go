@@ -0,0 +1,220 @@
+package mapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Kinds of graph changes worth a notification
+const (
+	changeBrokenReference = "broken-reference"
+	changeServiceRemoved  = "service-removed"
+	changeReplicasDropped = "replicas-dropped"
+)
+
+// graphChange is a notable change between two mappings of the cluster
+type graphChange struct {
+	Kind      string      `json:"kind"`
+	Namespace string      `json:"namespace"`
+	Resource  ResourceKey `json:"resource"`
+	// Target is the missing object of a broken reference
+	Target  *ResourceKey `json:"target,omitempty"`
+	Message string       `json:"message"`
+}
+
+// notableChanges returns the new broken references, removed Services and
+// replica drops of Deployments and StatefulSets from one mapping of the
+// namespaces to the next. Namespaces missing from before are new and only
+// their broken references are reported
+func notableChanges(before, after map[string]*Graph) []graphChange {
+	changes := []graphChange{}
+	namespaces := map[string]bool{}
+	for ns := range before {
+		namespaces[ns] = true
+	}
+	for ns := range after {
+		namespaces[ns] = true
+	}
+	for _, ns := range sortedKeys(namespaces) {
+		old, current := before[ns], after[ns]
+		if old == nil {
+			old = &Graph{}
+		}
+		if current == nil {
+			current = &Graph{}
+		}
+
+		brokenBefore := map[relationshipKey]bool{}
+		for _, rel := range old.Relationships {
+			if rel.Broken {
+				brokenBefore[relationshipKey{From: rel.From, To: rel.To, Type: rel.Type}] = true
+			}
+		}
+		for _, rel := range current.Relationships {
+			if !rel.Broken || brokenBefore[relationshipKey{From: rel.From, To: rel.To, Type: rel.Type}] {
+				continue
+			}
+			target := rel.To
+			changes = append(changes, graphChange{Kind: changeBrokenReference, Namespace: ns, Resource: rel.From, Target: &target,
+				Message: fmt.Sprintf("%s references missing %s (%s)", formatResourceKey(rel.From), formatResourceKey(rel.To), rel.Type)})
+		}
+
+		currentResources := map[ResourceKey]*Resource{}
+		for i := range current.Resources {
+			currentResources[current.Resources[i].Key()] = &current.Resources[i]
+		}
+		for i := range old.Resources {
+			res := &old.Resources[i]
+			now := currentResources[res.Key()]
+			switch {
+			case res.Kind == "Service" && now == nil:
+				changes = append(changes, graphChange{Kind: changeServiceRemoved, Namespace: ns, Resource: res.Key(),
+					Message: fmt.Sprintf("%s was removed", formatResourceKey(res.Key()))})
+			case (res.Kind == "Deployment" || res.Kind == "StatefulSet") && now != nil:
+				was, errWas := strconv.Atoi(res.Attributes["replicas"])
+				is, errIs := strconv.Atoi(now.Attributes["replicas"])
+				if errWas == nil && errIs == nil && is < was {
+					changes = append(changes, graphChange{Kind: changeReplicasDropped, Namespace: ns, Resource: res.Key(),
+						Message: fmt.Sprintf("%s scaled down from %d to %d replica(s)", formatResourceKey(res.Key()), was, is)})
+				}
+			}
+		}
+	}
+	return changes
+}
+
+// notificationData is what a --notify-template is executed with
+type notificationData struct {
+	Cluster string
+	Time    time.Time
+	Changes []graphChange
+}
+
+// notificationDocument is the body of generic notifications
+type notificationDocument struct {
+	APIVersion string        `json:"apiVersion"`
+	Kind       string        `json:"kind"`
+	Cluster    string        `json:"cluster"`
+	Time       time.Time     `json:"time"`
+	Changes    []graphChange `json:"changes"`
+}
+
+// changeNotifier posts graph changes to a webhook
+type changeNotifier struct {
+	url string
+	// format is slack, teams or generic
+	format string
+	// template renders the message text of slack and teams notifications and
+	// the whole body of generic ones, nil for the built-in message
+	template *template.Template
+}
+
+// notifyFlags are the flags of the long-running modes that set up change
+// notifications
+type notifyFlags struct {
+	url, format, template *string
+}
+
+// addNotifyFlags registers the change notification flags on a flag set
+func addNotifyFlags(fs subcommandFlagSet) notifyFlags {
+	return notifyFlags{
+		url:      fs.String("notify", "", "Webhook URL to POST graph changes to (new broken references, removed services, replica drops)"),
+		format:   fs.String("notify-format", "generic", "Notification body: slack, teams or generic (JSON)"),
+		template: fs.String("notify-template", "", "Go template file rendering the notification message"),
+	}
+}
+
+// notifier returns the notifier the flags configure, nil without --notify
+func (f notifyFlags) notifier() (*changeNotifier, error) {
+	if *f.url == "" {
+		if *f.template != "" {
+			return nil, fmt.Errorf("--notify-template requires --notify")
+		}
+		return nil, nil
+	}
+	if !strings.HasPrefix(*f.url, "http://") && !strings.HasPrefix(*f.url, "https://") {
+		return nil, fmt.Errorf("--notify expects an http:// or https:// URL")
+	}
+	switch *f.format {
+	case "slack", "teams", "generic":
+	default:
+		return nil, fmt.Errorf("invalid --notify-format value '%s' (expected slack, teams or generic)", *f.format)
+	}
+	n := &changeNotifier{url: *f.url, format: *f.format}
+	if *f.template != "" {
+		data, err := os.ReadFile(*f.template)
+		if err != nil {
+			return nil, fmt.Errorf("error reading notification template: %v", err)
+		}
+		if n.template, err = template.New("notification").Option("missingkey=error").Parse(string(data)); err != nil {
+			return nil, fmt.Errorf("error parsing notification template %s: %v", *f.template, err)
+		}
+		if err := n.template.Execute(&strings.Builder{}, notificationData{Changes: []graphChange{{}}}); err != nil {
+			return nil, fmt.Errorf("error in notification template %s: %v", *f.template, err)
+		}
+	}
+	return n, nil
+}
+
+// message renders the text of a notification
+func (n *changeNotifier) message(data notificationData) (string, error) {
+	if n.template != nil {
+		var b strings.Builder
+		if err := n.template.Execute(&b, data); err != nil {
+			return "", fmt.Errorf("error rendering notification: %v", err)
+		}
+		return b.String(), nil
+	}
+	lines := []string{fmt.Sprintf("%d change(s) in cluster %s:", len(data.Changes), data.Cluster)}
+	for _, c := range data.Changes {
+		lines = append(lines, fmt.Sprintf("- [%s] %s", c.Kind, c.Message))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// body encodes a notification in the format of the webhook
+func (n *changeNotifier) body(data notificationData) ([]byte, error) {
+	if n.format == "generic" {
+		if n.template != nil {
+			text, err := n.message(data)
+			return []byte(text), err
+		}
+		return json.Marshal(notificationDocument{APIVersion: apiVersion, Kind: "ChangeNotification",
+			Cluster: data.Cluster, Time: data.Time, Changes: data.Changes})
+	}
+	text, err := n.message(data)
+	if err != nil {
+		return nil, err
+	}
+	// Slack and Teams incoming webhooks both take the message as text
+	return json.Marshal(map[string]string{"text": text})
+}
+
+// notify posts the changes of a mapping, if any
+func (n *changeNotifier) notify(cluster string, changes []graphChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	data, err := n.body(notificationData{Cluster: cluster, Time: time.Now().UTC(), Changes: changes})
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(n.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error posting notification to %s: %v", n.url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s rejected notification: %s", n.url, resp.Status)
+	}
+	fmt.Printf("%s[notify] Sent %d change(s) to %s%s\n", colorCyan, len(changes), n.url, colorReset)
+	return nil
+}
@@ -0,0 +1,123 @@
+package mapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// ontologyResourceType describes a resource type that can appear in the graph
+type ontologyResourceType struct {
+	Kind        string   `json:"kind"`
+	APIVersion  string   `json:"apiVersion,omitempty"`
+	Namespaced  bool     `json:"namespaced"`
+	Description string   `json:"description"`
+	Attributes  []string `json:"attributes,omitempty"`
+}
+
+// ontologyRelationshipType describes a relationship type of the graph
+type ontologyRelationshipType struct {
+	Type        string   `json:"type"`
+	From        []string `json:"from"`
+	To          []string `json:"to"`
+	Description string   `json:"description"`
+}
+
+// ontologyDocument lists every resource and relationship type of the graph
+type ontologyDocument struct {
+	APIVersion        string                     `json:"apiVersion"`
+	Kind              string                     `json:"kind"`
+	ResourceTypes     []ontologyResourceType     `json:"resourceTypes"`
+	RelationshipTypes []ontologyRelationshipType `json:"relationshipTypes"`
+}
+
+// ontology returns the resource and relationship types produced by the
+// graph builder; it must be kept in line with resources() and graph()
+func ontology() ontologyDocument {
+	return ontologyDocument{
+		APIVersion: apiVersion,
+		Kind:       "Ontology",
+		ResourceTypes: []ontologyResourceType{
+			{Kind: "Deployment", APIVersion: "apps/v1", Namespaced: true,
+				Description: "Stateless workload managing pods through ReplicaSets",
+				Attributes:  []string{"replicas", "images", "ports", "strategy", "podLabels", "priorityClass", "runtimeClass", "findings"}},
+			{Kind: "StatefulSet", APIVersion: "apps/v1", Namespaced: true,
+				Description: "Stateful workload with stable pod names and DNS, governed by a headless service",
+				Attributes:  []string{"replicas", "images", "ports", "serviceName", "podLabels", "findings"}},
+			{Kind: "HorizontalPodAutoscaler", APIVersion: "autoscaling/v2", Namespaced: true,
+				Description: "Scales a workload on resource metrics",
+				Attributes:  []string{"target", "minReplicas", "maxReplicas", "metrics"}},
+			{Kind: "Service", APIVersion: "v1", Namespaced: true,
+				Description: "Stable endpoint selecting pods, or pointing at manual endpoints or an external name",
+				Attributes:  []string{"type", "ports", "selector", "externalName"}},
+			{Kind: "Ingress", APIVersion: "networking.k8s.io/v1", Namespaced: true,
+				Description: "HTTP routing from outside the cluster to services",
+				Attributes:  []string{"hosts", "routes", "backends", "tls", "class"}},
+			{Kind: "ConfigMap", APIVersion: "v1", Namespaced: true,
+				Description: "Configuration data consumed by pods",
+				Attributes:  []string{"keys"}},
+			{Kind: "Pod", APIVersion: "v1", Namespaced: true,
+				Description: "Running instance of a workload",
+				Attributes:  []string{"phase", "node"}},
+			{Kind: "Secret", APIVersion: "v1", Namespaced: true,
+				Description: "Secret referenced by a pod; known from pod specs only, its data is never read"},
+			{Kind: "Node", APIVersion: "v1", Namespaced: false,
+				Description: "Node a pod runs on; shared by the graphs of every namespace"},
+			{Kind: "ServiceMonitor", APIVersion: "monitoring.coreos.com/v1", Namespaced: true,
+				Description: "Prometheus Operator scrape configuration for services; may watch other namespaces",
+				Attributes:  []string{"selector", "endpoints"}},
+			{Kind: "PodMonitor", APIVersion: "monitoring.coreos.com/v1", Namespaced: true,
+				Description: "Prometheus Operator scrape configuration for pods; may watch other namespaces",
+				Attributes:  []string{"selector", "endpoints"}},
+			{Kind: "PrometheusRule", APIVersion: "monitoring.coreos.com/v1", Namespaced: true,
+				Description: "Prometheus Operator alerting rules; may alert on workloads of other namespaces",
+				Attributes:  []string{"alerts"}},
+			{Kind: externalKind, Namespaced: false,
+				Description: "Target outside the cluster: an ExternalName or a manually managed endpoint address"},
+			{Kind: "*", Namespaced: true,
+				Description: "Custom resources selected with --custom-resources, with an extracted status",
+				Attributes:  []string{"apiVersion"}},
+		},
+		RelationshipTypes: []ontologyRelationshipType{
+			{Type: RelRoutes, From: []string{"Ingress"}, To: []string{"Service"},
+				Description: "The ingress sends traffic for a host and path (or its default backend) to the service"},
+			{Type: RelSelects, From: []string{"Service"}, To: []string{"Pod"},
+				Description: "The service load balances over the pod, through its selector or manually managed endpoints"},
+			{Type: RelManages, From: []string{"Deployment", "StatefulSet"}, To: []string{"Pod"},
+				Description: "The workload owns the pod through its selector"},
+			{Type: RelScales, From: []string{"HorizontalPodAutoscaler"}, To: []string{"Deployment", "StatefulSet"},
+				Description: "The autoscaler adjusts the replicas of its scale target"},
+			{Type: RelUses, From: []string{"Pod", "Ingress"}, To: []string{"ConfigMap", "Secret"},
+				Description: "The pod mounts or reads environment variables from the configmap or secret, or the ingress terminates TLS with the secret's certificate"},
+			{Type: RelTargets, From: []string{"Service"}, To: []string{externalKind},
+				Description: "The service resolves to a target outside the cluster"},
+			{Type: RelGoverns, From: []string{"Service"}, To: []string{"StatefulSet"},
+				Description: "The headless service provides the stable DNS names of the statefulset's pods"},
+			{Type: RelScrapes, From: []string{"ServiceMonitor", "PodMonitor"}, To: []string{"Service", "Pod"},
+				Description: "Prometheus scrapes metrics from the service's endpoints or the pod"},
+			{Type: RelAlerts, From: []string{"PrometheusRule"}, To: []string{"Deployment", "StatefulSet"},
+				Description: "Alert expressions of the rule select series of the workload or its pods by label"},
+			{Type: RelRunsOn, From: []string{"Pod"}, To: []string{"Node"},
+				Description: "The pod is scheduled on the node"},
+			{Type: RelStartsAfter, From: []string{"Deployment", "StatefulSet", "Pod"}, To: []string{"Service"},
+				Description: "An init container waits for the service, possibly in another namespace, before the pod starts (inferred from its command and environment)"},
+			{Type: RelDependsOn, From: []string{"*"}, To: []string{"*"},
+				Description: "The object declares that it depends on the other in its " + dependsOnAnnotation + " annotation"},
+		},
+	}
+}
+
+// printOntology prints the ontology as JSON
+func printOntology() error {
+	data, err := json.MarshalIndent(ontology(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding ontology: %v", err)
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// handleAPIOntology serves the ontology of the graph
+func (s *graphServer) handleAPIOntology(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, ontology())
+}
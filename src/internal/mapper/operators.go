@@ -0,0 +1,108 @@
+package mapper
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// crdResource is read through the dynamic client, avoiding a dependency on
+// the apiextensions client
+var crdResource = schema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1",
+	Resource: "customresourcedefinitions",
+}
+
+// operatorLabels are the CRD labels naming the operator that installs it,
+// in order of preference
+var operatorLabels = []string{
+	"app.kubernetes.io/part-of",
+	"app.kubernetes.io/name",
+	"app.kubernetes.io/instance",
+}
+
+// kindHealth counts the custom resources of a kind by readiness
+type kindHealth struct {
+	total    int
+	ready    int
+	notReady int
+}
+
+// operatorOf names the operator owning a custom resource type from the labels
+// of its CRD, falling back to the API group
+func (rm *ResourceMapper) operatorOf(crt customResourceType) string {
+	crd, err := rm.dynamic.Resource(crdResource).Get(rm.ctx, crt.gvr.Resource+"."+crt.gvr.Group, metav1.GetOptions{})
+	if err == nil {
+		labels := crd.GetLabels()
+		for _, label := range operatorLabels {
+			if labels[label] != "" {
+				return labels[label]
+			}
+		}
+	}
+	return crt.gvr.Group
+}
+
+// showOperatorHealth groups the mapped custom resources by their owning
+// operator and rolls up how many of each kind are ready
+func (rm *ResourceMapper) showOperatorHealth(namespaces []string) error {
+	health := map[string]map[string]*kindHealth{}
+	operators := map[string]string{}
+	for _, crt := range rm.customResources {
+		operator := rm.operatorOf(crt)
+		operators[crt.kind] = operator
+		if health[operator] == nil {
+			health[operator] = map[string]*kindHealth{}
+		}
+		health[operator][crt.kind] = &kindHealth{}
+	}
+
+	for _, ns := range namespaces {
+		resources, _, err := rm.listCustomResources(ns)
+		if err != nil {
+			return fmt.Errorf("error getting custom resources in namespace %s: %v", ns, err)
+		}
+		for _, res := range resources {
+			counts := health[operators[res.Kind]][res.Kind]
+			counts.total++
+			if res.Status != nil && res.Status.Ready != nil {
+				if *res.Status.Ready {
+					counts.ready++
+				} else {
+					counts.notReady++
+				}
+			}
+		}
+	}
+
+	fmt.Printf("\n%sOperators:%s\n", colorBlue, colorReset)
+	names := sortedKeys(health)
+	for i, operator := range names {
+		branch, indent := sym("├──"), sym("│   ")
+		if i == len(names)-1 {
+			branch, indent = sym("└──"), "    "
+		}
+		fmt.Printf("%s %s\n", branch, operator)
+
+		kinds := sortedKeys(health[operator])
+		for j, kind := range kinds {
+			kindBranch := sym("├──")
+			if j == len(kinds)-1 {
+				kindBranch = sym("└──")
+			}
+			counts := health[operator][kind]
+			switch {
+			case counts.ready+counts.notReady == 0:
+				fmt.Printf("%s%s %s: %d (no readiness reported)\n", indent, kindBranch, kind, counts.total)
+			case counts.notReady > 0:
+				fmt.Printf("%s%s %s: %d/%d ready %s(%d not ready)%s\n", indent, kindBranch, kind,
+					counts.ready, counts.total, colorRed, counts.notReady, colorReset)
+			default:
+				fmt.Printf("%s%s %s: %s%d/%d ready%s\n", indent, kindBranch, kind, colorGreen, counts.ready, counts.total, colorReset)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package mapper
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MappingError is a part of a namespace that could not be mapped: a view of
+// the map or a resource type of the graph. With partial results the rest of
+// the namespace is still mapped and the errors are reported together
+type MappingError struct {
+	Namespace string `json:"namespace"`
+	// Source is the view or resource type that failed
+	Source  string `json:"source"`
+	Message string `json:"message"`
+	// Forbidden is set when RBAC denied access
+	Forbidden bool `json:"forbidden,omitempty"`
+	// Skipped is set for types not listed as the access check denied them
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// newMappingError describes a failure to map part of a namespace
+func newMappingError(namespace, source string, err error) MappingError {
+	// The API errors are wrapped by then, but keep the RBAC wording
+	return MappingError{Namespace: namespace, Source: source, Message: err.Error(),
+		Forbidden: strings.Contains(err.Error(), "forbidden")}
+}
+
+// recordError keeps an error for the report, once per namespace and message:
+// a list failing in a view fails the same way in the graph. Skipped types
+// are reported by the access check instead
+func (rm *ResourceMapper) recordError(e MappingError) {
+	if e.Skipped {
+		return
+	}
+	for _, seen := range rm.errors {
+		if seen.Namespace == e.Namespace && seen.Message == e.Message {
+			return
+		}
+	}
+	rm.errors = append(rm.errors, e)
+	fmt.Printf("%s[error] %s: %s%s\n", colorRed, e.Source, e.Message, colorReset)
+}
+
+// printSkippedTypes summarizes the types the access check skipped, with the
+// number of namespaces each was skipped in
+func (rm *ResourceMapper) printSkippedTypes() {
+	if rm.access == nil {
+		return
+	}
+	counts := map[string]int{}
+	for _, denied := range rm.access.denied {
+		for _, what := range denied["list"] {
+			counts[what]++
+		}
+	}
+	if len(counts) == 0 {
+		return
+	}
+	var parts []string
+	for _, what := range sortedKeys(counts) {
+		parts = append(parts, fmt.Sprintf("%s in %d namespace(s)", what, counts[what]))
+	}
+	fmt.Printf("\n%sSkipped, not allowed to list: %s%s\n", colorYellow, strings.Join(parts, ", "), colorReset)
+}
+
+// printMappingErrors prints the parts of the namespaces that could not be
+// mapped, grouped by namespace
+func printMappingErrors(errors []MappingError) {
+	if len(errors) == 0 {
+		return
+	}
+	byNamespace := map[string][]MappingError{}
+	for _, e := range errors {
+		byNamespace[e.Namespace] = append(byNamespace[e.Namespace], e)
+	}
+	fmt.Printf("\n%sErrors: %d part(s) of the map could not be mapped, the rest is complete%s\n", colorRed, len(errors), colorReset)
+	namespaces := sortedKeys(byNamespace)
+	for i, ns := range namespaces {
+		branch, indent := sym("├──"), sym("│   ")
+		if i == len(namespaces)-1 {
+			branch, indent = sym("└──"), "    "
+		}
+		fmt.Printf("%s %s\n", branch, ns)
+		for j, e := range byNamespace[ns] {
+			leaf := sym("├──")
+			if j == len(byNamespace[ns])-1 {
+				leaf = sym("└──")
+			}
+			note := ""
+			if e.Forbidden {
+				note = colorYellow + " [RBAC]" + colorReset
+			}
+			fmt.Printf("%s%s %s: %s%s\n", indent, leaf, e.Source, e.Message, note)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package mapper
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// pathStep is a relationship walked by a path, in either direction
+type pathStep struct {
+	rel     Relationship
+	forward bool
+}
+
+// next returns the resource a step leads to
+func (s pathStep) next() ResourceKey {
+	if s.forward {
+		return s.rel.To
+	}
+	return s.rel.From
+}
+
+// mergeGraphs joins the graphs of several namespaces into one, where
+// cluster-scoped resources such as nodes connect the namespaces
+func mergeGraphs(graphs map[string]*Graph) *Graph {
+	merged := &Graph{}
+	for _, ns := range sortedKeys(graphs) {
+		for _, res := range graphs[ns].Resources {
+			merged.addResource(res)
+		}
+		for _, rel := range graphs[ns].Relationships {
+			merged.addEdge(rel)
+		}
+	}
+	return merged
+}
+
+// splitGraph splits a graph spanning namespaces into a graph per namespace,
+// the reverse of mergeGraphs. Cluster-scoped resources join the graph of the
+// first namespaced resource related to them
+func splitGraph(g *Graph) map[string]*Graph {
+	graphs := map[string]*Graph{}
+	graphOf := func(ns string) *Graph {
+		if graphs[ns] == nil {
+			graphs[ns] = &Graph{Resources: []Resource{}, Relationships: []Relationship{}}
+		}
+		return graphs[ns]
+	}
+	home := map[ResourceKey]string{}
+	for _, rel := range g.Relationships {
+		ns := rel.From.Namespace
+		if ns == "" {
+			ns = rel.To.Namespace
+		}
+		graphOf(ns).Relationships = append(graphOf(ns).Relationships, rel)
+		for _, key := range []ResourceKey{rel.From, rel.To} {
+			if _, ok := home[key]; !ok && key.Namespace == "" {
+				home[key] = ns
+			}
+		}
+	}
+	for _, res := range g.Resources {
+		ns := res.Namespace
+		if ns == "" {
+			ns = home[res.Key()]
+		}
+		graphOf(ns).Resources = append(graphOf(ns).Resources, res)
+	}
+	return graphs
+}
+
+// parseResourceRef parses a kind/name reference
+func parseResourceRef(ref string) (string, string, error) {
+	kind, name, ok := strings.Cut(ref, "/")
+	if !ok || kind == "" || name == "" {
+		return "", "", fmt.Errorf("invalid resource '%s' (expected kind/name)", ref)
+	}
+	return kind, name, nil
+}
+
+// findResources returns the keys of the resources of a graph with a kind,
+// compared case-insensitively, and a name
+func findResources(g *Graph, kind, name string) []ResourceKey {
+	keys := []ResourceKey{}
+	for _, res := range g.Resources {
+		if strings.EqualFold(res.Kind, kind) && res.Name == name {
+			keys = append(keys, res.Key())
+		}
+	}
+	return keys
+}
+
+// findPaths returns every simple path of at most maxDepth relationships
+// between two resources, walking relationships in either direction, shortest
+// first
+func findPaths(g *Graph, from, to ResourceKey, maxDepth int) [][]pathStep {
+	var paths [][]pathStep
+	onPath := map[ResourceKey]bool{from: true}
+	var walk func(at ResourceKey, steps []pathStep)
+	walk = func(at ResourceKey, steps []pathStep) {
+		if at == to {
+			paths = append(paths, append([]pathStep(nil), steps...))
+			return
+		}
+		if len(steps) == maxDepth {
+			return
+		}
+		for _, step := range g.steps(at) {
+			next := step.next()
+			if onPath[next] {
+				continue
+			}
+			onPath[next] = true
+			walk(next, append(steps, step))
+			onPath[next] = false
+		}
+	}
+	walk(from, nil)
+
+	sort.SliceStable(paths, func(i, j int) bool { return len(paths[i]) < len(paths[j]) })
+	return paths
+}
+
+// formatResourceKey formats a key as kind/namespace/name, or kind/name for
+// cluster-scoped resources
+func formatResourceKey(key ResourceKey) string {
+	if key.Namespace == "" {
+		return key.Kind + "/" + key.Name
+	}
+	return key.String()
+}
+
+// formatPath formats the steps of a path from a resource, showing the
+// direction of each relationship
+func formatPath(from ResourceKey, steps []pathStep) string {
+	var b strings.Builder
+	b.WriteString(formatResourceKey(from))
+	for _, step := range steps {
+		if step.forward {
+			fmt.Fprintf(&b, " --%s--> ", step.rel.Type)
+		} else {
+			fmt.Fprintf(&b, " <--%s-- ", step.rel.Type)
+		}
+		b.WriteString(formatResourceKey(step.next()))
+	}
+	return b.String()
+}
+
+// runPath runs the path subcommand: prints every relationship path between
+// two resources
+func runPath(args []string) error {
+	var global globalFlags
+	fs := newSubcommandFlagSet("path", &global)
+	fromRef := fs.String("from", "", "Resource the paths start from, as kind/name")
+	toRef := fs.String("to", "", "Resource the paths lead to, as kind/name")
+	maxDepth := fs.Int("max-depth", 6, "Longest path searched, in relationships")
+	fs.Parse(args)
+
+	fromKind, fromName, err := parseResourceRef(*fromRef)
+	if err != nil {
+		return fmt.Errorf("--from: %v", err)
+	}
+	toKind, toName, err := parseResourceRef(*toRef)
+	if err != nil {
+		return fmt.Errorf("--to: %v", err)
+	}
+	if *maxDepth < 1 {
+		return fmt.Errorf("--max-depth must be positive")
+	}
+
+	rm, err := global.newResourceMapper()
+	if err != nil {
+		return err
+	}
+	namespaces, err := global.namespaces(rm)
+	if err != nil {
+		return err
+	}
+	graphs, err := rm.buildGraphs(namespaces)
+	if err != nil {
+		return err
+	}
+	g := mergeGraphs(graphs)
+
+	sources := findResources(g, rm.resolveKind(fromKind), fromName)
+	if len(sources) == 0 {
+		return fmt.Errorf("%s not found", *fromRef)
+	}
+	targets := findResources(g, rm.resolveKind(toKind), toName)
+	if len(targets) == 0 {
+		return fmt.Errorf("%s not found", *toRef)
+	}
+
+	found := 0
+	for _, from := range sources {
+		for _, to := range targets {
+			paths := findPaths(g, from, to, *maxDepth)
+			fmt.Printf("\n%sPaths from %s to %s:%s\n", colorCyan, formatResourceKey(from), formatResourceKey(to), colorReset)
+			if len(paths) == 0 {
+				fmt.Printf(sym("└── %snone within %d relationship(s)%s\n"), colorYellow, *maxDepth, colorReset)
+				continue
+			}
+			for i, steps := range paths {
+				branch := sym("├──")
+				if i == len(paths)-1 {
+					branch = sym("└──")
+				}
+				fmt.Printf("%s %s\n", branch, formatPath(from, steps))
+			}
+			found += len(paths)
+		}
+	}
+	fmt.Printf("\n%s%d path(s) found%s\n", colorGreen, found, colorReset)
+	return nil
+}
@@ -0,0 +1,164 @@
+package mapper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pluginPrefix names the executables on PATH that are plugins: the rest of
+// the name is the name of the plugin
+const pluginPrefix = "k8s-resource-mapper-plugin-"
+
+// pluginTimeout bounds a plugin run for one namespace
+const pluginTimeout = 30 * time.Second
+
+// pluginAPIVersion versions the input and output of plugins
+const pluginAPIVersion = "k8s-resource-mapper/v1"
+
+// plugins holds the path of the plugins found on PATH, by name, and
+// loadPlugins finds them once
+var (
+	plugins     = map[string]string{}
+	pluginsOnce sync.Once
+)
+
+// pluginInput is what a plugin reads on stdin: the namespace being mapped,
+// the cluster, and the resources the mapper found there, to relate to
+type pluginInput struct {
+	APIVersion    string     `json:"apiVersion"`
+	Namespace     string     `json:"namespace"`
+	Context       string     `json:"context,omitempty"`
+	Kubeconfig    string     `json:"kubeconfig,omitempty"`
+	ClusterDomain string     `json:"clusterDomain"`
+	Resources     []Resource `json:"resources"`
+}
+
+// pluginOutput is what a plugin prints on stdout, in the JSON of graphs
+type pluginOutput struct {
+	Resources     []Resource     `json:"resources"`
+	Relationships []Relationship `json:"relationships"`
+}
+
+// loadPlugins finds the plugins on PATH and registers each as a processor,
+// off by default and named plugin:<name>. As with kubectl plugins, the first
+// of the same name on PATH wins. PATH is only read once plugins are asked
+// for, see setProcessors
+func loadPlugins() {
+	pluginsOnce.Do(func() {
+		for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				continue
+			}
+			for _, entry := range entries {
+				name, ok := strings.CutPrefix(entry.Name(), pluginPrefix)
+				if !ok || name == "" || plugins[name] != "" {
+					continue
+				}
+				path := filepath.Join(dir, entry.Name())
+				if info, err := os.Stat(path); err != nil || info.IsDir() || info.Mode()&0o111 == 0 {
+					continue
+				}
+				plugins[name] = path
+				registerProcessor("plugin:"+name, pluginWhat(name), false, notListed)
+			}
+		}
+	})
+}
+
+// pluginWhat names a plugin as a type of the processor registry
+func pluginWhat(name string) string {
+	return "plugin " + name
+}
+
+// runPlugins adds what the enabled plugins map in a namespace to its graph.
+// Plugins read the cluster themselves, so they only run when mapping one.
+// With partial results, a plugin that fails is reported in the graph
+func (rm *ResourceMapper) runPlugins(namespace string, g *Graph) error {
+	if rm.kubeconfig == "" {
+		return nil
+	}
+	for _, name := range sortedKeys(plugins) {
+		if !rm.enabled(pluginWhat(name)) {
+			continue
+		}
+		out, err := rm.runPlugin(name, namespace, g)
+		if err != nil {
+			if !rm.partial {
+				return err
+			}
+			g.Errors = append(g.Errors, newMappingError(namespace, pluginWhat(name), err))
+			continue
+		}
+		for _, res := range out.Resources {
+			g.addResource(res)
+		}
+		for _, rel := range out.Relationships {
+			g.addEdge(rel)
+		}
+	}
+	return nil
+}
+
+// runPlugin runs a plugin for a namespace and checks what it printed
+func (rm *ResourceMapper) runPlugin(name, namespace string, g *Graph) (*pluginOutput, error) {
+	resources := g.Resources
+	if resources == nil {
+		resources = []Resource{}
+	}
+	input, err := json.Marshal(pluginInput{APIVersion: pluginAPIVersion, Namespace: namespace, Context: rm.opts.Context,
+		Kubeconfig: rm.kubeconfig, ClusterDomain: rm.clusterDomain, Resources: resources})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding input of plugin %s: %v", name, err)
+	}
+	ctx, cancel := context.WithTimeout(rm.ctx, pluginTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, plugins[name])
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(), "KUBECONFIG="+rm.kubeconfig)
+	if err := cmd.Run(); err != nil {
+		lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+		return nil, fmt.Errorf("error running plugin %s: %v: %s", name, err, lines[len(lines)-1])
+	}
+
+	var out pluginOutput
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return nil, fmt.Errorf("error decoding output of plugin %s: %v", name, err)
+	}
+	for i, res := range out.Resources {
+		if res.Kind == "" || res.Name == "" {
+			return nil, fmt.Errorf("plugin %s: resource without kind or name", name)
+		}
+		if res.Attributes == nil {
+			out.Resources[i].Attributes = map[string]string{}
+		}
+	}
+	// Relationships connect resources of the graph or of the plugin, so that
+	// no edge dangles
+	added := map[ResourceKey]bool{}
+	for _, res := range out.Resources {
+		added[res.Key()] = true
+	}
+	for _, rel := range out.Relationships {
+		if rel.From.Kind == "" || rel.From.Name == "" || rel.To.Kind == "" || rel.To.Name == "" || rel.Type == "" {
+			return nil, fmt.Errorf("plugin %s: relationship without type or ends", name)
+		}
+		for _, end := range []ResourceKey{rel.From, rel.To} {
+			if !added[end] && !g.hasResource(end) {
+				return nil, fmt.Errorf("plugin %s: %s relationship with %s, which is neither in the graph nor added by the plugin", name, rel.Type, end)
+			}
+		}
+	}
+	return &out, nil
+}
@@ -0,0 +1,101 @@
+package mapper
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// installTestPlugin puts first on PATH a directory holding one plugin, acme,
+// running a shell script. As PATH is searched once, a plugin found before is
+// pointed at the new script
+func installTestPlugin(t *testing.T, script string) {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, pluginPrefix+"acme")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	if plugins["acme"] != "" {
+		plugins["acme"] = path
+	}
+}
+
+func TestPluginsOptIn(t *testing.T) {
+	installTestPlugin(t, "cat >/dev/null\necho '{}'\n")
+	if err := testMapper().setProcessors(nil, nil, false); err != nil {
+		t.Fatalf("setProcessors: %v", err)
+	}
+	if _, ok := processors["plugin:acme"]; ok {
+		t.Fatalf("PATH searched without plugins enabled")
+	}
+
+	tests := []struct {
+		name    string
+		enable  []string
+		disable []string
+		plugins bool
+		want    bool
+	}{
+		{name: "all plugins", plugins: true, want: true},
+		{name: "by name", enable: []string{"pods,plugin:acme"}, want: true},
+		{name: "left out", disable: []string{"plugin:acme"}, plugins: true, want: false},
+		{name: "off by default", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rm := testMapper()
+			if err := rm.setProcessors(tt.enable, tt.disable, tt.plugins); err != nil {
+				t.Fatalf("setProcessors: %v", err)
+			}
+			if got := rm.enabled(pluginWhat("acme")); got != tt.want {
+				t.Errorf("plugin enabled = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPluginRelationshipEnds(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "to a resource of the graph",
+			output: `{"resources": [{"kind": "AcmeDatabase", "namespace": "shop", "name": "orders"}],
+				"relationships": [{"from": {"kind": "AcmeDatabase", "namespace": "shop", "name": "orders"},
+				"to": {"kind": "ConfigMap", "namespace": "shop", "name": "orders-config"}, "type": "uses"}]}`,
+			want: []string{"AcmeDatabase/shop/orders uses ConfigMap/shop/orders-config"},
+		},
+		{
+			name: "to a missing resource",
+			output: `{"resources": [{"kind": "AcmeDatabase", "namespace": "shop", "name": "orders"}],
+				"relationships": [{"from": {"kind": "AcmeDatabase", "namespace": "shop", "name": "orders"},
+				"to": {"kind": "ConfigMap", "namespace": "shop", "name": "missing"}, "type": "uses"}]}`,
+			want:    []string{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installTestPlugin(t, "cat >/dev/null\ncat <<'EOF'\n"+tt.output+"\nEOF\n")
+			rm := testMapper()
+			rm.kubeconfig = "kubeconfig"
+			if err := rm.setProcessors(nil, nil, true); err != nil {
+				t.Fatalf("setProcessors: %v", err)
+			}
+			g := &Graph{Resources: []Resource{{Kind: "ConfigMap", Namespace: "shop", Name: "orders-config"}}, Relationships: []Relationship{}}
+			err := rm.runPlugins("shop", g)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("runPlugins error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := relationshipStrings(g); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("relationships = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package mapper
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// podIndex indexes the pods of a namespace by label, so that the selectors of
+// all services and workloads are evaluated in memory against a single list
+type podIndex struct {
+	pods []corev1.Pod
+	// byLabel maps "key=value" to the positions of the pods carrying that
+	// label, in ascending order
+	byLabel map[string][]int
+}
+
+// newPodIndex builds the label index of a list of pods
+func newPodIndex(pods []corev1.Pod) *podIndex {
+	idx := &podIndex{byLabel: map[string][]int{}}
+	for _, pod := range pods {
+		idx.add(pod)
+	}
+	return idx
+}
+
+// add appends a pod to the index
+func (idx *podIndex) add(pod corev1.Pod) {
+	i := len(idx.pods)
+	idx.pods = append(idx.pods, pod)
+	for key, value := range pod.Labels {
+		idx.byLabel[key+"="+value] = append(idx.byLabel[key+"="+value], i)
+	}
+}
+
+// candidates returns the positions of the pods carrying every label of a set,
+// intersecting the postings of each label starting with the shortest
+func (idx *podIndex) candidates(set map[string]string) []int {
+	var postings [][]int
+	for key, value := range set {
+		positions := idx.byLabel[key+"="+value]
+		if len(positions) == 0 {
+			return nil
+		}
+		postings = append(postings, positions)
+	}
+	if len(postings) == 0 {
+		return nil
+	}
+
+	shortest := 0
+	for i := range postings {
+		if len(postings[i]) < len(postings[shortest]) {
+			shortest = i
+		}
+	}
+	result := postings[shortest]
+	for i, positions := range postings {
+		if i == shortest {
+			continue
+		}
+		result = intersectSorted(result, positions)
+		if len(result) == 0 {
+			return nil
+		}
+	}
+	return result
+}
+
+// intersectSorted intersects two ascending lists of positions
+func intersectSorted(a, b []int) []int {
+	result := []int{}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+// matchLabels returns the pods selected by a service style selector. An empty
+// selector selects nothing, as for services
+func (idx *podIndex) matchLabels(set map[string]string) []corev1.Pod {
+	positions := idx.candidates(set)
+	pods := make([]corev1.Pod, 0, len(positions))
+	for _, i := range positions {
+		pods = append(pods, idx.pods[i])
+	}
+	return pods
+}
+
+// matchSelector returns the pods selected by a workload label selector. The
+// index narrows the candidates through matchLabels, match expressions are
+// then checked on the candidates only. An empty selector selects nothing
+func (idx *podIndex) matchSelector(selector *metav1.LabelSelector) ([]corev1.Pod, error) {
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing selector: %v", err)
+	}
+	if sel.Empty() {
+		return nil, nil
+	}
+
+	var positions []int
+	if len(selector.MatchLabels) > 0 {
+		positions = idx.candidates(selector.MatchLabels)
+	} else {
+		positions = make([]int, len(idx.pods))
+		for i := range idx.pods {
+			positions[i] = i
+		}
+	}
+
+	pods := []corev1.Pod{}
+	for _, i := range positions {
+		if sel.Matches(labels.Set(idx.pods[i].Labels)) {
+			pods = append(pods, idx.pods[i])
+		}
+	}
+	return pods, nil
+}
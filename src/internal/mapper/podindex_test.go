@@ -0,0 +1,136 @@
+package mapper
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func indexTestPods() *podIndex {
+	return newPodIndex([]corev1.Pod{
+		*testPod("web-1", map[string]string{"app": "web", "tier": "front"}, corev1.PodSpec{}),
+		*testPod("web-2", map[string]string{"app": "web", "tier": "back"}, corev1.PodSpec{}),
+		*testPod("api-1", map[string]string{"app": "api", "tier": "back"}, corev1.PodSpec{}),
+		*testPod("bare", nil, corev1.PodSpec{}),
+	})
+}
+
+func podNames(pods []corev1.Pod) []string {
+	names := []string{}
+	for _, pod := range pods {
+		names = append(names, pod.Name)
+	}
+	return names
+}
+
+func TestPodIndexMatchLabels(t *testing.T) {
+	idx := indexTestPods()
+	tests := []struct {
+		name string
+		set  map[string]string
+		want []string
+	}{
+		{name: "one label", set: map[string]string{"app": "web"}, want: []string{"web-1", "web-2"}},
+		{name: "every label must match", set: map[string]string{"app": "web", "tier": "back"}, want: []string{"web-2"}},
+		{name: "shared label", set: map[string]string{"tier": "back"}, want: []string{"web-2", "api-1"}},
+		{name: "unknown value", set: map[string]string{"app": "db"}, want: []string{}},
+		{name: "disjoint labels", set: map[string]string{"app": "api", "tier": "front"}, want: []string{}},
+		{name: "empty selects nothing", set: map[string]string{}, want: []string{}},
+		{name: "nil selects nothing", set: nil, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := podNames(idx.matchLabels(tt.set)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matchLabels(%v) = %q, want %q", tt.set, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPodIndexMatchSelector(t *testing.T) {
+	idx := indexTestPods()
+	tests := []struct {
+		name     string
+		selector *metav1.LabelSelector
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:     "match labels",
+			selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			want:     []string{"web-1", "web-2"},
+		},
+		{
+			name: "match labels narrowed by expressions",
+			selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": "web"},
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "tier", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"front"}},
+				},
+			},
+			want: []string{"web-2"},
+		},
+		{
+			name: "expressions only are checked on every pod",
+			selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "app", Operator: metav1.LabelSelectorOpIn, Values: []string{"web", "api"}},
+			}},
+			want: []string{"web-1", "web-2", "api-1"},
+		},
+		{
+			name: "does not exist matches unlabelled pods",
+			selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "app", Operator: metav1.LabelSelectorOpDoesNotExist},
+			}},
+			want: []string{"bare"},
+		},
+		{
+			name:     "empty selects nothing",
+			selector: &metav1.LabelSelector{},
+			want:     []string{},
+		},
+		{
+			name: "invalid operator",
+			selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "app", Operator: "Like", Values: []string{"web"}},
+			}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pods, err := idx.matchSelector(tt.selector)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("matchSelector error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := podNames(pods); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matchSelector = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIntersectSorted(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []int
+		want []int
+	}{
+		{name: "overlap", a: []int{1, 3, 5, 7}, b: []int{2, 3, 4, 7, 9}, want: []int{3, 7}},
+		{name: "identical", a: []int{0, 2}, b: []int{0, 2}, want: []int{0, 2}},
+		{name: "disjoint", a: []int{1, 3}, b: []int{2, 4}, want: []int{}},
+		{name: "empty", a: nil, b: []int{1}, want: []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := intersectSorted(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("intersectSorted(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package mapper
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// policy bounds a count over the graph: the relationships of a type each
+// selected resource has or, without a relationship, the number of selected
+// resources in a namespace
+type policy struct {
+	Name string `json:"name"`
+	// Select is a query expression without traversal choosing the resources
+	// the policy applies to, such as "from Service where type!=ExternalName"
+	Select string `json:"select"`
+	// Relationship is the relationship type counted, Direction whether
+	// outgoing (out, the default) or incoming (in) ones, and To restricts the
+	// kind at the other end
+	Relationship string `json:"relationship,omitempty"`
+	Direction    string `json:"direction,omitempty"`
+	To           string `json:"to,omitempty"`
+	Min          *int   `json:"min,omitempty"`
+	Max          *int   `json:"max,omitempty"`
+	// For is how long a violation must last before it fires in serve mode
+	For      string `json:"for,omitempty"`
+	Severity string `json:"severity,omitempty"`
+
+	query    *graphQuery
+	duration time.Duration
+}
+
+// policiesFile is the format of the --policies file
+type policiesFile struct {
+	Policies []policy `json:"policies"`
+}
+
+// policyViolation is a resource, or a namespace for count quotas, breaking
+// a policy
+type policyViolation struct {
+	Policy    string      `json:"policy"`
+	Severity  string      `json:"severity"`
+	Namespace string      `json:"namespace"`
+	Resource  ResourceKey `json:"resource"`
+	Message   string      `json:"message"`
+}
+
+// id identifies a violation between refreshes
+func (v policyViolation) id() string {
+	return v.Policy + " " + v.Resource.String()
+}
+
+// finding reports a violation as a finding
+func (v policyViolation) finding() Finding {
+	return Finding{
+		Rule:      "policy/" + v.Policy,
+		Severity:  v.Severity,
+		Kind:      v.Resource.Kind,
+		Namespace: v.Namespace,
+		Name:      v.Resource.Name,
+		Message:   v.Message,
+	}
+}
+
+// loadPolicies reads policies from a YAML file
+func loadPolicies(path string) ([]policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading policies: %v", err)
+	}
+	var file policiesFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing policies %s: %v", path, err)
+	}
+	names := map[string]bool{}
+	for i := range file.Policies {
+		p := &file.Policies[i]
+		if p.Name == "" {
+			return nil, fmt.Errorf("policy %d has no name", i+1)
+		}
+		if names[p.Name] {
+			return nil, fmt.Errorf("policy %s is defined twice", p.Name)
+		}
+		names[p.Name] = true
+		if p.query, err = parseQuery(p.Select); err != nil {
+			return nil, fmt.Errorf("invalid select of policy %s: %v", p.Name, err)
+		}
+		if p.query.Depth > 0 {
+			return nil, fmt.Errorf("select of policy %s may not traverse relationships", p.Name)
+		}
+		if p.Min == nil && p.Max == nil {
+			return nil, fmt.Errorf("policy %s needs min or max", p.Name)
+		}
+		switch p.Direction {
+		case "":
+			p.Direction = traverseOut
+		case traverseOut, traverseIn:
+		default:
+			return nil, fmt.Errorf("invalid direction '%s' of policy %s (expected out or in)", p.Direction, p.Name)
+		}
+		if p.Relationship == "" && p.To != "" {
+			return nil, fmt.Errorf("policy %s sets to without a relationship", p.Name)
+		}
+		switch p.Severity {
+		case "":
+			p.Severity = severityWarning
+		case severityInfo, severityWarning, severityError:
+		default:
+			return nil, fmt.Errorf("invalid severity '%s' of policy %s", p.Severity, p.Name)
+		}
+		if p.For != "" {
+			if p.duration, err = time.ParseDuration(p.For); err != nil || p.duration < 0 {
+				return nil, fmt.Errorf("invalid for '%s' of policy %s", p.For, p.Name)
+			}
+		}
+	}
+	return file.Policies, nil
+}
+
+// bounds describes the allowed range of a count
+func (p *policy) bounds() string {
+	switch {
+	case p.Min != nil && p.Max != nil:
+		return fmt.Sprintf("between %d and %d", *p.Min, *p.Max)
+	case p.Min != nil:
+		return fmt.Sprintf("at least %d", *p.Min)
+	}
+	return fmt.Sprintf("at most %d", *p.Max)
+}
+
+// allows reports whether a count is within the bounds of the policy
+func (p *policy) allows(count int) bool {
+	return (p.Min == nil || count >= *p.Min) && (p.Max == nil || count <= *p.Max)
+}
+
+// relationshipCount counts the relationships of the policy's type a resource
+// has; broken relationships do not count
+func (p *policy) relationshipCount(g *Graph, key ResourceKey) int {
+	count := 0
+	for _, rel := range g.Relationships {
+		if rel.Broken || !strings.EqualFold(rel.Type, p.Relationship) {
+			continue
+		}
+		self, other := rel.From, rel.To
+		if p.Direction == traverseIn {
+			self, other = rel.To, rel.From
+		}
+		if self == key && (p.To == "" || strings.EqualFold(other.Kind, p.To)) {
+			count++
+		}
+	}
+	return count
+}
+
+// evaluate checks the policy against the graph of a namespace. Only the
+// namespace's own resources are selected, leaving out cluster-scoped ones
+// and stand-ins for missing objects
+func (p *policy) evaluate(namespace string, g *Graph) []policyViolation {
+	selected := []ResourceKey{}
+	for i := range g.Resources {
+		res := &g.Resources[i]
+		if res.Namespace == namespace && res.Attributes["missing"] != "true" && p.query.selects(res) {
+			selected = append(selected, res.Key())
+		}
+	}
+
+	violations := []policyViolation{}
+	violation := func(key ResourceKey, message string) {
+		violations = append(violations, policyViolation{Policy: p.Name, Severity: p.Severity, Namespace: namespace,
+			Resource: key, Message: message})
+	}
+	if p.Relationship == "" {
+		if !p.allows(len(selected)) {
+			violation(ResourceKey{Kind: "Namespace", Name: namespace},
+				fmt.Sprintf("%d resource(s) match '%s', %s allowed", len(selected), p.Select, p.bounds()))
+		}
+		return violations
+	}
+	for _, key := range selected {
+		count := p.relationshipCount(g, key)
+		if p.allows(count) {
+			continue
+		}
+		what := p.Direction + "going " + p.Relationship
+		if p.To != "" {
+			what += " " + p.To
+		}
+		violation(key, fmt.Sprintf("%d %s relationship(s), %s expected", count, what, p.bounds()))
+	}
+	return violations
+}
+
+// evaluatePolicies checks every policy against the graph of a namespace
+func evaluatePolicies(policies []policy, namespace string, g *Graph) []policyViolation {
+	violations := []policyViolation{}
+	for i := range policies {
+		violations = append(violations, policies[i].evaluate(namespace, g)...)
+	}
+	return violations
+}
+
+// trackedViolation is a violation seen by consecutive refreshes
+type trackedViolation struct {
+	policyViolation
+	Since  time.Time `json:"since"`
+	Firing bool      `json:"firing"`
+}
+
+// policyTracker follows violations across refreshes: a violation fires once
+// it has lasted for the policy's duration, and resolves when it disappears
+type policyTracker struct {
+	policies []policy
+	// alerts are the exporter specs firing violations are sent to
+	alerts []string
+
+	mu      sync.Mutex
+	active  map[string]*trackedViolation
+	updated time.Time
+}
+
+// update records the violations found by a refresh, returning the ones that
+// started firing and the firing ones that resolved
+func (t *policyTracker) update(now time.Time, violations []policyViolation) (fired, resolved []policyViolation) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	durations := map[string]time.Duration{}
+	for i := range t.policies {
+		durations[t.policies[i].Name] = t.policies[i].duration
+	}
+
+	active := map[string]*trackedViolation{}
+	for _, v := range violations {
+		tracked := t.active[v.id()]
+		if tracked == nil {
+			tracked = &trackedViolation{Since: now}
+		}
+		tracked.policyViolation = v
+		if !tracked.Firing && now.Sub(tracked.Since) >= durations[v.Policy] {
+			tracked.Firing = true
+			fired = append(fired, v)
+		}
+		active[v.id()] = tracked
+	}
+	for id, tracked := range t.active {
+		if active[id] == nil && tracked.Firing {
+			resolved = append(resolved, tracked.policyViolation)
+		}
+	}
+	t.active = active
+	t.updated = now
+	return fired, resolved
+}
+
+// check evaluates the policies against freshly mapped graphs, printing the
+// violations that fire or resolve and sending the firing ones to the alert
+// exporters
+func (t *policyTracker) check(graphs map[string]*Graph) {
+	violations := []policyViolation{}
+	for _, ns := range sortedKeys(graphs) {
+		violations = append(violations, evaluatePolicies(t.policies, ns, graphs[ns])...)
+	}
+	fired, resolved := t.update(time.Now(), violations)
+	for _, v := range fired {
+		fmt.Printf("%s[policy firing] %s: %s: %s%s\n", colorRed, v.Policy, formatResourceKey(v.Resource), v.Message, colorReset)
+	}
+	for _, v := range resolved {
+		fmt.Printf("%s[policy resolved] %s: %s%s\n", colorGreen, v.Policy, formatResourceKey(v.Resource), colorReset)
+	}
+	if len(fired) == 0 || len(t.alerts) == 0 {
+		return
+	}
+	findings := []Finding{}
+	for _, v := range fired {
+		findings = append(findings, v.finding())
+	}
+	if err := exportFindings(t.alerts, findings); err != nil {
+		fmt.Printf("%sError sending policy alerts: %v%s\n", colorRed, err, colorReset)
+	}
+}
+
+// policyViolationsDocument lists the current violations as served by the API
+type policyViolationsDocument struct {
+	APIVersion string             `json:"apiVersion"`
+	Kind       string             `json:"kind"`
+	Updated    time.Time          `json:"updated"`
+	Violations []trackedViolation `json:"violations"`
+}
+
+// handleAPIPolicies serves GET /api/v1/policies: the violations of the last
+// refresh, pending ones included with firing false
+func (t *policyTracker) handleAPIPolicies(w http.ResponseWriter, r *http.Request) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	doc := policyViolationsDocument{APIVersion: apiVersion, Kind: "PolicyViolationList", Updated: t.updated,
+		Violations: []trackedViolation{}}
+	for _, tracked := range t.active {
+		doc.Violations = append(doc.Violations, *tracked)
+	}
+	sort.Slice(doc.Violations, func(i, j int) bool {
+		return doc.Violations[i].id() < doc.Violations[j].id()
+	})
+	writeJSON(w, http.StatusOK, doc)
+}
@@ -0,0 +1,77 @@
+package mapper
+
+import (
+	"sync"
+)
+
+// defaultConcurrency is the number of API calls a mapper makes at once
+const defaultConcurrency = 4
+
+// workerPool bounds the number of tasks running at once across a mapper, so
+// that concurrent work never has more than its size of API calls in flight
+type workerPool struct {
+	slots chan struct{}
+}
+
+// newWorkerPool creates a pool running at most size tasks at once
+func newWorkerPool(size int) *workerPool {
+	return &workerPool{slots: make(chan struct{}, size)}
+}
+
+// run runs the tasks, at most the size of the pool at once, and waits for
+// them all. A nil pool, or one of size 1, runs them in order
+func (p *workerPool) run(tasks ...func()) {
+	if p == nil || cap(p.slots) <= 1 {
+		for _, task := range tasks {
+			task()
+		}
+		return
+	}
+	var wg sync.WaitGroup
+	for _, task := range tasks {
+		p.slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-p.slots
+				wg.Done()
+			}()
+			task()
+		}()
+	}
+	wg.Wait()
+}
+
+// prefetch fills the processor cache of a namespace with the lists the views
+// of a map use, through the worker pool, so that the views find them cached
+// instead of listing them one after the other. Errors are left for the views
+// to report: a list that failed is listed again by the first view using it
+func (rm *ResourceMapper) prefetch(namespace string) {
+	if rm.pool == nil || cap(rm.pool.slots) <= 1 {
+		return
+	}
+	// Create the cache before the tasks, which each fill a field of their own
+	rm.cacheFor(namespace)
+	tasks := []func(){
+		func() { rm.listServices(namespace) },
+		func() { rm.listIngresses(namespace) },
+		func() { rm.listPods(namespace) },
+		func() { rm.podRevisionsFor(namespace) },
+		func() { rm.listDeployments(namespace) },
+		func() { rm.listStatefulSets(namespace) },
+		func() { rm.listHPAs(namespace) },
+		func() { rm.listConfigMaps(namespace) },
+		func() { rm.listSecretNames(namespace) },
+		func() { rm.listEndpoints(namespace) },
+		func() { rm.listEndpointSlices(namespace) },
+		func() { rm.listPDBs(namespace) },
+	}
+	if !rm.compact {
+		tasks = append(tasks,
+			func() { rm.listDaemonSets(namespace) },
+			func() { rm.listJobs(namespace) },
+			func() { rm.listCronJobs(namespace) },
+		)
+	}
+	rm.pool.run(tasks...)
+}
@@ -0,0 +1,288 @@
+package mapper
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// declaredPort is a port declared by a container of a pod template
+type declaredPort struct {
+	container string
+	port      corev1.ContainerPort
+}
+
+// String formats a declared port as [name:]port/protocol
+func (p declaredPort) String() string {
+	text := fmt.Sprintf("%d/%s", p.port.ContainerPort, portProtocol(p.port.Protocol))
+	if p.port.Name != "" {
+		text = p.port.Name + ":" + text
+	}
+	return text
+}
+
+// portProtocol defaults an unset protocol to TCP, as the API server does
+func portProtocol(protocol corev1.Protocol) corev1.Protocol {
+	if protocol == "" {
+		return corev1.ProtocolTCP
+	}
+	return protocol
+}
+
+// formatContainerPorts lists the ports declared by the containers of a pod
+// template, as in the ports attribute of workloads
+func formatContainerPorts(spec *corev1.PodSpec) string {
+	ports := []string{}
+	for _, p := range templatePorts(spec) {
+		ports = append(ports, p.String())
+	}
+	return strings.Join(ports, ",")
+}
+
+// formatServicePorts lists the ports of a service as port/protocol->target,
+// as in the ports attribute of services
+func formatServicePorts(servicePorts []corev1.ServicePort) string {
+	ports := []string{}
+	for _, port := range servicePorts {
+		ports = append(ports, fmt.Sprintf("%d/%s->%s", port.Port, port.Protocol, port.TargetPort.String()))
+	}
+	return strings.Join(ports, ",")
+}
+
+// templatePorts returns the ports declared by the containers of a pod
+// template, init containers included as sidecars may serve traffic
+func templatePorts(spec *corev1.PodSpec) []declaredPort {
+	ports := []declaredPort{}
+	containers := append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...)
+	for _, c := range containers {
+		for _, port := range c.Ports {
+			ports = append(ports, declaredPort{container: c.Name, port: port})
+		}
+	}
+	return ports
+}
+
+// portWorkload is a workload with the labels and ports of its pod template
+type portWorkload struct {
+	kind   string
+	name   string
+	labels map[string]string
+	ports  []declaredPort
+}
+
+// resolvesTargetPort reports whether a declared port receives the traffic of
+// a service port: a named targetPort resolves by name, a numeric one by number
+func resolvesTargetPort(p declaredPort, svcPort corev1.ServicePort) bool {
+	if portProtocol(p.port.Protocol) != portProtocol(svcPort.Protocol) {
+		return false
+	}
+	target := svcPort.TargetPort
+	switch {
+	case target.Type == intstr.String:
+		return p.port.Name == target.StrVal
+	case target.IntVal == 0:
+		// An unset targetPort defaults to the service port
+		return p.port.ContainerPort == svcPort.Port
+	}
+	return p.port.ContainerPort == target.IntVal
+}
+
+// portWorkloads lists the deployments, statefulsets, daemonsets and pods
+// without an owner of a namespace with the ports their templates declare
+func (rm *ResourceMapper) portWorkloads(namespace string) ([]portWorkload, error) {
+	workloads := []portWorkload{}
+	add := func(kind string, meta metav1.ObjectMeta, template map[string]string, spec *corev1.PodSpec) {
+		workloads = append(workloads, portWorkload{kind: kind, name: meta.Name, labels: template, ports: templatePorts(spec)})
+	}
+
+	deployments, err := rm.listDeployments(namespace)
+	if err != nil {
+		return nil, err
+	}
+	for i := range deployments {
+		d := &deployments[i]
+		add("Deployment", d.ObjectMeta, d.Spec.Template.Labels, &d.Spec.Template.Spec)
+	}
+	statefulSets, err := rm.listStatefulSets(namespace)
+	if err != nil {
+		return nil, err
+	}
+	for i := range statefulSets {
+		s := &statefulSets[i]
+		add("StatefulSet", s.ObjectMeta, s.Spec.Template.Labels, &s.Spec.Template.Spec)
+	}
+	daemonSets, err := rm.listDaemonSets(namespace)
+	if err != nil {
+		return nil, err
+	}
+	for i := range daemonSets {
+		d := &daemonSets[i]
+		add("DaemonSet", d.ObjectMeta, d.Spec.Template.Labels, &d.Spec.Template.Spec)
+	}
+	pods, err := rm.listPods(namespace)
+	if err != nil {
+		return nil, err
+	}
+	for i := range pods {
+		if len(pods[i].OwnerReferences) == 0 {
+			add("Pod", pods[i].ObjectMeta, pods[i].Labels, &pods[i].Spec)
+		}
+	}
+	return workloads, nil
+}
+
+// servicePortTarget is a service port with the workload ports receiving its
+// traffic
+type servicePortTarget struct {
+	service string
+	port    corev1.ServicePort
+	// workloads are the workloads the service selects, and targets the
+	// "kind name" of those declaring the target port
+	workloads int
+	targets   []string
+}
+
+// String formats the service port as port/protocol->targetPort
+func (t servicePortTarget) String() string {
+	target := t.port.TargetPort.String()
+	if t.port.TargetPort.Type == intstr.Int && t.port.TargetPort.IntVal == 0 {
+		target = fmt.Sprint(t.port.Port)
+	}
+	return fmt.Sprintf("%s %d/%s->%s", t.service, t.port.Port, portProtocol(t.port.Protocol), target)
+}
+
+// correlatePorts matches the ports of selector services with the ports the
+// selected workloads declare. It returns the service ports and, per workload,
+// whether each declared port is exposed by a service
+func correlatePorts(services []corev1.Service, workloads []portWorkload) ([]servicePortTarget, map[string][]bool) {
+	exposed := map[string][]bool{}
+	for _, w := range workloads {
+		exposed[w.kind+" "+w.name] = make([]bool, len(w.ports))
+	}
+	targets := []servicePortTarget{}
+	for _, svc := range services {
+		if len(svc.Spec.Selector) == 0 {
+			continue
+		}
+		selector := labels.SelectorFromSet(svc.Spec.Selector)
+		for _, svcPort := range svc.Spec.Ports {
+			t := servicePortTarget{service: svc.Name, port: svcPort}
+			for _, w := range workloads {
+				if !selector.Matches(labels.Set(w.labels)) {
+					continue
+				}
+				t.workloads++
+				for i, p := range w.ports {
+					if resolvesTargetPort(p, svcPort) {
+						exposed[w.kind+" "+w.name][i] = true
+						t.targets = append(t.targets, fmt.Sprintf("%s %s (%s %s)", w.kind, w.name, p.container, p))
+					}
+				}
+			}
+			targets = append(targets, t)
+		}
+	}
+	return targets, exposed
+}
+
+// undeclaredPortFinding reports a service port no selected workload declares.
+// A named targetPort then resolves nowhere and the port receives no traffic;
+// a numeric one still works, declaring ports being informational
+func undeclaredPortFinding(namespace string, t servicePortTarget) Finding {
+	f := Finding{
+		Rule:      "undeclared-target-port",
+		Severity:  severityInfo,
+		Kind:      "Service",
+		Namespace: namespace,
+		Name:      t.service,
+		Message:   fmt.Sprintf("port %d targets %s, declared by none of the %d selected workload(s)", t.port.Port, t.port.TargetPort.String(), t.workloads),
+	}
+	if t.port.TargetPort.Type == intstr.String {
+		f.Severity = severityWarning
+	}
+	return f
+}
+
+// portFindings checks the service ports of a namespace against the ports the
+// selected workloads declare
+func (rm *ResourceMapper) portFindings(namespace string) ([]Finding, error) {
+	services, err := rm.listServices(namespace)
+	if err != nil {
+		return nil, err
+	}
+	workloads, err := rm.portWorkloads(namespace)
+	if err != nil {
+		return nil, err
+	}
+	findings := []Finding{}
+	targets, _ := correlatePorts(services, workloads)
+	for _, t := range targets {
+		if t.workloads > 0 && len(t.targets) == 0 {
+			findings = append(findings, undeclaredPortFinding(namespace, t))
+		}
+	}
+	return findings, nil
+}
+
+// showPortInventory lists the container ports each workload declares and the
+// service ports sending traffic to them, flagging service ports no container
+// declares and container ports no service exposes
+func (rm *ResourceMapper) showPortInventory(namespace string) error {
+	services, err := rm.listServices(namespace)
+	if err != nil {
+		return err
+	}
+	workloads, err := rm.portWorkloads(namespace)
+	if err != nil {
+		return err
+	}
+	targets, exposed := correlatePorts(services, workloads)
+
+	fmt.Printf("\n%sPort inventory in namespace: %s%s\n", colorBlue, namespace, colorReset)
+	fmt.Println(sym("├── Container ports:"))
+	for i, w := range workloads {
+		branch, indent := sym("├──"), sym("│  ")
+		if i == len(workloads)-1 {
+			branch, indent = sym("└──"), "   "
+		}
+		if len(w.ports) == 0 {
+			fmt.Printf(sym("│   %s %s %s: no declared ports\n"), branch, w.kind, w.name)
+			continue
+		}
+		fmt.Printf(sym("│   %s %s %s\n"), branch, w.kind, w.name)
+		for j, p := range w.ports {
+			note := ""
+			if !exposed[w.kind+" "+w.name][j] {
+				note = fmt.Sprintf(" %s(not exposed by a service)%s", colorYellow, colorReset)
+			}
+			fmt.Printf(sym("│   %s %s %s %s%s\n"), indent, rm.createArrow(4), p.container, p, note)
+		}
+	}
+	if len(workloads) == 0 {
+		fmt.Println(sym("│   └── No workloads"))
+	}
+
+	fmt.Println(sym("└── Service ports:"))
+	if len(targets) == 0 {
+		fmt.Println(sym("    └── No selector services"))
+	}
+	for i, t := range targets {
+		branch := sym("├──")
+		if i == len(targets)-1 {
+			branch = sym("└──")
+		}
+		switch {
+		case t.workloads == 0:
+			fmt.Printf("    %s %s: %sno workload selected%s\n", branch, t, colorYellow, colorReset)
+		case len(t.targets) == 0:
+			fmt.Printf("    %s %s: %snot declared by any container%s\n", branch, t, colorRed, colorReset)
+		default:
+			fmt.Printf("    %s %s: %s\n", branch, t, strings.Join(t.targets, ", "))
+		}
+	}
+	return nil
+}
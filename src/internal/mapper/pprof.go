@@ -0,0 +1,40 @@
+package mapper
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+)
+
+// addPprofFlag registers the profiling flag of the long-running modes
+func addPprofFlag(fs subcommandFlagSet) *string {
+	return fs.String("pprof", "", "Serve Go runtime profiles (net/http/pprof) on an address, such as :6060 or localhost:6060")
+}
+
+// startPprof serves the runtime profiles under /debug/pprof/ on an address of
+// their own, kept apart from the resource map as profiles expose internals.
+// Nothing is served without an address
+func startPprof(addr string) error {
+	if addr == "" {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	// Listen first, so that an address in use fails the command
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("error serving profiles: %v", err)
+	}
+	fmt.Printf("%sServing profiles on http://%s/debug/pprof/%s\n", colorGreen, listener.Addr(), colorReset)
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			fmt.Printf("%sError serving profiles: %v%s\n", colorRed, err, colorReset)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,105 @@
+package mapper
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// prReference identifies a GitHub pull request or a GitLab merge request
+type prReference struct {
+	Provider string // "github" or "gitlab"
+	Repo     string // owner/repo or group/project
+	Number   int
+}
+
+// parsePRReference parses "github:owner/repo#number" or
+// "gitlab:group/project!iid" (GitLab also accepts '#')
+func parsePRReference(ref string) (prReference, error) {
+	provider, rest, ok := strings.Cut(ref, ":")
+	if !ok || (provider != "github" && provider != "gitlab") {
+		return prReference{}, fmt.Errorf("invalid PR reference '%s' (expected github:owner/repo#number or gitlab:group/project!iid)", ref)
+	}
+
+	sep := strings.LastIndexAny(rest, "#!")
+	if sep <= 0 {
+		return prReference{}, fmt.Errorf("invalid PR reference '%s': missing PR/MR number", ref)
+	}
+	number, err := strconv.Atoi(rest[sep+1:])
+	if err != nil || !strings.Contains(rest[:sep], "/") {
+		return prReference{}, fmt.Errorf("invalid PR reference '%s'", ref)
+	}
+	return prReference{Provider: provider, Repo: rest[:sep], Number: number}, nil
+}
+
+// prCommentTarget parses the reference given to --pr-comment and checks its
+// token is set, returning nil when the flag is empty
+func prCommentTarget(ref string) (*prReference, error) {
+	if ref == "" {
+		return nil, nil
+	}
+	pr, err := parsePRReference(ref)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := pr.token(); err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+func (r prReference) String() string {
+	if r.Provider == "gitlab" {
+		return fmt.Sprintf("%s!%d", r.Repo, r.Number)
+	}
+	return fmt.Sprintf("%s#%d", r.Repo, r.Number)
+}
+
+// token returns the API token for the provider from the environment
+func (r prReference) token() (string, error) {
+	envVar := "GITHUB_TOKEN"
+	if r.Provider == "gitlab" {
+		envVar = "GITLAB_TOKEN"
+	}
+	token := os.Getenv(envVar)
+	if token == "" {
+		return "", fmt.Errorf("posting to %s requires %s to be set", r.Provider, envVar)
+	}
+	return token, nil
+}
+
+// envOrDefault returns the first non-empty environment variable or the fallback
+func envOrDefault(fallback string, names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return fallback
+}
+
+// postComment posts a Markdown comment on the pull/merge request
+func (r prReference) postComment(body string) error {
+	token, err := r.token()
+	if err != nil {
+		return err
+	}
+
+	if r.Provider == "gitlab" {
+		apiURL := envOrDefault("https://gitlab.com/api/v4", "GITLAB_API_URL", "CI_API_V4_URL")
+		endpoint := fmt.Sprintf("%s/projects/%s/merge_requests/%d/notes",
+			strings.TrimSuffix(apiURL, "/"), url.PathEscape(r.Repo), r.Number)
+		return postJSON(endpoint, map[string]string{"body": body}, map[string]string{
+			"PRIVATE-TOKEN": token,
+		})
+	}
+
+	apiURL := envOrDefault("https://api.github.com", "GITHUB_API_URL")
+	endpoint := fmt.Sprintf("%s/repos/%s/issues/%d/comments", strings.TrimSuffix(apiURL, "/"), r.Repo, r.Number)
+	return postJSON(endpoint, map[string]string{"body": body}, map[string]string{
+		"Authorization": "Bearer " + token,
+		"Accept":        "application/vnd.github+json",
+	})
+}
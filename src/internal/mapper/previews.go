@@ -0,0 +1,146 @@
+package mapper
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// previewEnvironment is a namespace holding a short-lived preview of a
+// change, with what it runs
+type previewEnvironment struct {
+	name        string
+	age         time.Duration
+	pods        int
+	deployments int
+	services    int
+	requests    corev1.ResourceList
+}
+
+// formatAge formats a duration the way kubectl prints ages
+func formatAge(age time.Duration) string {
+	switch {
+	case age >= 48*time.Hour:
+		return fmt.Sprintf("%dd", int(age.Hours())/24)
+	case age >= time.Hour:
+		return fmt.Sprintf("%dh", int(age.Hours()))
+	}
+	return fmt.Sprintf("%dm", int(age.Minutes()))
+}
+
+// listPreviewEnvironments returns the selected namespaces whose name matches
+// the preview pattern, oldest first
+func (rm *ResourceMapper) listPreviewEnvironments(pattern *regexp.Regexp, selected []string) ([]previewEnvironment, error) {
+	wanted := map[string]bool{}
+	for _, ns := range selected {
+		wanted[ns] = true
+	}
+	namespaces, err := rm.listNamespaces()
+	if err != nil {
+		return nil, err
+	}
+
+	previews := []previewEnvironment{}
+	for _, ns := range namespaces {
+		if !wanted[ns.Name] || !pattern.MatchString(ns.Name) {
+			continue
+		}
+		env := previewEnvironment{name: ns.Name, age: time.Since(ns.CreationTimestamp.Time), requests: corev1.ResourceList{}}
+		pods, err := rm.listPods(ns.Name)
+		if err != nil {
+			return nil, err
+		}
+		for i := range pods {
+			// Finished pods no longer hold their requests
+			if pods[i].Status.Phase == corev1.PodSucceeded || pods[i].Status.Phase == corev1.PodFailed {
+				continue
+			}
+			env.pods++
+			for name, qty := range podFootprint(&pods[i]) {
+				total := env.requests[name]
+				total.Add(qty)
+				env.requests[name] = total
+			}
+		}
+		deployments, err := rm.listDeployments(ns.Name)
+		if err != nil {
+			return nil, err
+		}
+		env.deployments = len(deployments)
+		services, err := rm.listServices(ns.Name)
+		if err != nil {
+			return nil, err
+		}
+		env.services = len(services)
+		previews = append(previews, env)
+	}
+	sort.Slice(previews, func(i, j int) bool { return previews[i].age > previews[j].age })
+	return previews, nil
+}
+
+// runPreviews runs the previews subcommand: reports the age and usage of
+// preview environments and flags those past their TTL for cleanup
+func runPreviews(args []string) error {
+	var global globalFlags
+	fs := newSubcommandFlagSet("previews", &global)
+	patternFlag := fs.String("pattern", `^(pr|preview|review)-`, "Regular expression matching the names of preview environment namespaces")
+	ttl := fs.Duration("ttl", 7*24*time.Hour, "Age after which a preview environment is due for cleanup")
+	fs.Parse(args)
+
+	pattern, err := regexp.Compile(*patternFlag)
+	if err != nil {
+		return fmt.Errorf("invalid --pattern: %v", err)
+	}
+	if *ttl <= 0 {
+		return fmt.Errorf("--ttl must be positive")
+	}
+
+	rm, err := global.newResourceMapper()
+	if err != nil {
+		return err
+	}
+	namespaces, err := global.namespaces(rm)
+	if err != nil {
+		return err
+	}
+	previews, err := rm.listPreviewEnvironments(pattern, namespaces)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%sPreview environments matching %s (TTL %s):%s\n", colorCyan, pattern, formatAge(*ttl), colorReset)
+	if len(previews) == 0 {
+		fmt.Printf(sym("└── %sNone found%s\n"), colorYellow, colorReset)
+		return nil
+	}
+	expired := []string{}
+	for i, env := range previews {
+		branch, indent := sym("├──"), sym("│  ")
+		if i == len(previews)-1 {
+			branch, indent = sym("└──"), "   "
+		}
+		status := colorGreen + "within TTL" + colorReset
+		if env.age > *ttl {
+			status = colorRed + "expired, due for cleanup" + colorReset
+			expired = append(expired, env.name)
+		}
+		cpu := env.requests[corev1.ResourceCPU]
+		memory := env.requests[corev1.ResourceMemory]
+		fmt.Printf("%s %s (age %s, %s)\n", branch, env.name, formatAge(env.age), status)
+		fmt.Printf("%s %s %d pod(s), %d deployment(s), %d service(s)\n", indent, rm.createArrow(4), env.pods, env.deployments, env.services)
+		fmt.Printf("%s %s reserved: cpu %s, memory %s\n", indent, rm.createArrow(4), cpu.String(), memory.String())
+	}
+
+	if len(expired) == 0 {
+		fmt.Printf("\n%sNo preview environment is past its TTL%s\n", colorGreen, colorReset)
+		return nil
+	}
+	fmt.Printf("\n%s%d preview environment(s) past their TTL. To clean up:%s\n", colorYellow, len(expired), colorReset)
+	for _, name := range expired {
+		fmt.Printf("  kubectl delete namespace %s\n", name)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package mapper
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// processor is a resource type the mapper lists, maps and relates, which
+// --enable and --disable switch on and off. A disabled type is not listed
+// nor watched, and the views and graphs see it as empty
+type processor struct {
+	// name is the name given to --enable and --disable
+	name string
+	// what is the type as named in the processor cache and access checks
+	what string
+	// enabled tells whether the type is mapped unless disabled
+	enabled bool
+	// listing tells how often the type is listed, for --estimate
+	listing processorListing
+}
+
+// processorListing tells how often a processor lists its type
+type processorListing int
+
+// Listings of processors: once per namespace, once per namespace outside of
+// --compact for the types only the per-kind listings use, once per run for
+// cluster-wide types, or never for processors not calling the API server,
+// such as plugins and custom resources, which list one type per kind mapped
+const (
+	listedPerNamespace processorListing = iota
+	listedUnlessCompact
+	listedPerRun
+	notListed
+)
+
+// processors holds the registered processors by name
+var processors = map[string]processor{}
+
+// registerProcessor makes a resource type switchable with --enable and
+// --disable. Types mapped only on request, such as expensive or noisy ones,
+// register as disabled. Plugins register as they are found, disabled, see
+// loadPlugins
+func registerProcessor(name, what string, enabled bool, listing processorListing) {
+	processors[name] = processor{name: name, what: what, enabled: enabled, listing: listing}
+}
+
+// The legacy Endpoints duplicate the EndpointSlices, and the Prometheus
+// Operator types are optional and listed across every namespace, so those
+// are mapped on request
+func init() {
+	registerProcessor("pods", "pods", true, listedPerNamespace)
+	registerProcessor("services", "services", true, listedPerNamespace)
+	registerProcessor("configmaps", "configmaps", true, listedPerNamespace)
+	registerProcessor("secrets", "secrets", true, listedPerNamespace)
+	registerProcessor("endpoints", "endpoints", false, listedPerNamespace)
+	registerProcessor("endpointslices", "endpoint slices", true, listedPerNamespace)
+	registerProcessor("deployments", "deployments", true, listedPerNamespace)
+	registerProcessor("statefulsets", "statefulsets", true, listedPerNamespace)
+	registerProcessor("daemonsets", "daemonsets", true, listedUnlessCompact)
+	registerProcessor("replicasets", "replicasets", true, listedPerNamespace)
+	registerProcessor("jobs", "jobs", true, listedUnlessCompact)
+	registerProcessor("cronjobs", "cronjobs", true, listedUnlessCompact)
+	registerProcessor("hpas", "HPAs", true, listedPerNamespace)
+	registerProcessor("ingresses", "ingresses", true, listedPerNamespace)
+	registerProcessor("pdbs", "pod disruption budgets", true, listedPerNamespace)
+	registerProcessor("servicemonitors", "ServiceMonitors", false, listedPerNamespace)
+	registerProcessor("podmonitors", "PodMonitors", false, listedPerNamespace)
+	registerProcessor("prometheusrules", "PrometheusRules", false, listedPerRun)
+	registerProcessor("customresources", "custom resources", true, notListed)
+}
+
+// processorNames lists the processors for flag help and errors, marking
+// those disabled by default
+func processorNames() string {
+	names := make([]string, 0, len(processors))
+	for name, p := range processors {
+		if !p.enabled {
+			name += " (off by default)"
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// setProcessors switches processors on and off from their defaults, given by
+// name in comma-separated lists. Plugins are off unless all of them are
+// enabled with plugins or one is by name, and PATH is only searched for them
+// then
+func (rm *ResourceMapper) setProcessors(enable, disable []string, plugins bool) error {
+	if plugins || strings.Contains(strings.Join(enable, ","), "plugin:") {
+		loadPlugins()
+	}
+	states := map[string]bool{}
+	for _, p := range processors {
+		states[p.what] = p.enabled
+		if plugins && strings.HasPrefix(p.name, "plugin:") {
+			states[p.what] = true
+		}
+	}
+	switched := map[string]string{}
+	for _, change := range []struct {
+		flag    string
+		names   []string
+		enabled bool
+	}{{"--enable", enable, true}, {"--disable", disable, false}} {
+		for _, list := range change.names {
+			for _, name := range strings.Split(list, ",") {
+				name = strings.ToLower(strings.TrimSpace(name))
+				if name == "" {
+					continue
+				}
+				p, ok := processors[name]
+				if !ok {
+					return fmt.Errorf("%s: unknown processor '%s' (available: %s)", change.flag, name, processorNames())
+				}
+				if flag, ok := switched[name]; ok && flag != change.flag {
+					return fmt.Errorf("processor %s is both enabled and disabled", name)
+				}
+				switched[name] = change.flag
+				states[p.what] = change.enabled
+			}
+		}
+	}
+	rm.processorStates = states
+	return nil
+}
+
+// enabled reports whether a type is mapped. Types that are no processor
+// always are
+func (rm *ResourceMapper) enabled(what string) bool {
+	if enabled, ok := rm.processorStates[what]; ok {
+		return enabled
+	}
+	for _, p := range processors {
+		if p.what == what {
+			return p.enabled
+		}
+	}
+	return true
+}
+
+// disabling reports whether types mapped by default are disabled, so that
+// references to their objects cannot be checked
+func (rm *ResourceMapper) disabling() bool {
+	for _, p := range processors {
+		if p.enabled && !rm.enabled(p.what) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package mapper
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSetProcessors(t *testing.T) {
+	tests := []struct {
+		name          string
+		enable        []string
+		disable       []string
+		want          map[string]bool
+		wantDisabling bool
+		wantErr       bool
+	}{
+		{
+			name: "defaults",
+			want: map[string]bool{"pods": true, "secrets": true, "endpoint slices": true,
+				"endpoints": false, "ServiceMonitors": false, "PodMonitors": false, "PrometheusRules": false},
+		},
+		{
+			name:   "enable optional types",
+			enable: []string{"endpoints", " ServiceMonitors , podmonitors", "prometheusrules"},
+			want:   map[string]bool{"endpoints": true, "ServiceMonitors": true, "PodMonitors": true, "PrometheusRules": true},
+		},
+		{
+			name:          "disable default types",
+			disable:       []string{"secrets,configmaps"},
+			want:          map[string]bool{"secrets": false, "configmaps": false, "pods": true},
+			wantDisabling: true,
+		},
+		{
+			name:    "disable an optional type",
+			disable: []string{"endpoints"},
+			want:    map[string]bool{"endpoints": false},
+		},
+		{
+			name:    "unknown processor",
+			enable:  []string{"widgets"},
+			wantErr: true,
+		},
+		{
+			name:    "enabled and disabled",
+			enable:  []string{"pods"},
+			disable: []string{"pods"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rm := testMapper()
+			err := rm.setProcessors(tt.enable, tt.disable, false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("setProcessors error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			for what, want := range tt.want {
+				if got := rm.enabled(what); got != want {
+					t.Errorf("enabled(%q) = %v, want %v", what, got, want)
+				}
+			}
+			if got := rm.disabling(); got != tt.wantDisabling {
+				t.Errorf("disabling = %v, want %v", got, tt.wantDisabling)
+			}
+		})
+	}
+}
+
+func TestDisabledProcessorNotListed(t *testing.T) {
+	rm := testMapper(testService("web", map[string]string{"app": "web"}),
+		&corev1.Endpoints{ObjectMeta: testMeta("web", nil)})
+	if err := rm.setProcessors(nil, []string{"services"}, false); err != nil {
+		t.Fatalf("setProcessors: %v", err)
+	}
+	services, err := rm.listServices("shop")
+	if err != nil {
+		t.Fatalf("listServices: %v", err)
+	}
+	if len(services) != 0 {
+		t.Errorf("services of a disabled processor = %d, want 0", len(services))
+	}
+	endpoints, err := rm.listEndpoints("shop")
+	if err != nil {
+		t.Fatalf("listEndpoints: %v", err)
+	}
+	if len(endpoints) != 0 {
+		t.Errorf("endpoints off by default = %d, want 0", len(endpoints))
+	}
+
+	rm = testMapper(&corev1.Endpoints{ObjectMeta: testMeta("web", nil)})
+	if err := rm.setProcessors([]string{"endpoints"}, nil, false); err != nil {
+		t.Fatalf("setProcessors: %v", err)
+	}
+	if endpoints, _ := rm.listEndpoints("shop"); len(endpoints) != 1 {
+		t.Errorf("endpoints enabled = %d, want 1", len(endpoints))
+	}
+}
@@ -0,0 +1,189 @@
+package mapper
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Traversal directions of a query
+const (
+	traverseOut  = "out"
+	traverseIn   = "in"
+	traverseBoth = "both"
+)
+
+// queryCondition is a where clause comparing a field of a resource
+type queryCondition struct {
+	Field string
+	Op    string
+	Value string
+	re    *regexp.Regexp
+}
+
+// graphQuery selects a subgraph: the resources of a kind matching every
+// condition, and the resources reachable from them over some relationships
+type graphQuery struct {
+	Kind       string
+	Conditions []queryCondition
+	// Relationships are the relationship types traversed, all when empty
+	Relationships map[string]bool
+	Direction     string
+	Depth         int
+}
+
+// parseQuery parses a query expression:
+//
+//	from <kind|*> [where <field><op><value> [and ...]]
+//	    [traverse [out|in|both] <type>[,<type>...]|*] [depth <n>]
+//
+// Fields are kind, name, namespace, label.<key>, annotation.<key> or an
+// attribute; operators are =, != and =~ (anchored regular expression)
+func parseQuery(expr string) (*graphQuery, error) {
+	tokens := strings.Fields(expr)
+	if len(tokens) < 2 || !strings.EqualFold(tokens[0], "from") {
+		return nil, fmt.Errorf("query must start with 'from <kind>'")
+	}
+	q := &graphQuery{Kind: tokens[1], Relationships: map[string]bool{}, Direction: traverseOut}
+	traverse := false
+	depth := -1
+	for i := 2; i < len(tokens); i++ {
+		keyword := strings.ToLower(tokens[i])
+		switch keyword {
+		case "where", "and":
+			if i+1 >= len(tokens) {
+				return nil, fmt.Errorf("'%s' expects a condition", keyword)
+			}
+			i++
+			cond, err := parseCondition(tokens[i])
+			if err != nil {
+				return nil, err
+			}
+			q.Conditions = append(q.Conditions, cond)
+		case "traverse":
+			traverse = true
+			if i+1 < len(tokens) {
+				switch dir := strings.ToLower(tokens[i+1]); dir {
+				case traverseOut, traverseIn, traverseBoth:
+					q.Direction = dir
+					i++
+				}
+			}
+			if i+1 >= len(tokens) {
+				return nil, fmt.Errorf("'traverse' expects relationship types or *")
+			}
+			i++
+			if tokens[i] != "*" {
+				for _, rel := range strings.Split(tokens[i], ",") {
+					q.Relationships[strings.ToLower(rel)] = true
+				}
+			}
+		case "depth":
+			if i+1 >= len(tokens) {
+				return nil, fmt.Errorf("'depth' expects a number")
+			}
+			i++
+			n, err := strconv.Atoi(tokens[i])
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid depth '%s'", tokens[i])
+			}
+			depth = n
+		default:
+			return nil, fmt.Errorf("unexpected '%s' in query", tokens[i])
+		}
+	}
+
+	// Traversing without a depth follows one hop; a depth alone follows
+	// every relationship
+	switch {
+	case depth >= 0:
+		q.Depth = depth
+	case traverse:
+		q.Depth = 1
+	}
+	return q, nil
+}
+
+// parseCondition parses a field<op>value condition
+func parseCondition(token string) (queryCondition, error) {
+	for _, op := range []string{"=~", "!=", "="} {
+		field, value, ok := strings.Cut(token, op)
+		if !ok || field == "" {
+			continue
+		}
+		cond := queryCondition{Field: field, Op: op, Value: value}
+		if op == "=~" {
+			re, err := regexp.Compile("^(?:" + value + ")$")
+			if err != nil {
+				return cond, fmt.Errorf("invalid regular expression in '%s': %v", token, err)
+			}
+			cond.re = re
+		}
+		return cond, nil
+	}
+	return queryCondition{}, fmt.Errorf("invalid condition '%s' (expected field=value, field!=value or field=~regexp)", token)
+}
+
+// fieldValue returns a field of a resource as compared by conditions
+func fieldValue(res *Resource, field string) string {
+	switch {
+	case field == "kind":
+		return res.Kind
+	case field == "name":
+		return res.Name
+	case field == "namespace":
+		return res.Namespace
+	case strings.HasPrefix(field, "label."):
+		return res.Labels[strings.TrimPrefix(field, "label.")]
+	case strings.HasPrefix(field, "annotation."):
+		return res.Annotations[strings.TrimPrefix(field, "annotation.")]
+	}
+	return res.Attributes[field]
+}
+
+// matches reports whether a resource satisfies a condition
+func (c *queryCondition) matches(res *Resource) bool {
+	value := fieldValue(res, c.Field)
+	switch c.Op {
+	case "=~":
+		return c.re.MatchString(value)
+	case "!=":
+		return value != c.Value
+	}
+	return value == c.Value
+}
+
+// selects reports whether a resource is a starting point of the query
+func (q *graphQuery) selects(res *Resource) bool {
+	if q.Kind != "*" && !strings.EqualFold(res.Kind, q.Kind) {
+		return false
+	}
+	for i := range q.Conditions {
+		if !q.Conditions[i].matches(res) {
+			return false
+		}
+	}
+	return true
+}
+
+// follows reports whether the traversal may use a relationship type
+func (q *graphQuery) follows(relType string) bool {
+	return len(q.Relationships) == 0 || q.Relationships[strings.ToLower(relType)]
+}
+
+// run selects the subgraph of a graph answering the query, walking
+// relationships breadth first from the selected resources. Nil is returned
+// when nothing is selected
+func (q *graphQuery) run(g *Graph) *Graph {
+	roots := []ResourceKey{}
+	for i := range g.Resources {
+		if q.selects(&g.Resources[i]) {
+			roots = append(roots, g.Resources[i].Key())
+		}
+	}
+	if len(roots) == 0 {
+		return nil
+	}
+	return g.walk(roots, q.Depth, Direction(q.Direction), q.follows)
+}
@@ -0,0 +1,121 @@
+package mapper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// Default client rate limits, those of client-go
+const (
+	defaultQPS   = 5
+	defaultBurst = 10
+)
+
+// Adaptive rate limiting: each throttled request halves the rate, down to
+// minAdaptiveQPS, and every recoverAfter successful requests in a row raise
+// it by a quarter again, up to the configured QPS
+const (
+	minAdaptiveQPS = 0.5
+	recoverAfter   = 20
+)
+
+// adaptiveRateLimiter limits the API calls of a mapper to a QPS and burst.
+// When adaptive, it slows down as the API server throttles requests (429,
+// from API Priority and Fairness or a max-inflight limit) and speeds back up
+// as they succeed again. It implements client-go's flowcontrol.RateLimiter
+// and is shared by all the clients of a mapper
+type adaptiveRateLimiter struct {
+	limiter  *rate.Limiter
+	qps      float64
+	adaptive bool
+
+	mu        sync.Mutex
+	current   float64
+	successes int
+}
+
+// newAdaptiveRateLimiter creates a limiter allowing qps calls per second with
+// bursts of burst calls
+func newAdaptiveRateLimiter(qps float64, burst int, adaptive bool) *adaptiveRateLimiter {
+	return &adaptiveRateLimiter{limiter: rate.NewLimiter(rate.Limit(qps), burst), qps: qps, adaptive: adaptive, current: qps}
+}
+
+func (l *adaptiveRateLimiter) TryAccept() bool {
+	return l.limiter.Allow()
+}
+
+func (l *adaptiveRateLimiter) Accept() {
+	l.limiter.Wait(context.Background())
+}
+
+func (l *adaptiveRateLimiter) Wait(ctx context.Context) error {
+	return l.limiter.Wait(ctx)
+}
+
+func (l *adaptiveRateLimiter) Stop() {}
+
+func (l *adaptiveRateLimiter) QPS() float32 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return float32(l.current)
+}
+
+// throttled halves the rate after the API server throttled a request,
+// warning on stderr as it may happen in the middle of JSON outputs
+func (l *adaptiveRateLimiter) throttled() {
+	if !l.adaptive {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.successes = 0
+	if l.current <= minAdaptiveQPS {
+		return
+	}
+	l.current = max(l.current/2, minAdaptiveQPS)
+	l.limiter.SetLimit(rate.Limit(l.current))
+	fmt.Fprintf(os.Stderr, "%s[rate limit] API server throttling requests, slowing down to %.1f calls/s%s\n", colorYellow, l.current, colorReset)
+}
+
+// succeeded counts a request the API server served, raising the rate back
+// towards the configured QPS after enough of them
+func (l *adaptiveRateLimiter) succeeded() {
+	if !l.adaptive {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.current >= l.qps {
+		return
+	}
+	l.successes++
+	if l.successes < recoverAfter {
+		return
+	}
+	l.successes = 0
+	l.current = min(l.current*1.25, l.qps)
+	l.limiter.SetLimit(rate.Limit(l.current))
+}
+
+// rateLimitTransport reports the outcome of each API call to the rate limiter
+type rateLimitTransport struct {
+	next    http.RoundTripper
+	limiter *adaptiveRateLimiter
+}
+
+func (t rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	switch {
+	case err != nil:
+	case resp.StatusCode == http.StatusTooManyRequests:
+		t.limiter.throttled()
+	case resp.StatusCode < 500:
+		t.limiter.succeeded()
+	}
+	return resp, err
+}
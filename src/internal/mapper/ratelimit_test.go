@@ -0,0 +1,86 @@
+package mapper
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAdaptiveRateLimiter(t *testing.T) {
+	succeed := strings.Repeat("s", recoverAfter)
+	tests := []struct {
+		name     string
+		adaptive bool
+		// steps are the outcomes of requests: t for throttled, s for succeeded
+		steps string
+		want  float32
+	}{
+		{name: "configured rate", adaptive: true, steps: "", want: 8},
+		{name: "throttled halves", adaptive: true, steps: "t", want: 4},
+		{name: "floor", adaptive: true, steps: "tttttt", want: minAdaptiveQPS},
+		{name: "not adaptive", adaptive: false, steps: "ttt", want: 8},
+		{name: "recovering needs enough successes", adaptive: true, steps: "t" + succeed[1:], want: 4},
+		{name: "recovers by a quarter", adaptive: true, steps: "t" + succeed, want: 5},
+		{name: "throttling restarts the count", adaptive: true, steps: "t" + succeed[1:] + "t" + succeed[1:], want: 2},
+		{name: "capped at the configured rate", adaptive: true, steps: "t" + strings.Repeat(succeed, 5), want: 8},
+		{name: "successes at full rate", adaptive: true, steps: succeed, want: 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newAdaptiveRateLimiter(8, 10, tt.adaptive)
+			for _, step := range tt.steps {
+				if step == 't' {
+					l.throttled()
+				} else {
+					l.succeeded()
+				}
+			}
+			if got := l.QPS(); got != tt.want {
+				t.Errorf("QPS = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRateLimitTransport(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		err    error
+		want   float32
+	}{
+		{name: "too many requests", status: http.StatusTooManyRequests, want: minAdaptiveQPS},
+		{name: "ok", status: http.StatusOK, want: 5},
+		{name: "client error", status: http.StatusNotFound, want: 5},
+		{name: "server error", status: http.StatusServiceUnavailable, want: 4},
+		{name: "network error", err: errors.New("connection refused"), want: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newAdaptiveRateLimiter(8, 10, true)
+			l.throttled()
+			transport := rateLimitTransport{limiter: l, next: roundTripperFunc(func(*http.Request) (*http.Response, error) {
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return &http.Response{StatusCode: tt.status}, nil
+			})}
+			req, _ := http.NewRequest(http.MethodGet, "http://cluster/api/v1/pods", nil)
+			for i := 0; i < recoverAfter; i++ {
+				if _, err := transport.RoundTrip(req); err != tt.err {
+					t.Fatalf("RoundTrip error = %v, want %v", err, tt.err)
+				}
+			}
+			if got := l.QPS(); got != tt.want {
+				t.Errorf("QPS = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
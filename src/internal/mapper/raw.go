@@ -0,0 +1,61 @@
+package mapper
+
+import (
+	"encoding/json"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// lastAppliedAnnotation holds a copy of the whole object, as last applied by
+// kubectl
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// trimAnnotations returns the annotations of an object without the copy of
+// the object kubectl keeps in them, which would make each resource as large
+// as its manifest. The manifests themselves are embedded with --include-raw
+func trimAnnotations(annotations map[string]string) map[string]string {
+	if _, ok := annotations[lastAppliedAnnotation]; !ok {
+		return annotations
+	}
+	trimmed := make(map[string]string, len(annotations)-1)
+	for key, value := range annotations {
+		if key != lastAppliedAnnotation {
+			trimmed[key] = value
+		}
+	}
+	if len(trimmed) == 0 {
+		return nil
+	}
+	return trimmed
+}
+
+// rawManifest returns the manifest of a typed object as JSON, with the kind
+// listed objects lack and without the managed fields. It is nil when the
+// object cannot be converted, which only types unknown to the client can cause
+func rawManifest(obj runtime.Object) json.RawMessage {
+	gvks, _, err := scheme.Scheme.ObjectKinds(obj)
+	if err != nil || len(gvks) == 0 {
+		return nil
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil
+	}
+	u := &unstructured.Unstructured{Object: content}
+	u.SetGroupVersionKind(gvks[0])
+	return unstructuredManifest(u)
+}
+
+// unstructuredManifest returns the manifest of an untyped object as JSON,
+// without the managed fields
+func unstructuredManifest(obj *unstructured.Unstructured) json.RawMessage {
+	obj = obj.DeepCopy()
+	obj.SetManagedFields(nil)
+	raw, err := json.Marshal(obj.Object)
+	if err != nil {
+		return nil
+	}
+	return raw
+}
@@ -0,0 +1,169 @@
+package mapper
+
+import (
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/yaml"
+)
+
+// relationshipRule relates the objects of a custom resource kind to the
+// objects named by one of their fields, such as a Secret named in
+// spec.databaseSecretRef
+type relationshipRule struct {
+	Group string `json:"group"`
+	Kind  string `json:"kind"`
+	// Field is a JSONPath expression giving names, or references with a
+	// name and optionally a kind and namespace
+	Field string `json:"field"`
+	// Target is the kind of the objects referenced, unless a reference has one
+	Target string `json:"target"`
+	// ClusterScoped tells that the objects referenced have no namespace
+	ClusterScoped bool   `json:"clusterScoped,omitempty"`
+	Type          string `json:"type"`
+	Description   string `json:"description,omitempty"`
+}
+
+// relationshipRulesFile is the format of the --relationship-rules file
+type relationshipRulesFile struct {
+	Rules []relationshipRule `json:"rules"`
+}
+
+// ruleReference is an object referenced by another, found by a relationship
+// rule or a hint annotation
+type ruleReference struct {
+	from        ResourceKey
+	to          ResourceKey
+	relType     string
+	description string
+}
+
+// loadRelationshipRules reads relationship rules from a YAML file
+func loadRelationshipRules(path string) ([]relationshipRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading relationship rules: %v", err)
+	}
+	var file relationshipRulesFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing relationship rules %s: %v", path, err)
+	}
+	for _, rule := range file.Rules {
+		if rule.Kind == "" || rule.Field == "" || rule.Target == "" || rule.Type == "" {
+			return nil, fmt.Errorf("relationship rule for %q needs a kind, field, target and type", rule.Kind)
+		}
+		if err := jsonpath.New(rule.Kind).Parse(rule.Field); err != nil {
+			return nil, fmt.Errorf("invalid JSONPath %q in relationship rule for %s: %v", rule.Field, rule.Kind, err)
+		}
+	}
+	return file.Rules, nil
+}
+
+// resolveRelationshipRules adds the kinds the rules relate from to the
+// custom resource types mapped, so that a rule is enough to map a kind
+func (rm *ResourceMapper) resolveRelationshipRules(rules []relationshipRule) error {
+	groupResources, err := restmapper.GetAPIGroupResources(rm.clientset.Discovery())
+	if err != nil {
+		return fmt.Errorf("error discovering API resources: %v", err)
+	}
+	mapper := restmapper.NewDiscoveryRESTMapper(groupResources)
+
+	mapped := map[schema.GroupKind]bool{}
+	for _, crt := range rm.customResources {
+		mapped[schema.GroupKind{Group: crt.gvr.Group, Kind: crt.kind}] = true
+	}
+	for _, rule := range rules {
+		gk := schema.GroupKind{Group: rule.Group, Kind: rule.Kind}
+		if mapped[gk] {
+			continue
+		}
+		mapping, err := mapper.RESTMapping(gk)
+		if err != nil {
+			return fmt.Errorf("error resolving kind %s of relationship rule: %v", gk, err)
+		}
+		if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+			return fmt.Errorf("kind %s of relationship rule is cluster-scoped, only namespaced resources can be mapped", gk)
+		}
+		rm.customResources = append(rm.customResources, customResourceType{gvr: mapping.Resource, kind: rule.Kind})
+		mapped[gk] = true
+	}
+	rm.relationshipRules = rules
+	return nil
+}
+
+// ruleReferences evaluates the relationship rules of a custom resource kind
+// on one of its objects
+func ruleReferences(rules []relationshipRule, group, kind string, obj *unstructured.Unstructured) ([]ruleReference, error) {
+	from := ResourceKey{Kind: kind, Namespace: obj.GetNamespace(), Name: obj.GetName()}
+	refs := []ruleReference{}
+	for _, rule := range rules {
+		if rule.Group != group || rule.Kind != kind {
+			continue
+		}
+		jp := jsonpath.New(rule.Kind).AllowMissingKeys(true)
+		if err := jp.Parse(rule.Field); err != nil {
+			return nil, err
+		}
+		results, err := jp.FindResults(obj.Object)
+		if err != nil {
+			return nil, fmt.Errorf("error evaluating %s: %v", rule.Field, err)
+		}
+		for _, values := range results {
+			for _, value := range values {
+				to := ResourceKey{Kind: rule.Target, Namespace: obj.GetNamespace()}
+				switch v := value.Interface().(type) {
+				case string:
+					to.Name = v
+				case map[string]interface{}:
+					to.Name, _ = v["name"].(string)
+					if kind, _ := v["kind"].(string); kind != "" {
+						to.Kind = kind
+					}
+					if namespace, _ := v["namespace"].(string); namespace != "" {
+						to.Namespace = namespace
+					}
+				}
+				if to.Name == "" {
+					continue
+				}
+				if rule.ClusterScoped {
+					to.Namespace = ""
+				}
+				refs = append(refs, ruleReference{from: from, to: to, relType: rule.Type, description: rule.Description})
+			}
+		}
+	}
+	return refs, nil
+}
+
+// addReferences relates objects to those their relationship rules or hints
+// reference. Objects of the kinds listed in the namespace must exist, the
+// others are added as referenced
+func (objs *namespaceObjects) addReferences(g *Graph, refs []ruleReference) {
+	listed := map[string]bool{"Deployment": true, "StatefulSet": true, "HorizontalPodAutoscaler": true,
+		"Service": true, "Ingress": true, "ConfigMap": true, "Pod": true}
+	for _, ref := range refs {
+		to := ref.to
+		if !g.hasResource(to) {
+			local := to.Namespace == objs.namespace
+			switch {
+			case local && listed[to.Kind]:
+				if !objs.selected {
+					g.addBroken(ref.from, to.Kind, to.Namespace, to.Name, ref.relType, ref.description)
+				}
+				continue
+			case local && to.Kind == "Secret" && objs.secrets != nil && !objs.secrets[to.Name] && !objs.selected:
+				// Secrets are only checked when they may be listed
+				g.addBroken(ref.from, to.Kind, to.Namespace, to.Name, ref.relType, ref.description)
+				continue
+			}
+			to = g.addReferenced(to.Kind, to.Namespace, to.Name)
+		}
+		g.addRelationship(ref.from, to, ref.relType, ref.description)
+	}
+}
@@ -0,0 +1,62 @@
+package mapper
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// runRenderer runs a manifest rendering tool and returns what it printed,
+// including its error output when it fails
+func runRenderer(name string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error running %s %s: %v: %s", name, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// renderKustomize builds a kustomization with kustomize, or with the copy
+// embedded in kubectl when kustomize is not installed
+func renderKustomize(dir string) ([]byte, error) {
+	if _, err := exec.LookPath("kustomize"); err == nil {
+		return runRenderer("kustomize", "build", dir)
+	}
+	if _, err := exec.LookPath("kubectl"); err == nil {
+		return runRenderer("kubectl", "kustomize", dir)
+	}
+	return nil, fmt.Errorf("--kustomize needs kustomize or kubectl in PATH")
+}
+
+// renderHelmChart renders a chart with helm template into a namespace, the
+// release being named after the chart
+func renderHelmChart(chart string, values []string, namespace string) ([]byte, error) {
+	if _, err := exec.LookPath("helm"); err != nil {
+		return nil, fmt.Errorf("--helm-chart needs helm in PATH")
+	}
+	release := strings.TrimSuffix(filepath.Base(filepath.Clean(chart)), ".tgz")
+	if i := strings.LastIndex(release, "-"); i > 0 && strings.HasSuffix(chart, ".tgz") {
+		// Packaged charts are named <chart>-<version>.tgz
+		release = release[:i]
+	}
+	args := []string{"template", release, chart, "--namespace", namespace}
+	for _, file := range values {
+		args = append(args, "--values", file)
+	}
+	return runRenderer("helm", args...)
+}
+
+// newRenderedResourceMapper creates a ResourceMapper serving manifests
+// rendered by kustomize or helm
+func newRenderedResourceMapper(source string, rendered []byte, defaultNamespace string) (*ResourceMapper, error) {
+	set := &manifestSet{skipped: map[string]int{}}
+	if err := set.decodeManifests(bytes.NewReader(rendered), source, defaultNamespace); err != nil {
+		return nil, err
+	}
+	return newManifestSetResourceMapper(set, source)
+}
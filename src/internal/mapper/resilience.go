@@ -0,0 +1,162 @@
+package mapper
+
+import (
+	"fmt"
+	"strings"
+
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// resilienceAnnotation is a retry or timeout setting of an ingress controller
+type resilienceAnnotation struct {
+	key          string
+	label        string
+	unit         string
+	defaultValue string
+}
+
+// ingressController describes the resilience annotations understood by an
+// ingress controller and the defaults it applies when they are absent
+type ingressController struct {
+	name        string
+	classHint   string
+	prefix      string
+	annotations []resilienceAnnotation
+}
+
+// ingressControllers lists the controllers whose annotations are recognized
+var ingressControllers = []ingressController{
+	{
+		name: "ingress-nginx", classHint: "nginx", prefix: "nginx.ingress.kubernetes.io/",
+		annotations: []resilienceAnnotation{
+			{"proxy-connect-timeout", "connect timeout", "s", "5"},
+			{"proxy-read-timeout", "read timeout", "s", "60"},
+			{"proxy-send-timeout", "send timeout", "s", "60"},
+			{"proxy-next-upstream", "retry on", "", "error timeout"},
+			{"proxy-next-upstream-tries", "retries", "", "3"},
+			{"proxy-next-upstream-timeout", "retry budget", "s", "0 (unlimited)"},
+		},
+	},
+	{
+		name: "Contour", classHint: "contour", prefix: "projectcontour.io/",
+		annotations: []resilienceAnnotation{
+			{"response-timeout", "response timeout", "", "15s"},
+			{"retry-on", "retry on", "", "none"},
+			{"num-retries", "retries", "", "1"},
+			{"per-try-timeout", "per-try timeout", "", "response timeout"},
+		},
+	},
+	{
+		name: "Kong", classHint: "kong", prefix: "konghq.com/",
+		annotations: []resilienceAnnotation{
+			{"connect-timeout", "connect timeout", "ms", "60000"},
+			{"read-timeout", "read timeout", "ms", "60000"},
+			{"write-timeout", "write timeout", "ms", "60000"},
+			{"retries", "retries", "", "5"},
+		},
+	},
+	{
+		name: "HAProxy", classHint: "haproxy", prefix: "haproxy.org/",
+		annotations: []resilienceAnnotation{
+			{"timeout-connect", "connect timeout", "", "5s"},
+			{"timeout-server", "server timeout", "", "50s"},
+			{"timeout-queue", "queue timeout", "", "5s"},
+		},
+	},
+	{
+		name: "AWS Load Balancer Controller", classHint: "alb", prefix: "alb.ingress.kubernetes.io/",
+		annotations: []resilienceAnnotation{
+			{"load-balancer-attributes", "load balancer attributes", "", "idle_timeout.timeout_seconds=60"},
+		},
+	},
+}
+
+// ingressClassOf returns the class of an ingress, from the spec or the
+// legacy annotation
+func ingressClassOf(ing *networkingv1.Ingress) string {
+	if ing.Spec.IngressClassName != nil {
+		return *ing.Spec.IngressClassName
+	}
+	return ing.Annotations["kubernetes.io/ingress.class"]
+}
+
+// controllerFor picks the ingress controller of an ingress by its class, or
+// by the annotations it carries
+func controllerFor(ing *networkingv1.Ingress) *ingressController {
+	class := strings.ToLower(ingressClassOf(ing))
+	for i := range ingressControllers {
+		if class != "" && strings.Contains(class, ingressControllers[i].classHint) {
+			return &ingressControllers[i]
+		}
+	}
+	for i := range ingressControllers {
+		for key := range ing.Annotations {
+			if strings.HasPrefix(key, ingressControllers[i].prefix) {
+				return &ingressControllers[i]
+			}
+		}
+	}
+	return nil
+}
+
+// effectiveResilience formats the effective retry and timeout settings of an
+// ingress; values falling back to controller defaults are marked with *
+func effectiveResilience(ing *networkingv1.Ingress, controller *ingressController) string {
+	settings := []string{}
+	for _, ann := range controller.annotations {
+		value, ok := ing.Annotations[controller.prefix+ann.key]
+		if !ok {
+			settings = append(settings, fmt.Sprintf("%s %s*", ann.label, ann.defaultValue))
+			continue
+		}
+		if ann.unit != "" && !strings.HasSuffix(value, ann.unit) {
+			value += ann.unit
+		}
+		settings = append(settings, fmt.Sprintf("%s %s", ann.label, value))
+	}
+	return strings.Join(settings, ", ")
+}
+
+// showEdgeResilience shows the effective retry and timeout settings of every
+// ingress route, so the edge layer documents its resilience settings
+func (rm *ResourceMapper) showEdgeResilience(namespace string) error {
+	ingresses, err := rm.listIngresses(namespace)
+	if err != nil {
+		return err
+	}
+	if len(ingresses) == 0 {
+		return nil
+	}
+
+	fmt.Printf("\n%sEdge resilience settings in namespace: %s%s (* = controller default)\n", colorBlue, namespace, colorReset)
+	for i := range ingresses {
+		ing := &ingresses[i]
+		branch, indent := sym("├──"), sym("│   ")
+		if i == len(ingresses)-1 {
+			branch, indent = sym("└──"), "    "
+		}
+
+		controller := controllerFor(ing)
+		if controller == nil {
+			fmt.Printf("%s %s (controller unknown, no retry or timeout annotations recognized)\n", branch, ing.Name)
+			continue
+		}
+		fmt.Printf("%s %s (%s)\n", branch, ing.Name, controller.name)
+
+		// The annotations apply to the whole ingress, so every route shares them
+		settings := effectiveResilience(ing, controller)
+		for _, rule := range ing.Spec.Rules {
+			if rule.HTTP == nil {
+				continue
+			}
+			for _, path := range rule.HTTP.Paths {
+				if path.Backend.Service == nil {
+					continue
+				}
+				fmt.Printf("%s%s %s%s -> %s: %s\n", indent, rm.createArrow(4), rule.Host, path.Path,
+					path.Backend.Service.Name, settings)
+			}
+		}
+	}
+	return nil
+}
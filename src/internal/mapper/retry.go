@@ -0,0 +1,131 @@
+package mapper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Defaults of the API call retries and timeouts
+const (
+	defaultRequestTimeout = 30 * time.Second
+	defaultRetries        = 3
+)
+
+// Backoff between the attempts of an API call: it doubles from
+// retryBaseDelay up to retryMaxDelay, with up to half of it added as jitter
+const (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 10 * time.Second
+)
+
+// retryTransport gives each API call a timeout and retries the reads that
+// fail transiently (throttling, 5xx, network errors) with exponential
+// backoff, so that one flaky call does not fail the view or namespace it
+// belongs to. Responses with a Retry-After are left to client-go, which
+// waits and retries them itself. Retries take their turn with the rate
+// limiter and stop as soon as the context of the call is done
+type retryTransport struct {
+	next    http.RoundTripper
+	limiter *adaptiveRateLimiter
+	// timeout bounds each attempt, including reading the response body; zero
+	// for none
+	timeout time.Duration
+	// retries is the number of attempts after the first
+	retries int
+}
+
+func (t retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Watches are long-running by design, and only reads are safe to repeat
+	if req.URL.Query().Get("watch") == "true" {
+		return t.next.RoundTrip(req)
+	}
+	retries := t.retries
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		retries = 0
+	}
+	for attempt := 0; ; attempt++ {
+		resp, err := t.attempt(req)
+		if attempt == retries || req.Context().Err() != nil || !transient(resp, err) {
+			return resp, err
+		}
+		delay := backoff(attempt)
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		if err := t.limiter.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// attempt makes one attempt of an API call within the timeout
+func (t retryTransport) attempt(req *http.Request) (*http.Response, error) {
+	if t.timeout == 0 {
+		return t.next.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.next.RoundTrip(req.Clone(ctx))
+	if err != nil {
+		cancel()
+		if ctx.Err() == context.DeadlineExceeded && req.Context().Err() == nil {
+			err = fmt.Errorf("no response within %s: %v", t.timeout, err)
+		}
+		return nil, err
+	}
+	// The timeout covers the body too, so it ends when the body is closed
+	resp.Body = cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose releases the context of an attempt with its response body
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// transient reports whether an API call failed in a way worth retrying:
+// network errors and timeouts, throttling and server errors. Throttling and
+// server errors with a Retry-After are retried by client-go instead, which
+// honors the delay asked for
+func transient(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		_, retryAfter := retryAfterSeconds(resp)
+		return !retryAfter
+	}
+	return false
+}
+
+// retryAfterSeconds returns the delay in seconds a response asks for, the
+// only form of Retry-After client-go honors
+func retryAfterSeconds(resp *http.Response) (int, bool) {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	return seconds, err == nil && seconds >= 0
+}
+
+// backoff returns the delay before the next attempt, an exponential backoff
+// with jitter
+func backoff(attempt int) time.Duration {
+	delay := min(retryBaseDelay<<attempt, retryMaxDelay)
+	return delay + time.Duration(rand.Int63n(int64(delay)/2+1))
+}
@@ -0,0 +1,131 @@
+package mapper
+
+import (
+	"fmt"
+	"strconv"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// revisionAnnotation is set by the deployment controller on each ReplicaSet
+const revisionAnnotation = "deployment.kubernetes.io/revision"
+
+// podRevision is the deployment revision a pod belongs to
+type podRevision struct {
+	Deployment string
+	Revision   int
+	Current    bool
+}
+
+func (r podRevision) String() string {
+	if r.Current {
+		return fmt.Sprintf("new, revision %d", r.Revision)
+	}
+	return fmt.Sprintf("old, revision %d", r.Revision)
+}
+
+// revisionKey identifies the ReplicaSets of a deployment revision. The
+// pod-template-hash alone is shared by deployments with the same pod template
+type revisionKey struct {
+	deployment types.UID
+	hash       string
+}
+
+// podRevisions holds the deployment revisions of a namespace, and the
+// deployment owning each ReplicaSet to find the revision of a pod
+type podRevisions struct {
+	byHash      map[revisionKey]podRevision
+	deployments map[types.UID]types.UID
+}
+
+// revisionsByHash maps the owning deployment and pod-template-hash of every
+// ReplicaSet owned by a deployment to its revision, marking the latest
+// revision of each deployment as current
+func revisionsByHash(replicaSets []appsv1.ReplicaSet) podRevisions {
+	revisions := podRevisions{byHash: map[revisionKey]podRevision{}, deployments: map[types.UID]types.UID{}}
+	latest := map[types.UID]int{}
+	for i := range replicaSets {
+		rs := &replicaSets[i]
+		hash := rs.Labels[appsv1.DefaultDeploymentUniqueLabelKey]
+		owner := metav1.GetControllerOfNoCopy(rs)
+		if hash == "" || owner == nil || owner.Kind != "Deployment" {
+			continue
+		}
+		revision, err := strconv.Atoi(rs.Annotations[revisionAnnotation])
+		if err != nil {
+			continue
+		}
+		revisions.byHash[revisionKey{deployment: owner.UID, hash: hash}] = podRevision{Deployment: owner.Name, Revision: revision}
+		revisions.deployments[rs.UID] = owner.UID
+		if revision > latest[owner.UID] {
+			latest[owner.UID] = revision
+		}
+	}
+	for key, rev := range revisions.byHash {
+		rev.Current = rev.Revision == latest[key.deployment]
+		revisions.byHash[key] = rev
+	}
+	return revisions
+}
+
+// revisionOf returns the deployment revision of a pod, if it has one
+func revisionOf(pod *corev1.Pod, revisions podRevisions) (podRevision, bool) {
+	hash := pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]
+	owner := metav1.GetControllerOfNoCopy(pod)
+	if hash == "" || owner == nil || owner.Kind != "ReplicaSet" {
+		return podRevision{}, false
+	}
+	deployment, ok := revisions.deployments[owner.UID]
+	if !ok {
+		return podRevision{}, false
+	}
+	rev, ok := revisions.byHash[revisionKey{deployment: deployment, hash: hash}]
+	return rev, ok
+}
+
+// formatPodRevision formats the revision of a pod as a suffix for its name,
+// highlighting pods of old revisions
+func formatPodRevision(pod *corev1.Pod, revisions podRevisions) string {
+	rev, ok := revisionOf(pod, revisions)
+	switch {
+	case !ok:
+		return ""
+	case rev.Current:
+		return fmt.Sprintf(" %s(%s)%s", colorGreen, rev, colorReset)
+	}
+	return fmt.Sprintf(" %s(%s)%s", colorYellow, rev, colorReset)
+}
+
+// trafficMix summarizes, per deployment, how many of the pods behind a
+// service run the new and old revisions; only deployments mid-rollout are
+// included
+func trafficMix(pods []corev1.Pod, revisions podRevisions) []string {
+	newPods := map[string]int{}
+	oldPods := map[string]int{}
+	for i := range pods {
+		rev, ok := revisionOf(&pods[i], revisions)
+		if !ok {
+			continue
+		}
+		if rev.Current {
+			newPods[rev.Deployment]++
+		} else {
+			oldPods[rev.Deployment]++
+		}
+	}
+
+	mix := []string{}
+	for _, deploy := range sortedKeys(oldPods) {
+		if newPods[deploy] == 0 {
+			mix = append(mix, fmt.Sprintf("%s: all %d pods on an old revision", deploy, oldPods[deploy]))
+			continue
+		}
+		total := newPods[deploy] + oldPods[deploy]
+		mix = append(mix, fmt.Sprintf("%s: %d/%d pods new, %d/%d old (rollout in progress)",
+			deploy, newPods[deploy], total, oldPods[deploy], total))
+	}
+	return mix
+}
@@ -0,0 +1,84 @@
+package mapper
+
+import (
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// formatPreemption describes the preemption policy of a PriorityClass
+func formatPreemption(pc *schedulingv1.PriorityClass) string {
+	if pc.PreemptionPolicy == nil {
+		return "PreemptLowerPriority"
+	}
+	return string(*pc.PreemptionPolicy)
+}
+
+// showSchedulingClasses shows which PriorityClasses and RuntimeClasses the
+// workloads use, with their preemption policy and runtime handler
+func (rm *ResourceMapper) showSchedulingClasses(deployments []appsv1.Deployment) error {
+	priorityUsers := map[string][]string{}
+	runtimeUsers := map[string][]string{}
+	for _, deploy := range deployments {
+		spec := deploy.Spec.Template.Spec
+		if spec.PriorityClassName != "" {
+			priorityUsers[spec.PriorityClassName] = append(priorityUsers[spec.PriorityClassName], deploy.Name)
+		}
+		if spec.RuntimeClassName != nil && *spec.RuntimeClassName != "" {
+			runtimeUsers[*spec.RuntimeClassName] = append(runtimeUsers[*spec.RuntimeClassName], deploy.Name)
+		}
+	}
+	if len(priorityUsers) == 0 && len(runtimeUsers) == 0 {
+		return nil
+	}
+
+	fmt.Printf("\n%sScheduling classes:%s\n", colorYellow, colorReset)
+	lines := len(priorityUsers) + len(runtimeUsers)
+	printClass := func(title string, users []string) {
+		lines--
+		branch, indent := sym("├──"), sym("│   ")
+		if lines == 0 {
+			branch, indent = sym("└──"), "    "
+		}
+		fmt.Printf("%s %s\n", branch, title)
+		for _, user := range users {
+			fmt.Printf("%s%s Deployment: %s\n", indent, rm.createArrow(4), user)
+		}
+	}
+
+	for _, name := range sortedKeys(priorityUsers) {
+		pc, err := rm.clientset.SchedulingV1().PriorityClasses().Get(rm.ctx, name, metav1.GetOptions{})
+		if err != nil {
+			printClass(fmt.Sprintf("PriorityClass: %s %s(not found: pods will be rejected)%s", name, colorRed, colorReset), priorityUsers[name])
+			continue
+		}
+		title := fmt.Sprintf("PriorityClass: %s (value %d, preemption %s)", name, pc.Value, formatPreemption(pc))
+		if pc.GlobalDefault {
+			title += " [global default]"
+		}
+		printClass(title, priorityUsers[name])
+	}
+
+	for _, name := range sortedKeys(runtimeUsers) {
+		rc, err := rm.clientset.NodeV1().RuntimeClasses().Get(rm.ctx, name, metav1.GetOptions{})
+		if err != nil {
+			printClass(fmt.Sprintf("RuntimeClass: %s %s(not found: pods will be rejected)%s", name, colorRed, colorReset), runtimeUsers[name])
+			continue
+		}
+		title := fmt.Sprintf("RuntimeClass: %s (handler %s", name, rc.Handler)
+		if rc.Overhead != nil && len(rc.Overhead.PodFixed) > 0 {
+			overhead := []string{}
+			for _, resName := range sortedKeys(rc.Overhead.PodFixed) {
+				qty := rc.Overhead.PodFixed[resName]
+				overhead = append(overhead, string(resName)+"="+qty.String())
+			}
+			title += ", overhead " + strings.Join(overhead, ",")
+		}
+		printClass(title+")", runtimeUsers[name])
+	}
+
+	return nil
+}
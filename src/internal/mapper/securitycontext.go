@@ -0,0 +1,324 @@
+package mapper
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"os"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// securityAttributes are the columns of the security context matrix
+var securityAttributes = []string{"runAsNonRoot", "readOnlyRootFilesystem", "capabilitiesDropped", "seccomp"}
+
+// Cell values of the security context matrix: whether every container, some
+// of them or none has the attribute
+const (
+	securityYes     = "yes"
+	securityPartial = "partial"
+	securityNo      = "no"
+)
+
+// securityRow is a workload of the security context matrix
+type securityRow struct {
+	Namespace string
+	Kind      string
+	Name      string
+	Values    map[string]string
+}
+
+// containerSecurity reports which matrix attributes a container has, taking
+// the pod security context into account where the container may inherit it
+func containerSecurity(pod *corev1.PodSecurityContext, sc *corev1.SecurityContext) map[string]bool {
+	has := map[string]bool{}
+
+	nonRoot := pod != nil && pod.RunAsNonRoot != nil && *pod.RunAsNonRoot
+	if sc != nil && sc.RunAsNonRoot != nil {
+		nonRoot = *sc.RunAsNonRoot
+	}
+	has["runAsNonRoot"] = nonRoot
+
+	has["readOnlyRootFilesystem"] = sc != nil && sc.ReadOnlyRootFilesystem != nil && *sc.ReadOnlyRootFilesystem
+
+	if sc != nil && sc.Capabilities != nil {
+		for _, capability := range sc.Capabilities.Drop {
+			if capability == "ALL" {
+				has["capabilitiesDropped"] = true
+			}
+		}
+	}
+
+	var profile *corev1.SeccompProfile
+	if pod != nil {
+		profile = pod.SeccompProfile
+	}
+	if sc != nil && sc.SeccompProfile != nil {
+		profile = sc.SeccompProfile
+	}
+	has["seccomp"] = profile != nil && profile.Type != corev1.SeccompProfileTypeUnconfined
+	return has
+}
+
+// podSecurityValues fills the matrix cells of a pod template, counting init
+// and app containers alike
+func podSecurityValues(spec *corev1.PodSpec) map[string]string {
+	containers := append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...)
+	counts := map[string]int{}
+	for _, container := range containers {
+		for attr, ok := range containerSecurity(spec.SecurityContext, container.SecurityContext) {
+			if ok {
+				counts[attr]++
+			}
+		}
+	}
+
+	values := map[string]string{}
+	for _, attr := range securityAttributes {
+		switch counts[attr] {
+		case len(containers):
+			values[attr] = securityYes
+		case 0:
+			values[attr] = securityNo
+		default:
+			values[attr] = securityPartial
+		}
+	}
+	return values
+}
+
+// securityMatrix lists the workloads of a namespace with the security
+// context attributes of their pod templates. Pods without an owner and
+// static pods are listed too, as nothing else describes them
+func (rm *ResourceMapper) securityMatrix(namespace string) ([]securityRow, error) {
+	rows := []securityRow{}
+	add := func(kind string, meta metav1.ObjectMeta, spec *corev1.PodSpec) {
+		rows = append(rows, securityRow{Namespace: namespace, Kind: kind, Name: meta.Name, Values: podSecurityValues(spec)})
+	}
+
+	deployments, err := rm.listDeployments(namespace)
+	if err != nil {
+		return nil, err
+	}
+	for i := range deployments {
+		add("Deployment", deployments[i].ObjectMeta, &deployments[i].Spec.Template.Spec)
+	}
+	statefulSets, err := rm.listStatefulSets(namespace)
+	if err != nil {
+		return nil, err
+	}
+	for i := range statefulSets {
+		add("StatefulSet", statefulSets[i].ObjectMeta, &statefulSets[i].Spec.Template.Spec)
+	}
+	daemonSets, err := rm.listDaemonSets(namespace)
+	if err != nil {
+		return nil, err
+	}
+	for i := range daemonSets {
+		add("DaemonSet", daemonSets[i].ObjectMeta, &daemonSets[i].Spec.Template.Spec)
+	}
+	cronJobs, err := rm.listCronJobs(namespace)
+	if err != nil {
+		return nil, err
+	}
+	for i := range cronJobs {
+		add("CronJob", cronJobs[i].ObjectMeta, &cronJobs[i].Spec.JobTemplate.Spec.Template.Spec)
+	}
+	pods, err := rm.listPods(namespace)
+	if err != nil {
+		return nil, err
+	}
+	for i := range pods {
+		switch {
+		case isMirrorPod(&pods[i]):
+			add("StaticPod", pods[i].ObjectMeta, &pods[i].Spec)
+		case len(pods[i].OwnerReferences) == 0:
+			add("Pod", pods[i].ObjectMeta, &pods[i].Spec)
+		}
+	}
+	return rows, nil
+}
+
+// printSecurityMatrix prints the matrix of a namespace as a table
+func (rm *ResourceMapper) printSecurityMatrix(namespace string, rows []securityRow) {
+	fmt.Printf("\n%sSecurity contexts in namespace: %s%s\n", colorCyan, namespace, colorReset)
+	if len(rows) == 0 {
+		fmt.Printf(sym("└── No workloads\n"))
+		return
+	}
+	width := len("Workload")
+	for _, row := range rows {
+		if n := len(row.Kind) + 1 + len(row.Name); n > width {
+			width = n
+		}
+	}
+	fmt.Printf("%-*s", width+2, "Workload")
+	for _, attr := range securityAttributes {
+		fmt.Printf("  %-*s", len(attr), attr)
+	}
+	fmt.Println()
+	for _, row := range rows {
+		fmt.Printf("%-*s", width+2, row.Kind+"/"+row.Name)
+		for _, attr := range securityAttributes {
+			color := colorGreen
+			switch row.Values[attr] {
+			case securityPartial:
+				color = colorYellow
+			case securityNo:
+				color = colorRed
+			}
+			fmt.Printf("  %s%-*s%s", color, len(attr), row.Values[attr], colorReset)
+		}
+		fmt.Println()
+	}
+}
+
+// securityMatrixCSV renders the matrix as CSV, one line per workload
+func securityMatrixCSV(rows []securityRow) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(append([]string{"namespace", "kind", "name"}, securityAttributes...))
+	for _, row := range rows {
+		record := []string{row.Namespace, row.Kind, row.Name}
+		for _, attr := range securityAttributes {
+			record = append(record, row.Values[attr])
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("error encoding CSV: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+var securityMatrixTemplate = template.Must(template.New("security").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Pod security context matrix: {{.Host}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+th { background: #f0f0f0; }
+td.yes { background: #e6ffed; }
+td.partial { background: #fff5b1; }
+td.no { background: #ffeef0; }
+</style>
+</head>
+<body>
+<h1>Pod security context matrix</h1>
+<p>Cluster {{.Host}} &middot; generated {{.Generated}}</p>
+{{range .Namespaces}}
+<h2>{{.Name}}</h2>
+<table>
+<tr><th>Kind</th><th>Name</th>{{range $.Attributes}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}
+<tr><td>{{.Kind}}</td><td>{{.Name}}</td>{{range .Cells}}<td class="{{.}}">{{.}}</td>{{end}}</tr>
+{{end}}
+</table>
+{{end}}
+</body>
+</html>
+`))
+
+// securityMatrixHTML renders the matrix as an HTML report with a table per
+// namespace
+func securityMatrixHTML(host string, rows []securityRow) ([]byte, error) {
+	type htmlRow struct {
+		Kind, Name string
+		Cells      []string
+	}
+	type htmlNamespace struct {
+		Name string
+		Rows []htmlRow
+	}
+	var namespaces []htmlNamespace
+	for _, row := range rows {
+		if len(namespaces) == 0 || namespaces[len(namespaces)-1].Name != row.Namespace {
+			namespaces = append(namespaces, htmlNamespace{Name: row.Namespace})
+		}
+		cells := []string{}
+		for _, attr := range securityAttributes {
+			cells = append(cells, row.Values[attr])
+		}
+		ns := &namespaces[len(namespaces)-1]
+		ns.Rows = append(ns.Rows, htmlRow{Kind: row.Kind, Name: row.Name, Cells: cells})
+	}
+
+	var buf bytes.Buffer
+	err := securityMatrixTemplate.Execute(&buf, map[string]interface{}{
+		"Host":       host,
+		"Generated":  time.Now().Format(time.RFC3339),
+		"Attributes": securityAttributes,
+		"Namespaces": namespaces,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error rendering report: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// runSecurityMatrix runs the security-matrix subcommand: tabulates the
+// security context of every workload, in the terminal or as CSV or HTML
+// audit evidence
+func runSecurityMatrix(args []string) error {
+	var global globalFlags
+	fs := newSubcommandFlagSet("security-matrix", &global)
+	format := fs.String("format", "text", "Output format: text, csv or html")
+	output := fs.String("output", "", "File the csv or html matrix is written to, - for stdout (default: security-matrix.<format>)")
+	fs.Parse(args)
+
+	if *format != "text" && *format != "csv" && *format != "html" {
+		return fmt.Errorf("invalid --format value '%s' (expected text, csv or html)", *format)
+	}
+	rm, err := global.newResourceMapper()
+	if err != nil {
+		return err
+	}
+	namespaces, err := global.namespaces(rm)
+	if err != nil {
+		return err
+	}
+
+	var rows []securityRow
+	for _, ns := range namespaces {
+		nsRows, err := rm.securityMatrix(ns)
+		if err != nil {
+			return fmt.Errorf("error checking namespace %s: %v", ns, err)
+		}
+		if *format == "text" {
+			rm.printSecurityMatrix(ns, nsRows)
+		}
+		rows = append(rows, nsRows...)
+	}
+	if *format == "text" {
+		return nil
+	}
+
+	var data []byte
+	if *format == "csv" {
+		data, err = securityMatrixCSV(rows)
+	} else {
+		data, err = securityMatrixHTML(rm.host, rows)
+	}
+	if err != nil {
+		return err
+	}
+	if *output == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if *output == "" {
+		*output = "security-matrix." + *format
+	}
+	if err := writeFile(*output, data); err != nil {
+		return err
+	}
+	fmt.Printf("%sSecurity context matrix of %d workload(s) written to %s%s\n", colorGreen, len(rows), *output, colorReset)
+	return nil
+}
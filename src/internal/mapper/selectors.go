@@ -0,0 +1,91 @@
+package mapper
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// typeFields are the fields the API server selects on beyond metadata.name
+// and metadata.namespace, which every type supports, with the type they
+// belong to, named as in the errors of the processor cache
+var typeFields = map[string]string{
+	"status.phase":             "pods",
+	"status.podIP":             "pods",
+	"status.nominatedNodeName": "pods",
+	"spec.nodeName":            "pods",
+	"spec.restartPolicy":       "pods",
+	"spec.schedulerName":       "pods",
+	"spec.serviceAccountName":  "pods",
+	"type":                     "secrets",
+}
+
+// clusterScoped are the cluster-scoped types listed through the shared
+// helper. The selectors pick the objects of the mapped applications, so they
+// do not apply to the nodes, namespaces and webhooks those run on
+var clusterScoped = map[string]bool{
+	"nodes":                             true,
+	"namespaces":                        true,
+	"mutating webhook configurations":   true,
+	"validating webhook configurations": true,
+}
+
+// setSelectors restricts the lists of the mapped namespaces to the objects
+// matching a label selector and a field selector, both optional. Fields of a
+// single type, such as the phase of pods, only select among objects of that
+// type
+func (rm *ResourceMapper) setSelectors(labelSelector, fieldSelector string) error {
+	if _, err := labels.Parse(labelSelector); err != nil {
+		return fmt.Errorf("error parsing --selector: %v", err)
+	}
+	selector, err := fields.ParseSelector(fieldSelector)
+	if err != nil {
+		return fmt.Errorf("error parsing --field-selector: %v", err)
+	}
+	for _, req := range selector.Requirements() {
+		if req.Field == "metadata.name" || req.Field == "metadata.namespace" {
+			continue
+		}
+		if _, ok := typeFields[req.Field]; !ok {
+			return fmt.Errorf("--field-selector: field %s cannot be selected on, use metadata.name, metadata.namespace, %s",
+				req.Field, strings.Join(sortedKeys(typeFields), ", "))
+		}
+	}
+	rm.labelSelector, rm.fieldSelector = labelSelector, selector
+	return nil
+}
+
+// listOptions returns the options listing a type in the mapped namespaces,
+// with the selectors that apply to it. The empty type gets those applying to
+// every type, and cluster-scoped types none
+func (rm *ResourceMapper) listOptions(what string) metav1.ListOptions {
+	if clusterScoped[what] {
+		return metav1.ListOptions{}
+	}
+	opts := metav1.ListOptions{LabelSelector: rm.labelSelector}
+	if rm.fieldSelector == nil {
+		return opts
+	}
+	var terms []string
+	for _, req := range rm.fieldSelector.Requirements() {
+		if only, ok := typeFields[req.Field]; ok && only != what {
+			continue
+		}
+		op := "="
+		if req.Operator == selection.NotEquals {
+			op = "!="
+		}
+		terms = append(terms, req.Field+op+fields.EscapeValue(req.Value))
+	}
+	opts.FieldSelector = strings.Join(terms, ",")
+	return opts
+}
+
+// selecting reports whether the lists are restricted by selectors
+func (rm *ResourceMapper) selecting() bool {
+	return rm.labelSelector != "" || (rm.fieldSelector != nil && !rm.fieldSelector.Empty())
+}
@@ -0,0 +1,83 @@
+package mapper
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestClusterListsSelectors(t *testing.T) {
+	web := map[string]string{"app": "web"}
+	other := testPod("db-1", map[string]string{"app": "db"}, corev1.PodSpec{})
+	remote := testPod("web-2", web, corev1.PodSpec{})
+	remote.Namespace = "ops"
+	rm := testMapper(
+		testPod("web-1", web, corev1.PodSpec{}), other, remote,
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ops"}},
+	)
+	if err := rm.setSelectors("app=web", ""); err != nil {
+		t.Fatalf("setSelectors: %v", err)
+	}
+
+	pods, err := rm.listAllPods()
+	if err != nil {
+		t.Fatalf("listAllPods: %v", err)
+	}
+	names := []string{}
+	for _, pod := range pods {
+		names = append(names, pod.Namespace+"/"+pod.Name)
+	}
+	sort.Strings(names)
+	if want := []string{"ops/web-2", "shop/web-1"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("pods = %q, want %q", names, want)
+	}
+
+	// Cluster-scoped types are not filtered, so the app selector keeps them
+	nodes, err := rm.listNodes()
+	if err != nil {
+		t.Fatalf("listNodes: %v", err)
+	}
+	if len(nodes) != 2 {
+		t.Errorf("nodes = %d, want 2", len(nodes))
+	}
+	namespaces, err := rm.listNamespaces()
+	if err != nil {
+		t.Fatalf("listNamespaces: %v", err)
+	}
+	if len(namespaces) != 2 {
+		t.Errorf("namespaces = %d, want 2", len(namespaces))
+	}
+
+	// Later calls read the cache
+	if err := rm.clientset.CoreV1().Nodes().Delete(rm.ctx, "node-2", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if nodes, _ := rm.listNodes(); len(nodes) != 2 {
+		t.Errorf("cached nodes = %d, want 2", len(nodes))
+	}
+}
+
+func TestClusterListsCapped(t *testing.T) {
+	rm := testMapper(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}},
+	)
+	rm.maxResources = 1
+	nodes, err := rm.listNodes()
+	if err != nil {
+		t.Fatalf("listNodes: %v", err)
+	}
+	if len(nodes) != 1 {
+		t.Errorf("nodes = %d, want 1", len(nodes))
+	}
+	want := []Truncation{{Source: "nodes", Listed: 1, Total: 2}}
+	if got := rm.truncatedIn(""); !reflect.DeepEqual(got, want) {
+		t.Errorf("truncations = %+v, want %+v", got, want)
+	}
+}
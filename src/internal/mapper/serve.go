@@ -0,0 +1,390 @@
+package mapper
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+	corev1 "k8s.io/api/core/v1"
+)
+
+//go:embed web/index.html
+var indexHTML []byte
+
+// graphServer serves the latest mapped graphs of a set of namespaces
+type graphServer struct {
+	rm        *ResourceMapper
+	namespace string
+	excludeNs []string
+
+	mu     sync.RWMutex
+	graphs map[string]*Graph
+	// aliases are the kind aliases of the last refresh, resolving the kinds
+	// of API requests without discovery in the handlers
+	aliases map[string]string
+	updated time.Time
+	lastErr error
+	// duration is how long the last successful refresh took, failures the
+	// number of refreshes that failed
+	duration time.Duration
+	failures int
+
+	stream graphStream
+
+	// policies tracks policy violations across refreshes, nil without --policies
+	policies *policyTracker
+
+	// spikes tracks warning-event rates per workload, nil when disabled
+	spikes *eventSpikeTracker
+
+	// notifier posts notable graph changes to a webhook, nil without --notify
+	notifier *changeNotifier
+
+	// deny rejects admission requests with warnings instead of admitting them
+	deny bool
+
+	// watch keeps the graphs up to date with watches between refreshes
+	watch bool
+}
+
+// refresh maps every namespace again and swaps in the new graphs
+func (s *graphServer) refresh() (err error) {
+	// Follow kubeconfig changes, keeping the current clients when the new
+	// kubeconfig cannot be used
+	if err := s.rm.reloadClients(); err != nil {
+		fmt.Printf("%sError reloading kubeconfig, still mapping %s: %v%s\n", colorRed, s.rm.host, err, colorReset)
+	}
+	if s.watch && (s.rm.watcher == nil || s.rm.watcher.clientset != s.rm.clientset) {
+		s.restartWatches()
+	}
+	start := time.Now()
+	ctx, end := startSpan(s.rm.ctx, "refresh")
+	defer func() { end(err) }()
+	// Nodes and namespaces are listed again too
+	s.rm.clusterCache = nil
+	namespaces, err := s.rm.resolveNamespaces(s.namespace, s.excludeNs)
+	if err != nil {
+		return err
+	}
+
+	graphs := map[string]*Graph{}
+	warnings := map[string][]corev1.Event{}
+	for _, ns := range namespaces {
+		// Drop cached objects so every refresh sees the current state
+		s.rm.cache = nil
+		g, err := s.rm.buildGraph(ctx, ns)
+		if err != nil {
+			return fmt.Errorf("error mapping namespace %s: %v", ns, err)
+		}
+		// Indexed here, as the handlers share the graph once published
+		g.indexed()
+		graphs[ns] = g
+		if s.spikes != nil {
+			// Events missing for a namespace only pause its spike detection
+			if warnings[ns], err = s.rm.listWarningEvents(ns); err != nil {
+				fmt.Printf("%sError listing warning events in namespace %s: %v%s\n", colorRed, ns, err, colorReset)
+			}
+		}
+	}
+	s.publish(graphs, warnings, start)
+	return nil
+}
+
+// refreshChanged maps again the namespaces whose watched objects changed,
+// keeping the graphs of the others. Namespaces not mapped yet are left to
+// the next refresh, which also lists the types that are not watched
+func (s *graphServer) refreshChanged(namespaces []string) (err error) {
+	start := time.Now()
+	ctx, end := startSpan(s.rm.ctx, "refreshChanged")
+	defer func() { end(err) }()
+	// Only the refresh loop replaces the graphs, so they are read unlocked
+	graphs := make(map[string]*Graph, len(s.graphs))
+	for ns, g := range s.graphs {
+		graphs[ns] = g
+	}
+	changed := false
+	s.rm.clusterCache = nil
+	for _, ns := range namespaces {
+		if graphs[ns] == nil {
+			continue
+		}
+		s.rm.cache = nil
+		g, err := s.rm.buildGraph(ctx, ns)
+		if err != nil {
+			return fmt.Errorf("error mapping namespace %s: %v", ns, err)
+		}
+		g.indexed()
+		graphs[ns] = g
+		changed = true
+	}
+	if changed {
+		s.publish(graphs, nil, start)
+	}
+	return nil
+}
+
+// publish swaps in new graphs, streaming and notifying what changed. Warning
+// events, listed by full refreshes only, feed the spike detection
+func (s *graphServer) publish(graphs map[string]*Graph, warnings map[string][]corev1.Event, start time.Time) {
+	if s.policies != nil {
+		s.policies.check(graphs)
+	}
+	// Discovered here, as a kubeconfig reload forgets them
+	aliases := s.rm.kindAliases()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []graphEvent
+	for _, ns := range sortedKeys(graphs) {
+		events = append(events, diffGraphs(ns, s.graphs[ns], graphs[ns])...)
+	}
+	for _, ns := range sortedKeys(s.graphs) {
+		if graphs[ns] == nil {
+			events = append(events, diffGraphs(ns, s.graphs[ns], nil)...)
+		}
+	}
+	if s.notifier != nil && s.graphs != nil {
+		// Notifications are posted in the background so a slow webhook never
+		// delays the next refresh
+		changes := notableChanges(s.graphs, graphs)
+		go func() {
+			if err := s.notifier.notify(s.rm.host, changes); err != nil {
+				fmt.Printf("%sError sending change notification: %v%s\n", colorRed, err, colorReset)
+			}
+		}()
+	}
+	s.graphs = graphs
+	s.aliases = aliases
+	s.updated = time.Now()
+	s.duration = s.updated.Sub(start)
+	if s.spikes != nil && warnings != nil {
+		s.spikes.check(s.updated, graphs, warnings, events)
+	}
+	s.stream.publish(events)
+}
+
+// restartWatches starts watching with the current clients, replacing the
+// watches of earlier ones. Without watches, every type is listed on each
+// refresh as before
+func (s *graphServer) restartWatches() {
+	if s.rm.watcher != nil {
+		s.rm.watcher.close()
+		s.rm.watcher = nil
+	}
+	watcher, err := s.rm.startWatches(s.namespace)
+	if err != nil {
+		fmt.Printf("%sError watching %s, listing on each refresh instead: %v%s\n", colorRed, s.rm.host, err, colorReset)
+		return
+	}
+	s.rm.watcher = watcher
+}
+
+// refreshLoop refreshes the graphs periodically, keeping the last good
+// graphs when a refresh fails
+func (s *graphServer) refreshLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	changes := watchKubeconfig(s.rm.kubeconfig, s.rm.kubeconfigSum)
+	for {
+		// A kubeconfig change, such as a context switch, refreshes right away,
+		// and watched changes remap their namespaces
+		var watched <-chan struct{}
+		if s.rm.watcher != nil {
+			watched = s.rm.watcher.changed
+		}
+		var err error
+		select {
+		case <-ticker.C:
+			err = s.refresh()
+		case <-changes:
+			err = s.refresh()
+		case <-watched:
+			// Let a burst of changes, such as a rollout, settle first
+			time.Sleep(watchDebounce)
+			err = s.refreshChanged(s.rm.watcher.takeDirty())
+		}
+		s.mu.Lock()
+		s.lastErr = err
+		if err != nil {
+			s.failures++
+		}
+		s.mu.Unlock()
+		if err != nil {
+			fmt.Printf("%sError refreshing graph: %v%s\n", colorRed, err, colorReset)
+		}
+	}
+}
+
+// graphResponse is the JSON document served to the web UI
+type graphResponse struct {
+	Namespaces    []string       `json:"namespaces"`
+	Updated       time.Time      `json:"updated"`
+	Error         string         `json:"error,omitempty"`
+	Resources     []Resource     `json:"resources"`
+	Relationships []Relationship `json:"relationships"`
+	// Layers gives the topological layer of each resource by kind/namespace/name,
+	// which the web UI lays resources out by
+	Layers map[string]int `json:"layers"`
+}
+
+// handleGraph serves the merged graph of all namespaces, or of the one given
+// by the namespace query parameter
+func (s *graphServer) handleGraph(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	resp := graphResponse{
+		Namespaces:    sortedKeys(s.graphs),
+		Updated:       s.updated,
+		Resources:     []Resource{},
+		Relationships: []Relationship{},
+	}
+	if s.lastErr != nil {
+		resp.Error = s.lastErr.Error()
+	}
+	filter := r.URL.Query().Get("namespace")
+	if filter != "" {
+		if _, ok := s.graphs[filter]; !ok {
+			http.Error(w, fmt.Sprintf("namespace %s is not mapped", filter), http.StatusNotFound)
+			return
+		}
+	}
+	// Merged, cluster-scoped resources such as nodes appear once
+	selected := map[string]*Graph{}
+	for _, ns := range resp.Namespaces {
+		if filter == "" || ns == filter {
+			selected[ns] = s.graphs[ns]
+		}
+	}
+	merged := mergeGraphs(selected)
+	resp.Resources = append(resp.Resources, merged.Resources...)
+	resp.Relationships = append(resp.Relationships, merged.Relationships...)
+	sort.SliceStable(resp.Resources, func(i, j int) bool {
+		return resp.Resources[i].Key().String() < resp.Resources[j].Key().String()
+	})
+	resp.Layers = map[string]int{}
+	for layer, keys := range merged.TopologicalLayers() {
+		for _, key := range keys {
+			resp.Layers[key.String()] = layer
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		fmt.Printf("%sError writing graph response: %v%s\n", colorRed, err, colorReset)
+	}
+}
+
+// handleIndex serves the web UI
+func (s *graphServer) handleIndex(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(indexHTML)
+}
+
+// runServe runs the serve subcommand: an HTTP server exposing the resource
+// graph as a read-only, browsable topology dashboard
+func runServe(args []string) error {
+	var global globalFlags
+	fs := newSubcommandFlagSet("serve", &global)
+	addr := fs.String("addr", ":8080", "Address to listen on")
+	refresh := fs.Duration("refresh", time.Minute, "Interval between graph refreshes")
+	watch := fs.Bool("watch", false, "Watch the cluster and remap namespaces as their objects change, instead of only on each refresh")
+	tlsCert := fs.String("tls-cert", "", "TLS certificate file; admission webhooks must be served over HTTPS")
+	tlsKey := fs.String("tls-key", "", "TLS private key file")
+	deny := fs.Bool("deny", false, "Reject admission requests with warnings instead of admitting them")
+	policiesPath := fs.String("policies", "", "YAML file of policies evaluated on every refresh")
+	rulesPath := fs.String("audit-rules", "", "YAML file configuring the built-in rules whose findings are attached to the graph")
+	spikeFactor := fs.Float64("event-spike-factor", 4, "Flag workloads whose warning-event rate reaches this multiple of their baseline (0 disables)")
+	spikeMin := fs.Int("event-spike-min", 5, "Warning events a workload must see within one refresh to be flagged")
+	var alerts stringSliceFlag
+	fs.Var(&alerts, "policy-alert", "Send firing policy violations to a findings exporter, as for audit --export-findings (repeatable)")
+	notify := addNotifyFlags(fs)
+	pprofAddr := addPprofFlag(fs)
+	fs.Parse(args)
+
+	if *refresh <= 0 {
+		return fmt.Errorf("--refresh must be positive")
+	}
+	if *spikeFactor < 0 || *spikeMin < 1 {
+		return fmt.Errorf("--event-spike-factor may not be negative and --event-spike-min must be positive")
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		return fmt.Errorf("--tls-cert and --tls-key must be given together")
+	}
+
+	if len(alerts) > 0 && *policiesPath == "" {
+		return fmt.Errorf("--policy-alert requires --policies")
+	}
+	for _, spec := range alerts {
+		if _, err := newExporter(spec); err != nil {
+			return err
+		}
+	}
+
+	notifier, err := notify.notifier()
+	if err != nil {
+		return err
+	}
+
+	rm, err := global.newResourceMapper()
+	if err != nil {
+		return err
+	}
+	if *rulesPath != "" {
+		if rm.rules, err = loadAuditRules(*rulesPath); err != nil {
+			return err
+		}
+	}
+
+	if err := startPprof(*pprofAddr); err != nil {
+		return err
+	}
+
+	server := &graphServer{rm: rm, namespace: global.namespace, excludeNs: global.excludeNs, deny: *deny, notifier: notifier, watch: *watch}
+	if *policiesPath != "" {
+		policies, err := loadPolicies(*policiesPath)
+		if err != nil {
+			return err
+		}
+		rm.resolvePolicyKinds(policies)
+		server.policies = &policyTracker{policies: policies, alerts: alerts}
+	}
+	if *spikeFactor > 0 {
+		server.spikes = newEventSpikeTracker(*spikeFactor, *spikeMin)
+	}
+	fmt.Printf("%sMapping cluster %s...%s\n", colorGreen, rm.host, colorReset)
+	if err := server.refresh(); err != nil {
+		return err
+	}
+	go server.refreshLoop(*refresh)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", server.handleIndex)
+	mux.HandleFunc("GET /graph.json", server.handleGraph)
+	mux.HandleFunc("GET /metrics", server.handleMetrics)
+	server.registerAPI(mux)
+	if server.policies != nil {
+		mux.HandleFunc("GET /api/v1/policies", server.policies.handleAPIPolicies)
+	}
+	if server.spikes != nil {
+		mux.HandleFunc("GET /api/v1/anomalies", server.spikes.handleAPIAnomalies)
+	}
+	server.registerGrafana(mux)
+	mux.Handle("GET /api/v1/stream", websocket.Handler(server.handleStream))
+	mux.HandleFunc("POST /admission/validate", server.handleAdmission)
+
+	mode := ""
+	if *watch {
+		mode = ", watching changes"
+	}
+	fmt.Printf("%sServing resource map on %s (refresh every %s%s)%s\n", colorGreen, *addr, *refresh, mode, colorReset)
+	if *tlsCert != "" {
+		return http.ListenAndServeTLS(*addr, *tlsCert, *tlsKey, mux)
+	}
+	return http.ListenAndServe(*addr, mux)
+}
@@ -0,0 +1,153 @@
+package mapper
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+)
+
+// externalKind is the graph kind of targets outside the cluster, such as the
+// DNS name of an ExternalName service or a manually managed endpoint address
+const externalKind = "External"
+
+// serviceBackend is one backend of a service without a selector, taken from
+// its manually managed EndpointSlices
+type serviceBackend struct {
+	Pod     string
+	Address string
+}
+
+func (b serviceBackend) String() string {
+	if b.Pod != "" {
+		return "Pod: " + b.Pod
+	}
+	return "Endpoint: " + b.Address
+}
+
+// endpointSliceBackends returns the backends listed in the EndpointSlices of a service
+func endpointSliceBackends(slices []discoveryv1.EndpointSlice, service string) []serviceBackend {
+	backends := []serviceBackend{}
+	seen := map[serviceBackend]bool{}
+	for _, slice := range slices {
+		if slice.Labels[discoveryv1.LabelServiceName] != service {
+			continue
+		}
+		for _, endpoint := range slice.Endpoints {
+			for _, address := range endpoint.Addresses {
+				backend := serviceBackend{Address: address}
+				if endpoint.TargetRef != nil && endpoint.TargetRef.Kind == "Pod" {
+					backend = serviceBackend{Pod: endpoint.TargetRef.Name}
+				}
+				if !seen[backend] {
+					seen[backend] = true
+					backends = append(backends, backend)
+				}
+			}
+		}
+	}
+	return backends
+}
+
+// selectorlessBackends reads the manually managed endpoints of a service
+// without a selector
+func (rm *ResourceMapper) selectorlessBackends(namespace, service string) ([]serviceBackend, error) {
+	slices, err := rm.listEndpointSlices(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return endpointSliceBackends(slices, service), nil
+}
+
+// isHeadless reports whether a service has no cluster IP, so that its DNS
+// name resolves to the addresses of its pods
+func isHeadless(svc *corev1.Service) bool {
+	return svc.Spec.ClusterIP == corev1.ClusterIPNone
+}
+
+// serviceDNSName returns the cluster DNS name of a service
+func serviceDNSName(namespace, service, domain string) string {
+	return fmt.Sprintf("%s.%s.svc.%s", service, namespace, domain)
+}
+
+// statefulSetDNSNames returns the stable per-pod DNS names the governing
+// headless service gives to the pods of a StatefulSet
+func statefulSetDNSNames(sts *appsv1.StatefulSet, domain string) []string {
+	replicas := int32(1)
+	if sts.Spec.Replicas != nil {
+		replicas = *sts.Spec.Replicas
+	}
+	start := int32(0)
+	if sts.Spec.Ordinals != nil {
+		start = sts.Spec.Ordinals.Start
+	}
+
+	names := make([]string, 0, replicas)
+	for ordinal := start; ordinal < start+replicas; ordinal++ {
+		pod := fmt.Sprintf("%s-%d", sts.Name, ordinal)
+		names = append(names, pod+"."+serviceDNSName(sts.Namespace, sts.Spec.ServiceName, domain))
+	}
+	return names
+}
+
+// showHeadlessServices shows the headless services of a namespace with the
+// StatefulSets they govern and the stable DNS names of their pods
+func (rm *ResourceMapper) showHeadlessServices(namespace string) error {
+	services, err := rm.listServices(namespace)
+	if err != nil {
+		return err
+	}
+	statefulSets, err := rm.listStatefulSets(namespace)
+	if err != nil {
+		return err
+	}
+
+	headless := map[string]bool{}
+	for i := range services {
+		if isHeadless(&services[i]) {
+			headless[services[i].Name] = true
+		}
+	}
+	governed := map[string][]appsv1.StatefulSet{}
+	orphaned := []appsv1.StatefulSet{}
+	for _, sts := range statefulSets {
+		if headless[sts.Spec.ServiceName] {
+			governed[sts.Spec.ServiceName] = append(governed[sts.Spec.ServiceName], sts)
+		} else {
+			orphaned = append(orphaned, sts)
+		}
+	}
+	if len(headless) == 0 && len(orphaned) == 0 {
+		return nil
+	}
+
+	fmt.Printf("\n%sHeadless services in namespace: %s%s\n", colorBlue, namespace, colorReset)
+	names := sortedKeys(headless)
+	for i, name := range names {
+		branch, indent := sym("├──"), sym("│   ")
+		if i == len(names)-1 && len(orphaned) == 0 {
+			branch, indent = sym("└──"), "    "
+		}
+		fmt.Printf("%s %s (%s)\n", branch, name, serviceDNSName(namespace, name, rm.clusterDomain))
+		if len(governed[name]) == 0 {
+			fmt.Printf("%s%s Resolves to the ready pod addresses (no StatefulSet)\n", indent, rm.createArrow(4))
+			continue
+		}
+		for _, sts := range governed[name] {
+			fmt.Printf("%s%s StatefulSet: %s\n", indent, rm.createArrow(4), sts.Name)
+			for _, dnsName := range statefulSetDNSNames(&sts, rm.clusterDomain) {
+				fmt.Printf("%s      %s\n", indent, dnsName)
+			}
+		}
+	}
+	for i, sts := range orphaned {
+		branch := sym("├──")
+		if i == len(orphaned)-1 {
+			branch = sym("└──")
+		}
+		fmt.Printf("%s %sStatefulSet %s: governing service '%s' is missing or not headless, pods get no stable DNS names%s\n",
+			branch, colorRed, sts.Name, sts.Spec.ServiceName, colorReset)
+	}
+	return nil
+}
@@ -0,0 +1,442 @@
+package mapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// mapSnapshot is a captured mapping of a cluster, saved with snapshot save
+// and rendered again offline with --from-snapshot
+type mapSnapshot struct {
+	APIVersion string            `json:"apiVersion"`
+	Cluster    string            `json:"cluster"`
+	Taken      time.Time         `json:"taken"`
+	Namespaces map[string]*Graph `json:"namespaces"`
+}
+
+// newMapSnapshot creates an empty snapshot of a cluster
+func newMapSnapshot(cluster string) *mapSnapshot {
+	return &mapSnapshot{
+		APIVersion: apiVersion,
+		Cluster:    cluster,
+		Taken:      time.Now(),
+		Namespaces: map[string]*Graph{},
+	}
+}
+
+// encode encodes the snapshot as indented JSON
+func (s *mapSnapshot) encode() ([]byte, error) {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding snapshot: %v", err)
+	}
+	return data, nil
+}
+
+// save writes the snapshot to a file
+func (s *mapSnapshot) save(path string) error {
+	data, err := s.encode()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("error writing snapshot: %v", err)
+	}
+	return nil
+}
+
+// snapshotWriter writes a snapshot to a file one namespace at a time, as
+// each is mapped, so that a run saving a large cluster holds a single
+// namespace in memory. The file is written under a temporary name and only
+// replaces path on close
+type snapshotWriter struct {
+	path  string
+	file  *os.File
+	count int
+}
+
+// createSnapshot starts writing a snapshot of a cluster to a file, in the
+// layout save writes
+func createSnapshot(path, cluster string) (*snapshotWriter, error) {
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, fmt.Errorf("error writing snapshot: %v", err)
+	}
+	header, _ := json.MarshalIndent(newMapSnapshot(cluster), "", "  ")
+	// Leave the namespaces object open: the snapshot ends with "{}\n}"
+	header = bytes.TrimSuffix(header, []byte("{}\n}"))
+	if _, err := file.Write(header); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error writing snapshot: %v", err)
+	}
+	return &snapshotWriter{path: path, file: file}, nil
+}
+
+// add writes the graph of a namespace
+func (w *snapshotWriter) add(ns string, g *Graph) error {
+	data, err := json.MarshalIndent(g, "    ", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding snapshot: %v", err)
+	}
+	name, _ := json.Marshal(ns)
+	separator := ",\n"
+	if w.count == 0 {
+		separator = "{\n"
+	}
+	if _, err := fmt.Fprintf(w.file, "%s    %s: %s", separator, name, data); err != nil {
+		return fmt.Errorf("error writing snapshot: %v", err)
+	}
+	w.count++
+	return nil
+}
+
+// close completes the snapshot and moves it to its path
+func (w *snapshotWriter) close() error {
+	end := "\n  }\n}"
+	if w.count == 0 {
+		end = "{}\n}"
+	}
+	_, err := w.file.WriteString(end)
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(w.path+".tmp", w.path)
+	}
+	if err != nil {
+		os.Remove(w.path + ".tmp")
+		return fmt.Errorf("error writing snapshot: %v", err)
+	}
+	return nil
+}
+
+// abort discards a snapshot left incomplete
+func (w *snapshotWriter) abort() {
+	w.file.Close()
+	os.Remove(w.path + ".tmp")
+}
+
+// saveSnapshot maps namespaces to a snapshot file, writing each as it is
+// mapped, and records the run in the history when one is given
+func (rm *ResourceMapper) saveSnapshot(namespaces []string, path string, hist *historyStore) (int, error) {
+	w, err := createSnapshot(path, rm.host)
+	if err != nil {
+		return 0, err
+	}
+	// The history records the run at once, so only then are the graphs kept
+	var snapshot *mapSnapshot
+	if hist != nil {
+		snapshot = newMapSnapshot(rm.host)
+	}
+	for _, ns := range namespaces {
+		rm.cache = nil
+		g, err := rm.buildGraph(rm.ctx, ns)
+		if err == nil {
+			err = w.add(ns, g)
+		}
+		if err != nil {
+			w.abort()
+			return 0, fmt.Errorf("error capturing snapshot of namespace %s: %v", ns, err)
+		}
+		if snapshot != nil {
+			snapshot.Namespaces[ns] = g
+		}
+	}
+	if err := w.close(); err != nil {
+		return 0, err
+	}
+	if hist != nil {
+		if err := hist.record(snapshot); err != nil {
+			return 0, err
+		}
+	}
+	return w.count, nil
+}
+
+// captureSnapshot maps namespaces into a new snapshot
+func (rm *ResourceMapper) captureSnapshot(namespaces []string) (*mapSnapshot, error) {
+	snapshot := newMapSnapshot(rm.host)
+	for _, ns := range namespaces {
+		// Every capture starts from fresh objects
+		rm.cache = nil
+		g, err := rm.buildGraph(rm.ctx, ns)
+		if err != nil {
+			return nil, fmt.Errorf("error capturing snapshot of namespace %s: %v", ns, err)
+		}
+		snapshot.Namespaces[ns] = g
+	}
+	return snapshot, nil
+}
+
+// snapshotDestination is where scheduled snapshots are written: a local
+// directory, or an s3:// or gs:// URL written with the aws or gcloud CLI
+type snapshotDestination string
+
+// cloudCLI returns the command uploading to the destination, nil when it is
+// a local directory
+func (d snapshotDestination) cloudCLI() []string {
+	switch {
+	case strings.HasPrefix(string(d), "s3://"):
+		return []string{"aws", "s3", "cp", "-"}
+	case strings.HasPrefix(string(d), "gs://"):
+		return []string{"gcloud", "storage", "cp", "-"}
+	}
+	return nil
+}
+
+// check makes sure snapshots can be written before the first run: the local
+// directory exists, or the CLI of the object storage is installed
+func (d snapshotDestination) check() error {
+	if cli := d.cloudCLI(); cli != nil {
+		if _, err := exec.LookPath(cli[0]); err != nil {
+			return fmt.Errorf("writing snapshots to %s needs the %s CLI, which was not found in PATH: install it or write to a local directory", d, cli[0])
+		}
+		return nil
+	}
+	if err := os.MkdirAll(string(d), 0o755); err != nil {
+		return fmt.Errorf("error creating snapshot directory: %v", err)
+	}
+	return nil
+}
+
+// write writes a snapshot under a name and returns where it went
+func (d snapshotDestination) write(name string, data []byte) (string, error) {
+	cli := d.cloudCLI()
+	if cli == nil {
+		path := filepath.Join(string(d), name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return "", fmt.Errorf("error writing snapshot: %v", err)
+		}
+		return path, nil
+	}
+	url := strings.TrimSuffix(string(d), "/") + "/" + name
+	var stderr bytes.Buffer
+	cmd := exec.Command(cli[0], append(cli[1:], url)...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("error uploading snapshot to %s: %v: %s", url, err, strings.TrimSpace(stderr.String()))
+	}
+	return url, nil
+}
+
+// snapshotName is the timestamped name of a scheduled snapshot, sorting in
+// the order the snapshots were taken
+func snapshotName(taken time.Time) string {
+	return "snapshot-" + taken.UTC().Format("20060102T150405Z") + ".json"
+}
+
+// scheduleSnapshots maps the selected namespaces every interval, writing each
+// snapshot to the destination. Failed runs are reported and retried at the
+// next interval. Snapshots are also recorded in the history when one is
+// given, and notable changes since the previous snapshot are posted to the
+// notifier
+func (rm *ResourceMapper) scheduleSnapshots(global *globalFlags, dest snapshotDestination, interval time.Duration, hist *historyStore, notifier *changeNotifier) {
+	fmt.Printf("%sWriting a snapshot to %s every %s%s\n", colorGreen, dest, interval, colorReset)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var previous *mapSnapshot
+	for {
+		if err := rm.reloadClients(); err != nil {
+			fmt.Printf("%sError reloading kubeconfig, still mapping %s: %v%s\n", colorRed, rm.host, err, colorReset)
+		}
+		// Every snapshot sees the current nodes and namespaces
+		rm.clusterCache = nil
+		namespaces, err := global.namespaces(rm)
+		var snapshot *mapSnapshot
+		if err == nil {
+			snapshot, err = rm.captureSnapshot(namespaces)
+		}
+		var data []byte
+		if err == nil {
+			data, err = snapshot.encode()
+		}
+		var location string
+		if err == nil {
+			location, err = dest.write(snapshotName(snapshot.Taken), data)
+		}
+		if err == nil && hist != nil {
+			err = hist.record(snapshot)
+		}
+		if err != nil {
+			fmt.Printf("%s[%s] Error: %v%s\n", colorRed, time.Now().Format("15:04:05"), err, colorReset)
+		} else {
+			fmt.Printf("[%s] Snapshot of %d namespace(s) written to %s\n", snapshot.Taken.Format("15:04:05"), len(snapshot.Namespaces), location)
+			if notifier != nil && previous != nil {
+				if err := notifier.notify(snapshot.Cluster, notableChanges(previous.Namespaces, snapshot.Namespaces)); err != nil {
+					fmt.Printf("%sError sending change notification: %v%s\n", colorRed, err, colorReset)
+				}
+			}
+			previous = snapshot
+		}
+		<-ticker.C
+	}
+}
+
+// loadMapSnapshot reads a snapshot written by snapshot save
+func loadMapSnapshot(path string) (*mapSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot: %v", err)
+	}
+	var s mapSnapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("error parsing snapshot %s: %v", path, err)
+	}
+	if s.APIVersion != apiVersion {
+		return nil, fmt.Errorf("snapshot %s has unsupported apiVersion %q (expected %q)", path, s.APIVersion, apiVersion)
+	}
+	if s.Namespaces == nil {
+		s.Namespaces = map[string]*Graph{}
+	}
+	return &s, nil
+}
+
+// filter keeps the namespaces selected by -n and --exclude-ns, and drops
+// completed pods and their relationships when completed work is hidden
+func (s *mapSnapshot) filter(namespace string, excludeNs []string, hideCompleted bool) {
+	for ns := range s.Namespaces {
+		excluded := namespace != "" && ns != namespace
+		for _, excludedNs := range excludeNs {
+			if ns == excludedNs {
+				excluded = true
+			}
+		}
+		if excluded {
+			delete(s.Namespaces, ns)
+		}
+	}
+	if !hideCompleted {
+		return
+	}
+
+	for _, g := range s.Namespaces {
+		dropped := map[ResourceKey]bool{}
+		resources := g.Resources[:0]
+		for _, res := range g.Resources {
+			if res.Kind == "Pod" && res.Attributes["phase"] == "Succeeded" {
+				dropped[res.Key()] = true
+				continue
+			}
+			resources = append(resources, res)
+		}
+		g.Resources = resources
+		relationships := g.Relationships[:0]
+		for _, rel := range g.Relationships {
+			if !dropped[rel.From] && !dropped[rel.To] {
+				relationships = append(relationships, rel)
+			}
+		}
+		g.Relationships = relationships
+	}
+}
+
+// showSnapshotNamespace renders the captured graph of a namespace
+func (rm *ResourceMapper) showSnapshotNamespace(namespace string, g *Graph) {
+	rm.printLine()
+	fmt.Printf("%sAnalyzing namespace: %s%s\n", colorRed, namespace, colorReset)
+	rm.printLine()
+
+	kindOrder := map[string]int{}
+	for i, kind := range inventoryKinds {
+		kindOrder[kind] = i + 1
+	}
+	byKind := map[string][]string{}
+	for _, res := range g.Resources {
+		byKind[res.Kind] = append(byKind[res.Kind], res.Name)
+	}
+	kinds := sortedKeys(byKind)
+	// Known kinds keep the live display order, others follow alphabetically
+	sort.SliceStable(kinds, func(i, j int) bool {
+		a, b := kindOrder[kinds[i]], kindOrder[kinds[j]]
+		if a == 0 || b == 0 {
+			return a != 0 && b == 0
+		}
+		return a < b
+	})
+
+	fmt.Printf("%sResources in namespace: %s%s\n", colorGreen, namespace, colorReset)
+	for _, kind := range kinds {
+		fmt.Printf("\n%s%s:%s\n", colorYellow, kind, colorReset)
+		for _, name := range byKind[kind] {
+			fmt.Println(name)
+		}
+	}
+
+	fmt.Printf("\n%sResource relationships in namespace: %s%s\n", colorBlue, namespace, colorReset)
+	for i, rel := range g.Relationships {
+		branch := sym("├──")
+		if i == len(g.Relationships)-1 {
+			branch = sym("└──")
+		}
+		fmt.Printf("%s %s/%s %s %s %s/%s\n", branch, rel.From.Kind, rel.From.Name, rm.createArrow(4), rel.Type, rel.To.Kind, rel.To.Name)
+	}
+
+	isolated := isolatedResources(g)
+	if len(isolated) > 0 {
+		fmt.Printf("\n%sIsolated resources in namespace: %s%s\n", colorRed, namespace, colorReset)
+		for i, res := range isolated {
+			branch := sym("├──")
+			if i == len(isolated)-1 {
+				branch = sym("└──")
+			}
+			fmt.Printf("%s %s: %s\n", branch, res.Kind, res.Name)
+		}
+	}
+	rm.printLine()
+}
+
+// runFromSnapshots renders one snapshot offline, or diffs two snapshots
+// namespace by namespace
+func (rm *ResourceMapper) runFromSnapshots(paths []string, namespace string, excludeNs []string) error {
+	if len(paths) > 2 {
+		return fmt.Errorf("--from-snapshot accepts one snapshot to render or two to diff")
+	}
+	var snapshots []*mapSnapshot
+	for _, path := range paths {
+		s, err := loadMapSnapshot(path)
+		if err != nil {
+			return err
+		}
+		s.filter(namespace, excludeNs, rm.hideCompleted)
+		snapshots = append(snapshots, s)
+	}
+
+	if len(snapshots) == 1 {
+		s := snapshots[0]
+		fmt.Printf("%sSnapshot of %s taken %s%s\n", colorGreen, s.Cluster, s.Taken.Local().Format("2006-01-02 15:04"), colorReset)
+		for _, ns := range sortedKeys(s.Namespaces) {
+			rm.showSnapshotNamespace(ns, s.Namespaces[ns])
+		}
+		return nil
+	}
+
+	left, right := snapshots[0], snapshots[1]
+	namespaces := map[string]bool{}
+	for ns := range left.Namespaces {
+		namespaces[ns] = true
+	}
+	for ns := range right.Namespaces {
+		namespaces[ns] = true
+	}
+	for _, ns := range sortedKeys(namespaces) {
+		var leftResources, rightResources []Resource
+		if g := left.Namespaces[ns]; g != nil {
+			leftResources = g.Resources
+		}
+		if g := right.Namespaces[ns]; g != nil {
+			rightResources = g.Resources
+		}
+		rm.printComparison(compareTarget{Context: paths[0], Namespace: ns}, compareTarget{Context: paths[1], Namespace: ns},
+			compareResources(leftResources, rightResources))
+		rm.printLine()
+	}
+	return nil
+}
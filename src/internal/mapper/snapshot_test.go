@@ -0,0 +1,26 @@
+package mapper
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotDestinationCheck(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	for dest, cli := range map[snapshotDestination]string{"s3://ops/prod/": "aws", "gs://ops/prod/": "gcloud"} {
+		err := dest.check()
+		if err == nil || !strings.Contains(err.Error(), "the "+cli+" CLI") {
+			t.Errorf("check(%s) = %v, want an error naming the %s CLI", dest, err, cli)
+		}
+	}
+
+	dir := filepath.Join(t.TempDir(), "snapshots")
+	if err := snapshotDestination(dir).check(); err != nil {
+		t.Fatalf("check(%s): %v", dir, err)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("snapshot directory not created: %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package mapper
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// waitPattern recognizes init containers waiting for a dependency: retry
+// loops, DNS lookups, port probes and the common wait-for tools
+var waitPattern = regexp.MustCompile(`\b(until|while|wait-for-it|wait-for|waitforit|dockerize|nslookup|getent|dig|nc|ncat|pg_isready|mysqladmin|redis-cli|curl|wget|timeout)\b`)
+
+// hostSeparators split init container commands into candidate host names
+var hostSeparators = regexp.MustCompile(`[\s;|&"'()=,\[\]{}]+`)
+
+// hostOf extracts the host of a token written as a host name, host:port or
+// URL, lower-cased
+func hostOf(token string) string {
+	if _, rest, ok := strings.Cut(token, "://"); ok {
+		token = rest
+	}
+	if i := strings.IndexAny(token, "/?"); i >= 0 {
+		token = token[:i]
+	}
+	if i := strings.LastIndex(token, "@"); i >= 0 {
+		token = token[i+1:]
+	}
+	host, _, _ := strings.Cut(token, ":")
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// serviceOfHost resolves a host name to a service: a short name of a service
+// of the namespace, or a service DNS name of any namespace. Short names are
+// only trusted from containers that wait, as they may be plain words
+func serviceOfHost(host, namespace, clusterDomain string, services map[string]bool, waits bool) (string, string, bool) {
+	if match := serviceDNSPattern.FindStringSubmatch(host); match != nil && match[0] == strings.TrimSuffix(host, "."+clusterDomain) {
+		return match[3], match[1], true
+	}
+	name, ns, qualified := strings.Cut(host, ".")
+	if qualified && ns != namespace {
+		return "", "", false
+	}
+	if services[name] && (waits || qualified) {
+		return namespace, name, true
+	}
+	return "", "", false
+}
+
+// initDependency is a service an init container waits for
+type initDependency struct {
+	container string
+	namespace string
+	service   string
+}
+
+// initDependencies finds the services the init containers of a pod wait
+// for, from their commands and arguments and the host names in their
+// environment, which scripts commonly wait on through variables
+func initDependencies(pod *corev1.Pod, clusterDomain string, services map[string]bool) []initDependency {
+	deps := []initDependency{}
+	seen := map[initDependency]bool{}
+	for _, c := range pod.Spec.InitContainers {
+		script := strings.Join(append(append([]string{}, c.Command...), c.Args...), " ")
+		waits := waitPattern.MatchString(script)
+		tokens := hostSeparators.Split(script, -1)
+		for _, env := range c.Env {
+			tokens = append(tokens, env.Value)
+		}
+		for _, token := range tokens {
+			host := hostOf(token)
+			if host == "" {
+				continue
+			}
+			ns, service, ok := serviceOfHost(host, pod.Namespace, clusterDomain, services, waits)
+			dep := initDependency{container: c.Name, namespace: ns, service: service}
+			if ok && !seen[dep] {
+				seen[dep] = true
+				deps = append(deps, dep)
+			}
+		}
+	}
+	return deps
+}
+
+// addStartupDependencies adds a starts-after edge from each workload, or pod
+// without one in the graph, to the services its init containers wait for
+func (objs *namespaceObjects) addStartupDependencies(g *Graph) {
+	services := map[string]bool{}
+	for _, svc := range objs.services {
+		services[svc.Name] = true
+	}
+	added := map[relationshipKey]bool{}
+	for i := range objs.pods {
+		pod := &objs.pods[i]
+		from := ResourceKey{Kind: "Pod", Namespace: objs.namespace, Name: pod.Name}
+		kind, name, _ := strings.Cut(podOwnerName(pod), " ")
+		if owner := (ResourceKey{Kind: kind, Namespace: objs.namespace, Name: name}); g.hasResource(owner) {
+			from = owner
+		}
+		for _, dep := range initDependencies(pod, objs.clusterDomain, services) {
+			to := ResourceKey{Kind: "Service", Namespace: dep.namespace, Name: dep.service}
+			if dep.namespace != objs.namespace {
+				to = g.addReferenced("Service", dep.namespace, dep.service)
+			}
+			if added[relationshipKey{From: from, To: to, Type: RelStartsAfter}] {
+				continue
+			}
+			added[relationshipKey{From: from, To: to, Type: RelStartsAfter}] = true
+			g.addRelationship(from, to, RelStartsAfter, "init container "+dep.container,
+				relationshipDetails{Container: dep.container})
+		}
+	}
+}
+
+// showStartupOrder lists the services each workload waits for before
+// starting, as inferred from init containers
+func (rm *ResourceMapper) showStartupOrder(namespace string, g *Graph) {
+	waits := map[string][]string{}
+	for _, rel := range g.Relationships {
+		if rel.Type != RelStartsAfter {
+			continue
+		}
+		from := rel.From.Kind + " " + rel.From.Name
+		to := "Service " + rel.To.Name
+		if rel.To.Namespace != namespace {
+			to += " (" + rel.To.Namespace + ")"
+		}
+		waits[from] = append(waits[from], fmt.Sprintf("%s, %s", to, rel.Description))
+	}
+	if len(waits) == 0 {
+		return
+	}
+
+	fmt.Printf("\n%sStartup order in namespace: %s%s\n", colorCyan, namespace, colorReset)
+	workloads := sortedKeys(waits)
+	for i, workload := range workloads {
+		branch, indent := sym("├──"), sym("│  ")
+		if i == len(workloads)-1 {
+			branch, indent = sym("└──"), "   "
+		}
+		fmt.Printf("%s %s starts after:\n", branch, workload)
+		for _, wait := range waits[workload] {
+			fmt.Printf("%s %s %s\n", indent, rm.createArrow(4), wait)
+		}
+	}
+}
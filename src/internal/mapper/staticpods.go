@@ -0,0 +1,21 @@
+package mapper
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// isMirrorPod reports whether a pod is the API server mirror of a static pod
+// run by the kubelet from a manifest on its node. Mirror pods have no
+// controller but their node, and are managed by editing that manifest
+func isMirrorPod(pod *corev1.Pod) bool {
+	_, ok := pod.Annotations[corev1.MirrorPodAnnotationKey]
+	return ok
+}
+
+// formatStaticPod marks mirror pods in pod listings
+func formatStaticPod(pod *corev1.Pod) string {
+	if !isMirrorPod(pod) {
+		return ""
+	}
+	return " " + colorCyan + "[static pod]" + colorReset
+}
@@ -0,0 +1,170 @@
+package mapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// graphStats holds complexity metrics of a namespace graph
+type graphStats struct {
+	Time          time.Time `json:"time"`
+	Namespace     string    `json:"namespace"`
+	Nodes         int       `json:"nodes"`
+	Edges         int       `json:"edges"`
+	MaxFanOut     int       `json:"maxFanOut"`
+	MaxFanOutNode string    `json:"maxFanOutNode,omitempty"`
+	MaxFanIn      int       `json:"maxFanIn"`
+	MaxFanInNode  string    `json:"maxFanInNode,omitempty"`
+	AvgDepth      float64   `json:"avgDepth"`
+	Components    int       `json:"components"`
+}
+
+// graphStatsSeries is the snapshot store series holding graph statistics
+const graphStatsSeries = "graph-stats"
+
+// connectedComponents counts the weakly connected components of a graph
+func connectedComponents(g *Graph) int {
+	parent := map[ResourceKey]ResourceKey{}
+	var find func(ResourceKey) ResourceKey
+	find = func(k ResourceKey) ResourceKey {
+		if parent[k] != k {
+			parent[k] = find(parent[k])
+		}
+		return parent[k]
+	}
+
+	for _, res := range g.Resources {
+		parent[res.Key()] = res.Key()
+	}
+	components := len(parent)
+	for _, rel := range g.Relationships {
+		a, b := find(rel.From), find(rel.To)
+		if a != b {
+			parent[a] = b
+			components--
+		}
+	}
+	return components
+}
+
+// computeGraphStats computes the complexity metrics of a graph
+func computeGraphStats(namespace string, g *Graph) graphStats {
+	stats := graphStats{
+		Time:      time.Now(),
+		Namespace: namespace,
+		Nodes:     len(g.Resources),
+		Edges:     len(g.Relationships),
+	}
+
+	fanOut := map[ResourceKey]int{}
+	fanIn := map[ResourceKey]int{}
+	outgoing := map[ResourceKey][]ResourceKey{}
+	for _, rel := range g.Relationships {
+		fanOut[rel.From]++
+		fanIn[rel.To]++
+		outgoing[rel.From] = append(outgoing[rel.From], rel.To)
+	}
+	for key, count := range fanOut {
+		if count > stats.MaxFanOut || (count == stats.MaxFanOut && key.String() < stats.MaxFanOutNode) {
+			stats.MaxFanOut, stats.MaxFanOutNode = count, key.String()
+		}
+	}
+	for key, count := range fanIn {
+		if count > stats.MaxFanIn || (count == stats.MaxFanIn && key.String() < stats.MaxFanInNode) {
+			stats.MaxFanIn, stats.MaxFanInNode = count, key.String()
+		}
+	}
+
+	// Dependency depth is the longest chain of outgoing relationships
+	// starting at a node; cycles are cut when revisiting a node
+	depth := map[ResourceKey]int{}
+	visiting := map[ResourceKey]bool{}
+	var longest func(ResourceKey) int
+	longest = func(k ResourceKey) int {
+		if d, ok := depth[k]; ok {
+			return d
+		}
+		if visiting[k] {
+			return 0
+		}
+		visiting[k] = true
+		deepest := 0
+		for _, next := range outgoing[k] {
+			if d := longest(next) + 1; d > deepest {
+				deepest = d
+			}
+		}
+		visiting[k] = false
+		depth[k] = deepest
+		return deepest
+	}
+	total := 0
+	for _, res := range g.Resources {
+		total += longest(res.Key())
+	}
+	if len(g.Resources) > 0 {
+		stats.AvgDepth = float64(total) / float64(len(g.Resources))
+	}
+
+	stats.Components = connectedComponents(g)
+	return stats
+}
+
+// formatDelta formats the change of a metric since the previous run
+func formatDelta(current, previous float64) string {
+	diff := current - previous
+	switch {
+	case diff > 0.005:
+		return fmt.Sprintf(" %s(+%.4g)%s", colorYellow, diff, colorReset)
+	case diff < -0.005:
+		return fmt.Sprintf(" %s(%.4g)%s", colorGreen, diff, colorReset)
+	}
+	return ""
+}
+
+// previousGraphStats returns the last recorded statistics of a namespace
+func previousGraphStats(store *snapshotStore, namespace string) (*graphStats, error) {
+	records, err := store.records(graphStatsSeries)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(records) - 1; i >= 0; i-- {
+		var stats graphStats
+		if err := json.Unmarshal(records[i], &stats); err != nil {
+			continue
+		}
+		if stats.Namespace == namespace {
+			return &stats, nil
+		}
+	}
+	return nil, nil
+}
+
+// showGraphStats shows the complexity metrics of a namespace, compared with
+// the previous run, and records them in the snapshot store
+func (rm *ResourceMapper) showGraphStats(namespace string, store *snapshotStore) error {
+	g, err := rm.buildGraph(rm.ctx, namespace)
+	if err != nil {
+		return err
+	}
+	stats := computeGraphStats(namespace, g)
+
+	prev, err := previousGraphStats(store, namespace)
+	if err != nil {
+		return err
+	}
+	if prev == nil {
+		prev = &stats
+	}
+
+	fmt.Printf("\n%sGraph statistics for namespace: %s%s\n", colorCyan, namespace, colorReset)
+	fmt.Printf(sym("├── Nodes: %d%s\n"), stats.Nodes, formatDelta(float64(stats.Nodes), float64(prev.Nodes)))
+	fmt.Printf(sym("├── Edges: %d%s\n"), stats.Edges, formatDelta(float64(stats.Edges), float64(prev.Edges)))
+	fmt.Printf(sym("├── Max fan-out: %d %s%s\n"), stats.MaxFanOut, stats.MaxFanOutNode, formatDelta(float64(stats.MaxFanOut), float64(prev.MaxFanOut)))
+	fmt.Printf(sym("├── Max fan-in: %d %s%s\n"), stats.MaxFanIn, stats.MaxFanInNode, formatDelta(float64(stats.MaxFanIn), float64(prev.MaxFanIn)))
+	fmt.Printf(sym("├── Average dependency depth: %.2f%s\n"), stats.AvgDepth, formatDelta(stats.AvgDepth, prev.AvgDepth))
+	fmt.Printf(sym("└── Disconnected components: %d%s\n"), stats.Components, formatDelta(float64(stats.Components), float64(prev.Components)))
+
+	return store.append(graphStatsSeries, stats)
+}
@@ -0,0 +1,72 @@
+package mapper
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// snapshotStore persists per-run records for a cluster under the state
+// directory, so that results can be compared across runs
+type snapshotStore struct {
+	dir string
+}
+
+// openSnapshotStore opens the snapshot store of a cluster
+func openSnapshotStore(cluster string) (*snapshotStore, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return nil, err
+	}
+	return &snapshotStore{dir: filepath.Join(dir, "snapshots", clusterFileName(cluster))}, nil
+}
+
+// append adds a record to the named series
+func (s *snapshotStore) append(series string, record interface{}) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error encoding %s record: %v", series, err)
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("error creating snapshot store: %v", err)
+	}
+
+	file, err := os.OpenFile(filepath.Join(s.dir, series+".jsonl"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("error opening %s series: %v", series, err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing %s record: %v", series, err)
+	}
+	return nil
+}
+
+// records returns the raw records of the named series, oldest first
+func (s *snapshotStore) records(series string) ([]json.RawMessage, error) {
+	file, err := os.Open(filepath.Join(s.dir, series+".jsonl"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s series: %v", series, err)
+	}
+	defer file.Close()
+
+	var records []json.RawMessage
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		records = append(records, append(json.RawMessage(nil), line...))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s series: %v", series, err)
+	}
+	return records, nil
+}
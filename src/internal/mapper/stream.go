@@ -0,0 +1,241 @@
+package mapper
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"golang.org/x/net/websocket"
+)
+
+// Graph event types pushed on the stream
+const (
+	eventAdded   = "added"
+	eventUpdated = "updated"
+	eventRemoved = "removed"
+)
+
+// graphEvent is a change to a resource or relationship pushed to stream clients
+type graphEvent struct {
+	APIVersion   string        `json:"apiVersion"`
+	Type         string        `json:"type"`
+	Namespace    string        `json:"namespace"`
+	Resource     *Resource     `json:"resource,omitempty"`
+	Relationship *Relationship `json:"relationship,omitempty"`
+}
+
+// streamBuffer is the number of events a client may lag behind before it is
+// disconnected, so that a slow client never stalls refreshes
+const streamBuffer = 1024
+
+// relationshipKey identifies a relationship between two refreshes
+type relationshipKey struct {
+	From, To ResourceKey
+	Type     string
+}
+
+// diffGraphs returns the events turning the graph of a namespace before a
+// refresh into the graph after it; either graph may be nil
+func diffGraphs(namespace string, before, after *Graph) []graphEvent {
+	if before == nil {
+		before = &Graph{}
+	}
+	if after == nil {
+		after = &Graph{}
+	}
+	var events []graphEvent
+	event := func(eventType string, res *Resource, rel *Relationship) {
+		events = append(events, graphEvent{APIVersion: apiVersion, Type: eventType, Namespace: namespace, Resource: res, Relationship: rel})
+	}
+
+	oldResources := map[ResourceKey]*Resource{}
+	for i := range before.Resources {
+		oldResources[before.Resources[i].Key()] = &before.Resources[i]
+	}
+	newResources := map[ResourceKey]bool{}
+	for i := range after.Resources {
+		res := &after.Resources[i]
+		newResources[res.Key()] = true
+		prev, ok := oldResources[res.Key()]
+		switch {
+		case !ok:
+			event(eventAdded, res, nil)
+		case !reflect.DeepEqual(prev, res):
+			event(eventUpdated, res, nil)
+		}
+	}
+	for i := range before.Resources {
+		if !newResources[before.Resources[i].Key()] {
+			event(eventRemoved, &before.Resources[i], nil)
+		}
+	}
+
+	// Resources may be related several times with the same type, such as a
+	// service routing to a pod on two ports, so the relationships between
+	// two resources are compared as a set. A single relationship replaced by
+	// another, with a new description or broken state, is an update
+	keyOf := func(rel *Relationship) relationshipKey {
+		return relationshipKey{From: rel.From, To: rel.To, Type: rel.Type}
+	}
+	oldRelationships := map[relationshipKey][]*Relationship{}
+	for i := range before.Relationships {
+		rel := &before.Relationships[i]
+		oldRelationships[keyOf(rel)] = append(oldRelationships[keyOf(rel)], rel)
+	}
+	newRelationships := map[relationshipKey][]*Relationship{}
+	var keys []relationshipKey
+	for i := range after.Relationships {
+		rel := &after.Relationships[i]
+		if _, ok := newRelationships[keyOf(rel)]; !ok {
+			keys = append(keys, keyOf(rel))
+		}
+		newRelationships[keyOf(rel)] = append(newRelationships[keyOf(rel)], rel)
+	}
+	for _, key := range keys {
+		removed, added := relationshipChanges(oldRelationships[key], newRelationships[key])
+		if len(removed) == 1 && len(added) == 1 {
+			event(eventUpdated, nil, added[0])
+			continue
+		}
+		for _, rel := range removed {
+			event(eventRemoved, nil, rel)
+		}
+		for _, rel := range added {
+			event(eventAdded, nil, rel)
+		}
+	}
+	for i := range before.Relationships {
+		rel := &before.Relationships[i]
+		if _, ok := newRelationships[keyOf(rel)]; !ok {
+			event(eventRemoved, nil, rel)
+		}
+	}
+	return events
+}
+
+// relationshipChanges returns the relationships of before missing from after
+// and those of after missing from before
+func relationshipChanges(before, after []*Relationship) (removed, added []*Relationship) {
+	matched := make([]bool, len(before))
+	for _, rel := range after {
+		found := false
+		for i, prev := range before {
+			if !matched[i] && *prev == *rel {
+				matched[i], found = true, true
+				break
+			}
+		}
+		if !found {
+			added = append(added, rel)
+		}
+	}
+	for i, prev := range before {
+		if !matched[i] {
+			removed = append(removed, prev)
+		}
+	}
+	return removed, added
+}
+
+// graphStream fans graph events out to the connected clients
+type graphStream struct {
+	mu      sync.Mutex
+	clients map[chan graphEvent]bool
+}
+
+// subscribe registers a client
+func (gs *graphStream) subscribe() chan graphEvent {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	if gs.clients == nil {
+		gs.clients = map[chan graphEvent]bool{}
+	}
+	ch := make(chan graphEvent, streamBuffer)
+	gs.clients[ch] = true
+	return ch
+}
+
+// unsubscribe removes a client, unless it was already dropped
+func (gs *graphStream) unsubscribe(ch chan graphEvent) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	if gs.clients[ch] {
+		delete(gs.clients, ch)
+		close(ch)
+	}
+}
+
+// publish sends events to every client, dropping clients that fall behind
+func (gs *graphStream) publish(events []graphEvent) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	for ch := range gs.clients {
+		for _, ev := range events {
+			select {
+			case ch <- ev:
+			default:
+				delete(gs.clients, ch)
+				close(ch)
+			}
+			if !gs.clients[ch] {
+				break
+			}
+		}
+	}
+}
+
+// handleStream serves the /api/v1/stream WebSocket. A client first receives
+// the current graph as added events, then every change found by a refresh.
+// The namespace query parameter restricts the stream to one namespace
+func (s *graphServer) handleStream(ws *websocket.Conn) {
+	defer ws.Close()
+	namespace := ws.Request().URL.Query().Get("namespace")
+
+	// Refreshes publish while holding the write lock, so subscribing and
+	// taking the snapshot under the read lock neither misses nor repeats events
+	s.mu.RLock()
+	ch := s.stream.subscribe()
+	defer s.stream.unsubscribe(ch)
+	var initial []graphEvent
+	for _, ns := range sortedKeys(s.graphs) {
+		if namespace == "" || ns == namespace {
+			initial = append(initial, diffGraphs(ns, nil, s.graphs[ns])...)
+		}
+	}
+	s.mu.RUnlock()
+
+	// Clients do not send anything; a failed read means they went away
+	closed := make(chan struct{})
+	go func() {
+		var discard []byte
+		for websocket.Message.Receive(ws, &discard) == nil {
+		}
+		close(closed)
+	}()
+
+	send := func(ev graphEvent) bool {
+		if namespace != "" && ev.Namespace != namespace {
+			return true
+		}
+		if err := websocket.JSON.Send(ws, ev); err != nil {
+			fmt.Printf("%sError streaming to %s: %v%s\n", colorYellow, ws.Request().RemoteAddr, err, colorReset)
+			return false
+		}
+		return true
+	}
+	for _, ev := range initial {
+		if !send(ev) {
+			return
+		}
+	}
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok || !send(ev) {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package mapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+)
+
+// namespaceHealth is the health summary of a namespace
+type namespaceHealth struct {
+	Namespace                string   `json:"namespace"`
+	UnreadyDeployments       []string `json:"unreadyDeployments"`
+	UnhealthyPods            []string `json:"unhealthyPods"`
+	ServicesWithoutEndpoints []string `json:"servicesWithoutEndpoints"`
+	PendingLoadBalancers     []string `json:"pendingLoadBalancers"`
+	// Deployments and Services count those checked, and Findings counts the
+	// findings of the namespace by severity
+	Deployments int            `json:"deployments"`
+	Services    int            `json:"services"`
+	Findings    map[string]int `json:"findings"`
+	// Score is the health score of the namespace, from 0 to 100
+	Score float64 `json:"score"`
+}
+
+// problems returns the number of problems found in the namespace
+func (h *namespaceHealth) problems() int {
+	return len(h.UnreadyDeployments) + len(h.UnhealthyPods) + len(h.ServicesWithoutEndpoints) + len(h.PendingLoadBalancers)
+}
+
+// podProblem explains why a pod is unhealthy, or returns "" for pods that
+// are running and ready or completed
+func podProblem(pod *corev1.Pod) string {
+	if pod.Status.Phase == corev1.PodSucceeded {
+		return ""
+	}
+	// A waiting container, such as one in CrashLoopBackOff, says the most
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Waiting != nil && status.State.Waiting.Reason != "" {
+			return status.State.Waiting.Reason
+		}
+	}
+	if pod.Status.Phase != corev1.PodRunning {
+		if pod.Status.Reason != "" {
+			return string(pod.Status.Phase) + " (" + pod.Status.Reason + ")"
+		}
+		return string(pod.Status.Phase)
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady && cond.Status != corev1.ConditionTrue {
+			return "Running, not ready"
+		}
+	}
+	return ""
+}
+
+// readyEndpoints counts the ready endpoints of a service across its slices
+func readyEndpoints(slices []discoveryv1.EndpointSlice, service string) int {
+	ready := 0
+	for _, slice := range slices {
+		if slice.Labels[discoveryv1.LabelServiceName] != service {
+			continue
+		}
+		for _, endpoint := range slice.Endpoints {
+			if endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready {
+				ready++
+			}
+		}
+	}
+	return ready
+}
+
+// namespaceHealthOf checks the deployments, pods and services of a namespace
+func (rm *ResourceMapper) namespaceHealthOf(namespace string) (*namespaceHealth, error) {
+	health := &namespaceHealth{
+		Namespace:                namespace,
+		UnreadyDeployments:       []string{},
+		UnhealthyPods:            []string{},
+		ServicesWithoutEndpoints: []string{},
+		PendingLoadBalancers:     []string{},
+		Findings:                 map[string]int{},
+	}
+
+	deployments, err := rm.listDeployments(namespace)
+	if err != nil {
+		return nil, err
+	}
+	health.Deployments = len(deployments)
+	for _, deploy := range deployments {
+		replicas := int32(1)
+		if deploy.Spec.Replicas != nil {
+			replicas = *deploy.Spec.Replicas
+		}
+		if deploy.Status.ReadyReplicas < replicas {
+			health.UnreadyDeployments = append(health.UnreadyDeployments,
+				fmt.Sprintf("%s (%d/%d ready)", deploy.Name, deploy.Status.ReadyReplicas, replicas))
+		}
+	}
+
+	pods, err := rm.listPods(namespace)
+	if err != nil {
+		return nil, err
+	}
+	for i := range pods {
+		if problem := podProblem(&pods[i]); problem != "" {
+			health.UnhealthyPods = append(health.UnhealthyPods, fmt.Sprintf("%s (%s)", pods[i].Name, problem))
+		}
+	}
+
+	services, err := rm.listServices(namespace)
+	if err != nil {
+		return nil, err
+	}
+	slices, err := rm.listEndpointSlices(namespace)
+	if err != nil {
+		return nil, err
+	}
+	for _, svc := range services {
+		if svc.Spec.Type == corev1.ServiceTypeExternalName {
+			continue
+		}
+		health.Services++
+		if readyEndpoints(slices, svc.Name) == 0 {
+			health.ServicesWithoutEndpoints = append(health.ServicesWithoutEndpoints, svc.Name)
+		}
+		if svc.Spec.Type == corev1.ServiceTypeLoadBalancer && len(svc.Status.LoadBalancer.Ingress) == 0 {
+			health.PendingLoadBalancers = append(health.PendingLoadBalancers, svc.Name)
+		}
+	}
+
+	findings, err := rm.collectFindings(namespace)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range findings {
+		health.Findings[f.Severity]++
+	}
+	health.Score = health.score()
+	return health, nil
+}
+
+// printHealthSummary prints the health of each namespace with its score,
+// listing the problems of unhealthy ones. Scores are compared with those of
+// the previous run when there is one
+func (rm *ResourceMapper) printHealthSummary(summaries []*namespaceHealth, previous *healthScores) {
+	cluster := clusterHealthScore(summaries)
+	fmt.Printf("\n%sCluster health summary:%s score %s%s\n", colorCyan, colorReset, formatScore(cluster),
+		formatScoreDelta(cluster, previous, ""))
+	total := 0
+	for i, health := range summaries {
+		branch, indent := sym("├──"), sym("│  ")
+		if i == len(summaries)-1 {
+			branch, indent = sym("└──"), "   "
+		}
+		problems := health.problems()
+		total += problems
+		score := fmt.Sprintf("score %s%s", formatScore(health.Score), formatScoreDelta(health.Score, previous, health.Namespace))
+		if problems == 0 {
+			fmt.Printf("%s %s: %shealthy%s, %s\n", branch, health.Namespace, colorGreen, colorReset, score)
+			continue
+		}
+		fmt.Printf("%s %s: %s%d problem(s)%s, %s\n", branch, health.Namespace, colorRed, problems, colorReset, score)
+		for _, section := range []struct {
+			label string
+			items []string
+		}{
+			{"Deployments not fully ready", health.UnreadyDeployments},
+			{"Pods not running and ready", health.UnhealthyPods},
+			{"Services without ready endpoints", health.ServicesWithoutEndpoints},
+			{"LoadBalancers pending an address", health.PendingLoadBalancers},
+		} {
+			if len(section.items) > 0 {
+				fmt.Printf("%s %s %s: %s\n", indent, rm.createArrow(4), section.label, strings.Join(section.items, ", "))
+			}
+		}
+	}
+	if total == 0 {
+		fmt.Printf("\n%sNo problems found in %d namespace(s)%s\n", colorGreen, len(summaries), colorReset)
+		return
+	}
+	fmt.Printf("\n%s%d problem(s) found%s\n", colorRed, total, colorReset)
+}
+
+// runSummary runs the summary subcommand: aggregates the health of each
+// namespace for quick triage
+func runSummary(args []string) error {
+	var global globalFlags
+	fs := newSubcommandFlagSet("summary", &global)
+	output := fs.String("output", "text", "Output format: text, json, or prometheus for the health scores in the Prometheus text format")
+	exitCode := fs.Bool("exit-code", false, fmt.Sprintf("Exit with status %d when a problem is found", exitFindings))
+	trends := fs.Bool("trends", false, "Record the health scores and show their change since the last run")
+	fs.Parse(args)
+
+	if *output != "text" && *output != "json" && *output != "prometheus" {
+		return fmt.Errorf("invalid --output value '%s' (expected text, json or prometheus)", *output)
+	}
+	rm, err := global.newResourceMapper()
+	if err != nil {
+		return err
+	}
+	namespaces, err := global.namespaces(rm)
+	if err != nil {
+		return err
+	}
+
+	summaries := []*namespaceHealth{}
+	problems := 0
+	for _, ns := range namespaces {
+		health, err := rm.namespaceHealthOf(ns)
+		if err != nil {
+			return fmt.Errorf("error checking namespace %s: %v", ns, err)
+		}
+		summaries = append(summaries, health)
+		problems += health.problems()
+	}
+
+	var previous *healthScores
+	if *trends {
+		store, err := openSnapshotStore(rm.host)
+		if err != nil {
+			return err
+		}
+		if previous, err = recordHealthScores(store, summaries); err != nil {
+			return err
+		}
+	}
+
+	switch *output {
+	case "json":
+		data, err := json.MarshalIndent(summaries, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error encoding summary: %v", err)
+		}
+		fmt.Println(string(data))
+	case "prometheus":
+		fmt.Print(healthScoreMetrics(summaries))
+	default:
+		rm.printHealthSummary(summaries, previous)
+	}
+	if *exitCode && problems > 0 {
+		os.Exit(exitFindings)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package mapper
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// symbolSet holds the symbols the terminal output is drawn with
+type symbolSet struct {
+	// Branch and Last lead an entry of a tree, Last the final one, and Pipe
+	// carries a branch past the lines nested under an entry
+	Branch string `json:"branch,omitempty"`
+	Last   string `json:"last,omitempty"`
+	Pipe   string `json:"pipe,omitempty"`
+	// Arrow is repeated as the shaft of arrows, which end with ArrowHead
+	Arrow     string `json:"arrow,omitempty"`
+	ArrowHead string `json:"arrowHead,omitempty"`
+	// Down leads from one level of the traffic flow to the next, Then
+	// separates the steps of a sequence
+	Down string `json:"down,omitempty"`
+	Then string `json:"then,omitempty"`
+	// BarFull and BarEmpty fill the used and free cells of utilization bars
+	BarFull  string `json:"barFull,omitempty"`
+	BarEmpty string `json:"barEmpty,omitempty"`
+}
+
+// symbolPresets are the built-in symbol sets; ascii suits terminals and
+// log collectors without Unicode
+var symbolPresets = map[string]symbolSet{
+	"unicode": {Branch: "├──", Last: "└──", Pipe: "│", Arrow: "-", ArrowHead: ">", Down: "▼", Then: "→", BarFull: "█", BarEmpty: "░"},
+	"ascii":   {Branch: "|--", Last: "`--", Pipe: "|", Arrow: "-", ArrowHead: ">", Down: "v", Then: "->", BarFull: "#", BarEmpty: "."},
+}
+
+// symbols is the symbol set in use, and symbolReplacer draws the unicode
+// symbols written in output strings with it, nil when it is unicode
+var (
+	symbols        = symbolPresets["unicode"]
+	symbolReplacer *strings.Replacer
+)
+
+// sym draws the symbols of an output string with the symbol set in use
+func sym(s string) string {
+	if symbolReplacer == nil {
+		return s
+	}
+	return symbolReplacer.Replace(s)
+}
+
+// useSymbols makes a symbol set the one in use
+func useSymbols(set symbolSet) {
+	symbols = set
+	unicode := symbolPresets["unicode"]
+	symbolReplacer = strings.NewReplacer(
+		unicode.Branch, set.Branch,
+		unicode.Last, set.Last,
+		unicode.Pipe, set.Pipe,
+		unicode.Down, set.Down,
+		unicode.Then, set.Then,
+	)
+}
+
+// symbolsFile is the format of a --symbols file: symbols overriding those
+// of a preset, unicode by default
+type symbolsFile struct {
+	Preset  string    `json:"preset,omitempty"`
+	Symbols symbolSet `json:"symbols"`
+}
+
+// loadSymbols resolves a --symbols value, a preset name or a YAML file
+func loadSymbols(value string) (symbolSet, error) {
+	if set, ok := symbolPresets[value]; ok {
+		return set, nil
+	}
+	data, err := os.ReadFile(value)
+	if err != nil {
+		return symbolSet{}, fmt.Errorf("'%s' is neither a symbol preset (unicode or ascii) nor a readable file: %v", value, err)
+	}
+	var file symbolsFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return symbolSet{}, fmt.Errorf("error parsing symbols %s: %v", value, err)
+	}
+	if file.Preset == "" {
+		file.Preset = "unicode"
+	}
+	set, ok := symbolPresets[file.Preset]
+	if !ok {
+		return symbolSet{}, fmt.Errorf("unknown symbol preset '%s' in %s (expected unicode or ascii)", file.Preset, value)
+	}
+	for _, field := range []struct{ value, target *string }{
+		{&file.Symbols.Branch, &set.Branch},
+		{&file.Symbols.Last, &set.Last},
+		{&file.Symbols.Pipe, &set.Pipe},
+		{&file.Symbols.Arrow, &set.Arrow},
+		{&file.Symbols.ArrowHead, &set.ArrowHead},
+		{&file.Symbols.Down, &set.Down},
+		{&file.Symbols.Then, &set.Then},
+		{&file.Symbols.BarFull, &set.BarFull},
+		{&file.Symbols.BarEmpty, &set.BarEmpty},
+	} {
+		if *field.value != "" {
+			*field.target = *field.value
+		}
+	}
+	return set, nil
+}
+
+// symbolsFlag is the --symbols flag, putting the symbol set it names in use
+// as soon as it is parsed
+type symbolsFlag string
+
+func (f *symbolsFlag) String() string {
+	return string(*f)
+}
+
+func (f *symbolsFlag) Set(value string) error {
+	set, err := loadSymbols(value)
+	if err != nil {
+		return err
+	}
+	useSymbols(set)
+	*f = symbolsFlag(value)
+	return nil
+}
@@ -0,0 +1,321 @@
+package mapper
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// traceExportTimeout bounds the export of one trace
+const traceExportTimeout = 10 * time.Second
+
+// tracing is where the traces of the run go, set by --otlp-endpoint,
+// --trace-file or the OTEL_EXPORTER_OTLP_* environment variables. Tracing is
+// off while none is set
+var tracing struct {
+	endpoint string
+	fromEnv  bool
+	file     string
+}
+
+// traceProvider is the OpenTelemetry SDK provider of the run, created on
+// first use, nil when tracing is off
+var (
+	traceProvider     *sdktrace.TracerProvider
+	traceProviderOnce sync.Once
+)
+
+// tracingEnabled reports whether the traces of the run are exported
+func tracingEnabled() bool {
+	return tracing.endpoint != "" || tracing.fromEnv || tracing.file != ""
+}
+
+// tracingFromEnv enables OTLP export when the standard OpenTelemetry
+// environment variables name an endpoint. The exporter reads them, headers
+// included
+func tracingFromEnv() {
+	tracing.fromEnv = os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != ""
+}
+
+// otlpEndpointFlag is the --otlp-endpoint flag, exporting traces to an
+// OTLP/HTTP collector
+type otlpEndpointFlag string
+
+func (f *otlpEndpointFlag) String() string {
+	return string(*f)
+}
+
+func (f *otlpEndpointFlag) Set(value string) error {
+	if !strings.HasPrefix(value, "http://") && !strings.HasPrefix(value, "https://") {
+		return fmt.Errorf("expected an http:// or https:// URL, such as http://localhost:4318/v1/traces")
+	}
+	tracing.endpoint = value
+	*f = otlpEndpointFlag(value)
+	return nil
+}
+
+// traceFileFlag is the --trace-file flag, appending traces to a file in the
+// OTLP JSON format
+type traceFileFlag string
+
+func (f *traceFileFlag) String() string {
+	return string(*f)
+}
+
+func (f *traceFileFlag) Set(value string) error {
+	tracing.file = value
+	*f = traceFileFlag(value)
+	return nil
+}
+
+// tracer returns the tracer of the run, a no-op one when tracing is off
+func tracer() trace.Tracer {
+	traceProviderOnce.Do(func() {
+		if tracingEnabled() {
+			traceProvider = newTraceProvider()
+		}
+	})
+	if traceProvider == nil {
+		return noop.NewTracerProvider().Tracer("")
+	}
+	return traceProvider.Tracer("k8s-resource-mapper")
+}
+
+// newTraceProvider creates the provider exporting to the trace file and the
+// OTLP/HTTP collector selected
+func newTraceProvider() *sdktrace.TracerProvider {
+	service := os.Getenv("OTEL_SERVICE_NAME")
+	if service == "" {
+		service = "k8s-resource-mapper"
+	}
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", service))),
+	}
+	ctx := context.Background()
+	if tracing.file != "" {
+		exporter, err := otlptrace.New(ctx, traceFileClient{path: tracing.file})
+		if err != nil {
+			fmt.Printf("%sWarning: error creating the trace file exporter: %v%s\n", colorYellow, err, colorReset)
+		} else {
+			opts = append(opts, sdktrace.WithSpanProcessor(newTraceProcessor(exporter)))
+		}
+	}
+	if tracing.endpoint != "" || tracing.fromEnv {
+		httpOpts := []otlptracehttp.Option{otlptracehttp.WithTimeout(traceExportTimeout)}
+		if tracing.endpoint != "" {
+			httpOpts = append(httpOpts, otlptracehttp.WithEndpointURL(tracing.endpoint))
+		}
+		exporter, err := otlptracehttp.New(ctx, httpOpts...)
+		if err != nil {
+			fmt.Printf("%sWarning: error creating the OTLP exporter: %v%s\n", colorYellow, err, colorReset)
+		} else {
+			opts = append(opts, sdktrace.WithSpanProcessor(newTraceProcessor(exporter)))
+		}
+	}
+	return sdktrace.NewTracerProvider(opts...)
+}
+
+// startSpan starts a span for a step of the mapper as a child of the span in
+// ctx. The returned context carries the span, to pass to the work of the
+// step, and the returned function ends it with the step's error
+func startSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, func(err error)) {
+	ctx, span := tracer().Start(ctx, name, trace.WithAttributes(attributes...))
+	return ctx, func(err error) {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// traced runs a processor of a namespace in a span named after it, as a
+// child of the span in ctx
+func traced(ctx context.Context, name, namespace string, process func(string) error) error {
+	_, end := startSpan(ctx, name, attribute.String("k8s.namespace.name", namespace))
+	err := process(namespace)
+	end(err)
+	return err
+}
+
+// tracingTransport records a span for each API call and propagates it to the
+// API server in a traceparent header
+type tracingTransport struct {
+	next http.RoundTripper
+}
+
+func (t tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := tracer().Start(req.Context(), req.Method+" "+req.URL.Path,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.full", req.URL.String()),
+			attribute.String("server.address", req.URL.Host)))
+	defer span.End()
+	req = req.Clone(ctx)
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return resp, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	return resp, nil
+}
+
+// traceProcessor exports each trace once its root span ends, rather than in
+// batches on a timer, so that no trace is lost when the process exits right
+// after a step. Failures are reported once and do not fail the run
+type traceProcessor struct {
+	exporter sdktrace.SpanExporter
+
+	mu sync.Mutex
+	// pending holds the ended spans of each trace whose root is still open
+	pending map[trace.TraceID][]sdktrace.ReadOnlySpan
+	warned  bool
+}
+
+// newTraceProcessor creates a processor exporting to an exporter
+func newTraceProcessor(exporter sdktrace.SpanExporter) *traceProcessor {
+	return &traceProcessor{exporter: exporter, pending: map[trace.TraceID][]sdktrace.ReadOnlySpan{}}
+}
+
+func (p *traceProcessor) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+func (p *traceProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	id := s.SpanContext().TraceID()
+	p.mu.Lock()
+	p.pending[id] = append(p.pending[id], s)
+	var spans []sdktrace.ReadOnlySpan
+	if !s.Parent().IsValid() {
+		spans = p.pending[id]
+		delete(p.pending, id)
+	}
+	p.mu.Unlock()
+	if spans != nil {
+		p.export(spans)
+	}
+}
+
+// ForceFlush exports the spans of the traces still open
+func (p *traceProcessor) ForceFlush(context.Context) error {
+	p.mu.Lock()
+	var spans []sdktrace.ReadOnlySpan
+	for _, pending := range p.pending {
+		spans = append(spans, pending...)
+	}
+	p.pending = map[trace.TraceID][]sdktrace.ReadOnlySpan{}
+	p.mu.Unlock()
+	if len(spans) > 0 {
+		p.export(spans)
+	}
+	return nil
+}
+
+func (p *traceProcessor) Shutdown(ctx context.Context) error {
+	p.ForceFlush(ctx)
+	return p.exporter.Shutdown(ctx)
+}
+
+// export sends spans to the exporter, reporting the first failure
+func (p *traceProcessor) export(spans []sdktrace.ReadOnlySpan) {
+	ctx, cancel := context.WithTimeout(context.Background(), traceExportTimeout)
+	defer cancel()
+	if err := p.exporter.ExportSpans(ctx, spans); err != nil {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if !p.warned {
+			fmt.Printf("%sWarning: error exporting traces: %v%s\n", colorYellow, err, colorReset)
+			p.warned = true
+		}
+	}
+}
+
+// traceFileClient is the otlptrace client of --trace-file, appending each
+// export request to a file, one per line
+type traceFileClient struct {
+	path string
+}
+
+func (c traceFileClient) Start(context.Context) error { return nil }
+
+func (c traceFileClient) Stop(context.Context) error { return nil }
+
+func (c traceFileClient) UploadTraces(_ context.Context, spans []*tracepb.ResourceSpans) error {
+	data, err := otlpJSON(&coltracepb.ExportTraceServiceRequest{ResourceSpans: spans})
+	if err != nil {
+		return fmt.Errorf("error encoding traces: %v", err)
+	}
+	return appendTrace(c.path, data)
+}
+
+// otlpJSON encodes an export request in the OTLP JSON encoding, which
+// differs from the canonical JSON of protobuf messages in its hex trace and
+// span IDs and integer enums
+func otlpJSON(req *coltracepb.ExportTraceServiceRequest) ([]byte, error) {
+	data, err := protojson.MarshalOptions{UseEnumNumbers: true}.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	hexIDs(doc)
+	return json.Marshal(doc)
+}
+
+// hexIDs rewrites the base64 trace and span IDs of decoded OTLP JSON in hex
+func hexIDs(v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if id, ok := value.(string); ok && (key == "traceId" || key == "spanId" || key == "parentSpanId") {
+				if raw, err := base64.StdEncoding.DecodeString(id); err == nil {
+					v[key] = hex.EncodeToString(raw)
+				}
+				continue
+			}
+			hexIDs(value)
+		}
+	case []any:
+		for _, item := range v {
+			hexIDs(item)
+		}
+	}
+}
+
+// appendTrace appends an export request to a file, one per line
+func appendTrace(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening trace file: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing trace file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package mapper
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+func TestTraceProcessorExportsAtRootEnd(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(newTraceProcessor(exporter)))
+	tracer := provider.Tracer("test")
+
+	ctx, root := tracer.Start(context.Background(), "namespace")
+	_, child := tracer.Start(ctx, "GET /api/v1/namespaces/shop/pods")
+	child.End()
+	if got := len(exporter.GetSpans()); got != 0 {
+		t.Fatalf("spans exported before the root ended = %d, want 0", got)
+	}
+	root.End()
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("spans exported = %d, want 2", len(spans))
+	}
+	if spans[0].Parent.SpanID() != spans[1].SpanContext.SpanID() {
+		t.Errorf("API call span is not a child of the namespace span")
+	}
+}
+
+func TestOTLPJSON(t *testing.T) {
+	req := &coltracepb.ExportTraceServiceRequest{ResourceSpans: []*tracepb.ResourceSpans{{
+		ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{{
+			TraceId:      []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10},
+			SpanId:       []byte{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff, 0x00, 0x11},
+			ParentSpanId: []byte{0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88},
+			Name:         "buildGraph",
+			Kind:         tracepb.Span_SPAN_KIND_CLIENT,
+		}}}},
+	}}}
+	data, err := otlpJSON(req)
+	if err != nil {
+		t.Fatalf("otlpJSON: %v", err)
+	}
+	var doc struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []map[string]any `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("decoding %s: %v", data, err)
+	}
+	span := doc.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	want := map[string]any{
+		"traceId":      "0102030405060708090a0b0c0d0e0f10",
+		"spanId":       "aabbccddeeff0011",
+		"parentSpanId": "1122334455667788",
+		"kind":         float64(3),
+	}
+	for key, value := range want {
+		if span[key] != value {
+			t.Errorf("%s = %v, want %v", key, span[key], value)
+		}
+	}
+}
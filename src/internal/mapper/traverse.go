@@ -0,0 +1,199 @@
+package mapper
+
+import (
+	"sort"
+	"strings"
+)
+
+// Direction is the way traversals follow relationships
+type Direction string
+
+// Directions of traversals: along relationships, against them, or both
+const (
+	DirectionOut  Direction = traverseOut
+	DirectionIn   Direction = traverseIn
+	DirectionBoth Direction = traverseBoth
+)
+
+// Neighbors returns the resources one relationship away from a resource, in
+// the order of the relationships, over the relationship types given or any
+// when none are
+func (g *Graph) Neighbors(key ResourceKey, direction Direction, types ...string) []ResourceKey {
+	follows := followsTypes(types)
+	idx := g.indexed()
+	seen := map[ResourceKey]bool{}
+	neighbors := []ResourceKey{}
+	add := func(positions []int, forward bool) {
+		for _, i := range positions {
+			rel := g.Relationships[i]
+			other := rel.To
+			if !forward {
+				other = rel.From
+			}
+			if follows(rel.Type) && !seen[other] {
+				seen[other] = true
+				neighbors = append(neighbors, other)
+			}
+		}
+	}
+	if direction != DirectionIn {
+		add(idx.out[key], true)
+	}
+	if direction != DirectionOut {
+		add(idx.in[key], false)
+	}
+	return neighbors
+}
+
+// Subgraph returns the resources within depth relationships of the roots, in
+// either direction, and the relationships leading to them
+func (g *Graph) Subgraph(roots []ResourceKey, depth int) *Graph {
+	return g.walk(roots, depth, DirectionBoth, followsTypes(nil))
+}
+
+// TopologicalLayers orders the resources in layers, each relating only to
+// resources of earlier layers: the first holds those relating to none, such
+// as ConfigMaps and Nodes, then come the Pods using them, the Deployments and
+// Services managing and selecting the Pods, the Ingresses routing to the
+// Services and so on. Resources relating to each other in a cycle, such as a
+// Pod starting after the Service selecting it, share a layer
+func (g *Graph) TopologicalLayers() [][]ResourceKey {
+	idx := g.indexed()
+	// Tarjan's algorithm finds the cycles, completing each after those it
+	// relates to, so that its layer follows theirs
+	index := map[ResourceKey]int{}
+	low := map[ResourceKey]int{}
+	onStack := map[ResourceKey]bool{}
+	layer := map[ResourceKey]int{}
+	stack := []ResourceKey{}
+	layers := [][]ResourceKey{}
+	var visit func(key ResourceKey)
+	visit = func(key ResourceKey) {
+		index[key], low[key] = len(index), len(index)
+		stack = append(stack, key)
+		onStack[key] = true
+		for _, i := range idx.out[key] {
+			to := g.Relationships[i].To
+			if _, ok := idx.resources[to]; !ok {
+				continue
+			}
+			if _, visited := index[to]; !visited {
+				visit(to)
+				low[key] = min(low[key], low[to])
+			} else if onStack[to] {
+				low[key] = min(low[key], index[to])
+			}
+		}
+		if low[key] != index[key] {
+			return
+		}
+		cycle := map[ResourceKey]bool{}
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			cycle[top] = true
+			if top == key {
+				break
+			}
+		}
+		level := 0
+		for member := range cycle {
+			for _, i := range idx.out[member] {
+				if to := g.Relationships[i].To; !cycle[to] {
+					if l, ok := layer[to]; ok {
+						level = max(level, l+1)
+					}
+				}
+			}
+		}
+		for len(layers) <= level {
+			layers = append(layers, []ResourceKey{})
+		}
+		for member := range cycle {
+			layer[member] = level
+			layers[level] = append(layers[level], member)
+		}
+	}
+	for _, res := range g.Resources {
+		if _, visited := index[res.Key()]; !visited {
+			visit(res.Key())
+		}
+	}
+	for _, keys := range layers {
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	}
+	return layers
+}
+
+// walk walks relationships breadth first from roots, up to depth hops in a
+// direction, over the relationship types follows accepts. It returns the
+// resources reached and the relationships walked, in the order of the graph
+func (g *Graph) walk(roots []ResourceKey, depth int, direction Direction, follows func(string) bool) *Graph {
+	visited := map[ResourceKey]bool{}
+	frontier := []ResourceKey{}
+	for _, key := range roots {
+		if !visited[key] {
+			visited[key] = true
+			frontier = append(frontier, key)
+		}
+	}
+
+	idx := g.indexed()
+	used := map[int]bool{}
+	for hop := 0; hop < depth && len(frontier) > 0; hop++ {
+		next := []ResourceKey{}
+		follow := func(positions []int, forward bool) {
+			for _, i := range positions {
+				rel := g.Relationships[i]
+				if !follows(rel.Type) {
+					continue
+				}
+				other := rel.To
+				if !forward {
+					other = rel.From
+				}
+				used[i] = true
+				if !visited[other] {
+					visited[other] = true
+					next = append(next, other)
+				}
+			}
+		}
+		for _, key := range frontier {
+			if direction != DirectionIn {
+				follow(idx.out[key], true)
+			}
+			if direction != DirectionOut {
+				follow(idx.in[key], false)
+			}
+		}
+		frontier = next
+	}
+
+	sub := &Graph{Resources: []Resource{}, Relationships: []Relationship{}}
+	for _, res := range g.Resources {
+		if visited[res.Key()] {
+			sub.Resources = append(sub.Resources, res)
+		}
+	}
+	for i, rel := range g.Relationships {
+		if used[i] {
+			sub.Relationships = append(sub.Relationships, rel)
+		}
+	}
+	return sub
+}
+
+// followsTypes accepts the relationship types given, compared
+// case-insensitively, or any when none are
+func followsTypes(types []string) func(string) bool {
+	if len(types) == 0 {
+		return func(string) bool { return true }
+	}
+	accepted := map[string]bool{}
+	for _, t := range types {
+		accepted[strings.ToLower(t)] = true
+	}
+	return func(relType string) bool { return accepted[strings.ToLower(relType)] }
+}
@@ -0,0 +1,202 @@
+package mapper
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// traverseTestGraph maps an ingress routing to a service that selects the
+// pods of a deployment, which mount a ConfigMap
+func traverseTestGraph(t *testing.T) *Graph {
+	t.Helper()
+	web := map[string]string{"app": "web"}
+	spec := corev1.PodSpec{Volumes: []corev1.Volume{configMapVolume("app-config", false)}}
+	return testGraph(t,
+		testIngress("web", "web"),
+		testService("web", web),
+		testDeployment("web", web),
+		testPod("web-1", web, spec),
+		testPod("web-2", web, spec),
+		&corev1.ConfigMap{ObjectMeta: testMeta("app-config", nil)},
+	)
+}
+
+func keyStrings(keys []ResourceKey) []string {
+	names := []string{}
+	for _, key := range keys {
+		names = append(names, key.String())
+	}
+	return names
+}
+
+func shopKey(kind, name string) ResourceKey {
+	return ResourceKey{Kind: kind, Namespace: "shop", Name: name}
+}
+
+func TestNeighbors(t *testing.T) {
+	g := traverseTestGraph(t)
+	tests := []struct {
+		name      string
+		key       ResourceKey
+		direction Direction
+		types     []string
+		want      []string
+	}{
+		{
+			name:      "out",
+			key:       shopKey("Service", "web"),
+			direction: DirectionOut,
+			want:      []string{"Pod/shop/web-1", "Pod/shop/web-2"},
+		},
+		{
+			name:      "in",
+			key:       shopKey("Service", "web"),
+			direction: DirectionIn,
+			want:      []string{"Ingress/shop/web"},
+		},
+		{
+			name:      "both",
+			key:       shopKey("Pod", "web-1"),
+			direction: DirectionBoth,
+			want:      []string{"ConfigMap/shop/app-config", "Service/shop/web", "Deployment/shop/web"},
+		},
+		{
+			name:      "types compared case-insensitively",
+			key:       shopKey("Pod", "web-1"),
+			direction: DirectionBoth,
+			types:     []string{"MANAGES", "uses"},
+			want:      []string{"ConfigMap/shop/app-config", "Deployment/shop/web"},
+		},
+		{
+			name:      "shared neighbour listed once",
+			key:       shopKey("ConfigMap", "app-config"),
+			direction: DirectionIn,
+			want:      []string{"Pod/shop/web-1", "Pod/shop/web-2"},
+		},
+		{
+			name:      "missing resource",
+			key:       shopKey("Pod", "gone"),
+			direction: DirectionBoth,
+			want:      []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := keyStrings(g.Neighbors(tt.key, tt.direction, tt.types...))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Neighbors = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubgraph(t *testing.T) {
+	g := traverseTestGraph(t)
+	tests := []struct {
+		name      string
+		roots     []ResourceKey
+		depth     int
+		want      []string
+		wantEdges int
+	}{
+		{
+			name:      "depth 0 keeps the roots",
+			roots:     []ResourceKey{shopKey("Service", "web")},
+			depth:     0,
+			want:      []string{"Service/shop/web"},
+			wantEdges: 0,
+		},
+		{
+			name:      "depth 1 in either direction",
+			roots:     []ResourceKey{shopKey("Service", "web")},
+			depth:     1,
+			want:      []string{"Ingress/shop/web", "Pod/shop/web-1", "Pod/shop/web-2", "Service/shop/web"},
+			wantEdges: 3,
+		},
+		{
+			name:  "depth 2 reaches the ConfigMap and deployment",
+			roots: []ResourceKey{shopKey("Service", "web")},
+			depth: 2,
+			want: []string{"ConfigMap/shop/app-config", "Deployment/shop/web", "Ingress/shop/web",
+				"Pod/shop/web-1", "Pod/shop/web-2", "Service/shop/web"},
+			wantEdges: 7,
+		},
+		{
+			name:      "duplicate roots",
+			roots:     []ResourceKey{shopKey("Ingress", "web"), shopKey("Ingress", "web")},
+			depth:     1,
+			want:      []string{"Ingress/shop/web", "Service/shop/web"},
+			wantEdges: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := g.Subgraph(tt.roots, tt.depth)
+			got := []string{}
+			for _, res := range sub.Resources {
+				got = append(got, res.Key().String())
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Subgraph resources = %q, want %q", got, tt.want)
+			}
+			if len(sub.Relationships) != tt.wantEdges {
+				t.Errorf("Subgraph relationships = %d, want %d", len(sub.Relationships), tt.wantEdges)
+			}
+		})
+	}
+}
+
+func TestTopologicalLayers(t *testing.T) {
+	a, b, c := ResourceKey{Kind: "Pod", Name: "a"}, ResourceKey{Kind: "Pod", Name: "b"}, ResourceKey{Kind: "Pod", Name: "c"}
+	resources := []Resource{{Kind: "Pod", Name: "a"}, {Kind: "Pod", Name: "b"}, {Kind: "Pod", Name: "c"}}
+	tests := []struct {
+		name          string
+		relationships []Relationship
+		want          [][]string
+	}{
+		{
+			name: "no relationships",
+			want: [][]string{{"Pod//a", "Pod//b", "Pod//c"}},
+		},
+		{
+			name:          "chain",
+			relationships: []Relationship{{From: a, To: b}, {From: b, To: c}},
+			want:          [][]string{{"Pod//c"}, {"Pod//b"}, {"Pod//a"}},
+		},
+		{
+			name:          "cycle shares a layer",
+			relationships: []Relationship{{From: a, To: b}, {From: b, To: a}, {From: b, To: c}},
+			want:          [][]string{{"Pod//c"}, {"Pod//a", "Pod//b"}},
+		},
+		{
+			name:          "relationship to a missing resource",
+			relationships: []Relationship{{From: a, To: ResourceKey{Kind: "Secret", Name: "gone"}}},
+			want:          [][]string{{"Pod//a", "Pod//b", "Pod//c"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &Graph{Resources: resources, Relationships: tt.relationships}
+			got := [][]string{}
+			for _, layer := range g.TopologicalLayers() {
+				got = append(got, keyStrings(layer))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TopologicalLayers = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// A mapped namespace layers ConfigMaps first and the ingress last
+	layers := traverseTestGraph(t).TopologicalLayers()
+	if first := keyStrings(layers[0]); !reflect.DeepEqual(first, []string{"ConfigMap/shop/app-config"}) {
+		t.Errorf("first layer = %q, want the ConfigMap", first)
+	}
+	if last := keyStrings(layers[len(layers)-1]); !reflect.DeepEqual(last, []string{"Ingress/shop/web"}) {
+		t.Errorf("last layer = %q, want the ingress", last)
+	}
+}
@@ -0,0 +1,134 @@
+package mapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// findingsRecord holds the findings of a namespace at the end of a run
+type findingsRecord struct {
+	Time       time.Time      `json:"time"`
+	Namespace  string         `json:"namespace"`
+	Total      int            `json:"total"`
+	BySeverity map[string]int `json:"bySeverity"`
+	ByRule     map[string]int `json:"byRule"`
+	Findings   []string       `json:"findings"`
+}
+
+// findingsSeries is the snapshot store series holding finding records
+const findingsSeries = "findings"
+
+// trendHistory is the number of runs shown in the finding count history
+const trendHistory = 5
+
+// findingKey identifies a finding across runs
+func findingKey(f Finding) string {
+	return f.Rule + " " + f.Resource()
+}
+
+// newFindingsRecord summarizes the findings of a namespace
+func newFindingsRecord(namespace string, findings []Finding) findingsRecord {
+	record := findingsRecord{
+		Time:       time.Now(),
+		Namespace:  namespace,
+		Total:      len(findings),
+		BySeverity: map[string]int{},
+		ByRule:     map[string]int{},
+		Findings:   []string{},
+	}
+	for _, f := range findings {
+		record.BySeverity[f.Severity]++
+		record.ByRule[f.Rule]++
+		record.Findings = append(record.Findings, findingKey(f))
+	}
+	sort.Strings(record.Findings)
+	return record
+}
+
+// findingsHistory returns the recorded findings of a namespace, oldest first
+func findingsHistory(store *snapshotStore, namespace string) ([]findingsRecord, error) {
+	records, err := store.records(findingsSeries)
+	if err != nil {
+		return nil, err
+	}
+	var history []findingsRecord
+	for _, raw := range records {
+		var record findingsRecord
+		if err := json.Unmarshal(raw, &record); err != nil {
+			continue
+		}
+		if record.Namespace == namespace {
+			history = append(history, record)
+		}
+	}
+	return history, nil
+}
+
+// diffFindings returns the findings of the current run that were not in the
+// previous one, and those of the previous run that are gone
+func diffFindings(previous, current []string) ([]string, []string) {
+	before := make(map[string]bool, len(previous))
+	for _, key := range previous {
+		before[key] = true
+	}
+	after := make(map[string]bool, len(current))
+	var added []string
+	for _, key := range current {
+		after[key] = true
+		if !before[key] {
+			added = append(added, key)
+		}
+	}
+	var resolved []string
+	for _, key := range previous {
+		if !after[key] {
+			resolved = append(resolved, key)
+		}
+	}
+	return added, resolved
+}
+
+// showFindingsTrend shows how the findings of a namespace changed since the
+// previous run, and records them in the snapshot store
+func (rm *ResourceMapper) showFindingsTrend(namespace string, findings []Finding, store *snapshotStore) error {
+	history, err := findingsHistory(store, namespace)
+	if err != nil {
+		return err
+	}
+	record := newFindingsRecord(namespace, findings)
+
+	fmt.Printf("\n%sFindings trend for namespace: %s%s\n", colorCyan, namespace, colorReset)
+	if len(history) == 0 {
+		fmt.Printf(sym("└── Findings: %d (first recorded run)\n"), record.Total)
+		return store.append(findingsSeries, record)
+	}
+
+	prev := history[len(history)-1]
+	counts := []string{}
+	if len(history) > trendHistory-1 {
+		history = history[len(history)-(trendHistory-1):]
+	}
+	for _, h := range history {
+		counts = append(counts, fmt.Sprint(h.Total))
+	}
+	counts = append(counts, fmt.Sprint(record.Total))
+
+	fmt.Printf(sym("├── Findings: %d%s (errors %d, warnings %d, info %d)\n"), record.Total,
+		formatDelta(float64(record.Total), float64(prev.Total)),
+		record.BySeverity[severityError], record.BySeverity[severityWarning], record.BySeverity[severityInfo])
+	fmt.Printf(sym("├── Last %d runs: %s\n"), len(counts), strings.Join(counts, sym(" → ")))
+	since := prev.Time.Local().Format("2006-01-02 15:04")
+	added, resolved := diffFindings(prev.Findings, record.Findings)
+	fmt.Printf(sym("├── %sNew since %s: %d%s\n"), colorYellow, since, len(added), colorReset)
+	for _, key := range added {
+		fmt.Printf(sym("│   %s %s\n"), rm.createArrow(4), key)
+	}
+	fmt.Printf(sym("└── %sResolved since %s: %d%s\n"), colorGreen, since, len(resolved), colorReset)
+	for _, key := range resolved {
+		fmt.Printf("    %s %s\n", rm.createArrow(4), key)
+	}
+	return store.append(findingsSeries, record)
+}
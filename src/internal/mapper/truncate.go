@@ -0,0 +1,176 @@
+package mapper
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// listPageSize is the page size of the lists capped by
+// --max-resources-per-namespace, which stop paging once the cap is reached
+const listPageSize = 500
+
+// Truncation is a resource type of a namespace holding more objects than
+// --max-resources-per-namespace: only the first ones were listed and mapped
+type Truncation struct {
+	// Namespace is empty for the lists of the whole cluster
+	Namespace string `json:"namespace"`
+	// Source is the resource type that was truncated
+	Source string `json:"source"`
+	// Listed is the number of objects mapped, Total the number of objects
+	// the API server estimated, zero when it did not tell
+	Listed int   `json:"listed"`
+	Total  int64 `json:"total,omitempty"`
+}
+
+// String describes a truncation for the outputs
+func (t Truncation) String() string {
+	if t.Total > 0 {
+		return fmt.Sprintf("%s: first %d of ~%d mapped", t.Source, t.Listed, t.Total)
+	}
+	return fmt.Sprintf("%s: first %d mapped", t.Source, t.Listed)
+}
+
+// truncations keeps the truncated types of a mapper, safe for the concurrent
+// lists of the worker pool
+type truncations struct {
+	mu   sync.Mutex
+	list []Truncation
+}
+
+// setMaxResources caps the objects listed per type and namespace, 0 for no
+// limit
+func (rm *ResourceMapper) setMaxResources(max int) error {
+	if max < 0 {
+		return fmt.Errorf("--max-resources-per-namespace cannot be negative")
+	}
+	rm.maxResources = max
+	return nil
+}
+
+// pagedList lists a type of a namespace with the selectors of the mapper.
+// Without a maximum it is listed at once; with one it is listed in pages,
+// stopping and recording a truncation once the maximum is reached, so that
+// a huge namespace costs at most the maximum of objects in memory
+func pagedList[T any](rm *ResourceMapper, namespace, what string, list func(opts metav1.ListOptions) ([]T, metav1.ListInterface, error)) ([]T, error) {
+	opts := rm.listOptions(what)
+	if rm.maxResources == 0 {
+		items, _, err := list(opts)
+		return items, err
+	}
+	opts.Limit = int64(min(rm.maxResources, listPageSize))
+	var items []T
+	for {
+		page, meta, err := list(opts)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page...)
+		more := meta != nil && meta.GetContinue() != ""
+		if len(items) > rm.maxResources || (len(items) == rm.maxResources && more) {
+			total := int64(len(items))
+			if meta != nil && meta.GetRemainingItemCount() != nil {
+				total += *meta.GetRemainingItemCount()
+			} else if more {
+				total = 0
+			}
+			rm.truncate(Truncation{Namespace: namespace, Source: what, Listed: rm.maxResources, Total: total})
+			return items[:rm.maxResources], nil
+		}
+		if !more {
+			return items, nil
+		}
+		opts.Continue = meta.GetContinue()
+	}
+}
+
+// capped keeps the first objects of a type held in memory, such as by
+// watches, up to the maximum, recording a truncation when there are more
+func capped[T any](rm *ResourceMapper, namespace, what string, items []T) []T {
+	if rm.maxResources == 0 || len(items) <= rm.maxResources {
+		return items
+	}
+	rm.truncate(Truncation{Namespace: namespace, Source: what, Listed: rm.maxResources, Total: int64(len(items))})
+	return items[:rm.maxResources]
+}
+
+// truncate records a truncated type, replacing an earlier truncation of the
+// type, and reports it on stderr so as not to corrupt JSON outputs
+func (rm *ResourceMapper) truncate(t Truncation) {
+	rm.truncated.mu.Lock()
+	defer rm.truncated.mu.Unlock()
+	for i, seen := range rm.truncated.list {
+		if seen.Namespace == t.Namespace && seen.Source == t.Source {
+			rm.truncated.list[i] = t
+			return
+		}
+	}
+	rm.truncated.list = append(rm.truncated.list, t)
+	fmt.Fprintf(os.Stderr, "%s[truncated] %s in %s (--max-resources-per-namespace %d)%s\n",
+		colorYellow, t, t.scope(), rm.maxResources, colorReset)
+}
+
+// scope names where a truncated type was listed
+func (t Truncation) scope() string {
+	if t.Namespace == "" {
+		return "the cluster"
+	}
+	return "namespace " + t.Namespace
+}
+
+// truncatedIn returns the truncated types of a namespace
+func (rm *ResourceMapper) truncatedIn(namespace string) []Truncation {
+	rm.truncated.mu.Lock()
+	defer rm.truncated.mu.Unlock()
+	var in []Truncation
+	for _, t := range rm.truncated.list {
+		if t.Namespace == namespace {
+			in = append(in, t)
+		}
+	}
+	return in
+}
+
+// forgetTruncations drops the truncations of a namespace about to be listed
+// again
+func (rm *ResourceMapper) forgetTruncations(namespace string) {
+	rm.truncated.mu.Lock()
+	defer rm.truncated.mu.Unlock()
+	kept := rm.truncated.list[:0]
+	for _, t := range rm.truncated.list {
+		if t.Namespace != namespace {
+			kept = append(kept, t)
+		}
+	}
+	rm.truncated.list = kept
+}
+
+// printTruncations summarizes the truncated types, grouped by namespace
+func (rm *ResourceMapper) printTruncations() {
+	rm.truncated.mu.Lock()
+	defer rm.truncated.mu.Unlock()
+	if len(rm.truncated.list) == 0 {
+		return
+	}
+	byNamespace := map[string][]string{}
+	for _, t := range rm.truncated.list {
+		byNamespace[t.Namespace] = append(byNamespace[t.Namespace], t.String())
+	}
+	fmt.Printf("\n%sTruncated: more than %d objects of a type, only the first were mapped (--max-resources-per-namespace)%s\n",
+		colorYellow, rm.maxResources, colorReset)
+	namespaces := sortedKeys(byNamespace)
+	for i, ns := range namespaces {
+		branch := sym("├──")
+		if i == len(namespaces)-1 {
+			branch = sym("└──")
+		}
+		label := ns
+		if ns == "" {
+			label = "cluster-wide"
+		}
+		fmt.Printf("%s %s: %s\n", branch, label, strings.Join(byNamespace[ns], ", "))
+	}
+}
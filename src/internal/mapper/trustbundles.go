@@ -0,0 +1,235 @@
+package mapper
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// caBundleNames are the trust bundles Kubernetes, OpenShift and Istio
+// distribute under well-known names
+var caBundleNames = map[string]bool{
+	"kube-root-ca.crt":         true,
+	"openshift-service-ca.crt": true,
+	"trusted-ca-bundle":        true,
+	"istio-ca-root-cert":       true,
+}
+
+// caBundleMarkers are the labels and annotations asking OpenShift or
+// trust-manager to inject a CA bundle into an object
+var caBundleMarkers = []string{
+	"config.openshift.io/inject-trusted-cabundle",
+	"service.beta.openshift.io/inject-cabundle",
+	"trust.cert-manager.io/bundle",
+}
+
+// caKeyWords are the words of a key name that mark a certificate file as a
+// CA rather than a leaf certificate, such as ca.crt or ca-bundle.pem
+var caKeyWords = map[string]bool{"ca": true, "cabundle": true, "bundle": true, "trust": true, "trusted": true, "root": true}
+
+// caExpiryWarning is how close to expiry a CA certificate gets highlighted
+const caExpiryWarning = 30 * 24 * time.Hour
+
+// serviceAccountVolumePrefix names the projected volumes the API server
+// injects into every pod, carrying kube-root-ca.crt with the token
+const serviceAccountVolumePrefix = "kube-api-access-"
+
+// trustBundle is a ConfigMap or Secret holding CA certificates
+type trustBundle struct {
+	kind string
+	name string
+	// keys maps each CA key to the certificates it holds
+	keys map[string][]*x509.Certificate
+}
+
+// isCAKey reports whether a key holds CA certificates, by its name
+func isCAKey(key string) bool {
+	lower := strings.ToLower(key)
+	if !strings.HasSuffix(lower, ".crt") && !strings.HasSuffix(lower, ".pem") {
+		return false
+	}
+	words := strings.FieldsFunc(lower, func(r rune) bool { return r == '.' || r == '-' || r == '_' })
+	for _, word := range words {
+		if caKeyWords[word] {
+			return true
+		}
+	}
+	return false
+}
+
+// isTrustBundle reports whether an object is a trust bundle by its name,
+// labels or annotations, whatever its keys are called
+func isTrustBundle(meta metav1.ObjectMeta) bool {
+	if caBundleNames[meta.Name] {
+		return true
+	}
+	for _, marker := range caBundleMarkers {
+		if _, ok := meta.Labels[marker]; ok {
+			return true
+		}
+		if _, ok := meta.Annotations[marker]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCertificates decodes the PEM certificates of a key, skipping those
+// that do not parse
+func parseCertificates(data []byte) []*x509.Certificate {
+	certs := []*x509.Certificate{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			certs = append(certs, cert)
+		}
+	}
+}
+
+// newTrustBundle returns the trust bundle held by an object, or nil when
+// none of its keys holds CA certificates
+func newTrustBundle(kind string, meta metav1.ObjectMeta, data map[string][]byte) *trustBundle {
+	marked := isTrustBundle(meta)
+	bundle := &trustBundle{kind: kind, name: meta.Name, keys: map[string][]*x509.Certificate{}}
+	for key, value := range data {
+		if !isCAKey(key) && !(marked && strings.Contains(string(value), "BEGIN CERTIFICATE")) {
+			continue
+		}
+		if certs := parseCertificates(value); len(certs) > 0 {
+			bundle.keys[key] = certs
+		}
+	}
+	if len(bundle.keys) == 0 {
+		return nil
+	}
+	return bundle
+}
+
+// listTrustBundles finds the ConfigMaps and Secrets of a namespace holding CA
+// certificates. Secrets are skipped when they may not be listed
+func (rm *ResourceMapper) listTrustBundles(namespace string) ([]*trustBundle, error) {
+	bundles := []*trustBundle{}
+	configMaps, err := rm.listConfigMaps(namespace)
+	if err != nil {
+		return nil, err
+	}
+	for _, cm := range configMaps {
+		data := map[string][]byte{}
+		for key, value := range cm.Data {
+			data[key] = []byte(value)
+		}
+		for key, value := range cm.BinaryData {
+			data[key] = value
+		}
+		if bundle := newTrustBundle("ConfigMap", cm.ObjectMeta, data); bundle != nil {
+			bundles = append(bundles, bundle)
+		}
+	}
+
+	secrets, allowed, err := rm.listSecrets(namespace)
+	if err != nil || !allowed {
+		return bundles, err
+	}
+	for _, secret := range secrets {
+		// Legacy token secrets all carry the cluster CA
+		if secret.Type == corev1.SecretTypeServiceAccountToken {
+			continue
+		}
+		if bundle := newTrustBundle("Secret", secret.ObjectMeta, secret.Data); bundle != nil {
+			bundles = append(bundles, bundle)
+		}
+	}
+	return bundles, nil
+}
+
+// formatCertificates summarizes the certificates of a key with the first of
+// them to expire, highlighted when it expires soon
+func formatCertificates(certs []*x509.Certificate, now time.Time) string {
+	first := certs[0]
+	for _, cert := range certs[1:] {
+		if cert.NotAfter.Before(first.NotAfter) {
+			first = cert
+		}
+	}
+	color := colorGreen
+	switch {
+	case now.After(first.NotAfter):
+		color = colorRed
+	case first.NotAfter.Sub(now) < caExpiryWarning:
+		color = colorYellow
+	}
+	return fmt.Sprintf("%d certificate(s), first expiry %s%s%s (%s)",
+		len(certs), color, first.NotAfter.Format("2006-01-02"), colorReset, first.Subject.CommonName)
+}
+
+// showTrustBundles lists the CA bundles of a namespace with their
+// certificates and the workloads mounting them, to plan CA rotations
+func (rm *ResourceMapper) showTrustBundles(namespace string) error {
+	bundles, err := rm.listTrustBundles(namespace)
+	if err != nil {
+		return err
+	}
+	if len(bundles) == 0 {
+		return nil
+	}
+	pods, err := rm.listPods(namespace)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	fmt.Printf("\n%sTrust bundles in namespace: %s%s\n", colorCyan, namespace, colorReset)
+	for i, bundle := range bundles {
+		branch, indent := sym("├──"), sym("│  ")
+		if i == len(bundles)-1 {
+			branch, indent = sym("└──"), "   "
+		}
+		fmt.Printf("%s %s: %s\n", branch, bundle.kind, bundle.name)
+		for _, key := range sortedKeys(bundle.keys) {
+			fmt.Printf("%s %s %s: %s\n", indent, rm.createArrow(4), key, formatCertificates(bundle.keys[key], now))
+		}
+
+		consumers := map[string]bool{}
+		tokenPods := 0
+		for j := range pods {
+			injected := false
+			for _, ref := range podConfigReferences(&pods[j]) {
+				if ref.Kind != bundle.kind || ref.Name != bundle.name {
+					continue
+				}
+				if strings.HasPrefix(ref.Usage, "Mounted via projected volume "+serviceAccountVolumePrefix) {
+					injected = true
+					continue
+				}
+				consumers[podOwnerName(&pods[j])] = true
+			}
+			if injected {
+				tokenPods++
+			}
+		}
+		if tokenPods > 0 {
+			fmt.Printf("%s %s injected into %d pod(s) with their service account token\n", indent, rm.createArrow(4), tokenPods)
+		}
+		if len(consumers) == 0 && tokenPods == 0 {
+			fmt.Printf("%s %s %sNot mounted by any workload%s\n", indent, rm.createArrow(4), colorYellow, colorReset)
+			continue
+		}
+		if len(consumers) == 0 {
+			continue
+		}
+		fmt.Printf("%s %s mounted by: %s\n", indent, rm.createArrow(4), strings.Join(sortedKeys(consumers), ", "))
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package mapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// usageBarWidth is the number of cells of a utilization bar
+const usageBarWidth = 20
+
+// podLimits returns the limits of a pod the way its requests are summed: app
+// containers added up, the largest init container as a floor, plus the
+// overhead of its RuntimeClass. Containers without a limit leave it out
+func podLimits(pod *corev1.Pod) corev1.ResourceList {
+	limits := corev1.ResourceList{}
+	for _, container := range pod.Spec.Containers {
+		for name, qty := range container.Resources.Limits {
+			total := limits[name]
+			total.Add(qty)
+			limits[name] = total
+		}
+	}
+	for _, container := range pod.Spec.InitContainers {
+		for name, qty := range container.Resources.Limits {
+			if total, ok := limits[name]; !ok || qty.Cmp(total) > 0 {
+				limits[name] = qty.DeepCopy()
+			}
+		}
+	}
+	for name, qty := range pod.Spec.Overhead {
+		total := limits[name]
+		total.Add(qty)
+		limits[name] = total
+	}
+	return limits
+}
+
+// resourceUsage is the CPU (in cores) and memory (in bytes) a group of pods
+// requests and is limited to, and for nodes and the cluster their allocatable
+// capacity
+type resourceUsage struct {
+	Name              string  `json:"name"`
+	Pods              int     `json:"pods"`
+	CPURequests       float64 `json:"cpuRequests"`
+	CPULimits         float64 `json:"cpuLimits"`
+	MemoryRequests    float64 `json:"memoryRequests"`
+	MemoryLimits      float64 `json:"memoryLimits"`
+	CPUAllocatable    float64 `json:"cpuAllocatable,omitempty"`
+	MemoryAllocatable float64 `json:"memoryAllocatable,omitempty"`
+}
+
+// add adds the footprint and limits of a pod
+func (u *resourceUsage) add(pod *corev1.Pod) {
+	footprint, limits := podFootprint(pod), podLimits(pod)
+	u.Pods++
+	u.CPURequests += quantityOf(footprint, corev1.ResourceCPU)
+	u.MemoryRequests += quantityOf(footprint, corev1.ResourceMemory)
+	u.CPULimits += quantityOf(limits, corev1.ResourceCPU)
+	u.MemoryLimits += quantityOf(limits, corev1.ResourceMemory)
+}
+
+// quantityOf returns a resource of a list as a float, 0 when unset
+func quantityOf(list corev1.ResourceList, name corev1.ResourceName) float64 {
+	qty := list[name]
+	return qty.AsApproximateFloat64()
+}
+
+// usageReport is the usage of the selected namespaces and of the nodes
+type usageReport struct {
+	Namespaces []*resourceUsage `json:"namespaces"`
+	Nodes      []*resourceUsage `json:"nodes"`
+	Cluster    resourceUsage    `json:"cluster"`
+	// NodesPartial is set when only the pods of the selected namespaces could
+	// be listed, so node totals leave the other namespaces out
+	NodesPartial bool `json:"nodesPartial,omitempty"`
+}
+
+// usageOf aggregates the requests and limits of the pods of the selected
+// namespaces per namespace and of every pod per node. Pods are listed across
+// namespaces in one call, falling back to the selected ones when not allowed
+func (rm *ResourceMapper) usageOf(namespaces []string) (*usageReport, error) {
+	nodes, err := rm.listNodes()
+	if err != nil {
+		return nil, err
+	}
+	report := &usageReport{Namespaces: []*resourceUsage{}, Nodes: []*resourceUsage{}, Cluster: resourceUsage{Name: "cluster"}}
+
+	pods, err := rm.listAllPods()
+	if err != nil {
+		pods = nil
+		report.NodesPartial = true
+		for _, ns := range namespaces {
+			nsPods, err := rm.listPods(ns)
+			if err != nil {
+				return nil, err
+			}
+			pods = append(pods, nsPods...)
+		}
+	}
+
+	byNamespace := map[string]*resourceUsage{}
+	for _, ns := range namespaces {
+		byNamespace[ns] = &resourceUsage{Name: ns}
+		report.Namespaces = append(report.Namespaces, byNamespace[ns])
+	}
+	byNode := map[string]*resourceUsage{}
+	for i := range nodes {
+		node := &nodes[i]
+		u := &resourceUsage{
+			Name:              node.Name,
+			CPUAllocatable:    quantityOf(node.Status.Allocatable, corev1.ResourceCPU),
+			MemoryAllocatable: quantityOf(node.Status.Allocatable, corev1.ResourceMemory),
+		}
+		byNode[node.Name] = u
+		report.Nodes = append(report.Nodes, u)
+		report.Cluster.CPUAllocatable += u.CPUAllocatable
+		report.Cluster.MemoryAllocatable += u.MemoryAllocatable
+	}
+	sort.Slice(report.Nodes, func(i, j int) bool { return report.Nodes[i].Name < report.Nodes[j].Name })
+
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		if u := byNode[pod.Spec.NodeName]; u != nil {
+			u.add(pod)
+			report.Cluster.add(pod)
+		}
+		if u := byNamespace[pod.Namespace]; u != nil {
+			u.add(pod)
+		}
+	}
+	return report, nil
+}
+
+// usageBar draws the share of a capacity used as a bar, coloured by how
+// close it is to full, with its percentage
+func usageBar(used, capacity float64) string {
+	if capacity <= 0 {
+		return strings.Repeat(symbols.BarEmpty, usageBarWidth) + "    -"
+	}
+	ratio := used / capacity
+	filled := int(ratio*usageBarWidth + 0.5)
+	if filled > usageBarWidth {
+		filled = usageBarWidth
+	}
+	color := colorGreen
+	switch {
+	case ratio >= 0.9:
+		color = colorRed
+	case ratio >= 0.7:
+		color = colorYellow
+	}
+	return fmt.Sprintf("%s%s%s%s %3.0f%%", color, strings.Repeat(symbols.BarFull, filled), colorReset,
+		strings.Repeat(symbols.BarEmpty, usageBarWidth-filled), ratio*100)
+}
+
+// formatCores formats CPU cores as kubectl does, in millicores below a core
+func formatCores(cores float64) string {
+	if cores < 1 {
+		return fmt.Sprintf("%.0fm", cores*1000)
+	}
+	return fmt.Sprintf("%.2f", cores)
+}
+
+// formatBytes formats memory in binary units
+func formatBytes(bytes float64) string {
+	units := []string{"", "Ki", "Mi", "Gi", "Ti"}
+	i := 0
+	for bytes >= 1024 && i < len(units)-1 {
+		bytes /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f%s", bytes, units[i])
+}
+
+// printUsageLines prints the CPU and memory lines of a group of pods, with
+// bars of requests against capacity and the limits beside them. The capacity
+// is named when it is the group's own
+func printUsageLines(indent string, u *resourceUsage, cpuCapacity, memoryCapacity float64, ownCapacity bool) {
+	cpu, memory := formatCores(u.CPURequests), formatBytes(u.MemoryRequests)
+	if ownCapacity {
+		cpu += " of " + formatCores(cpuCapacity)
+		memory += " of " + formatBytes(memoryCapacity)
+	}
+	fmt.Printf(sym("%s├── CPU    %s  %s requested, limits %s\n"), indent, usageBar(u.CPURequests, cpuCapacity),
+		cpu, formatCores(u.CPULimits))
+	fmt.Printf(sym("%s└── Memory %s  %s requested, limits %s\n"), indent, usageBar(u.MemoryRequests, memoryCapacity),
+		memory, formatBytes(u.MemoryLimits))
+}
+
+// printUsageReport prints the usage of namespaces against the cluster's
+// allocatable capacity and of nodes against their own
+func printUsageReport(report *usageReport) {
+	fmt.Printf("\n%sResource usage from pod specs (requests against allocatable capacity):%s\n", colorCyan, colorReset)
+
+	fmt.Println(sym("├── Namespaces (share of the cluster):"))
+	for i, u := range report.Namespaces {
+		branch, indent := sym("├──"), sym("│   │   ")
+		if i == len(report.Namespaces)-1 {
+			branch, indent = sym("└──"), sym("│       ")
+		}
+		fmt.Printf(sym("│   %s %s (%d pod(s))\n"), branch, u.Name, u.Pods)
+		printUsageLines(indent, u, report.Cluster.CPUAllocatable, report.Cluster.MemoryAllocatable, false)
+	}
+
+	fmt.Println(sym("├── Nodes:"))
+	if len(report.Nodes) == 0 {
+		fmt.Println(sym("│   └── No nodes"))
+	}
+	for i, u := range report.Nodes {
+		branch, indent := sym("├──"), sym("│   │   ")
+		if i == len(report.Nodes)-1 {
+			branch, indent = sym("└──"), sym("│       ")
+		}
+		fmt.Printf(sym("│   %s %s (%d pod(s))\n"), branch, u.Name, u.Pods)
+		printUsageLines(indent, u, u.CPUAllocatable, u.MemoryAllocatable, true)
+	}
+
+	c := &report.Cluster
+	fmt.Printf(sym("└── Cluster (%d node(s), %d pod(s))\n"), len(report.Nodes), c.Pods)
+	printUsageLines("    ", c, c.CPUAllocatable, c.MemoryAllocatable, true)
+	if report.NodesPartial {
+		fmt.Printf("\n%sPods could not be listed across namespaces: node and cluster totals only count the selected namespaces%s\n", colorYellow, colorReset)
+	}
+}
+
+// runUsage runs the usage subcommand: requests and limits per namespace and
+// per node from pod specs, without a metrics pipeline
+func runUsage(args []string) error {
+	var global globalFlags
+	fs := newSubcommandFlagSet("usage", &global)
+	output := fs.String("output", "text", "Output format: text or json")
+	fs.Parse(args)
+
+	if *output != "text" && *output != "json" {
+		return fmt.Errorf("invalid --output value '%s' (expected text or json)", *output)
+	}
+	rm, err := global.newResourceMapper()
+	if err != nil {
+		return err
+	}
+	namespaces, err := global.namespaces(rm)
+	if err != nil {
+		return err
+	}
+	report, err := rm.usageOf(namespaces)
+	if err != nil {
+		return err
+	}
+	if *output == "json" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error encoding usage: %v", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	printUsageReport(report)
+	return nil
+}
@@ -0,0 +1,236 @@
+package mapper
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Watches: how long the initial lists may take, and how long a burst of
+// changes is left to settle before the namespaces it touched are mapped
+const (
+	watchSyncTimeout = 30 * time.Second
+	watchDebounce    = 250 * time.Millisecond
+)
+
+// graphWatcher keeps the objects the graphs are built from in memory,
+// updated by watches, and tracks the namespaces whose objects changed since
+// they were last mapped. Mapping a namespace then reads the watched types
+// from memory instead of listing them, so a change is mapped again without
+// any API call for them
+type graphWatcher struct {
+	clientset kubernetes.Interface
+	factory   informers.SharedInformerFactory
+	stop      chan struct{}
+	// informers are the watched types, by their name in the processor cache
+	informers map[string]cache.SharedIndexInformer
+
+	mu    sync.Mutex
+	dirty map[string]bool
+	// changed is signalled when a namespace becomes dirty
+	changed chan struct{}
+}
+
+// startWatches watches the types the graphs are built from, in one namespace
+// or in all of them, and waits for their initial lists. Types the identity
+// may not list are not watched and keep being listed, as are those whose
+// watch cannot start in time
+func (rm *ResourceMapper) startWatches(namespace string) (*graphWatcher, error) {
+	scope := metav1.NamespaceAll
+	var options []informers.SharedInformerOption
+	if namespace != "" {
+		scope = namespace
+		options = append(options, informers.WithNamespace(namespace))
+	}
+	// The watches select the objects the lists would
+	tweak := func(what string) func(*metav1.ListOptions) {
+		return func(opts *metav1.ListOptions) {
+			selected := rm.listOptions(what)
+			opts.LabelSelector, opts.FieldSelector = selected.LabelSelector, selected.FieldSelector
+		}
+	}
+	options = append(options, informers.WithTweakListOptions(tweak("")))
+	factory := informers.NewSharedInformerFactoryWithOptions(rm.clientset, 0, options...)
+	// Pods and Secrets have fields of their own to select on
+	indexers := cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}
+	factory.InformerFor(&corev1.Pod{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return coreinformers.NewFilteredPodInformer(client, namespace, resync, indexers, tweak("pods"))
+	})
+	factory.InformerFor(&corev1.Secret{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return coreinformers.NewFilteredSecretInformer(client, namespace, resync, indexers, tweak("secrets"))
+	})
+	w := &graphWatcher{
+		clientset: rm.clientset,
+		factory:   factory,
+		stop:      make(chan struct{}),
+		informers: map[string]cache.SharedIndexInformer{},
+		dirty:     map[string]bool{},
+		changed:   make(chan struct{}, 1),
+	}
+	for what, informer := range map[string]func() cache.SharedIndexInformer{
+		"services":               factory.Core().V1().Services().Informer,
+		"pods":                   factory.Core().V1().Pods().Informer,
+		"configmaps":             factory.Core().V1().ConfigMaps().Informer,
+		"secrets":                factory.Core().V1().Secrets().Informer,
+		"deployments":            factory.Apps().V1().Deployments().Informer,
+		"statefulsets":           factory.Apps().V1().StatefulSets().Informer,
+		"HPAs":                   factory.Autoscaling().V2().HorizontalPodAutoscalers().Informer,
+		"ingresses":              factory.Networking().V1().Ingresses().Informer,
+		"endpoint slices":        factory.Discovery().V1().EndpointSlices().Informer,
+		"pod disruption budgets": factory.Policy().V1().PodDisruptionBudgets().Informer,
+	} {
+		// HPAs read in an older version keep being listed
+		if rm.skipped(scope, what) || rm.apiVersion(what) != versionsOf(what)[0] {
+			continue
+		}
+		w.informers[what] = informer()
+		w.informers[what].AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: w.touch,
+			UpdateFunc: func(old, obj any) {
+				// Relists deliver unchanged objects again
+				if o, err := meta.Accessor(old); err == nil {
+					if n, err := meta.Accessor(obj); err == nil && o.GetResourceVersion() == n.GetResourceVersion() {
+						return
+					}
+				}
+				w.touch(obj)
+			},
+			DeleteFunc: w.touch,
+		})
+	}
+	if len(w.informers) == 0 {
+		return nil, fmt.Errorf("no resource type may be watched")
+	}
+
+	factory.Start(w.stop)
+	timeout := make(chan struct{})
+	timer := time.AfterFunc(watchSyncTimeout, func() { close(timeout) })
+	defer timer.Stop()
+	var pending []string
+	for what, informer := range w.informers {
+		if !cache.WaitForCacheSync(timeout, informer.HasSynced) {
+			pending = append(pending, what)
+		}
+	}
+	if len(pending) == len(w.informers) {
+		w.close()
+		return nil, fmt.Errorf("error starting watches: no initial list within %s", watchSyncTimeout)
+	}
+	if len(pending) > 0 {
+		sort.Strings(pending)
+		fmt.Printf("%s[watch] Still listing %s, read from the API server until their watches start%s\n", colorYellow, strings.Join(pending, ", "), colorReset)
+	}
+	// The initial lists are mapped by the first refresh
+	w.takeDirty()
+	select {
+	case <-w.changed:
+	default:
+	}
+	return w, nil
+}
+
+// touch marks the namespace of a changed object dirty
+func (w *graphWatcher) touch(obj any) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	o, err := meta.Accessor(obj)
+	if err != nil {
+		return
+	}
+	w.mu.Lock()
+	w.dirty[o.GetNamespace()] = true
+	w.mu.Unlock()
+	select {
+	case w.changed <- struct{}{}:
+	default:
+	}
+}
+
+// takeDirty returns the namespaces changed since the last call, in order
+func (w *graphWatcher) takeDirty() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	namespaces := sortedKeys(w.dirty)
+	w.dirty = map[string]bool{}
+	return namespaces
+}
+
+// close stops the watches
+func (w *graphWatcher) close() {
+	close(w.stop)
+	w.factory.Shutdown()
+}
+
+// synced reports whether a type is watched and its initial list complete
+func (w *graphWatcher) synced(what string) bool {
+	informer, ok := w.informers[what]
+	return ok && informer.HasSynced()
+}
+
+// fill fills the processor cache of a namespace with the watched objects,
+// sorted by name as lists return them, so that they are not listed. Types
+// are capped at the maximum of the mapper as lists are
+func (w *graphWatcher) fill(rm *ResourceMapper, c *processorCache) {
+	ns, all := c.namespace, labels.Everything()
+	if w.synced("services") {
+		c.services = capped(rm, ns, "services", fromStore(w.factory.Core().V1().Services().Lister().Services(ns).List(all)))
+	}
+	if w.synced("pods") {
+		c.pods = capped(rm, ns, "pods", fromStore(w.factory.Core().V1().Pods().Lister().Pods(ns).List(all)))
+		if rm.hideCompleted {
+			c.pods = withoutCompletedPods(c.pods)
+		}
+	}
+	if w.synced("configmaps") {
+		c.configMaps = capped(rm, ns, "configmaps", fromStore(w.factory.Core().V1().ConfigMaps().Lister().ConfigMaps(ns).List(all)))
+	}
+	if w.synced("secrets") {
+		c.secrets = capped(rm, ns, "secrets", fromStore(w.factory.Core().V1().Secrets().Lister().Secrets(ns).List(all)))
+		c.secretsListed, c.secretsAllowed = true, true
+	}
+	if w.synced("deployments") {
+		c.deployments = capped(rm, ns, "deployments", fromStore(w.factory.Apps().V1().Deployments().Lister().Deployments(ns).List(all)))
+	}
+	if w.synced("statefulsets") {
+		c.statefulSets = capped(rm, ns, "statefulsets", fromStore(w.factory.Apps().V1().StatefulSets().Lister().StatefulSets(ns).List(all)))
+	}
+	if w.synced("HPAs") {
+		c.hpas = capped(rm, ns, "HPAs", fromStore(w.factory.Autoscaling().V2().HorizontalPodAutoscalers().Lister().HorizontalPodAutoscalers(ns).List(all)))
+	}
+	if w.synced("ingresses") {
+		c.ingresses = capped(rm, ns, "ingresses", fromStore(w.factory.Networking().V1().Ingresses().Lister().Ingresses(ns).List(all)))
+	}
+	if w.synced("endpoint slices") {
+		c.endpointSlices = capped(rm, ns, "endpoint slices", fromStore(w.factory.Discovery().V1().EndpointSlices().Lister().EndpointSlices(ns).List(all)))
+	}
+	if w.synced("pod disruption budgets") {
+		c.pdbs = capped(rm, ns, "pod disruption budgets", fromStore(w.factory.Policy().V1().PodDisruptionBudgets().Lister().PodDisruptionBudgets(ns).List(all)))
+	}
+}
+
+// fromStore copies the objects of a lister, sorted by name. The objects are
+// shared with the watch cache, so the copies are shallow and, like every
+// cached object, must not be modified
+func fromStore[T any, P interface {
+	*T
+	GetName() string
+}](items []P, _ error) []T {
+	sort.Slice(items, func(i, j int) bool { return items[i].GetName() < items[j].GetName() })
+	objects := make([]T, 0, len(items))
+	for _, item := range items {
+		objects = append(objects, *item)
+	}
+	return objects
+}
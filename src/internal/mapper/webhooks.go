@@ -0,0 +1,241 @@
+package mapper
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// admissionWebhook holds the fields shared by mutating and validating webhooks
+type admissionWebhook struct {
+	Type              string
+	Configuration     string
+	Name              string
+	FailurePolicy     string
+	ClientConfig      admissionregistrationv1.WebhookClientConfig
+	Rules             []admissionregistrationv1.RuleWithOperations
+	NamespaceSelector *metav1.LabelSelector
+	ObjectSelector    *metav1.LabelSelector
+}
+
+// listAdmissionWebhooks lists all mutating and validating webhooks
+func (rm *ResourceMapper) listAdmissionWebhooks() ([]admissionWebhook, error) {
+	var webhooks []admissionWebhook
+
+	policy := func(p *admissionregistrationv1.FailurePolicyType) string {
+		if p == nil {
+			return string(admissionregistrationv1.Fail)
+		}
+		return string(*p)
+	}
+
+	mutating, err := rm.listMutatingWebhooks()
+	if err != nil {
+		return nil, err
+	}
+	for _, config := range mutating {
+		for _, wh := range config.Webhooks {
+			webhooks = append(webhooks, admissionWebhook{
+				Type:              "Mutating",
+				Configuration:     config.Name,
+				Name:              wh.Name,
+				FailurePolicy:     policy(wh.FailurePolicy),
+				ClientConfig:      wh.ClientConfig,
+				Rules:             wh.Rules,
+				NamespaceSelector: wh.NamespaceSelector,
+				ObjectSelector:    wh.ObjectSelector,
+			})
+		}
+	}
+
+	validating, err := rm.listValidatingWebhooks()
+	if err != nil {
+		return nil, err
+	}
+	for _, config := range validating {
+		for _, wh := range config.Webhooks {
+			webhooks = append(webhooks, admissionWebhook{
+				Type:              "Validating",
+				Configuration:     config.Name,
+				Name:              wh.Name,
+				FailurePolicy:     policy(wh.FailurePolicy),
+				ClientConfig:      wh.ClientConfig,
+				Rules:             wh.Rules,
+				NamespaceSelector: wh.NamespaceSelector,
+				ObjectSelector:    wh.ObjectSelector,
+			})
+		}
+	}
+
+	return webhooks, nil
+}
+
+// formatWebhookRules formats webhook rules as "CREATE,UPDATE apps/deployments"
+func formatWebhookRules(rules []admissionregistrationv1.RuleWithOperations) string {
+	formatted := []string{}
+	for _, rule := range rules {
+		ops := make([]string, 0, len(rule.Operations))
+		for _, op := range rule.Operations {
+			ops = append(ops, string(op))
+		}
+		resources := []string{}
+		for _, group := range rule.APIGroups {
+			for _, resource := range rule.Resources {
+				if group == "" {
+					resources = append(resources, resource)
+				} else {
+					resources = append(resources, group+"/"+resource)
+				}
+			}
+		}
+		formatted = append(formatted, strings.Join(ops, ",")+" "+strings.Join(resources, ","))
+	}
+	return strings.Join(formatted, "; ")
+}
+
+// interceptedNamespaces returns the namespaces matched by a webhook's namespace selector
+func interceptedNamespaces(selector *metav1.LabelSelector, namespaces map[string]map[string]string) ([]string, error) {
+	sel := labels.Everything()
+	if selector != nil {
+		var err error
+		sel, err = metav1.LabelSelectorAsSelector(selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespace selector: %v", err)
+		}
+	}
+	matched := []string{}
+	for _, ns := range sortedKeys(namespaces) {
+		if sel.Matches(labels.Set(namespaces[ns])) {
+			matched = append(matched, ns)
+		}
+	}
+	return matched, nil
+}
+
+// showWebhookBackend shows the service behind a webhook and the deployments serving it
+func (rm *ResourceMapper) showWebhookBackend(wh admissionWebhook, indent string) error {
+	if wh.ClientConfig.URL != nil {
+		fmt.Printf(sym("%s└── Backend: URL %s\n"), indent, *wh.ClientConfig.URL)
+		return nil
+	}
+	ref := wh.ClientConfig.Service
+	if ref == nil {
+		fmt.Printf(sym("%s└── Backend: none configured\n"), indent)
+		return nil
+	}
+
+	port := int32(443)
+	if ref.Port != nil {
+		port = *ref.Port
+	}
+	path := ""
+	if ref.Path != nil {
+		path = *ref.Path
+	}
+	fmt.Printf(sym("%s└── Backend: Service %s/%s:%d%s\n"), indent, ref.Namespace, ref.Name, port, path)
+
+	if rm.deniedGet(ref.Namespace, "services") {
+		fmt.Printf("%s    %sService not checked: not allowed to get services%s\n", indent, colorYellow, colorReset)
+		return nil
+	}
+	service, err := rm.clientset.CoreV1().Services(ref.Namespace).Get(rm.ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		impact := "intercepted requests skip this webhook"
+		if wh.FailurePolicy == string(admissionregistrationv1.Fail) {
+			impact = "intercepted requests are rejected"
+		}
+		fmt.Printf("%s    %sService not found: %s%s\n", indent, colorRed, impact, colorReset)
+		return nil
+	}
+	if len(service.Spec.Selector) == 0 {
+		return nil
+	}
+
+	deployments, err := rm.listDeployments(ref.Namespace)
+	if err != nil {
+		return err
+	}
+	selector := labels.SelectorFromSet(service.Spec.Selector)
+	found := false
+	for _, deploy := range deployments {
+		if !selector.Matches(labels.Set(deploy.Spec.Template.Labels)) {
+			continue
+		}
+		found = true
+		desired := int32(1)
+		if deploy.Spec.Replicas != nil {
+			desired = *deploy.Spec.Replicas
+		}
+		color := colorGreen
+		if deploy.Status.ReadyReplicas == 0 {
+			color = colorRed
+		}
+		fmt.Printf("%s    %s Deployment: %s %s(%d/%d ready)%s\n",
+			indent, rm.createArrow(4), deploy.Name, color, deploy.Status.ReadyReplicas, desired, colorReset)
+	}
+	if !found {
+		fmt.Printf("%s    %sNo deployment serves this webhook%s\n", indent, colorYellow, colorReset)
+	}
+	return nil
+}
+
+// showAdmissionWebhooks shows admission webhooks, the workloads backing them
+// and which of the given namespaces they intercept
+func (rm *ResourceMapper) showAdmissionWebhooks(namespaces []string) error {
+	fmt.Printf("\n%sAdmission webhooks:%s\n", colorBlue, colorReset)
+
+	webhooks, err := rm.listAdmissionWebhooks()
+	if err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		fmt.Println(sym("└── none"))
+		return nil
+	}
+	sort.SliceStable(webhooks, func(i, j int) bool {
+		return webhooks[i].Configuration < webhooks[j].Configuration
+	})
+
+	nsList, err := rm.listNamespaces()
+	if err != nil {
+		return err
+	}
+	selected := map[string]bool{}
+	for _, ns := range namespaces {
+		selected[ns] = true
+	}
+	nsLabels := map[string]map[string]string{}
+	for _, ns := range nsList {
+		if selected[ns.Name] {
+			nsLabels[ns.Name] = ns.Labels
+		}
+	}
+
+	for i, wh := range webhooks {
+		branch, indent := sym("├──"), sym("│   ")
+		if i == len(webhooks)-1 {
+			branch, indent = sym("└──"), "    "
+		}
+		fmt.Printf("%s %s[%s] %s / %s%s\n", branch, colorYellow, wh.Type, wh.Configuration, wh.Name, colorReset)
+		fmt.Printf(sym("%s├── Failure policy: %s\n"), indent, wh.FailurePolicy)
+		fmt.Printf(sym("%s├── Rules: %s\n"), indent, formatWebhookRules(wh.Rules))
+		if wh.ObjectSelector != nil && (len(wh.ObjectSelector.MatchLabels) > 0 || len(wh.ObjectSelector.MatchExpressions) > 0) {
+			fmt.Printf(sym("%s├── Object selector: %s\n"), indent, metav1.FormatLabelSelector(wh.ObjectSelector))
+		}
+		matched, err := interceptedNamespaces(wh.NamespaceSelector, nsLabels)
+		if err != nil {
+			fmt.Printf(sym("%s├── Intercepts namespaces: %s%v%s\n"), indent, colorRed, err, colorReset)
+		} else {
+			fmt.Printf(sym("%s├── Intercepts namespaces (%d/%d): %s\n"), indent, len(matched), len(nsLabels), strings.Join(matched, ", "))
+		}
+		if err := rm.showWebhookBackend(wh, indent); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
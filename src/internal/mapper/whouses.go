@@ -0,0 +1,186 @@
+package mapper
+
+import (
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// consumer is a resource using the resource looked up by who-uses
+type consumer struct {
+	owner  string
+	pods   []string
+	usages []string
+}
+
+// podOwnerName names the workload a pod belongs to from its owner reference
+// alone, without listing ReplicaSets: a ReplicaSet named after its
+// deployment plus the pod-template-hash belongs to that deployment
+func podOwnerName(pod *corev1.Pod) string {
+	owner := metav1.GetControllerOfNoCopy(pod)
+	if owner == nil || isMirrorPod(pod) {
+		return "Pod " + pod.Name
+	}
+	hash := pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]
+	if owner.Kind == "ReplicaSet" && hash != "" && strings.HasSuffix(owner.Name, "-"+hash) {
+		return "Deployment " + strings.TrimSuffix(owner.Name, "-"+hash)
+	}
+	return owner.Kind + " " + owner.Name
+}
+
+// addUsage records a usage by a consumer, keeping usages distinct
+func addUsage(consumers map[string]*consumer, owner, pod, usage string) {
+	c := consumers[owner]
+	if c == nil {
+		c = &consumer{owner: owner}
+		consumers[owner] = c
+	}
+	if pod != "" && (len(c.pods) == 0 || c.pods[len(c.pods)-1] != pod) {
+		c.pods = append(c.pods, pod)
+	}
+	for _, existing := range c.usages {
+		if existing == usage {
+			return
+		}
+	}
+	c.usages = append(c.usages, usage)
+}
+
+// podConsumers finds the pods referencing a ConfigMap or Secret, grouped by
+// their workload
+func podConsumers(pods []corev1.Pod, kind, name string, consumers map[string]*consumer) {
+	for i := range pods {
+		pod := &pods[i]
+		owner := podOwnerName(pod)
+		for _, ref := range podConfigReferences(pod) {
+			if ref.Kind == kind && ref.Name == name {
+				addUsage(consumers, owner, pod.Name, ref.describe())
+			}
+		}
+		if kind != "Secret" {
+			continue
+		}
+		for _, pull := range pod.Spec.ImagePullSecrets {
+			if pull.Name == name {
+				addUsage(consumers, owner, pod.Name, "Used as image pull secret")
+			}
+		}
+	}
+}
+
+// whoUses lists the consumers of a ConfigMap, Secret or Service, listing
+// only the kinds of objects able to reference it. It returns the consumers
+// and the number of API calls made
+func (rm *ResourceMapper) whoUses(namespace, kind, name string) (map[string]*consumer, int, error) {
+	consumers := map[string]*consumer{}
+	calls := 0
+	if kind == "ConfigMap" || kind == "Secret" {
+		pods, err := rm.listPods(namespace)
+		if err != nil {
+			return nil, calls, err
+		}
+		calls++
+		podConsumers(pods, kind, name, consumers)
+	}
+	if kind == "Service" || kind == "Secret" {
+		ingresses, err := rm.listIngresses(namespace)
+		if err != nil {
+			return nil, calls, err
+		}
+		calls++
+		for _, ing := range ingresses {
+			owner := "Ingress " + ing.Name
+			if kind == "Secret" {
+				for _, tls := range ing.Spec.TLS {
+					if tls.SecretName == name {
+						addUsage(consumers, owner, "", "TLS certificate for "+strings.Join(tls.Hosts, ", "))
+					}
+				}
+				continue
+			}
+			if backend := ing.Spec.DefaultBackend; backend != nil && backend.Service != nil && backend.Service.Name == name {
+				addUsage(consumers, owner, "", "Default backend")
+			}
+			for _, rule := range ing.Spec.Rules {
+				if rule.HTTP == nil {
+					continue
+				}
+				for _, path := range rule.HTTP.Paths {
+					if path.Backend.Service != nil && path.Backend.Service.Name == name {
+						addUsage(consumers, owner, "", "Routes "+rule.Host+path.Path)
+					}
+				}
+			}
+		}
+	}
+	return consumers, calls, nil
+}
+
+// normalizeUsedKind returns the kind who-uses looks up for a kind as typed
+// on the command line. The built-in aliases cover the kinds it looks up, so
+// no discovery call is spent on resolving them
+func normalizeUsedKind(kind string) (string, error) {
+	switch resolved := builtinKindAliases[strings.ToLower(kind)]; resolved {
+	case "ConfigMap", "Secret", "Service":
+		return resolved, nil
+	}
+	return "", fmt.Errorf("who-uses looks up a configmap, secret or service, not '%s'", kind)
+}
+
+// runWhoUses runs the who-uses subcommand: prints the consumers of a single
+// ConfigMap, Secret or Service
+func runWhoUses(args []string) error {
+	var global globalFlags
+	fs := newSubcommandFlagSet("who-uses", &global)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("who-uses expects a resource given as kind/name")
+	}
+	ref, name, err := parseResourceRef(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	kind, err := normalizeUsedKind(ref)
+	if err != nil {
+		return err
+	}
+	namespace := global.namespace
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+
+	rm, err := global.newResourceMapper()
+	if err != nil {
+		return err
+	}
+	consumers, calls, err := rm.whoUses(namespace, kind, name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%s%s %s in namespace %s is used by:%s\n", colorCyan, kind, name, namespace, colorReset)
+	if len(consumers) == 0 {
+		fmt.Printf(sym("└── %sNothing%s\n"), colorYellow, colorReset)
+	}
+	owners := sortedKeys(consumers)
+	for i, owner := range owners {
+		c := consumers[owner]
+		branch, indent := sym("├──"), sym("│  ")
+		if i == len(owners)-1 {
+			branch, indent = sym("└──"), "   "
+		}
+		fmt.Printf("%s %s\n", branch, owner)
+		if len(c.pods) > 0 && c.pods[0] != strings.TrimPrefix(owner, "Pod ") {
+			fmt.Printf("%s %s pods: %s\n", indent, rm.createArrow(4), strings.Join(c.pods, ", "))
+		}
+		for _, usage := range c.usages {
+			fmt.Printf("%s %s %s\n", indent, rm.createArrow(4), usage)
+		}
+	}
+	fmt.Printf("\n%s%d API call(s) made%s\n", colorGreen, calls, colorReset)
+	return nil
+}
@@ -0,0 +1,38 @@
+package resourcemap_test
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ai4design/k8s-resource-mapper/src/pkg/resourcemap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func ExampleMap() {
+	labels := map[string]string{"app": "web"}
+	clientset := fake.NewClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop"}},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop"},
+			Spec:       corev1.ServiceSpec{Selector: labels},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "shop", Labels: labels},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		},
+	)
+
+	g, err := resourcemap.Map(context.Background(), resourcemap.Options{Clientset: clientset})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, rel := range g.Relationships {
+		if rel.Type == resourcemap.RelSelects {
+			fmt.Println(rel.From, "selects", rel.To)
+		}
+	}
+	// Output: Service/shop/web selects Pod/shop/web-1
+}
@@ -0,0 +1,101 @@
+// Package resourcemap maps the resources of a Kubernetes cluster and the
+// relationships between them, such as an Ingress routing to a Service that
+// selects Pods mounting a ConfigMap, into a graph. It is the library of the
+// k8s-resource-mapper engine, for Go tools and operators embedding topology
+// discovery:
+//
+//	g, err := resourcemap.Map(ctx, resourcemap.Options{Namespaces: []string{"shop"}})
+//	if err != nil {
+//		return err
+//	}
+//	for _, rel := range g.Relationships {
+//		if rel.Type == resourcemap.RelRoutes {
+//			fmt.Println(rel.From, "routes to", rel.To)
+//		}
+//	}
+//
+// Errors are returned, never exited on; the types that could not be listed
+// are reported in Graph.Errors. Warnings, such as the types skipped by
+// access checks, are printed on stderr.
+package resourcemap
+
+import (
+	"context"
+
+	"github.com/ai4design/k8s-resource-mapper/src/internal/mapper"
+)
+
+// Options select the cluster, namespaces and objects a mapper maps. The zero
+// value maps every namespace of the current kubeconfig context
+type Options = mapper.Options
+
+// ResourceMapper maps the resources of one cluster, keeping its clients and
+// the capabilities discovered between calls. It is not safe for concurrent
+// use
+type ResourceMapper = mapper.ResourceMapper
+
+// Graph holds resources and the relationships between them
+type Graph = mapper.Graph
+
+// Resource is a node of the graph: a summary of an object
+type Resource = mapper.Resource
+
+// ResourceKey uniquely identifies a resource in the graph
+type ResourceKey = mapper.ResourceKey
+
+// ResourceStatus is the health of a resource as shown in the map
+type ResourceStatus = mapper.ResourceStatus
+
+// Relationship is a directed edge between two resources
+type Relationship = mapper.Relationship
+
+// MappingError is a part of a namespace that could not be mapped
+type MappingError = mapper.MappingError
+
+// Truncation is a resource type only partly mapped in a namespace, capped by
+// Options.MaxResourcesPerNamespace
+type Truncation = mapper.Truncation
+
+// Direction is the way Graph.Neighbors follows relationships
+type Direction = mapper.Direction
+
+// Directions of traversals: along relationships, against them, or both
+const (
+	DirectionOut  = mapper.DirectionOut
+	DirectionIn   = mapper.DirectionIn
+	DirectionBoth = mapper.DirectionBoth
+)
+
+// Relationship types, the values of Relationship.Type
+const (
+	RelRoutes      = mapper.RelRoutes      // Ingress -> Service
+	RelSelects     = mapper.RelSelects     // Service -> Pod
+	RelManages     = mapper.RelManages     // Deployment, StatefulSet -> Pod
+	RelScales      = mapper.RelScales      // HorizontalPodAutoscaler -> Deployment
+	RelUses        = mapper.RelUses        // Pod -> ConfigMap, Secret; Ingress -> Secret
+	RelTargets     = mapper.RelTargets     // Service -> External
+	RelGoverns     = mapper.RelGoverns     // headless Service -> StatefulSet
+	RelScrapes     = mapper.RelScrapes     // ServiceMonitor -> Service, PodMonitor -> Pod
+	RelAlerts      = mapper.RelAlerts      // PrometheusRule -> Deployment, StatefulSet
+	RelRunsOn      = mapper.RelRunsOn      // Pod -> Node
+	RelStartsAfter = mapper.RelStartsAfter // Deployment, StatefulSet, Pod -> Service
+	RelDependsOn   = mapper.RelDependsOn   // any -> any, from the resource-map.io/depends-on annotation
+)
+
+// New creates the mapper of the cluster selected by options, whose Map,
+// Graph and Namespaces methods map it
+func New(ctx context.Context, opts Options) (*ResourceMapper, error) {
+	return mapper.New(ctx, opts)
+}
+
+// Map maps the namespaces selected by options into one graph, where
+// cluster-scoped resources such as nodes connect the namespaces. The types
+// that could not be listed or were capped are reported in the graph. The
+// graph is returned by value, the zero Graph on error
+func Map(ctx context.Context, opts Options) (Graph, error) {
+	g, err := mapper.Map(ctx, opts)
+	if err != nil {
+		return Graph{}, err
+	}
+	return *g, nil
+}